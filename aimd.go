@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// aimd adapts the number of parallel downloads to the network the way TCP
+// does: one more slot for every limit's worth of quick successes, half as
+// many after a failure or a request that took far longer than the fastest
+// seen. The -r value is the ceiling.
+type aimd struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    float64
+	max      int
+	inflight int
+	// Fastest request so far, the yardstick for slow ones.
+	fastest time.Duration
+}
+
+// A request this many times slower than the fastest counts as congestion.
+const aimdSlowFactor = 4
+
+// newAIMD starts at start parallel downloads, such as where the last sync
+// settled, or at a cautious 4 if start is 0.
+func newAIMD(start, max int) *aimd {
+	if start <= 0 {
+		start = 4
+	}
+
+	a := &aimd{limit: float64(start), max: max}
+	if a.limit > float64(max) {
+		a.limit = float64(max)
+	}
+	a.cond = sync.NewCond(&a.mu)
+
+	return a
+}
+
+// acquire waits for a slot. A nil aimd never waits.
+func (a *aimd) acquire() {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for a.inflight >= int(a.limit) {
+		a.cond.Wait()
+	}
+	a.inflight++
+}
+
+// release frees a slot and adjusts the limit by how the request went.
+func (a *aimd) release(took time.Duration, err error) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.inflight--
+
+	if err == nil && (a.fastest == 0 || took < a.fastest) {
+		a.fastest = took
+	}
+
+	if err != nil || took > aimdSlowFactor*a.fastest {
+		a.limit /= 2
+		if a.limit < 1 {
+			a.limit = 1
+		}
+	} else {
+		a.limit += 1 / a.limit
+		if a.limit > float64(a.max) {
+			a.limit = float64(a.max)
+		}
+	}
+
+	a.cond.Broadcast()
+}
+
+func (a *aimd) current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return int(a.limit)
+}
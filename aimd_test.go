@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestAIMD(t *testing.T) {
+	a := newAIMD(0, 8)
+	if got := a.current(); got != 4 {
+		t.Fatalf("starts at %d, want 4", got)
+	}
+
+	for i := 0; i < 100; i++ {
+		a.acquire()
+		a.release(10*time.Millisecond, nil)
+	}
+	if got := a.current(); got != 8 {
+		t.Errorf("after quick successes at %d, want the ceiling of 8", got)
+	}
+
+	a.acquire()
+	a.release(10*time.Millisecond, errors.New("429 Too Many Requests"))
+	if got := a.current(); got != 4 {
+		t.Errorf("after a failure at %d, want 4", got)
+	}
+
+	a.acquire()
+	a.release(time.Second, nil)
+	if got := a.current(); got != 2 {
+		t.Errorf("after a slow request at %d, want 2", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		a.acquire()
+		a.release(0, errors.New("timeout"))
+	}
+	if got := a.current(); got != 1 {
+		t.Errorf("after many failures at %d, want 1", got)
+	}
+}
+
+func TestAIMDStartsBelowCeiling(t *testing.T) {
+	if got := newAIMD(0, 2).current(); got != 2 {
+		t.Errorf("with -r 2 starts at %d", got)
+	}
+}
+
+func TestSyncAdaptive(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(12))
+	dbPath := tempDB(t)
+
+	res, err := syncDB(dbPath, syncOptions{rateLimit: 6, adaptive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted != 12 || res.failed != 0 {
+		t.Errorf("got %+v", res)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+)
+
+// analyze runs the image analysis passes over stored comics and records
+// the results in the manifest.
+func analyze(args []string) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	force := fs.Bool("force", false, "Analyze comics again even if they already have results")
+	normalize := fs.Bool("normalize", false, "Also write display copies of images with paper borders trimmed and colour profiles removed; originals are kept")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+	a := startAudit(*dbPath, "analyze", args)
+
+	n, err := analyzeDB(*dbPath, *force)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	outcome := fmt.Sprintf("Analyzed %d comics", n)
+	if *normalize {
+		n, err = normalizeDB(*dbPath, nil)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		outcome += fmt.Sprintf(" and normalized %d images", n)
+	}
+	fmt.Println(outcome)
+	a.end(outcome)
+}
+
+func analyzeDB(dbPath string, force bool) (int, error) {
+	m, unlock, err := recoverManifest(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	_, err = m.index(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Every worker owns the entries it is given, so the map itself is only
+	// read concurrently.
+	work := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for num := range work {
+				path, err := comicImagePath(dbPath, num)
+				if err != nil {
+					continue
+				}
+
+				img, err := loadImage(path)
+				if err != nil {
+					log.Printf("Comic %d: %v\n", num, err)
+					continue
+				}
+
+				e := m.Comics[num]
+				e.Panels = findPanels(img)
+				e.Colors = findColors(img)
+
+				mu.Lock()
+				done++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for num, e := range m.Comics {
+		if e.Format == "" || (!force && e.Panels != nil && e.Colors != nil) {
+			continue
+		}
+		work <- num
+	}
+	close(work)
+	wg.Wait()
+
+	return done, m.save(dbPath)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// archiveEntry is a comic as listed on xkcd.com/archive/.
+type archiveEntry struct {
+	Num              int
+	Title            string
+	Year, Month, Day int
+}
+
+// Entries look like <a href="/1/" title="2006-1-1">Barrel - Part 1</a>.
+var archiveLink = regexp.MustCompile(`<a href="/(\d+)/" title="(\d+)-(\d+)-(\d+)">([^<]*)</a>`)
+
+// checkArchive compares the database with xkcd's archive page, a second
+// list of every comic that doesn't go through the JSON API.
+func checkArchive(args []string) {
+	fs := flag.NewFlagSet("check-archive", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+
+	if offline {
+		log.Fatalln("check-archive needs the network:", errOffline)
+	}
+
+	body, err := newCrawler(1, 0, "").get(xkcdURL + "archive/")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	entries := parseArchive(body)
+	if len(entries) == 0 {
+		log.Fatalln("Found no comics on the archive page; its layout may have changed")
+	}
+
+	problems, err := compareArchive(*dbPath, entries)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for _, p := range problems {
+		fmt.Println(paint(os.Stdout, bad, p.String()))
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+
+	fmt.Println(paint(os.Stdout, good, fmt.Sprintf("All %d comics on the archive page match", len(entries))))
+}
+
+// parseArchive reads the comics off the archive page, lowest number first.
+func parseArchive(page []byte) []archiveEntry {
+	var entries []archiveEntry
+
+	for _, m := range archiveLink.FindAllSubmatch(page, -1) {
+		var e archiveEntry
+		e.Num, _ = strconv.Atoi(string(m[1]))
+		e.Year, _ = strconv.Atoi(string(m[2]))
+		e.Month, _ = strconv.Atoi(string(m[3]))
+		e.Day, _ = strconv.Atoi(string(m[4]))
+		e.Title = html.UnescapeString(string(m[5]))
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Num < entries[j].Num })
+	return entries
+}
+
+// compareArchive lists where the database and the archive page disagree:
+// comics only one of them has, and stored comics whose metadata is
+// unreadable or has another title or date.
+func compareArchive(dbPath string, entries []archiveEntry) ([]fsckProblem, error) {
+	nums, err := storedComics(dbPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	stored := make(map[int]bool, len(nums))
+	for _, num := range nums {
+		stored[num] = true
+	}
+
+	var problems []fsckProblem
+	listed := make(map[int]bool, len(entries))
+	for _, e := range entries {
+		listed[e.Num] = true
+		if !stored[e.Num] {
+			problems = append(problems, fsckProblem{Num: e.Num, Problem: "on the archive page but not stored"})
+			continue
+		}
+
+		if p := compareEntry(dbPath, e); p != "" {
+			problems = append(problems, fsckProblem{Num: e.Num, Problem: p})
+		}
+	}
+
+	for _, num := range nums {
+		if !listed[num] {
+			problems = append(problems, fsckProblem{Num: num, Problem: "stored but not on the archive page"})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Num < problems[j].Num })
+	return problems, nil
+}
+
+func compareEntry(dbPath string, e archiveEntry) string {
+	c, err := readComic(dbPath, e.Num)
+	if err != nil {
+		return "metadata unreadable: " + err.Error()
+	}
+	if c.Num != e.Num {
+		return fmt.Sprintf("metadata is for comic %d", c.Num)
+	}
+
+	if c.Title != e.Title {
+		return fmt.Sprintf("title is %q, the archive says %q", c.Title, e.Title)
+	}
+
+	y, yerr := strconv.Atoi(c.Year)
+	m, merr := strconv.Atoi(c.Month)
+	d, derr := strconv.Atoi(c.Day)
+	if yerr != nil || merr != nil || derr != nil || y != e.Year || m != e.Month || d != e.Day {
+		return fmt.Sprintf("dated %q, the archive says %d-%02d-%02d", c.date(), e.Year, e.Month, e.Day)
+	}
+
+	return ""
+}
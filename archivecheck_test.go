@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestParseArchive(t *testing.T) {
+	page := []byte(`<div id="middleContainer" class="box">
+<a href="/2/" title="2006-1-1">Petit Trees (sketch)</a><br/>
+<a href="/1/" title="2006-1-1">Barrel - Part 1</a><br/>
+<a href="/3/" title="2006-1-1">Island &amp; Sketch</a><br/>
+</div>`)
+
+	entries := parseArchive(page)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if entries[0] != (archiveEntry{1, "Barrel - Part 1", 2006, 1, 1}) {
+		t.Errorf("got %+v", entries[0])
+	}
+	if entries[2].Title != "Island & Sketch" {
+		t.Errorf("title not unescaped: %q", entries[2].Title)
+	}
+}
+
+func TestCompareArchive(t *testing.T) {
+	comics := fakexkcd.Corpus(5)
+	srv := startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upstream renames 3 and publishes 6; locally 2 is lost and 5 is
+	// missing from the archive.
+	renamed := comics[2]
+	renamed.Title = "Renamed"
+	srv.Add(renamed)
+	srv.Add(fakexkcd.Corpus(6)[5])
+	err = os.RemoveAll(db + "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := newCrawler(1, 0, "").get(xkcdURL + "archive/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := parseArchive(body)
+	entries = entries[:len(entries)-2]
+	entries = append(entries, archiveEntry{Num: 6, Title: "Comic 6"})
+
+	problems, err := compareArchive(db, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`#2: on the archive page but not stored`,
+		`#3: title is "Comic 3", the archive says "Renamed"`,
+		`#5: stored but not on the archive page`,
+		`#6: on the archive page but not stored`,
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("got %v, want %v", problems, want)
+	}
+	for i, p := range problems {
+		if p.String() != want[i] {
+			t.Errorf("got %q, want %q", p, want[i])
+		}
+	}
+}
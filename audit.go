@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// auditFile records every command that changed the database. It is only
+// ever appended to.
+const auditFile = "audit.log"
+
+// auditRecord is one line of the audit log. A run starts with a start
+// record, may log messages, and ends with an end record unless it failed.
+type auditRecord struct {
+	Run   string    `json:"run"`
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	// Set on start records.
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// What was logged, or on end records the outcome.
+	Message string `json:"message,omitempty"`
+}
+
+// audit is the record of one run.
+type audit struct {
+	path string
+	run  string
+}
+
+// startAudit records that command is about to change the database at
+// dbPath. Anything logged from then on goes into the audit log too, so a
+// run that dies with log.Fatal leaves its reason behind.
+func startAudit(dbPath, command string, args []string) *audit {
+	a := &audit{
+		path: dbPath + auditFile,
+		run:  strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.Itoa(os.Getpid()),
+	}
+	a.write(auditRecord{Event: "start", Command: command, Args: args})
+	log.SetOutput(io.MultiWriter(os.Stderr, a))
+
+	return a
+}
+
+// redactArgs returns args with the values of the named flags hidden, so
+// secrets given on the command line stay out of the audit log.
+func redactArgs(args []string, secret ...string) []string {
+	out := make([]string, len(args))
+	copy(out, args)
+
+	for i := 0; i < len(out); i++ {
+		if out[i] == "--" {
+			break
+		}
+		name := strings.TrimLeft(out[i], "-")
+		if name == out[i] {
+			continue
+		}
+		dashes := out[i][:len(out[i])-len(name)]
+		for _, s := range secret {
+			switch {
+			case strings.HasPrefix(name, s+"="):
+				out[i] = dashes + s + "=" + redacted
+			case name == s && i+1 < len(out):
+				i++
+				out[i] = redacted
+			}
+		}
+	}
+
+	return out
+}
+
+// What redactArgs puts in place of a secret.
+const redacted = "(redacted)"
+
+// Write records a log message, without the date log puts in front; the
+// record has its own.
+func (a *audit) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	if len(msg) > len(logDate) {
+		if _, err := time.Parse(logDate, msg[:len(logDate)]); err == nil {
+			msg = strings.TrimSpace(msg[len(logDate):])
+		}
+	}
+
+	a.write(auditRecord{Event: "log", Message: msg})
+	return len(p), nil
+}
+
+// How the standard logger dates messages.
+const logDate = "2006/01/02 15:04:05"
+
+// end records that the run finished, and how.
+func (a *audit) end(outcome string) {
+	a.write(auditRecord{Event: "end", Message: outcome})
+}
+
+// write appends a record. The database may not exist yet, or may be
+// read-only; the command goes on either way.
+func (a *audit) write(r auditRecord) {
+	r.Run, r.Time = a.run, time.Now()
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	f.Write(append(data, '\n'))
+	f.Close()
+}
+
+// auditRun is a run as the log command shows it.
+type auditRun struct {
+	Start   time.Time
+	Command string
+	Args    []string
+	// Empty while unfinished.
+	Outcome string
+	// The last thing logged.
+	LastLog string
+}
+
+func (r auditRun) String() string {
+	s := fmt.Sprintf("%s  %s", r.Start.Local().Format("2006-01-02 15:04:05"), strings.Join(append([]string{r.Command}, r.Args...), " "))
+
+	switch {
+	case r.Outcome != "":
+		s += "\n    " + r.Outcome
+	case r.LastLog != "":
+		s += "\n    failed: " + r.LastLog
+	default:
+		s += "\n    did not finish"
+	}
+
+	return s
+}
+
+// readAudit returns the runs in the audit log, oldest first.
+func readAudit(dbPath string) ([]auditRun, error) {
+	f, err := os.Open(dbPath + auditFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var runs []auditRun
+	index := make(map[string]int)
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r auditRecord
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue
+		}
+
+		if r.Event == "start" {
+			index[r.Run] = len(runs)
+			runs = append(runs, auditRun{Start: r.Time, Command: r.Command, Args: r.Args})
+			continue
+		}
+
+		i, ok := index[r.Run]
+		if !ok {
+			continue
+		}
+		switch r.Event {
+		case "log":
+			runs[i].LastLog = r.Message
+		case "end":
+			runs[i].Outcome = r.Message
+		}
+	}
+
+	return runs, sc.Err()
+}
+
+// auditLog prints the latest runs from the audit log.
+func auditLog(args []string) {
+	fs := flag.NewFlagSet("log", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	n := fs.Int("n", 20, "Number of runs to show; 0 shows all")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	runs, err := readAudit(withSlash(*dbPath))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *n > 0 && len(runs) > *n {
+		runs = runs[len(runs)-*n:]
+	}
+	for _, r := range runs {
+		t := good
+		if r.Outcome == "" {
+			t = bad
+		}
+		fmt.Println(paint(os.Stdout, t, r.String()))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	db := withSlash(t.TempDir())
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	a := startAudit(db, "sync", []string{"-r", "5"})
+	log.Println("comic 3: 503 Service Unavailable")
+	a.end("Downloaded 4 missing comics, 1 failed")
+
+	startAudit(db, "import-archive", []string{"dump"})
+	log.Println("found no comics in dump")
+
+	startAudit(db, "cleanup", []string{"-delete"})
+
+	runs, err := readAudit(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("got %d runs, want 3", len(runs))
+	}
+
+	for i, want := range []string{
+		"sync -r 5\n    Downloaded 4 missing comics, 1 failed",
+		"import-archive dump\n    failed: found no comics in dump",
+		"cleanup -delete\n    did not finish",
+	} {
+		if got := runs[i].String(); !strings.HasSuffix(got, want) {
+			t.Errorf("run %d: %q, want it to end with %q", i, got, want)
+		}
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"open", "-password", "hunter2", "--password=hunter2", "-d", "db", "-password-file", "x", "bundle", "--", "-password", "y"}
+	got := strings.Join(redactArgs(args, "password"), " ")
+	want := "open -password (redacted) --password=(redacted) -d db -password-file x bundle -- -password y"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if args[2] != "hunter2" {
+		t.Error("redactArgs changed its argument")
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An authenticator puts the web UI and API behind a login.
+type authenticator interface {
+	wrap(h http.Handler) http.Handler
+}
+
+// How long a login lasts, and how long the identity provider has to send
+// the browser back.
+const (
+	sessionLength = 12 * time.Hour
+	loginLength   = 10 * time.Minute
+)
+
+// Cookies a login leaves in the browser.
+const (
+	sessionCookie = "xkcddb_session"
+	loginCookie   = "xkcddb_login"
+)
+
+type userKey struct{}
+
+// requestUser is who is logged in, or empty without authentication.
+func requestUser(r *http.Request) string {
+	user, _ := r.Context().Value(userKey{}).(string)
+	return user
+}
+
+type oidcOptions struct {
+	issuer   string
+	clientID string
+	// The mirror's public URL, which the provider sends browsers back to.
+	publicURL string
+	// Emails or subjects let in; empty lets in anyone the provider knows.
+	allow string
+}
+
+func oidcFlags(fs *flag.FlagSet) *oidcOptions {
+	o := &oidcOptions{}
+	fs.StringVar(&o.issuer, "oidc-issuer", "", "Require an OpenID Connect login from this issuer, e.g. https://accounts.google.com")
+	fs.StringVar(&o.clientID, "oidc-client-id", "", "Client ID registered with the issuer. The secret is read from XKCDDB_OIDC_CLIENT_SECRET")
+	fs.StringVar(&o.publicURL, "oidc-url", "", "Public URL of the mirror; register <url>/auth/callback with the issuer")
+	fs.StringVar(&o.allow, "oidc-allow", "", "Comma separated emails or subjects to let in; default anyone the issuer logs in")
+
+	return o
+}
+
+// authenticator returns nil if no login is configured.
+func (o *oidcOptions) authenticator() (authenticator, error) {
+	if o.issuer == "" {
+		return nil, nil
+	}
+	if o.clientID == "" || o.publicURL == "" {
+		return nil, errors.New("-oidc-issuer needs -oidc-client-id and -oidc-url")
+	}
+
+	return newOIDC(o.issuer, o.clientID, os.Getenv("XKCDDB_OIDC_CLIENT_SECRET"), o.publicURL, o.allow)
+}
+
+// oidcAuth logs users in with the authorization code flow and keeps them
+// logged in with a signed cookie. ID tokens must be signed with RS256,
+// which every provider supports.
+type oidcAuth struct {
+	issuer, clientID, secret string
+	callback                 string
+	allow                    map[string]bool
+
+	authURL, tokenURL, jwksURL string
+
+	// Signs session cookies; logins end when the server restarts.
+	key []byte
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+func newOIDC(issuer, clientID, secret, publicURL, allow string) (*oidcAuth, error) {
+	a := &oidcAuth{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		clientID: clientID,
+		secret:   secret,
+		callback: strings.TrimSuffix(publicURL, "/") + "/auth/callback",
+		key:      make([]byte, 32),
+	}
+
+	if allow != "" {
+		a.allow = make(map[string]bool)
+		for _, s := range strings.Split(allow, ",") {
+			a.allow[strings.TrimSpace(s)] = true
+		}
+	}
+
+	_, err := rand.Read(a.key)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery struct {
+		Issuer   string `json:"issuer"`
+		AuthURL  string `json:"authorization_endpoint"`
+		TokenURL string `json:"token_endpoint"`
+		JWKSURL  string `json:"jwks_uri"`
+	}
+	err = getJSON(a.issuer+"/.well-known/openid-configuration", &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	if discovery.Issuer != a.issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer is %q, not %q", discovery.Issuer, a.issuer)
+	}
+	a.authURL, a.tokenURL, a.jwksURL = discovery.AuthURL, discovery.TokenURL, discovery.JWKSURL
+
+	return a, a.loadKeys()
+}
+
+func getJSON(rawURL string, v interface{}) error {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", rawURL, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// loadKeys fetches the provider's signing keys.
+func (a *oidcAuth) loadKeys() error {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err := getJSON(a.jwksURL, &jwks)
+	if err != nil {
+		return fmt.Errorf("oidc keys: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, nerr := base64.RawURLEncoding.DecodeString(k.N)
+		e, eerr := base64.RawURLEncoding.DecodeString(k.E)
+		if nerr != nil || eerr != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.mu.Unlock()
+
+	return nil
+}
+
+func (a *oidcAuth) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/callback":
+			a.handleCallback(w, r)
+			return
+		case "/auth/logout":
+			http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		if user, ok := a.session(r); ok {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+			return
+		}
+
+		// Programs can't follow a login.
+		if strings.HasPrefix(r.URL.Path, "/api/") || r.Method != http.MethodGet {
+			http.Error(w, "Login required", http.StatusUnauthorized)
+			return
+		}
+		a.startLogin(w, r)
+	})
+}
+
+// startLogin sends the browser to the provider, remembering where it was
+// going.
+func (a *oidcAuth) startLogin(w http.ResponseWriter, r *http.Request) {
+	state, nonce := randomToken(), randomToken()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    a.sign(state + "|" + nonce + "|" + r.URL.RequestURI()),
+		Path:     "/auth/",
+		MaxAge:   int(loginLength / time.Second),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.callback, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {a.clientID},
+		"redirect_uri":  {a.callback},
+		"scope":         {"openid email profile"},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	http.Redirect(w, r, a.authURL+"?"+q.Encode(), http.StatusFound)
+}
+
+func (a *oidcAuth) handleCallback(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(loginCookie)
+	var login string
+	if err == nil {
+		login, err = a.verify(c.Value)
+	}
+	parts := strings.SplitN(login, "|", 3)
+	if err != nil || len(parts) != 3 || r.URL.Query().Get("state") != parts[0] {
+		http.Error(w, "Login expired; try again", http.StatusBadRequest)
+		return
+	}
+	nonce, next := parts[1], parts[2]
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		http.Error(w, "Login failed: "+e, http.StatusForbidden)
+		return
+	}
+
+	claims, err := a.exchange(r.URL.Query().Get("code"), nonce)
+	if err != nil {
+		http.Error(w, "Login failed: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	user := claims.Email
+	if user == "" {
+		user = claims.Subject
+	}
+	if a.allow != nil && !a.allow[claims.Email] && !a.allow[claims.Subject] {
+		http.Error(w, user+" may not use this mirror", http.StatusForbidden)
+		return
+	}
+
+	expires := time.Now().Add(sessionLength)
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Value: "", Path: "/auth/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    a.sign(strconv.FormatInt(expires.Unix(), 10) + "|" + user),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.callback, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		next = "/"
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// session returns who a valid session cookie belongs to.
+func (a *oidcAuth) session(r *http.Request) (string, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+
+	s, err := a.verify(c.Value)
+	if err != nil {
+		return "", false
+	}
+
+	parts := strings.SplitN(s, "|", 2)
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || len(parts) != 2 || time.Now().Unix() > expires {
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+type idClaims struct {
+	Issuer   string          `json:"iss"`
+	Subject  string          `json:"sub"`
+	Audience json.RawMessage `json:"aud"`
+	Expires  int64           `json:"exp"`
+	Nonce    string          `json:"nonce"`
+	Email    string          `json:"email"`
+}
+
+// exchange trades an authorization code for the user's verified claims.
+func (a *oidcAuth) exchange(code, nonce string) (*idClaims, error) {
+	resp, err := client.PostForm(a.tokenURL, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {a.callback},
+		"client_id":     {a.clientID},
+		"client_secret": {a.secret},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("token endpoint answered " + resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := a.verifyIDToken(token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token is for another login")
+	}
+
+	return claims, nil
+}
+
+// verifyIDToken checks an ID token's signature, issuer, audience and
+// expiry.
+func (a *oidcAuth) verifyIDToken(token string) (*idClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, errors.New("ID token is signed with " + header.Alg + "; only RS256 is supported")
+	}
+
+	a.mu.Lock()
+	key, ok := a.keys[header.Kid]
+	a.mu.Unlock()
+	if !ok {
+		// The provider may have rotated its keys.
+		err = a.loadKeys()
+		if err != nil {
+			return nil, err
+		}
+		a.mu.Lock()
+		key, ok = a.keys[header.Kid]
+		a.mu.Unlock()
+		if !ok {
+			return nil, errors.New("ID token is signed with an unknown key")
+		}
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+	if err != nil {
+		return nil, errors.New("ID token signature is invalid")
+	}
+
+	var claims idClaims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case claims.Issuer != a.issuer:
+		return nil, errors.New("ID token is from another issuer")
+	case !audienceHas(claims.Audience, a.clientID):
+		return nil, errors.New("ID token is for another client")
+	case time.Now().Unix() > claims.Expires:
+		return nil, errors.New("ID token has expired")
+	}
+
+	return &claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// audienceHas reads aud, which is a string or a list of them.
+func audienceHas(aud json.RawMessage, clientID string) bool {
+	var one string
+	if json.Unmarshal(aud, &one) == nil {
+		return one == clientID
+	}
+
+	var many []string
+	json.Unmarshal(aud, &many)
+	for _, s := range many {
+		if s == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sign appends an HMAC to s so the browser can't change it.
+func (a *oidcAuth) sign(s string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(s))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(s)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *oidcAuth) verify(signed string) (string, error) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", errors.New("unsigned cookie")
+	}
+
+	s, err := base64.RawURLEncoding.DecodeString(signed[:i])
+	if err != nil {
+		return "", err
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signed[i+1:])
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write(s)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return "", errors.New("bad cookie signature")
+	}
+
+	return string(s), nil
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
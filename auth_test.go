@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// fakeProvider is an OpenID Connect provider that logs everyone in as
+// email without asking.
+type fakeProvider struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	email string
+	aud   string
+	nonce string
+}
+
+func newFakeProvider(t *testing.T, email, aud string) *fakeProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key, email: email, aud: aud}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		p.nonce = q.Get("nonce")
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code=abc&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "abc" {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.token(t, p.aud)})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func (p *fakeProvider) token(t *testing.T, aud string) string {
+	seg := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := seg(map[string]string{"alg": "RS256", "kid": "k1"}) + "." + seg(map[string]interface{}{
+		"iss":   p.URL,
+		"sub":   "123",
+		"aud":   aud,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": p.nonce,
+		"email": p.email,
+	})
+
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ts, db := testServer(t, fakexkcd.Corpus(2))
+	ts.Close()
+	p := newFakeProvider(t, "ana@example.com", "mirror")
+
+	var handler http.Handler
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	defer mirror.Close()
+
+	auth, err := newOIDC(p.URL, "mirror", "secret", mirror.URL, "ana@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen string
+	handler = auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestUser(r)
+		(&server{dbPath: db}).routes().ServeHTTP(w, r)
+	}))
+
+	if status, _ := get(t, mirror.URL+"/api/comic/1"); status != http.StatusUnauthorized {
+		t.Errorf("API without login answered %d", status)
+	}
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	resp, err := browser.Get(mirror.URL + "/comic/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/comic/2" {
+		t.Fatalf("login ended at %s with %d", resp.Request.URL, resp.StatusCode)
+	}
+	if seen != "ana@example.com" {
+		t.Errorf("handler saw user %q", seen)
+	}
+
+	// The session now covers the API too.
+	resp, err = browser.Get(mirror.URL + "/api/comic/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("API with a session answered %d", resp.StatusCode)
+	}
+
+	// Someone not on the list gets no session.
+	p.email = "eve@example.com"
+	jar, _ = cookiejar.New(nil)
+	resp, err = (&http.Client{Jar: jar}).Get(mirror.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unlisted user got %d", resp.StatusCode)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	p := newFakeProvider(t, "ana@example.com", "mirror")
+	auth, err := newOIDC(p.URL, "mirror", "", "http://mirror", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.verifyIDToken(p.token(t, "mirror")); err != nil {
+		t.Error(err)
+	}
+	if _, err := auth.verifyIDToken(p.token(t, "other")); err == nil {
+		t.Error("accepted a token for another client")
+	}
+
+	tok := p.token(t, "mirror")
+	parts := strings.Split(tok, ".")
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"`+p.URL+`","aud":"mirror","exp":9999999999,"email":"eve@example.com"}`)) + "." + parts[2]
+	if _, err := auth.verifyIDToken(forged); err == nil {
+		t.Error("accepted a forged token")
+	}
+}
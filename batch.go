@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// batchCommands run one line of a batch each, given the words after the
+// command name.
+var batchCommands = map[string]func(dbPath string, args []string) (interface{}, error){
+	"get":    batchGet,
+	"list":   batchList,
+	"search": batchSearch,
+	"tag": func(dbPath string, args []string) (interface{}, error) {
+		return batchTag(dbPath, args, false)
+	},
+	"untag": func(dbPath string, args []string) (interface{}, error) {
+		return batchTag(dbPath, args, true)
+	},
+}
+
+// batchResult is written as one JSON line for each command read.
+type batchResult struct {
+	Line    int         `json:"line"`
+	Command string      `json:"command"`
+	Result  interface{} `json:"result,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// batch runs commands read a line at a time from a file, a named pipe or
+// stdin, so scripts can do many lookups in one process.
+func batch(args []string) {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db batch [flags] file|-")
+		fmt.Fprintln(fs.Output(), "Commands, one per line: get num, search query, list [list flags], tag|untag comic... tag")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	in := os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	err := runBatch(withSlash(*dbPath), in, os.Stdout)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// runBatch answers each command in r on w as soon as it is read. A failed
+// command is reported in its result and doesn't stop the batch. Blank
+// lines and lines starting with # are skipped.
+func runBatch(dbPath string, r io.Reader, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		words := strings.Fields(sc.Text())
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+
+		res := batchResult{Line: line, Command: words[0]}
+		var err error
+		if run, ok := batchCommands[words[0]]; ok {
+			res.Result, err = run(dbPath, words[1:])
+		} else {
+			err = errors.New("unknown command " + words[0])
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+
+		err = enc.Encode(res)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+func batchGet(dbPath string, args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: get num")
+	}
+
+	num, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, errors.New("not a comic number: " + args[0])
+	}
+
+	c, err := ensureComic(dbPath, num)
+	if err != nil {
+		return nil, err
+	}
+
+	return batchItem(c), nil
+}
+
+func batchSearch(dbPath string, args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("usage: search query")
+	}
+
+	matches, err := searchComics(dbPath, strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	items := []batchComic{}
+	for _, c := range matches {
+		items = append(items, batchItem(c))
+	}
+
+	return items, nil
+}
+
+// batchTag adds a tag to stored comics, or with untag removes it.
+func batchTag(dbPath string, args []string, untag bool) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, errors.New("usage: tag|untag comic... tag")
+	}
+	tag := args[len(args)-1]
+	err := validTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	nums, err := parseComics(args[:len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	for _, num := range nums {
+		if _, err := os.Stat(dbPath + strconv.Itoa(num)); err != nil {
+			return nil, fmt.Errorf("comic %d isn't stored", num)
+		}
+	}
+
+	command := "tag"
+	if untag {
+		command = "untag"
+	}
+	a := startAudit(dbPath, "batch", append([]string{command}, args...))
+	// What later lines log isn't part of this run.
+	defer log.SetOutput(os.Stderr)
+	outcome, err := tagComics(dbPath, nums, tag, untag)
+	if err != nil {
+		return nil, err
+	}
+	a.end(outcome)
+
+	return outcome, nil
+}
+
+func batchList(dbPath string, args []string) (interface{}, error) {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	f := listFlags(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return listComics(dbPath, *f)
+}
+
+// batchComic is a comic as get and search return it.
+type batchComic struct {
+	Comic
+	Image string `json:"image,omitempty"`
+}
+
+func batchItem(c localComic) batchComic {
+	return batchComic{Comic: c.Comic, Image: c.ImgPath}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestRunBatch(t *testing.T) {
+	comics := fakexkcd.Corpus(4)
+	comics[2].Alt = "Standards proliferate"
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := strings.Join([]string{
+		"get 2",
+		"",
+		"# comment",
+		"search standards",
+		"list -year " + comics[3].Year,
+		"tag 927 fav",
+		"get x",
+		"tag 1-2 fav",
+		"untag 2 fav",
+	}, "\n")
+
+	var out bytes.Buffer
+	err = runBatch(db, strings.NewReader(in), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type rawResult struct {
+		Line    int
+		Command string
+		Result  json.RawMessage
+		Error   string
+	}
+	var results []rawResult
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r rawResult
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, r)
+	}
+
+	if len(results) != 7 {
+		t.Fatalf("got %d results, want 7", len(results))
+	}
+
+	var got batchComic
+	json.Unmarshal(results[0].Result, &got)
+	if results[0].Line != 1 || got.Num != 2 || got.Alt != comics[1].Alt || got.Image == "" {
+		t.Errorf("get: %+v", results[0])
+	}
+
+	var found []batchComic
+	json.Unmarshal(results[1].Result, &found)
+	if results[1].Line != 4 || len(found) != 1 || found[0].Num != 3 {
+		t.Errorf("search: %+v", results[1])
+	}
+
+	var listed []listComic
+	json.Unmarshal(results[2].Result, &listed)
+	if len(listed) != 1 || listed[0].Num != 4 {
+		t.Errorf("list: %s", results[2].Result)
+	}
+
+	if results[3].Error == "" || results[4].Error == "" {
+		t.Errorf("bad commands didn't fail: %+v %+v", results[3], results[4])
+	}
+
+	if string(results[5].Result) != `"tagged 2 comics fav"` || string(results[6].Result) != `"untagged 1 comics fav"` {
+		t.Errorf("tag: %s, untag: %s", results[5].Result, results[6].Result)
+	}
+	tags, err := loadTags(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasTag(tags[1], "fav") || hasTag(tags[2], "fav") {
+		t.Errorf("tags %v", tags)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// budget ends a sync after a number of downloaded bytes or an amount of
+// time, for metered connections and cron windows. Downloads already under
+// way finish, so nothing is left half written, and whatever wasn't started
+// is still missing on the next run. Zero limits are unlimited.
+type budget struct {
+	maxBytes int64
+	deadline time.Time
+
+	// Updated atomically.
+	used int64
+}
+
+func newBudget(maxBytes int64, maxDuration time.Duration) *budget {
+	b := &budget{maxBytes: maxBytes}
+	if maxDuration > 0 {
+		b.deadline = time.Now().Add(maxDuration)
+	}
+
+	return b
+}
+
+func (b *budget) exhausted() bool {
+	if b.maxBytes > 0 && atomic.LoadInt64(&b.used) >= b.maxBytes {
+		return true
+	}
+
+	return !b.deadline.IsZero() && !time.Now().Before(b.deadline)
+}
+
+// track counts everything read through the shared client until the
+// returned function is called.
+func (b *budget) track() func() {
+	return tracked.track(func(next http.RoundTripper) http.RoundTripper {
+		return &countingTransport{next: next, b: b}
+	})
+}
+
+type countingTransport struct {
+	next http.RoundTripper
+	b    *budget
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		resp.Body = &countingBody{ReadCloser: resp.Body, b: t.b}
+	}
+
+	return resp, err
+}
+
+type countingBody struct {
+	io.ReadCloser
+	b *budget
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.b.used, int64(n))
+
+	return n, err
+}
+
+// byteSize is a flag taking sizes like 500MB or 2GiB.
+type byteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   float64
+}{
+	// Longest suffixes first so "MiB" isn't read as "B".
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+	{"B", 1},
+}
+
+func parseByteSize(s string) (int64, error) {
+	num, mult := strings.TrimSpace(s), 1.0
+	for _, u := range byteUnits {
+		if strings.HasSuffix(strings.ToUpper(num), strings.ToUpper(u.suffix)) {
+			num, mult = strings.TrimSpace(num[:len(num)-len(u.suffix)]), u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid size: " + s)
+	}
+
+	return int64(n * mult), nil
+}
+
+func (b *byteSize) String() string { return strconv.FormatInt(int64(*b), 10) }
+
+func (b *byteSize) Set(s string) error {
+	n, err := parseByteSize(s)
+	*b = byteSize(n)
+
+	return err
+}
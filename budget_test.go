@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestSyncStopsAtByteBudget(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(10))
+	db := tempDB(t)
+
+	// Enough for a couple of comics, not all of them.
+	res, err := syncDB(db, syncOptions{rateLimit: 1, maxBytes: 600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted == 0 || res.attempted >= 10 {
+		t.Fatalf("synced %d comics within the budget", res.attempted)
+	}
+
+	// The next run picks up the rest.
+	rest, err := syncDB(db, syncOptions{rateLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted+rest.attempted != 10 {
+		t.Errorf("synced %d then %d comics, want 10 in total", res.attempted, rest.attempted)
+	}
+}
+
+func TestSyncStopsAtDeadline(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+
+	res, err := syncDB(tempDB(t), syncOptions{rateLimit: 1, maxDuration: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted != 0 {
+		t.Errorf("synced %d comics past the deadline", res.attempted)
+	}
+}
+
+func TestBudgetsTrackConcurrently(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(1))
+
+	// Two syncs' budgets come and go while requests run; run with -race.
+	a, b := newBudget(0, 0), newBudget(0, 0)
+	var wg sync.WaitGroup
+	for _, bud := range []*budget{a, b} {
+		wg.Add(1)
+		go func(bud *budget) {
+			defer wg.Done()
+			done := bud.track()
+			defer done()
+			for i := 0; i < 5; i++ {
+				if _, err := (xkcdSource{}).latest(); err != nil {
+					t.Error(err)
+				}
+			}
+		}(bud)
+	}
+	wg.Wait()
+
+	if a.used == 0 || b.used == 0 {
+		t.Errorf("budgets counted %d and %d bytes", a.used, b.used)
+	}
+	if len(tracked.trackers) != 0 {
+		t.Errorf("%d trackers left behind", len(tracked.trackers))
+	}
+	if client.Transport != tracked {
+		t.Error("the client's transport was replaced")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	sizes := map[string]int64{
+		"1024":  1024,
+		"500MB": 500e6,
+		"1.5gb": 1.5e9,
+		"2MiB":  2 << 20,
+		"300 K": 300e3,
+		"7B":    7,
+	}
+	for s, want := range sizes {
+		got, err := parseByteSize(s)
+		if err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"", "MB", "-5MB", "lots"} {
+		if _, err := parseByteSize(s); err == nil {
+			t.Errorf("parseByteSize(%q) succeeded", s)
+		}
+	}
+}
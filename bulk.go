@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// bulkAction is something search -apply does to every match: tag=name,
+// untag=name, export=dir, refetch or exclude[=reason].
+type bulkAction struct {
+	name string
+	arg  string
+}
+
+// bulkActions collects -apply flags.
+type bulkActions []bulkAction
+
+func (b *bulkActions) String() string { return "" }
+
+func (b *bulkActions) Set(s string) error {
+	name, arg := s, ""
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		name, arg = s[:i], s[i+1:]
+	}
+
+	switch name {
+	case "tag", "untag":
+		err := validTag(arg)
+		if err != nil {
+			return err
+		}
+	case "export":
+		if arg == "" {
+			return errors.New("want export=dir")
+		}
+	case "refetch":
+		if arg != "" {
+			return errors.New("refetch takes no value")
+		}
+	case "exclude":
+	default:
+		return fmt.Errorf("unknown action %q; want tag=name, untag=name, export=dir, refetch or exclude[=reason]", name)
+	}
+	*b = append(*b, bulkAction{name, arg})
+
+	return nil
+}
+
+// applyActions does the actions to comics in the order given, returning
+// what was done. Excluding asks first, as it moves comics to the trash.
+func applyActions(dbPath string, actions bulkActions, comics []localComic) (string, error) {
+	nums := make([]int, len(comics))
+	for i, c := range comics {
+		nums[i] = c.Num
+	}
+
+	var done []string
+	for _, act := range actions {
+		var outcome string
+		var err error
+		switch act.name {
+		case "tag", "untag":
+			outcome, err = tagComics(dbPath, nums, act.arg, act.name == "untag")
+		case "export":
+			var n int
+			n, err = exportComics(dbPath, act.arg, nums, exportOptions{format: "json"})
+			outcome = fmt.Sprintf("exported %d comics to %s", n, withSlash(act.arg))
+		case "refetch":
+			outcome, err = refetchComics(dbPath, nums)
+		case "exclude":
+			outcome, err = excludeMatches(dbPath, nums, act.arg)
+		}
+		if err != nil {
+			return strings.Join(done, "; "), err
+		}
+		done = append(done, outcome)
+	}
+
+	return strings.Join(done, "; "), nil
+}
+
+// excludeMatches asks, then excludes comics, holding the database's lock
+// from before asking so no sync can start in between.
+func excludeMatches(dbPath string, nums []int, reason string) (string, error) {
+	unlock, err := lockDB(dbPath)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	if !confirm(fmt.Sprintf("Exclude %d comics, moving them to the trash?", len(nums))) {
+		return "", errors.New("not excluding")
+	}
+	ex, err := loadExclusions(dbPath)
+	if err != nil {
+		return "", err
+	}
+	removed, err := excludeComics(dbPath, ex, nums, reason)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("excluded %d comics, moving %d stored ones to the trash", len(nums), removed), nil
+}
+
+// tagComics adds a tag to comics, or with untag set removes it.
+func tagComics(dbPath string, nums []int, tag string, untag bool) (string, error) {
+	tags, err := loadTags(dbPath)
+	if err != nil {
+		return "", err
+	}
+
+	n := 0
+	for _, num := range nums {
+		changed := false
+		if untag {
+			changed = tags.remove(num, tag)
+		} else {
+			changed = tags.add(num, tag)
+		}
+		if changed {
+			n++
+		}
+	}
+	verb := "tagged"
+	if untag {
+		verb = "untagged"
+	}
+	if n == 0 {
+		return fmt.Sprintf("%s no comics %s", verb, tag), nil
+	}
+
+	return fmt.Sprintf("%s %d comics %s", verb, n, tag), tags.save(dbPath)
+}
+
+// refetchComics downloads comics and their images again from the
+// database's source, keeping local edits.
+func refetchComics(dbPath string, nums []int) (string, error) {
+	src, err := loadSource(dbPath)
+	if err != nil {
+		return "", err
+	}
+	m, unlock, err := recoverManifest(dbPath)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	n := 0
+	for _, num := range nums {
+		_, err := refreshComic(src, num, dbPath, m, true, false)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		n++
+	}
+
+	_, err = autoTag(dbPath, nums, m)
+	if err != nil {
+		return "", err
+	}
+	err = updateManifest(dbPath, m)
+	if err != nil {
+		return "", err
+	}
+	err = updateIndex(dbPath, false)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("refetched %d comics", n), nil
+}
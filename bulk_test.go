@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestApplyActions(t *testing.T) {
+	_, db := testServer(t, fakexkcd.Corpus(12))
+
+	matches, err := searchComics(db, "alt text 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var actions bulkActions
+	for _, s := range []string{"tag=ones", "tag=teens", "export=" + t.TempDir()} {
+		if err := actions.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outcome, err := applyActions(db, actions, matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(outcome, "tagged 4 comics ones") || !strings.Contains(outcome, "exported 4 comics") {
+		t.Errorf("outcome %q", outcome)
+	}
+
+	if got := searchNums(t, db, "tag:teens"); !equalInts(got, []int{1, 10, 11, 12}) {
+		t.Errorf("tag:teens found %v", got)
+	}
+
+	// Searching notices tags changing.
+	tagged, _ := searchComics(db, "tag:teens alt text 1")
+	if _, err := applyActions(db, bulkActions{{"untag", "teens"}}, tagged[:1]); err != nil {
+		t.Fatal(err)
+	}
+	found, _ := searchComics(db, "tag:teens")
+	if got := searchNums(t, db, "tag:teens"); !equalInts(got, []int{10, 11, 12}) {
+		t.Errorf("after untagging, tag:teens found %v", got)
+	}
+
+	assumeYes = true
+	defer func() { assumeYes = false }()
+	if _, err := applyActions(db, bulkActions{{"exclude", "curated"}}, found); err != nil {
+		t.Fatal(err)
+	}
+	ex, _ := loadExclusions(db)
+	if len(ex) != 3 || ex[10].Reason != "curated" {
+		t.Errorf("exclusions %v", ex)
+	}
+
+	for _, bad := range []string{"tag=", "tag=two words", "refetch=x", "delete"} {
+		if err := actions.Set(bad); err == nil {
+			t.Errorf("-apply %s accepted", bad)
+		}
+	}
+}
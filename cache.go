@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// cacheStats describes the local image cache of a hybrid database.
+type cacheStats struct {
+	Offloaded  int
+	Cached     int
+	Bytes      int64
+	Limit      int
+	LimitBytes int64
+	Fetches    int
+	Oldest     time.Time
+	Newest     time.Time
+}
+
+// imageCacheStats looks at the images of a hybrid database kept locally
+// after being viewed.
+func imageCacheStats(dbPath string, h *hybridConfig) (cacheStats, error) {
+	hybridMu.Lock()
+	defer hybridMu.Unlock()
+
+	s := cacheStats{Limit: h.Cache, LimitBytes: h.CacheBytes, Fetches: h.Fetches}
+
+	local, err := h.cached(dbPath)
+	if err != nil {
+		return s, err
+	}
+	for _, c := range local {
+		used := h.Used[c.num]
+		if used.IsZero() {
+			continue
+		}
+		s.Cached++
+		s.Bytes += c.size
+		if s.Oldest.IsZero() || used.Before(s.Oldest) {
+			s.Oldest = used
+		}
+		if used.After(s.Newest) {
+			s.Newest = used
+		}
+	}
+	for num := range h.Images {
+		if h.offloaded(dbPath, num) {
+			s.Offloaded++
+		}
+	}
+
+	return s, nil
+}
+
+// clearImageCache removes every cached image the store holds, returning
+// how many were removed.
+func clearImageCache(dbPath string, h *hybridConfig) (int, error) {
+	hybridMu.Lock()
+	defer hybridMu.Unlock()
+
+	for num := range h.Used {
+		delete(h.Used, num)
+	}
+
+	return h.evict(dbPath)
+}
+
+// cache reports on and empties the local image cache of a hybrid
+// database.
+func cache(args []string) {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db cache [flags] stats|clear")
+		fmt.Fprintln(fs.Output(), "Hybrid databases keep recently viewed images locally; see xkcd-db hybrid -h.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || (fs.Arg(0) != "stats" && fs.Arg(0) != "clear") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	*dbPath = withSlash(*dbPath)
+	h, err := loadHybrid(*dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if h == nil {
+		fmt.Println(*dbPath + " keeps its images locally and has no image cache")
+		return
+	}
+
+	if fs.Arg(0) == "clear" {
+		a := startAudit(*dbPath, "cache", args)
+		n, err := clearImageCache(*dbPath, h)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		outcome := fmt.Sprintf("Removed %d cached images", n)
+		fmt.Println(paint(os.Stdout, good, outcome))
+		a.end(outcome)
+		return
+	}
+
+	s, err := imageCacheStats(*dbPath, h)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	limit := func(n string, unlimited bool) string {
+		if unlimited {
+			return "unlimited"
+		}
+		return n
+	}
+	when := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Local().Format("2006-01-02 15:04")
+	}
+
+	fmt.Printf("Remote store:      %s\n", h.store)
+	fmt.Printf("Offloaded images:  %d\n", s.Offloaded)
+	fmt.Printf("Cached images:     %d of %s\n", s.Cached, limit(strconv.Itoa(s.Limit), s.Limit == 0))
+	fmt.Printf("Cached size:       %s of %s\n", formatBytes(s.Bytes), limit(formatBytes(s.LimitBytes), s.LimitBytes == 0))
+	fmt.Printf("Fetches:           %d\n", s.Fetches)
+	fmt.Printf("Oldest view:       %s\n", when(s.Oldest))
+	fmt.Printf("Newest view:       %s\n", when(s.Newest))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// changesFile logs every comic added to, refreshed in or removed from the
+// database, so others can follow the mirror with changes or /api/changes
+// rather than comparing all of it.
+const changesFile = "changes.log"
+
+// change is one line of the change log. Times only go up, so the last one
+// seen makes a cursor.
+type change struct {
+	Time time.Time `json:"time"`
+	// "added", "refreshed" or "removed".
+	Op  string `json:"op"`
+	Num int    `json:"num"`
+}
+
+var (
+	changeMu   sync.Mutex
+	lastChange time.Time
+)
+
+// recordChange appends to the change log.
+func recordChange(dbPath, op string, num int) error {
+	changeMu.Lock()
+	defer changeMu.Unlock()
+
+	// Changes made within the clock's resolution still get times of
+	// their own.
+	now := time.Now().UTC()
+	if !now.After(lastChange) {
+		now = lastChange.Add(time.Nanosecond)
+	}
+	lastChange = now
+
+	data, err := json.Marshal(change{Time: now, Op: op, Num: num})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(dbPath+changesFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// readChanges returns the changes made after since, oldest first.
+func readChanges(dbPath string, since time.Time) ([]change, error) {
+	changes := []change{}
+
+	f, err := os.Open(dbPath + changesFile)
+	if os.IsNotExist(err) {
+		return changes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var c change
+		// A line cut short by a crash is skipped.
+		if json.Unmarshal(sc.Bytes(), &c) != nil {
+			continue
+		}
+		if c.Time.After(since) {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes, sc.Err()
+}
+
+// parseSince reads a time as RFC 3339, or a day as YYYY-MM-DD in local
+// time. Empty is the beginning.
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("since %q: want YYYY-MM-DD or an RFC 3339 time", s)
+	}
+
+	return t, nil
+}
+
+// changesCmd lists what changed in the database.
+func changesCmd(args []string) {
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	since := fs.String("since", "", "Only changes after this day, YYYY-MM-DD, or time, as RFC 3339")
+	asJSON := fs.Bool("json", false, "Print JSON lines, as the change log holds them")
+	tableOpts := tableFlags(fs)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db changes [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	t0, err := parseSince(*since)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	changes, err := readChanges(withSlash(*dbPath), t0)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	t := newTable("time", "op", "num")
+	for _, c := range changes {
+		t.add(c.Time.Local().Format("2006-01-02 15:04:05"), c.Op, strconv.Itoa(c.Num))
+	}
+
+	if *asJSON {
+		rows, err := tableOpts.pick(t)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range rows {
+			err = enc.Encode(changes[r])
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+		return
+	}
+
+	err = tableOpts.print(os.Stdout, t)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// handleChanges lists changes after ?since=, a time or a day, oldest
+// first, a page at a time.
+func (s *server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changes, err := readChanges(s.dbPath, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lo, hi, ok := paginate(w, r, len(changes))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, changes[lo:hi])
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestChanges(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	if _, err := syncDB(db, syncOptions{rateLimit: 2}); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := readChanges(db, time.Time{})
+	if err != nil || len(changes) != 3 || changes[0].Op != "added" {
+		t.Fatalf("after sync: %v, %v", changes, err)
+	}
+	cursor := changes[2].Time
+
+	// Refreshing unchanged comics changes nothing.
+	c := fakexkcd.Corpus(3)[1]
+	c.Alt = "Fixed alt text"
+	srv.Add(c)
+	if _, err := syncDB(db, syncOptions{rateLimit: 2, refresh: true, images: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := excludeComics(db, exclusions{}, []int{3}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err = readChanges(db, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []change{{Op: "refreshed", Num: 2}, {Op: "removed", Num: 3}}
+	if len(changes) != len(want) {
+		t.Fatalf("since %v: %v", cursor, changes)
+	}
+	for i, c := range changes {
+		if c.Op != want[i].Op || c.Num != want[i].Num || !c.Time.After(cursor) {
+			t.Errorf("change %d = %+v, want %+v", i, c, want[i])
+		}
+	}
+
+	ts := httptest.NewServer((&server{dbPath: db}).routes())
+	defer ts.Close()
+	status, body := get(t, ts.URL+"/api/changes?limit=2&since="+cursor.Format(time.RFC3339Nano))
+	var got []change
+	if err := json.Unmarshal([]byte(body), &got); status != 200 || err != nil || len(got) != 2 {
+		t.Errorf("/api/changes: %d %s", status, body)
+	}
+	if status, _ := get(t, ts.URL+"/api/changes?since=yesterday"); status != 400 {
+		t.Errorf("bad since: %d", status)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Files the database keeps next to the comics.
+var dbFiles = map[string]bool{
+	auditFile:     true,
+	changesFile:   true,
+	controlSocket: true,
+	excludeFile:   true,
+	exportsFile:   true,
+	feedFile:      true,
+	hybridFile:    true,
+	hostsFile:     true,
+	journalFile:   true,
+	lockFile:      true,
+	manifestFile:  true,
+	quizFile:      true,
+	remoteFile:    true,
+	replicaFile:   true,
+	reviewFile:    true,
+	sourceFile:    true,
+	tagsFile:      true,
+	usageFile:     true,
+}
+
+// litter is a file or directory cleanup would remove.
+type litter struct {
+	Path   string
+	Reason string
+}
+
+// cleanup lists, and with -delete moves to the trash, what doesn't belong
+// in the database: leftovers of interrupted writes, empty files and files
+// no command made.
+func cleanup(args []string) {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	del := fs.Bool("delete", false, "Move what is found to the trash instead of only listing it")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+
+	found, err := findLitter(*dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for _, l := range found {
+		fmt.Println(paint(os.Stdout, warn, l.Path+": "+l.Reason))
+	}
+
+	if len(found) == 0 {
+		fmt.Println(paint(os.Stdout, good, tr("Nothing to clean up")))
+		return
+	}
+	if !*del {
+		fmt.Printf("%d items; run with -delete to remove them\n", len(found))
+		return
+	}
+	if !confirm(fmt.Sprintf("Move these %d items to the trash?", len(found))) {
+		os.Exit(1)
+	}
+
+	a := startAudit(*dbPath, "cleanup", args)
+
+	id, err := removeLitter(*dbPath, found)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf(tr("Moved %d items to the trash; xkcd-db trash restore %s puts them back\n"), len(found), id)
+	a.end(fmt.Sprintf("Moved %d items to trash run %s", len(found), id))
+}
+
+// findLitter walks the top of the database and each comic directory.
+func findLitter(dbPath string) ([]litter, error) {
+	entries, err := os.ReadDir(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []litter
+	for _, e := range entries {
+		name := e.Name()
+		path := dbPath + name
+
+		if reason := tempName(name); reason != "" {
+			found = append(found, litter{path, reason})
+			continue
+		}
+		if (dbFiles[name] && !e.IsDir()) || ((name == trashDir || name == indexDir || name == normalizedDir) && e.IsDir()) {
+			continue
+		}
+
+		num, err := strconv.Atoi(name)
+		if err != nil || !e.IsDir() {
+			found = append(found, litter{path, "not part of the database"})
+			continue
+		}
+
+		inside, err := comicLitter(dbPath, num)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, inside...)
+	}
+
+	return found, nil
+}
+
+// comicLitter checks one comic directory. A comic whose image is empty is
+// removed whole, so the next sync downloads it again.
+func comicLitter(dbPath string, num int) ([]litter, error) {
+	item := strconv.Itoa(num)
+	dir := dbPath + item + "/"
+
+	c, err := readComic(dbPath, num)
+	if err != nil {
+		return nil, err
+	}
+	img := ""
+	if i := strings.LastIndex(c.Img, "/"); i >= 0 {
+		img = c.Img[i+1:]
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []litter
+	for _, e := range entries {
+		name := e.Name()
+		path := dir + name
+
+		if reason := tempName(name); reason != "" {
+			found = append(found, litter{path, reason})
+			continue
+		}
+		if e.IsDir() {
+			found = append(found, litter{path, "not part of the database"})
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case item + "-alt", item + "-transcript", item + "-info.json":
+			if info.Size() == 0 {
+				found = append(found, litter{path, "empty file"})
+			}
+			continue
+		}
+
+		switch {
+		case img != "" && name != img:
+			found = append(found, litter{path, "not the image of comic " + item})
+		case info.Size() == 0:
+			// Nothing else is worth keeping without it.
+			return []litter{{strings.TrimSuffix(dir, "/"), "empty image; the comic will be downloaded again"}}, nil
+		}
+	}
+
+	return found, nil
+}
+
+// tempName explains names left by writes that never finished.
+func tempName(name string) string {
+	switch filepath.Ext(name) {
+	case ".tmp", ".partial":
+		return "left by an interrupted write"
+	}
+
+	return ""
+}
+
+// removeLitter moves what was found to the trash, brings the manifest in
+// line and returns the trash run's ID.
+func removeLitter(dbPath string, found []litter) (string, error) {
+	paths := make([]string, len(found))
+	for i, l := range found {
+		paths[i] = l.Path
+	}
+
+	id, err := moveToTrash(dbPath, paths)
+	if err != nil {
+		return id, err
+	}
+
+	_, err = fsckDB(dbPath, true)
+	return id, err
+}
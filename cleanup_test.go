@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestCleanup(t *testing.T) {
+	comics := fakexkcd.Corpus(4)
+	comics[2].Image = []byte{}
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, data := range map[string]string{
+		"manifest.json.tmp":   "{",
+		"notes.txt":           "mine",
+		"1/comic_1.png.tmp":   "half",
+		"1/comic_1_old.png":   "stale",
+		"2/2-alt":             "",
+		"4/.partial/whatever": "x",
+	} {
+		os.MkdirAll(filepath.Dir(db+path), 0755)
+		if err := os.WriteFile(db+path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := findLitter(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		db + "1/comic_1.png.tmp": "left by an interrupted write",
+		db + "1/comic_1_old.png": "not the image of comic 1",
+		db + "2/2-alt":           "empty file",
+		db + "3":                 "empty image; the comic will be downloaded again",
+		db + "4/.partial":        "left by an interrupted write",
+		db + "manifest.json.tmp": "left by an interrupted write",
+		db + "notes.txt":         "not part of the database",
+	}
+	if len(found) != len(want) {
+		t.Errorf("found %v", found)
+	}
+	for _, l := range found {
+		if want[l.Path] != l.Reason {
+			t.Errorf("%s: %q, want %q", l.Path, l.Reason, want[l.Path])
+		}
+	}
+
+	_, err = removeLitter(db, found)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err = findLitter(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Errorf("left after removing: %v", found)
+	}
+
+	problems, err := fsckDB(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("manifest out of line: %v", problems)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"image/png"
+	"os"
+)
+
+// copyComic puts part of a comic on the system clipboard: the image, the
+// alt text or the image's path.
+func copyComic(c localComic, what string) error {
+	switch what {
+	case "image":
+		if c.ImgPath == "" {
+			return errors.New("comic has no image")
+		}
+		if err := c.fetchImage(); err != nil {
+			return err
+		}
+		return copyImage(c.ImgPath)
+	case "alt":
+		return clipboardText(c.Alt)
+	case "path":
+		return clipboardText(c.ImgPath)
+	}
+
+	return errors.New("can only copy image, alt or path, not " + what)
+}
+
+// copyImage converts the image to PNG first, the one format every platform
+// clipboard understands.
+func copyImage(path string) error {
+	img, err := loadImage(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "xkcd-db-*.png")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	err = png.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return clipboardImage(f.Name())
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+func clipboardImage(pngPath string) error {
+	script := `set the clipboard to (read (POSIX file "` + pngPath + `") as «class PNGf»)`
+	return exec.Command("osascript", "-e", script).Run()
+}
+
+func clipboardText(s string) error {
+	cmd := exec.Command("pbcopy")
+	cmd.Stdin = strings.NewReader(s)
+
+	return cmd.Run()
+}
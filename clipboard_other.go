@@ -0,0 +1,16 @@
+//go:build !linux && !freebsd && !netbsd && !openbsd && !dragonfly && !darwin && !windows
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+func clipboardImage(pngPath string) error {
+	return errors.New("clipboard not supported on " + runtime.GOOS)
+}
+
+func clipboardText(s string) error {
+	return errors.New("clipboard not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,14 @@
+package main
+
+import "testing"
+
+func TestCopyComicRejectsBadRequests(t *testing.T) {
+	c := localComic{Comic: Comic{Num: 1, Alt: "alt"}}
+
+	if err := copyComic(c, "image"); err == nil {
+		t.Error("copied the image of a comic without one")
+	}
+	if err := copyComic(c, "title"); err == nil {
+		t.Error("copied an unsupported part")
+	}
+}
@@ -0,0 +1,58 @@
+//go:build linux || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// X11 and Wayland have different clipboard tools; use whichever matches
+// the session.
+func clipboardImage(pngPath string) error {
+	f, err := os.Open(pngPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cmd, err := clipboardCmd([]string{"wl-copy", "--type", "image/png"},
+		[]string{"xclip", "-selection", "clipboard", "-t", "image/png", "-i"})
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = f
+
+	return cmd.Run()
+}
+
+func clipboardText(s string) error {
+	cmd, err := clipboardCmd([]string{"wl-copy"},
+		[]string{"xclip", "-selection", "clipboard", "-i"},
+		[]string{"xsel", "--clipboard", "--input"})
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = strings.NewReader(s)
+
+	return cmd.Run()
+}
+
+// clipboardCmd picks the first installed tool. The Wayland tool only
+// counts inside a Wayland session.
+func clipboardCmd(wayland []string, x11 ...[]string) (*exec.Cmd, error) {
+	candidates := x11
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append([][]string{wayland}, x11...)
+	}
+
+	for _, c := range candidates {
+		if _, err := exec.LookPath(c[0]); err == nil {
+			return exec.Command(c[0], c[1:]...), nil
+		}
+	}
+
+	return nil, errors.New("no clipboard tool found; install wl-clipboard or xclip")
+}
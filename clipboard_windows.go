@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// The clipboard API needs a single-threaded apartment, hence -STA.
+func clipboardImage(pngPath string) error {
+	script := "Add-Type -AssemblyName System.Windows.Forms, System.Drawing; " +
+		"[System.Windows.Forms.Clipboard]::SetImage([System.Drawing.Image]::FromFile('" +
+		strings.ReplaceAll(pngPath, "'", "''") + "'))"
+
+	return exec.Command("powershell", "-NoProfile", "-STA", "-Command", script).Run()
+}
+
+func clipboardText(s string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-Command", "[Console]::In.ReadToEnd() | Set-Clipboard")
+	cmd.Stdin = strings.NewReader(s)
+
+	return cmd.Run()
+}
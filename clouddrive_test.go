@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withTokens keeps tokens in a fresh config directory, holding tok for
+// provider if given.
+func withTokens(t *testing.T, provider string, tok *oauthToken) {
+	t.Helper()
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	if tok != nil {
+		if err := saveToken(provider, tok); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeviceLogin(t *testing.T) {
+	withTokens(t, "", nil)
+	oldPoll := pollUnit
+	pollUnit = time.Millisecond
+	t.Cleanup(func() { pollUnit = oldPoll })
+
+	var mu sync.Mutex
+	polls, refreshes := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"device_code": "dev", "user_code": "ABCD-EFGH", "verification_url": "https://example.com/device", "expires_in": 60, "interval": 1}`)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		r.ParseForm()
+		switch r.Form.Get("grant_type") {
+		case "refresh_token":
+			refreshes++
+			fmt.Fprint(w, `{"access_token": "fresh", "expires_in": 3600}`)
+		default:
+			polls++
+			if polls < 3 {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": "authorization_pending"}`)
+				return
+			}
+			fmt.Fprint(w, `{"access_token": "first", "refresh_token": "again", "expires_in": 3600}`)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	p := &oauthProvider{name: "gdrive", clientID: "id", deviceURL: ts.URL + "/device", tokenURL: ts.URL + "/token"}
+	tok, err := p.token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok != "first" || polls != 3 {
+		t.Errorf("got token %q after %d polls", tok, polls)
+	}
+
+	path, _ := tokensPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("tokens saved with mode %v", info.Mode().Perm())
+	}
+
+	// A later run finds the tokens, and refreshes them once expired.
+	p = &oauthProvider{name: "gdrive", clientID: "id", deviceURL: ts.URL + "/device", tokenURL: ts.URL + "/token"}
+	if tok, err := p.token(); err != nil || tok != "first" || polls != 3 {
+		t.Errorf("second run got %q, %v after %d polls", tok, err, polls)
+	}
+	p.forget()
+	if tok, err := p.token(); err != nil || tok != "fresh" || refreshes != 1 {
+		t.Errorf("refresh got %q, %v", tok, err)
+	}
+	tokens, _ := loadTokens()
+	if tokens["gdrive"].Refresh != "again" {
+		t.Errorf("refresh token lost: %+v", tokens["gdrive"])
+	}
+}
+
+func TestDropboxChunkedUpload(t *testing.T) {
+	withTokens(t, "dropbox", &oauthToken{Access: "secret", Expiry: time.Now().Add(time.Hour)})
+	t.Setenv("XKCDDB_DROPBOX_CLIENT_ID", "id")
+	oldChunk := cloudChunk
+	cloudChunk = 4
+	t.Cleanup(func() { cloudChunk = oldChunk })
+
+	var mu sync.Mutex
+	files := make(map[string][]byte)
+	sessions := make(map[string][]byte)
+	var calls []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		endpoint := strings.TrimPrefix(r.URL.Path, "/2/")
+		calls = append(calls, endpoint)
+		data, _ := io.ReadAll(r.Body)
+		var arg struct {
+			Path   string
+			Cursor struct {
+				SessionID string `json:"session_id"`
+				Offset    int
+			}
+			Commit struct{ Path string }
+		}
+		if a := r.Header.Get("Dropbox-API-Arg"); a != "" {
+			json.Unmarshal([]byte(a), &arg)
+		} else {
+			json.Unmarshal(data, &arg)
+		}
+
+		switch endpoint {
+		case "files/upload":
+			files[arg.Path] = data
+		case "files/upload_session/start":
+			sessions["s1"] = data
+			fmt.Fprint(w, `{"session_id": "s1"}`)
+			return
+		case "files/upload_session/append_v2", "files/upload_session/finish":
+			s := sessions[arg.Cursor.SessionID]
+			if len(s) != arg.Cursor.Offset {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error_summary": "incorrect_offset"}`)
+				return
+			}
+			sessions[arg.Cursor.SessionID] = append(s, data...)
+			if endpoint == "files/upload_session/finish" {
+				files[arg.Commit.Path] = sessions[arg.Cursor.SessionID]
+			}
+		case "files/download":
+			data, ok := files[arg.Path]
+			if !ok {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error_summary": "path/not_found/"}`)
+				return
+			}
+			w.Write(data)
+			return
+		case "files/delete_v2":
+			if _, ok := files[arg.Path]; !ok {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error_summary": "path_lookup/not_found/"}`)
+				return
+			}
+			delete(files, arg.Path)
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer ts.Close()
+
+	oldAPI, oldContent := dropboxAPI, dropboxContent
+	dropboxAPI, dropboxContent = ts.URL+"/2/", ts.URL+"/2/"
+	t.Cleanup(func() { dropboxAPI, dropboxContent = oldAPI, oldContent })
+
+	db := tempDB(t)
+	os.MkdirAll(db+"1", 0755)
+	os.WriteFile(db+"1/1-alt", []byte("sma"), 0644)
+	os.WriteFile(db+"1/image.png", []byte("0123456789"), 0644)
+
+	store, err := openRemote("dropbox://xkcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := store.put(db, []string{"1/1-alt", "1/image.png"})
+	if err != nil || n != 2 {
+		t.Fatalf("put %d files: %v", n, err)
+	}
+	if string(files["/xkcd/1/1-alt"]) != "sma" || string(files["/xkcd/1/image.png"]) != "0123456789" {
+		t.Errorf("uploaded %q", files)
+	}
+	want := "files/upload files/upload_session/start files/upload_session/append_v2 files/upload_session/finish"
+	if got := strings.Join(calls, " "); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+
+	r, err := store.get("1/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "0123456789" {
+		t.Errorf("downloaded %q", data)
+	}
+
+	err = store.remove([]string{"1/1-alt", "1/1-alt", "1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["/xkcd/1/1-alt"]; ok {
+		t.Error("1-alt not removed")
+	}
+}
+
+// fakeDrive keeps files by ID under the root folder "root".
+type fakeDrive struct {
+	mu       sync.Mutex
+	next     int
+	files    map[string]*driveFile
+	sessions map[string]*driveSession
+}
+
+type driveFile struct {
+	name, parent string
+	folder       bool
+	data         []byte
+}
+
+type driveSession struct {
+	id, name, parent string
+	data             []byte
+	size             int
+}
+
+var driveQuery = regexp.MustCompile(`name = '(.*)' and '(.*)' in parents`)
+
+func (d *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	var meta struct {
+		Name     string   `json:"name"`
+		MimeType string   `json:"mimeType"`
+		Parents  []string `json:"parents"`
+	}
+	json.Unmarshal(body, &meta)
+	newID := func() string {
+		d.next++
+		return "id" + strconv.Itoa(d.next)
+	}
+
+	p := r.URL.Path
+	switch {
+	case r.Method == "GET" && p == "/drive/v3/files":
+		m := driveQuery.FindStringSubmatch(r.URL.Query().Get("q"))
+		var ids []string
+		for id, f := range d.files {
+			if f.name == m[1] && f.parent == m[2] {
+				ids = append(ids, `{"id": "`+id+`"}`)
+			}
+		}
+		fmt.Fprintf(w, `{"files": [%s]}`, strings.Join(ids, ","))
+	case r.Method == "POST" && p == "/drive/v3/files":
+		id := newID()
+		d.files[id] = &driveFile{name: meta.Name, parent: meta.Parents[0], folder: meta.MimeType == driveFolder}
+		fmt.Fprintf(w, `{"id": "%s"}`, id)
+	case r.Method == "POST" && p == "/upload/drive/v3/files", r.Method == "PATCH" && strings.HasPrefix(p, "/upload/drive/v3/files/"):
+		s := &driveSession{name: meta.Name}
+		if r.Method == "PATCH" {
+			s.id = strings.TrimPrefix(p, "/upload/drive/v3/files/")
+		}
+		if len(meta.Parents) > 0 {
+			s.parent = meta.Parents[0]
+		}
+		s.size, _ = strconv.Atoi(r.Header.Get("X-Upload-Content-Length"))
+		sid := newID()
+		d.sessions[sid] = s
+		w.Header().Set("Location", "http://"+r.Host+"/session/"+sid)
+	case r.Method == "PUT" && strings.HasPrefix(p, "/session/"):
+		s := d.sessions[strings.TrimPrefix(p, "/session/")]
+		s.data = append(s.data, body...)
+		if len(s.data) < s.size {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(s.data)-1))
+			w.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		if s.id == "" {
+			s.id = newID()
+			d.files[s.id] = &driveFile{name: s.name, parent: s.parent}
+		}
+		d.files[s.id].data = s.data
+		fmt.Fprintf(w, `{"id": "%s"}`, s.id)
+	case r.Method == "GET" && strings.HasPrefix(p, "/drive/v3/files/"):
+		f, ok := d.files[strings.TrimPrefix(p, "/drive/v3/files/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(f.data)
+	case r.Method == "DELETE":
+		delete(d.files, strings.TrimPrefix(p, "/drive/v3/files/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected "+r.Method+" "+p, http.StatusBadRequest)
+	}
+}
+
+func TestGDriveUpload(t *testing.T) {
+	withTokens(t, "gdrive", &oauthToken{Access: "secret", Expiry: time.Now().Add(time.Hour)})
+	t.Setenv("XKCDDB_GDRIVE_CLIENT_ID", "id")
+	oldChunk := cloudChunk
+	cloudChunk = 4
+	t.Cleanup(func() { cloudChunk = oldChunk })
+
+	d := &fakeDrive{files: make(map[string]*driveFile), sessions: make(map[string]*driveSession)}
+	ts := httptest.NewServer(d)
+	defer ts.Close()
+	oldAPI, oldUpload := driveAPI, driveUpload
+	driveAPI, driveUpload = ts.URL+"/drive/v3/", ts.URL+"/upload/drive/v3/"
+	t.Cleanup(func() { driveAPI, driveUpload = oldAPI, oldUpload })
+
+	db := tempDB(t)
+	os.MkdirAll(db+"1", 0755)
+	os.WriteFile(db+"1/image.png", []byte("0123456789"), 0644)
+
+	store, err := openRemote("gdrive://backups/xkcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.put(db, []string{"1/image.png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A replacement is a new revision of the same file.
+	os.WriteFile(db+"1/image.png", []byte("abcdefg"), 0644)
+	if _, err := store.put(db, []string{"1/image.png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Found again by a fresh store, which has to look the path up.
+	store, _ = openRemote("gdrive://backups/xkcd")
+	r, err := store.get("1/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "abcdefg" {
+		t.Errorf("downloaded %q", data)
+	}
+
+	folders, images := 0, 0
+	for _, f := range d.files {
+		if f.folder {
+			folders++
+		} else {
+			images++
+		}
+	}
+	if folders != 3 || images != 1 {
+		t.Errorf("drive holds %d folders and %d files, want 3 and 1", folders, images)
+	}
+
+	err = store.remove([]string{"1/image.png", "1/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.get("1/image.png"); err == nil {
+		t.Error("image still there after remove")
+	}
+}
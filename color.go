@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// Colour statistics for a comic image.
+type colorStats struct {
+	// Share of pixels that are noticeably coloured rather than gray.
+	ColorFraction float64 `json:"colorFraction"`
+	// Most common colours, quantized, most frequent first.
+	Palette []paletteEntry `json:"palette"`
+}
+
+type paletteEntry struct {
+	Color    string  `json:"color"`
+	Fraction float64 `json:"fraction"`
+}
+
+// A comic counts as colour when more than this share of it is coloured;
+// anti-aliasing and JPEG noise in black and white comics stay well below.
+const colorThreshold = 0.001
+
+func (c *colorStats) isColor() bool {
+	return c != nil && c.ColorFraction > colorThreshold
+}
+
+// findColors measures how much colour img uses and which colours dominate.
+func findColors(img image.Image) *colorStats {
+	src := flatten(img)
+	b := src.Bounds()
+	total := b.Dx() * b.Dy()
+	if total == 0 {
+		return &colorStats{}
+	}
+
+	// Colours are bucketed to 4 bits per channel.
+	counts := make(map[[3]uint8]int)
+	colored := 0
+
+	for i := 0; i < len(src.Pix); i += 4 {
+		r, g, bl := src.Pix[i], src.Pix[i+1], src.Pix[i+2]
+
+		hi, lo := r, r
+		for _, v := range []uint8{g, bl} {
+			if v > hi {
+				hi = v
+			}
+			if v < lo {
+				lo = v
+			}
+		}
+		// Channels far apart mean a saturated, non-gray pixel.
+		if hi-lo > 32 {
+			colored++
+		}
+
+		counts[[3]uint8{r >> 4, g >> 4, bl >> 4}]++
+	}
+
+	keys := make([][3]uint8, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	packed := func(k [3]uint8) int { return int(k[0])<<8 | int(k[1])<<4 | int(k[2]) }
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return packed(keys[i]) < packed(keys[j])
+	})
+	if len(keys) > 5 {
+		keys = keys[:5]
+	}
+
+	stats := &colorStats{ColorFraction: float64(colored) / float64(total)}
+	for _, k := range keys {
+		stats.Palette = append(stats.Palette, paletteEntry{
+			// Report the middle of each bucket.
+			Color:    fmt.Sprintf("#%02x%02x%02x", k[0]<<4|8, k[1]<<4|8, k[2]<<4|8),
+			Fraction: float64(counts[k]) / float64(total),
+		})
+	}
+
+	return stats
+}
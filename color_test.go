@@ -0,0 +1,34 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestFindColors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	// Gray line art is not colour.
+	for x := 0; x < 100; x++ {
+		img.Set(x, 50, color.RGBA{40, 40, 40, 255})
+	}
+	stats := findColors(img)
+	if stats.isColor() {
+		t.Errorf("gray comic counted as colour: %+v", stats)
+	}
+	if stats.Palette[0].Color != "#f8f8f8" {
+		t.Errorf("dominant colour %s, want white", stats.Palette[0].Color)
+	}
+
+	draw.Draw(img, image.Rect(0, 0, 10, 10), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	stats = findColors(img)
+	if !stats.isColor() || stats.ColorFraction != 0.01 {
+		t.Errorf("red square: %+v", stats)
+	}
+	if len(stats.Palette) != 3 {
+		t.Errorf("palette %v, want white, red and gray", stats.Palette)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"sort"
+)
+
+// comic404 stands in for the comic xkcd never had: its page has always
+// been an HTTP 404 error, as a joke. Nothing of it is stored; the web UI
+// shows it at /comic/404, and export -with-404 adds it as a placeholder.
+var comic404 = Comic{
+	Num:   404,
+	Title: "Not Found",
+	Year:  "2008",
+	Month: "4",
+	Day:   "2",
+	Alt:   "xkcd skipped comic 404. Its page has only ever been a 404 Not Found error, which is the joke.",
+}
+
+// is404Joke reports whether the database mirrors xkcd without a comic 404
+// of its own. Other webcomics may skip numbers without a joke.
+func is404Joke(dbPath string) bool {
+	if _, err := os.Stat(dbPath + sourceFile); err == nil {
+		return false
+	}
+	_, err := os.Stat(dbPath + "404")
+
+	return os.IsNotExist(err)
+}
+
+// with404 adds comic 404 to the stored comics nums, in order, if the
+// database mirrors xkcd past it and the joke applies.
+func with404(dbPath string, nums []int) []int {
+	i := sort.SearchInts(nums, 404)
+	if i == len(nums) || nums[i] == 404 || !is404Joke(dbPath) {
+		return nums
+	}
+
+	out := make([]int, 0, len(nums)+1)
+	out = append(out, nums[:i]...)
+	out = append(out, 404)
+
+	return append(out, nums[i:]...)
+}
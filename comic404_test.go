@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestServeComic404(t *testing.T) {
+	ts, _ := testServer(t, fakexkcd.Corpus(405)[401:])
+
+	status, body := get(t, ts.URL+"/comic/404")
+	if status != http.StatusNotFound {
+		t.Fatalf("status %d", status)
+	}
+	for _, want := range []string{"404 Not Found", `href="403"`, `href="405"`} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+
+	_, body = get(t, ts.URL+"/comic/403")
+	if !bytes.Contains(body, []byte(`href="404"`)) {
+		t.Error("403 doesn't lead to 404")
+	}
+}
+
+func TestExportWith404(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(405)[401:])
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := withSlash(t.TempDir())
+	n, err := exportComics(db, out, nil, exportOptions{format: "json"})
+	if err != nil || n != 3 {
+		t.Fatalf("exported %d comics, %v; want 3", n, err)
+	}
+
+	out = withSlash(t.TempDir())
+	n, err = exportComics(db, out, nil, exportOptions{format: "json", with404: true})
+	if err != nil || n != 4 {
+		t.Fatalf("exported %d comics with 404, %v; want 4", n, err)
+	}
+	var c Comic
+	err = json.Unmarshal(readFile(t, out+"404.json"), &c)
+	if err != nil || c.Num != 404 || c.Title != comic404.Title {
+		t.Errorf("404.json: %v, %+v", err, c)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// userConfig holds settings of the user rather than of a database, read
+// from config.json in their config directory, or the file XKCDDB_CONFIG
+// names. Flags override it.
+type userConfig struct {
+	// The theme to use and its variant: light, dark or auto.
+	Theme   string            `json:"theme,omitempty"`
+	Variant string            `json:"variant,omitempty"`
+	Themes  map[string]*theme `json:"themes,omitempty"`
+	// The command that opens images, as for -viewer.
+	Viewer string `json:"viewer,omitempty"`
+	// Tags comics get as they are downloaded or refreshed.
+	Rules []*tagRule `json:"rules,omitempty"`
+	// Write normalized display copies of images as they are downloaded,
+	// as analyze -normalize does.
+	Normalize bool `json:"normalize,omitempty"`
+}
+
+var userConf = &userConfig{}
+
+func configPath() (string, error) {
+	if p := os.Getenv("XKCDDB_CONFIG"); p != "" {
+		return p, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "xkcd-db", "config.json"), nil
+}
+
+// loadUserConfig reads the config file, if there is one, and applies it.
+func loadUserConfig() error {
+	path, err := configPath()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	c := &userConfig{}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	userConf = c
+
+	for _, r := range c.Rules {
+		if err == nil {
+			err = r.compile()
+		}
+	}
+	if err == nil && c.Variant != "" {
+		err = setThemeVariant(c.Variant)
+	}
+	if err == nil && c.Theme != "" {
+		err = useTheme(c.Theme)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	return nil
+}
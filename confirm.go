@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// assumeYes answers every confirmation, as set by -yes.
+var assumeYes bool
+
+// confirm asks before something destructive happens. Without a terminal to
+// ask on, it refuses unless -yes was given, so scripts have to say so.
+func confirm(prompt string) bool {
+	if assumeYes {
+		return true
+	}
+	if !isTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, "Not asking without a terminal; pass -yes to go ahead")
+		return false
+	}
+
+	return ask(os.Stdin, os.Stdout, prompt)
+}
+
+// ask puts a yes/no question on w and reads the answer from r. Anything
+// but yes is no.
+func ask(r io.Reader, w io.Writer, prompt string) bool {
+	fmt.Fprintf(w, "%s [y/N] ", prompt)
+
+	line, _ := bufio.NewReader(r).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+
+	return false
+}
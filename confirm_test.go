@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAsk(t *testing.T) {
+	for answer, want := range map[string]bool{
+		"y\n":     true,
+		" YES \n": true,
+		"yes":     true,
+		"\n":      false,
+		"n\n":     false,
+		"yep\n":   false,
+		"":        false,
+	} {
+		var out bytes.Buffer
+		if got := ask(strings.NewReader(answer), &out, "Delete?"); got != want {
+			t.Errorf("answer %q: got %v, want %v", answer, got, want)
+		}
+		if out.String() != "Delete? [y/N] " {
+			t.Errorf("prompted %q", out.String())
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How many recent errors a sync keeps for whoever is watching it.
+const recentErrors = 10
+
+// syncControl steers a running sync: downloads can be paused and held to
+// fewer than -r at a time, and it tracks what is in flight for the
+// dashboard.
+type syncControl struct {
+	gate *aimd
+	// The -r value; limits set by hand stay within it.
+	max int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+	// Most downloads to run at once, set by hand; 0 leaves it to -r and
+	// -adaptive.
+	limit    int
+	inflight int
+	// Comics being downloaded and when each started.
+	active map[string]time.Time
+	done   int
+	failed int
+	// Newest last.
+	errors []string
+	// Set while something else, like the dashboard, reports progress.
+	quiet bool
+	// Why the database stopped taking writes, once it did.
+	halted error
+	// What is left to download, for ctl fetch to reorder.
+	queue *fetchQueue
+
+	// Progress goes here too, if set, and no downloads start once stop
+	// is closed.
+	events func(syncEvent)
+	stop   <-chan struct{}
+}
+
+func newSyncControl(gate *aimd, max int) *syncControl {
+	c := &syncControl{gate: gate, max: max, active: make(map[string]time.Time)}
+	c.cond = sync.NewCond(&c.mu)
+
+	return c
+}
+
+// acquire waits until a download may start, or the sync stops, which the
+// caller checks next.
+func (c *syncControl) acquire() {
+	c.mu.Lock()
+	for !c.stoppingLocked() && (c.paused || (c.limit > 0 && c.inflight >= c.limit)) {
+		c.cond.Wait()
+	}
+	c.inflight++
+	c.mu.Unlock()
+
+	c.gate.acquire()
+}
+
+// started records that item is being downloaded.
+func (c *syncControl) started(item string) {
+	c.mu.Lock()
+	c.active[item] = time.Now()
+	c.mu.Unlock()
+
+	num, _ := strconv.Atoi(item)
+	c.emit(syncEvent{Kind: eventComicStart, Comic: num})
+}
+
+func (c *syncControl) emit(e syncEvent) {
+	if c.events != nil {
+		c.events(e)
+	}
+}
+
+// stopping reports whether the sync was asked to stop, or halted.
+func (c *syncControl) stopping() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stoppingLocked()
+}
+
+func (c *syncControl) stoppingLocked() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+	}
+
+	return c.halted != nil
+}
+
+// watchStop wakes downloads waiting to start once stop is closed, until
+// the returned function is called.
+func (c *syncControl) watchStop() func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-c.stop:
+			c.mu.Lock()
+			c.cond.Broadcast()
+			c.mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// halt stops the sync starting downloads because the database can't be
+// written, e.g. as the disk is full. Downloads in flight still finish.
+func (c *syncControl) halt(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.halted == nil {
+		c.halted = err
+	}
+	c.cond.Broadcast()
+}
+
+func (c *syncControl) haltedBy() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.halted
+}
+
+// release ends a download started with acquire. An empty item means
+// nothing was downloaded after all.
+func (c *syncControl) release(item string, took time.Duration, err error) {
+	c.gate.release(took, err)
+	if item != "" {
+		c.emit(comicEvent(item, took, err))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inflight--
+	if item != "" {
+		delete(c.active, item)
+		c.done++
+	}
+	if err != nil {
+		c.failed++
+		c.errors = append(c.errors, err.Error())
+		if len(c.errors) > recentErrors {
+			c.errors = c.errors[1:]
+		}
+	}
+
+	c.cond.Broadcast()
+}
+
+func (c *syncControl) setPaused(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.paused = paused
+	c.cond.Broadcast()
+}
+
+// concurrency is how many downloads may run at once right now.
+func (c *syncControl) concurrency() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.concurrencyLocked()
+}
+
+func (c *syncControl) concurrencyLocked() int {
+	n := c.max
+	if c.gate != nil {
+		n = c.gate.current()
+	}
+	if c.limit > 0 && c.limit < n {
+		n = c.limit
+	}
+
+	return n
+}
+
+// adjust raises or lowers the number of parallel downloads by delta,
+// keeping it between 1 and -r.
+func (c *syncControl) adjust(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.concurrencyLocked() + delta
+	if n < 1 {
+		n = 1
+	}
+	if n >= c.max {
+		n = 0
+	}
+	c.limit = n
+	c.cond.Broadcast()
+}
+
+// syncStatus is a snapshot of a running sync.
+type syncStatus struct {
+	Paused      bool `json:"paused"`
+	Concurrency int  `json:"concurrency"`
+	// Longest running first.
+	Active []activeDownload `json:"active"`
+	Done   int              `json:"done"`
+	Failed int              `json:"failed"`
+	Errors []string         `json:"errors,omitempty"`
+}
+
+type activeDownload struct {
+	Comic   string  `json:"comic"`
+	Seconds float64 `json:"seconds"`
+}
+
+func (c *syncControl) status() syncStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st := syncStatus{
+		Paused:      c.paused,
+		Concurrency: c.concurrencyLocked(),
+		Done:        c.done,
+		Failed:      c.failed,
+		Errors:      append([]string(nil), c.errors...),
+	}
+	for item, start := range c.active {
+		st.Active = append(st.Active, activeDownload{item, time.Since(start).Seconds()})
+	}
+	sort.Slice(st.Active, func(i, j int) bool {
+		return st.Active[i].Seconds > st.Active[j].Seconds
+	})
+
+	return st
+}
+
+// controlSocket is where a sync run with -control listens by default, in
+// the database directory.
+const controlSocket = "control.sock"
+
+// serveControl lets ctl steer the sync through addr, as taken by -listen,
+// until the returned function is called.
+func serveControl(addr string, c *syncControl) (func(), error) {
+	l, err := listen(addr)
+	if err != nil {
+		return nil, errors.New("another sync may be running: " + err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.status())
+	})
+	mux.HandleFunc("/pause", c.handleSetPaused(true))
+	mux.HandleFunc("/resume", c.handleSetPaused(false))
+	mux.HandleFunc("/fetch", c.handleFetch)
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+
+	// Closing the listener removes any socket. It is closed here too in
+	// case Serve hasn't got to it yet.
+	return func() {
+		srv.Close()
+		l.Close()
+	}, nil
+}
+
+func (c *syncControl) handleSetPaused(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		c.setPaused(paused)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleFetch moves the comic asked for to the front of the queue, if it
+// is still waiting there.
+func (c *syncControl) handleFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	num, err := strconv.Atoi(r.URL.Query().Get("comic"))
+	if err != nil || num < 1 {
+		http.Error(w, "bad comic number", http.StatusBadRequest)
+		return
+	}
+	if c.queue == nil || !c.queue.promote(strconv.Itoa(num)) {
+		http.Error(w, fmt.Sprintf("comic %d isn't waiting to be fetched", num), http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
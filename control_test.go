@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncControlPause(t *testing.T) {
+	ctl := newSyncControl(nil, 4)
+	ctl.setPaused(true)
+
+	started := make(chan struct{})
+	go func() {
+		ctl.acquire()
+		close(started)
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("download started while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ctl.setPaused(false)
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("download didn't start after resuming")
+	}
+}
+
+func TestSyncControlStopWhilePaused(t *testing.T) {
+	for _, how := range []string{"stop", "halt"} {
+		stop := make(chan struct{})
+		ctl := newSyncControl(nil, 4)
+		ctl.stop = stop
+		defer ctl.watchStop()()
+		ctl.setPaused(true)
+
+		woke := make(chan struct{})
+		go func() {
+			ctl.acquire()
+			close(woke)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		if how == "stop" {
+			close(stop)
+		} else {
+			ctl.halt(errors.New("disk full"))
+		}
+		select {
+		case <-woke:
+		case <-time.After(time.Second):
+			t.Fatalf("%s didn't wake a paused download", how)
+		}
+		if !ctl.stopping() {
+			t.Errorf("%s: not stopping", how)
+		}
+	}
+}
+
+func TestSyncControlAdjust(t *testing.T) {
+	ctl := newSyncControl(nil, 4)
+
+	ctl.adjust(-1)
+	ctl.adjust(-1)
+	if got := ctl.concurrency(); got != 2 {
+		t.Errorf("lowered twice from 4 to %d", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		ctl.adjust(-1)
+	}
+	if got := ctl.concurrency(); got != 1 {
+		t.Errorf("lowered to %d, want no fewer than 1", got)
+	}
+
+	for i := 0; i < 5; i++ {
+		ctl.adjust(1)
+	}
+	if got := ctl.concurrency(); got != 4 {
+		t.Errorf("raised to %d, want no more than -r", got)
+	}
+}
+
+func TestDashboardFrame(t *testing.T) {
+	ctl := newSyncControl(nil, 2)
+	ctl.acquire()
+	ctl.started("7")
+	ctl.acquire()
+	ctl.started("8")
+	ctl.release("8", time.Millisecond, errors.New("comic 8: 429 Too Many Requests"))
+	ctl.setPaused(true)
+
+	d := &dashboard{ctl: ctl, total: 10, rates: []float64{0, 2048, 1024}}
+	frame := d.frame(ctl.status())
+
+	for _, want := range []string{
+		"Sync paused: 1 of 10 comics, 1 failed, 2 parallel downloads\n",
+		"▁█▄ 1.0 KiB/s\n",
+		"  #7  ",
+		"! comic 8: 429 Too Many Requests\n",
+	} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("frame lacks %q:\n%s", want, frame)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// corsPolicy lets web pages from other origins call the API.
+type corsPolicy struct {
+	origins map[string]bool
+	any     bool
+	// Any port on localhost, for frontends under development.
+	localhost bool
+}
+
+// parseCORS reads a comma separated list of origins like
+// https://app.example.com. * allows every origin and localhost any local
+// port; an empty list allows none.
+func parseCORS(s string) *corsPolicy {
+	p := &corsPolicy{origins: make(map[string]bool)}
+
+	for _, o := range strings.Split(s, ",") {
+		switch o = strings.TrimSuffix(strings.TrimSpace(o), "/"); o {
+		case "":
+		case "*":
+			p.any = true
+		case "localhost":
+			p.localhost = true
+		default:
+			p.origins[o] = true
+		}
+	}
+
+	return p
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	if p.any || p.origins[origin] {
+		return true
+	}
+	if !p.localhost {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+
+	return false
+}
+
+// wrap adds CORS headers to API responses for allowed origins and
+// answers their preflight requests. The web UI is left alone.
+func (p *corsPolicy) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, info := infoPath(r.URL.Path)
+		if !strings.HasPrefix(r.URL.Path, "/api/") && !info {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !p.allowed(origin) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := parseCORS("localhost, https://app.example.com/").wrap(ok)
+
+	for _, c := range []struct {
+		method, path, origin string
+		status               int
+		allow                string
+	}{
+		{"GET", "/api/comic/1", "https://app.example.com", 200, "https://app.example.com"},
+		{"GET", "/api/comic/1", "http://localhost:5173", 200, "http://localhost:5173"},
+		{"GET", "/2/info.0.json", "http://127.0.0.1:3000", 200, "http://127.0.0.1:3000"},
+		{"GET", "/api/comic/1", "https://evil.example.com", 200, ""},
+		{"GET", "/api/comic/1", "http://localhost.evil.example.com", 200, ""},
+		{"GET", "/comic/1", "https://app.example.com", 200, ""},
+		{"OPTIONS", "/api/onthisday", "https://app.example.com", 204, "https://app.example.com"},
+	} {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.Header.Set("Origin", c.origin)
+		if c.method == "OPTIONS" {
+			r.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != c.status || w.Header().Get("Access-Control-Allow-Origin") != c.allow {
+			t.Errorf("%s %s from %s: %d, allowed %q", c.method, c.path, c.origin, w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+
+	if !parseCORS("*").allowed("https://anywhere.example") || parseCORS("").allowed("http://localhost") {
+		t.Error("* or the empty list misbehave")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// The largest page a crawler accepts.
+const maxPageSize = 16 << 20
+
+// crawler fetches pages from sites other than xkcd's JSON API, such as
+// explainxkcd or what-if, where the mirror is a guest. It identifies
+// itself, keeps to robots.txt and its Crawl-delay, limits requests per
+// host, spaces them out, and caches what it fetched so reruns don't ask
+// again.
+type crawler struct {
+	// Concurrent requests allowed per host.
+	perHost int
+	// Minimum time between the starts of two requests to a host.
+	delay time.Duration
+	// Cached pages live here, named by a hash of their URL. Empty disables
+	// the cache.
+	cacheDir string
+	// Cached pages older than this are fetched again; zero keeps them
+	// forever.
+	maxAge time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	slots chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+
+	robotsOnce sync.Once
+	robots     *robots
+	robotsErr  error
+}
+
+func newCrawler(perHost int, delay time.Duration, cacheDir string) *crawler {
+	if perHost < 1 {
+		perHost = 1
+	}
+
+	return &crawler{
+		perHost:  perHost,
+		delay:    delay,
+		cacheDir: cacheDir,
+		hosts:    make(map[string]*hostState),
+	}
+}
+
+func (c *crawler) host(name string) *hostState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok := c.hosts[name]
+	if !ok {
+		h = &hostState{slots: make(chan struct{}, c.perHost)}
+		c.hosts[name] = h
+	}
+
+	return h
+}
+
+// get returns the body of a page, from the cache if it has a fresh copy.
+func (c *crawler) get(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, errors.New("not an absolute URL: " + rawURL)
+	}
+
+	if body, ok := c.cached(rawURL); ok {
+		return body, nil
+	}
+
+	h := c.host(u.Host)
+	h.robotsOnce.Do(func() {
+		h.robots, h.robotsErr = fetchRobots(u.Scheme + "://" + u.Host + "/robots.txt")
+	})
+	if h.robotsErr != nil {
+		return nil, h.robotsErr
+	}
+	if !h.robots.allowed(u.RequestURI()) {
+		return nil, errors.New(rawURL + " is disallowed by robots.txt")
+	}
+
+	delay := c.delay
+	if h.robots.delay > delay {
+		delay = h.robots.delay
+	}
+
+	h.slots <- struct{}{}
+	defer func() { <-h.slots }()
+
+	// Claim the next start time for this host, then wait for it.
+	h.mu.Lock()
+	start := time.Now()
+	if h.next.After(start) {
+		start = h.next
+	}
+	h.next = start.Add(delay)
+	h.mu.Unlock()
+	time.Sleep(time.Until(start))
+
+	resp, err := politeGet(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxPageSize {
+		return nil, errors.New("page too large: " + rawURL)
+	}
+
+	return body, c.store(rawURL, body)
+}
+
+// politeGet requests a page as the tool, so site owners know who asks.
+func politeGet(rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	return client.Do(req)
+}
+
+// fetchRobots loads a host's rules. A missing robots.txt allows
+// everything; one that can't be read, e.g. during an outage, is treated as
+// a request to stay away for now.
+func fetchRobots(rawURL string) (*robots, error) {
+	resp, err := politeGet(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("%s: %s", rawURL, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return &robots{}, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRobots(data, userAgent), nil
+}
+
+// getAll fetches pages in parallel, as far as the per-host limits allow,
+// and calls fn with each result as it arrives. Calls to fn don't overlap.
+func (c *crawler) getAll(urls []string, fn func(url string, body []byte, err error)) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+
+			body, err := c.get(u)
+
+			mu.Lock()
+			defer mu.Unlock()
+			fn(u, body, err)
+		}(u)
+	}
+
+	wg.Wait()
+}
+
+func (c *crawler) cachePath(rawURL string) string {
+	sum := sha1.Sum([]byte(rawURL))
+	return withSlash(c.cacheDir) + hex.EncodeToString(sum[:])
+}
+
+func (c *crawler) cached(rawURL string) ([]byte, bool) {
+	if c.cacheDir == "" {
+		return nil, false
+	}
+
+	path := c.cachePath(rawURL)
+	info, err := os.Stat(path)
+	if err != nil || (c.maxAge > 0 && time.Since(info.ModTime()) > c.maxAge) {
+		return nil, false
+	}
+
+	body, err := os.ReadFile(path)
+	return body, err == nil
+}
+
+// store caches a page, replacing it atomically so concurrent readers never
+// see half of it.
+func (c *crawler) store(rawURL string, body []byte) error {
+	if c.cacheDir == "" {
+		return nil
+	}
+
+	err := os.MkdirAll(c.cacheDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(c.cacheDir, "page-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.cachePath(rawURL))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
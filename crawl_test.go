@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pageServer serves /page/<n> and /missing, counting requests.
+func pageServer(t *testing.T) (*httptest.Server, func() int) {
+	t.Helper()
+
+	var mu sync.Mutex
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "page %s", r.URL.Path)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits
+	}
+}
+
+func TestCrawlerPoliteness(t *testing.T) {
+	ts, _ := pageServer(t)
+	c := newCrawler(1, 40*time.Millisecond, "")
+
+	urls := []string{ts.URL + "/page/1", ts.URL + "/page/2", ts.URL + "/page/3"}
+	start := time.Now()
+	got := 0
+	c.getAll(urls, func(u string, body []byte, err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		got++
+	})
+
+	if got != 3 {
+		t.Errorf("got %d pages, want 3", got)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("three requests to one host took %v, want at least two delays", elapsed)
+	}
+}
+
+func TestCrawlerCache(t *testing.T) {
+	ts, hits := pageServer(t)
+	c := newCrawler(2, 0, t.TempDir())
+
+	for i := 0; i < 2; i++ {
+		body, err := c.get(ts.URL + "/page/1")
+		if err != nil || string(body) != "page /page/1" {
+			t.Fatalf("get = %q, %v", body, err)
+		}
+	}
+	// One for robots.txt, one for the page.
+	if hits() != 2 {
+		t.Errorf("%d requests for a cached page, want 2", hits())
+	}
+
+	// Failures aren't cached.
+	for i := 0; i < 2; i++ {
+		if _, err := c.get(ts.URL + "/missing"); err == nil {
+			t.Error("404 page returned without an error")
+		}
+	}
+	if hits() != 4 {
+		t.Errorf("%d requests, want failed pages asked for again", hits())
+	}
+}
+
+func TestCrawlerRobots(t *testing.T) {
+	var agents []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private/\nCrawl-delay: 0.05\n")
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	c := newCrawler(1, 0, "")
+	if _, err := c.get(ts.URL + "/private/page"); err == nil {
+		t.Error("fetched a disallowed page")
+	}
+
+	start := time.Now()
+	for _, p := range []string{"/a", "/b"} {
+		if _, err := c.get(ts.URL + p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Crawl-delay ignored: two requests took %v", elapsed)
+	}
+
+	for _, a := range agents {
+		if a != userAgent {
+			t.Errorf("requested as %q", a)
+		}
+	}
+	if len(agents) != 3 {
+		t.Errorf("%d requests, want robots.txt and two pages", len(agents))
+	}
+}
+
+func TestRobotsRules(t *testing.T) {
+	txt := `# comment
+User-agent: Googlebot
+Disallow: /
+
+User-agent: *
+Disallow: /wiki/Special:
+Disallow: /*.php$
+
+User-agent: xkcd-db
+Allow: /wiki/Special:Random
+Disallow: /wiki/Special:
+Disallow: /api/*/raw
+`
+	r := parseRobots([]byte(txt), userAgent)
+
+	cases := map[string]bool{
+		"/wiki/1234":           true,
+		"/wiki/Special:Search": false,
+		"/wiki/Special:Random": true,
+		"/api/v1/raw":          false,
+		"/api/v1/rendered":     true,
+		"/index.php":           true,
+	}
+	for path, want := range cases {
+		if got := r.allowed(path); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	// Without a group of its own, the tool follows the one for everyone.
+	r = parseRobots([]byte("User-agent: *\nDisallow: /*.php$\n"), userAgent)
+	if r.allowed("/index.php") || !r.allowed("/index.php?x=1") {
+		t.Error("wildcard rules misapplied")
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// control steers a sync started with -control.
+func control(args []string) {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	addr := fs.String("connect", "", "The sync's -control-listen address; defaults to the socket in the database")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db ctl [flags] pause|resume|status")
+		fmt.Fprintln(fs.Output(), "       xkcd-db ctl [flags] fetch comic...")
+		fmt.Fprintln(fs.Output(), "fetch moves comics still waiting to the front of the queue.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || (fs.NArg() > 1 && fs.Arg(0) != "fetch") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *addr == "" {
+		*addr = "unix:" + withSlash(*dbPath) + controlSocket
+	}
+	c := controlClient(*addr)
+
+	switch fs.Arg(0) {
+	case "pause", "resume":
+		err := c.post(fs.Arg(0))
+		if err != nil {
+			log.Fatalln(err)
+		}
+	case "status":
+		st, err := c.status()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		printSyncStatus(st)
+	case "fetch":
+		nums, err := parseComics(fs.Args()[1:])
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(nums) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		for _, num := range nums {
+			err = c.fetch(num)
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// ctlClient talks to a sync's control channel. The host in its URLs is
+// ignored.
+type ctlClient struct {
+	*http.Client
+}
+
+func controlClient(addr string) ctlClient {
+	network, address := splitAddr(addr)
+
+	return ctlClient{&http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+	}}}
+}
+
+func (c ctlClient) post(cmd string) error {
+	resp, err := c.Post("http://sync/"+cmd, "", nil)
+	if err != nil {
+		return noSync(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.New(cmd + ": " + resp.Status)
+	}
+
+	return nil
+}
+
+// fetch asks the sync to fetch a comic next.
+func (c ctlClient) fetch(num int) error {
+	resp, err := c.Post("http://sync/fetch?comic="+strconv.Itoa(num), "", nil)
+	if err != nil {
+		return noSync(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.New("fetch: " + strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+func (c ctlClient) status() (syncStatus, error) {
+	var st syncStatus
+
+	resp, err := c.Get("http://sync/status")
+	if err != nil {
+		return st, noSync(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return st, errors.New("status: " + resp.Status)
+	}
+
+	return st, json.NewDecoder(resp.Body).Decode(&st)
+}
+
+// noSync explains the usual reason the socket can't be reached.
+func noSync(err error) error {
+	return fmt.Errorf("no sync with -control is running (%v)", err)
+}
+
+func printSyncStatus(st syncStatus) {
+	state := "Running"
+	if st.Paused {
+		state = "Paused"
+	}
+
+	fmt.Printf("%s: %d comics done, %d failed, %d parallel downloads\n", state, st.Done, st.Failed, st.Concurrency)
+	for _, a := range st.Active {
+		fmt.Printf("  #%s for %.1fs\n", a.Comic, a.Seconds)
+	}
+	for _, e := range st.Errors {
+		fmt.Println("! " + firstLine(e))
+	}
+}
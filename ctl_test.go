@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net"
+	"os"
+	"testing"
+)
+
+func TestControlSocket(t *testing.T) {
+	addr := "unix:" + withSlash(t.TempDir()) + controlSocket
+	ctl := newSyncControl(nil, 3)
+	ctl.acquire()
+	ctl.started("42")
+
+	stop, err := serveControl(addr, ctl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = serveControl(addr, ctl)
+	if err == nil {
+		t.Error("a second sync took over the control socket")
+	}
+
+	c := controlClient(addr)
+	err = c.post("pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := c.status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Paused || st.Concurrency != 3 || len(st.Active) != 1 || st.Active[0].Comic != "42" {
+		t.Errorf("status %+v", st)
+	}
+
+	err = c.post("resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := c.status(); st.Paused {
+		t.Error("still paused after resume")
+	}
+
+	stop()
+	if _, err := c.status(); err == nil {
+		t.Error("status answered after the sync ended")
+	}
+}
+
+func TestControlSocketStale(t *testing.T) {
+	path := withSlash(t.TempDir()) + controlSocket
+
+	// As if a crashed sync had left its socket behind.
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	stop, err := serveControl("unix:"+path, newSyncControl(nil, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop()
+}
+
+func TestListenKeepsFiles(t *testing.T) {
+	path := withSlash(t.TempDir()) + manifestFile
+	err := os.WriteFile(path, []byte("{}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l, err := listen("unix:" + path); err == nil {
+		l.Close()
+		t.Error("listened in place of a file")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "{}" {
+		t.Errorf("file removed or changed: %v", err)
+	}
+}
+
+func TestControlOverTCP(t *testing.T) {
+	l, err := listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	stop, err := serveControl(addr, newSyncControl(nil, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	st, err := controlClient(addr).status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Concurrency != 5 {
+		t.Errorf("status %+v", st)
+	}
+}
+
+func TestControlFetch(t *testing.T) {
+	addr := "unix:" + withSlash(t.TempDir()) + controlSocket
+	ctl := newSyncControl(nil, 1)
+	ctl.queue = newFetchQueue([]string{"1", "2", "3"})
+	first, _ := ctl.queue.pop()
+
+	stop, err := serveControl(addr, ctl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	c := controlClient(addr)
+	if err := c.fetch(3); err != nil {
+		t.Fatal(err)
+	}
+	for _, num := range []int{1, 9} {
+		if err := c.fetch(num); err == nil {
+			t.Errorf("fetch %d accepted, though it isn't waiting", num)
+		}
+	}
+
+	if got, want := first+" "+drain(ctl.queue), "1 3 2"; got != want {
+		t.Errorf("queue order %q, want %q", got, want)
+	}
+}
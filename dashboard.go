@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// How often the dashboard redraws, and how many redraws its throughput
+// graph spans.
+const (
+	dashboardTick    = 500 * time.Millisecond
+	dashboardHistory = 60
+)
+
+// Bars for the throughput graph, lowest first.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// dashboard draws a sync's progress over and over in place.
+type dashboard struct {
+	ctl   *syncControl
+	b     *budget
+	total int
+
+	// Bytes per second at each redraw, oldest first.
+	rates []float64
+	last  int64
+	// Lines drawn last time, to go back over.
+	lines int
+}
+
+// runDashboard redraws the progress of a sync of total comics on w until
+// the returned function is called, and reads commands from keys a line at
+// a time: p pauses, r resumes, + and - change the number of parallel
+// downloads.
+func runDashboard(w io.Writer, keys io.Reader, ctl *syncControl, b *budget, total int) func() {
+	d := &dashboard{ctl: ctl, b: b, total: total}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		t := time.NewTicker(dashboardTick)
+		defer t.Stop()
+
+		for {
+			d.draw(w)
+			select {
+			case <-t.C:
+			case <-done:
+				d.draw(w)
+				return
+			}
+		}
+	}()
+
+	// Reading stdin can't be interrupted; this goroutine ends with the
+	// process.
+	go func() {
+		sc := bufio.NewScanner(keys)
+		for sc.Scan() {
+			d.command(strings.TrimSpace(sc.Text()))
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (d *dashboard) command(cmd string) {
+	switch cmd {
+	case "p":
+		d.ctl.setPaused(true)
+	case "r":
+		d.ctl.setPaused(false)
+	case "+":
+		d.ctl.adjust(1)
+	case "-":
+		d.ctl.adjust(-1)
+	}
+}
+
+// draw replaces the previous frame with the current state.
+func (d *dashboard) draw(w io.Writer) {
+	used := atomic.LoadInt64(&d.b.used)
+	d.rates = append(d.rates, float64(used-d.last)/dashboardTick.Seconds())
+	if len(d.rates) > dashboardHistory {
+		d.rates = d.rates[1:]
+	}
+	d.last = used
+
+	var sb strings.Builder
+	if d.lines > 0 {
+		// Back to the top of the last frame, and clear it.
+		fmt.Fprintf(&sb, "\x1b[%dA\x1b[J", d.lines)
+	}
+
+	frame := d.frame(d.ctl.status())
+	sb.WriteString(frame)
+	d.lines = strings.Count(frame, "\n")
+
+	io.WriteString(w, sb.String())
+}
+
+// frame renders st as text, one item per line.
+func (d *dashboard) frame(st syncStatus) string {
+	var sb strings.Builder
+
+	state := "running"
+	if st.Paused {
+		state = "paused"
+	}
+	fmt.Fprintf(&sb, "Sync %s: %d of %d comics, %d failed, %d parallel downloads\n",
+		state, st.Done, d.total, st.Failed, st.Concurrency)
+
+	rate := 0.0
+	if len(d.rates) > 0 {
+		rate = d.rates[len(d.rates)-1]
+	}
+	fmt.Fprintf(&sb, "%s %s/s\n", sparkline(d.rates), formatBytes(int64(rate)))
+
+	for _, a := range st.Active {
+		fmt.Fprintf(&sb, "  #%s  %.1fs\n", a.Comic, a.Seconds)
+	}
+	for _, e := range st.Errors {
+		fmt.Fprintf(&sb, "! %s\n", firstLine(e))
+	}
+
+	sb.WriteString("p pause, r resume, + more, - fewer, then Enter\n")
+
+	return sb.String()
+}
+
+// sparkline draws values as bars scaled to the largest.
+func sparkline(values []float64) string {
+	peak := 0.0
+	for _, v := range values {
+		if v > peak {
+			peak = v
+		}
+	}
+
+	var sb strings.Builder
+	for _, v := range values {
+		i := 0
+		if peak > 0 {
+			i = int(v / peak * float64(len(sparks)-1))
+		}
+		sb.WriteRune(sparks[i])
+	}
+
+	return sb.String()
+}
+
+// formatBytes writes n in the largest binary unit that keeps it above 1.
+func formatBytes(n int64) string {
+	const units = "KMGT"
+
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	v, i := float64(n)/1024, 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", v, units[i])
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// digestDays is how far back a digest reaches.
+const digestDays = 7
+
+// weekDigest is a week of comics for the digest template.
+type weekDigest struct {
+	From, To string
+	Comics   []digestComic
+}
+
+type digestComic struct {
+	Num   int
+	Title string
+	Date  string
+	Alt   string
+	// xkcd's URL of the image, or the image itself as a data URI.
+	Src template.URL
+}
+
+// digest writes the week's comics as one HTML page, or a snippet to embed
+// in another page, that needs nothing but itself and, unless images are
+// inlined, xkcd's image server.
+func digest(args []string) {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	until := fs.String("until", "", "Last day of the week as YYYY-MM-DD instead of today")
+	inline := fs.Bool("inline", false, "Put the images in the page as data URIs")
+	snippet := fs.Bool("snippet", false, "Write an HTML fragment to embed instead of a whole page")
+	out := fs.String("o", "", "Write the digest to a file instead of stdout")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	to := time.Now()
+	if *until != "" {
+		var err error
+		to, err = time.Parse(dayLayout, *until)
+		if err != nil {
+			log.Fatalf("Invalid date %q, want YYYY-MM-DD\n", *until)
+		}
+	}
+
+	d, err := buildDigest(withSlash(*dbPath), to, *inline)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	name := "digest.html"
+	if *snippet {
+		name = "digest"
+	}
+
+	err = templates.ExecuteTemplate(w, name, d)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// buildDigest collects the comics published in the week ending on to.
+func buildDigest(dbPath string, to time.Time, inline bool) (*weekDigest, error) {
+	last := to.Format(dayLayout)
+	first := to.AddDate(0, 0, 1-digestDays).Format(dayLayout)
+
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &weekDigest{From: first, To: last}
+	for _, num := range nums {
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return nil, err
+		}
+
+		date := c.date()
+		if date == "" || date < first || date > last {
+			continue
+		}
+
+		dc := digestComic{Num: num, Title: c.Title, Date: date, Alt: c.Alt}
+		if strings.HasPrefix(c.Img, "https://") || strings.HasPrefix(c.Img, "http://") {
+			dc.Src = template.URL(c.Img)
+		}
+		if inline && c.ImgPath != "" {
+			err = c.fetchImage()
+			if err == nil {
+				dc.Src, err = dataURI(c.ImgPath)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		d.Comics = append(d.Comics, dc)
+	}
+
+	return d, nil
+}
+
+// dataURI inlines a file, typed by its content.
+func dataURI(path string) (template.URL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return template.URL(fmt.Sprintf("data:%s;base64,%s", http.DetectContentType(data), base64.StdEncoding.EncodeToString(data))), nil
+}
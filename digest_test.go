@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestDigest(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Comic 1 is dated 2007-02-02, the others years later.
+	d, err := buildDigest(db, time.Date(2007, 2, 5, 0, 0, 0, 0, time.UTC), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.From != "2007-01-30" || d.To != "2007-02-05" {
+		t.Errorf("week is %s to %s", d.From, d.To)
+	}
+	if len(d.Comics) != 1 || d.Comics[0].Num != 1 {
+		t.Fatalf("got %+v", d.Comics)
+	}
+	if !strings.HasPrefix(string(d.Comics[0].Src), "data:image/png;base64,") {
+		t.Errorf("image not inlined: %.40s", d.Comics[0].Src)
+	}
+
+	var buf bytes.Buffer
+	err = templates.ExecuteTemplate(&buf, "digest", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippet := buf.String()
+	if strings.Contains(snippet, "<html") || !strings.Contains(snippet, `<img src="data:image/png;base64,`) {
+		t.Errorf("bad snippet:\n%s", snippet)
+	}
+
+	d, err = buildDigest(db, time.Date(2007, 2, 5, 0, 0, 0, 0, time.UTC), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src := string(d.Comics[0].Src); !strings.HasSuffix(src, "/comics/comic_1.png") {
+		t.Errorf("image links to %s", src)
+	}
+}
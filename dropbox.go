@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Client IDs of the cloud drives, set for releases with -ldflags -X.
+// XKCDDB_GDRIVE_CLIENT_ID, XKCDDB_GDRIVE_CLIENT_SECRET and
+// XKCDDB_DROPBOX_CLIENT_ID override them.
+var (
+	gdriveClientID     string
+	gdriveClientSecret string
+	dropboxClientID    string
+)
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+// Images larger than this are uploaded in chunks, so a failed one
+// doesn't start over.
+var cloudChunk int64 = 8 << 20
+
+// Tests point these at a fake server.
+var (
+	dropboxAPI     = "https://api.dropboxapi.com/2/"
+	dropboxContent = "https://content.dropboxapi.com/2/"
+	dropboxAuth    = "https://www.dropbox.com/oauth2/authorize?token_access_type=offline"
+	dropboxToken   = "https://api.dropboxapi.com/oauth2/token"
+)
+
+// dropboxStore keeps a mirror in a Dropbox folder.
+type dropboxStore struct {
+	dir  string
+	auth *oauthProvider
+}
+
+func newDropbox(dir string) *dropboxStore {
+	return &dropboxStore{
+		dir: "/" + strings.Trim(dir, "/"),
+		auth: &oauthProvider{
+			name:     "dropbox",
+			clientID: envOr("XKCDDB_DROPBOX_CLIENT_ID", dropboxClientID),
+			authURL:  dropboxAuth,
+			tokenURL: dropboxToken,
+		},
+	}
+}
+
+func (s *dropboxStore) String() string {
+	return "dropbox:/" + s.dir
+}
+
+// call sends an API request. Arguments go in the body of RPC calls and in
+// a header of content calls, whose body is data.
+func (s *dropboxStore) call(endpoint string, arg interface{}, data []byte, content bool) (*http.Response, error) {
+	argJSON, err := json.Marshal(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.auth.bearer(func() (*http.Request, error) {
+		if !content {
+			req, err := http.NewRequest("POST", dropboxAPI+endpoint, bytes.NewReader(argJSON))
+			if err == nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			return req, err
+		}
+
+		req, err := http.NewRequest("POST", dropboxContent+endpoint, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Dropbox-API-Arg", asciiJSON(argJSON))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+}
+
+// asciiJSON escapes what HTTP headers can't carry.
+func asciiJSON(data []byte) string {
+	var b strings.Builder
+	for _, r := range string(data) {
+		if r < 0x80 {
+			b.WriteRune(r)
+		} else if r > 0xffff {
+			r -= 0x10000
+			fmt.Fprintf(&b, `\u%04x\u%04x`, 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+		} else {
+			fmt.Fprintf(&b, `\u%04x`, r)
+		}
+	}
+
+	return b.String()
+}
+
+// dropboxError reads the error of a failed call.
+func dropboxError(endpoint string, resp *http.Response) error {
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("dropbox %s: %s: %s", endpoint, resp.Status, bytes.TrimSpace(body))
+}
+
+func (s *dropboxStore) do(endpoint string, arg interface{}, data []byte, content bool, v interface{}) error {
+	resp, err := s.call(endpoint, arg, data, content)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return dropboxError(endpoint, resp)
+	}
+	defer resp.Body.Close()
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// put uploads files whole, or large ones in an upload session. Dropbox
+// only shows a file once its upload is finished.
+func (s *dropboxStore) put(dbPath string, paths []string) (int, error) {
+	for i, rel := range paths {
+		err := s.putFile(dbPath, rel)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(paths), nil
+}
+
+func (s *dropboxStore) putFile(dbPath, rel string) error {
+	data, err := os.ReadFile(dbPath + rel)
+	if err != nil {
+		return err
+	}
+	commit := map[string]interface{}{"path": path.Join(s.dir, rel), "mode": "overwrite", "mute": true}
+
+	if int64(len(data)) <= cloudChunk {
+		return s.do("files/upload", commit, data, true, nil)
+	}
+
+	var session struct {
+		ID string `json:"session_id"`
+	}
+	err = s.do("files/upload_session/start", map[string]interface{}{}, data[:cloudChunk], true, &session)
+	if err != nil {
+		return err
+	}
+
+	offset := cloudChunk
+	for ; int64(len(data))-offset > cloudChunk; offset += cloudChunk {
+		cursor := map[string]interface{}{"session_id": session.ID, "offset": offset}
+		err = s.do("files/upload_session/append_v2", map[string]interface{}{"cursor": cursor}, data[offset:offset+cloudChunk], true, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	cursor := map[string]interface{}{"session_id": session.ID, "offset": offset}
+	return s.do("files/upload_session/finish", map[string]interface{}{"cursor": cursor, "commit": commit}, data[offset:], true, nil)
+}
+
+func (s *dropboxStore) get(rel string) (io.ReadCloser, error) {
+	p := path.Join(s.dir, rel)
+	resp, err := s.call("files/download", map[string]string{"path": p}, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusConflict {
+		resp.Body.Close()
+		return nil, fmt.Errorf("dropbox:/%s: %w", p, errRemoteNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, dropboxError("files/download", resp)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *dropboxStore) remove(paths []string) error {
+	for _, rel := range paths {
+		resp, err := s.call("files/delete_v2", map[string]string{"path": path.Join(s.dir, rel)}, nil, false)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusOK {
+			resp.Body.Close()
+			continue
+		}
+
+		err = dropboxError("files/delete_v2", resp)
+		// Gone already, or deleted with its folder.
+		if resp.StatusCode != http.StatusConflict || !strings.Contains(err.Error(), "not_found") {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+// How hard xkcd-db works to get writes onto the disk before going on.
+// Every fsync costs a lot on SD cards and network mounts, so the choice
+// trades speed for what survives a power cut:
+//
+//   - file syncs every comic file before the journal marks the comic
+//     complete, and every journal record. Nothing finished is lost, but
+//     each comic costs several fsyncs.
+//   - batch syncs the journal once every -fsync-batch records and leaves
+//     comic files to the operating system. With the default batch of 1
+//     each comic costs two fsyncs. A larger batch can lose the last
+//     records; the comics they covered are downloaded again.
+//   - never leaves everything to the operating system. A power cut may
+//     corrupt the manifest; remove it and run fsck -reconcile.
+//
+// A crash of xkcd-db alone, rather than the machine, loses nothing under
+// any of them.
+const (
+	fsyncFile  = "file"
+	fsyncBatch = "batch"
+	fsyncNever = "never"
+)
+
+var (
+	fsyncPolicy    = fsyncBatch
+	fsyncBatchSize = 1
+)
+
+// fsyncFlag checks -fsync against the policies it knows.
+type fsyncFlag struct{}
+
+func (fsyncFlag) String() string { return fsyncBatch }
+
+func (fsyncFlag) Set(s string) error {
+	switch s {
+	case fsyncFile, fsyncBatch, fsyncNever:
+		fsyncPolicy = s
+		return nil
+	}
+
+	return errors.New("must be file, batch or never")
+}
+
+// fsyncBatchFlag sets how many journal records share an fsync.
+type fsyncBatchFlag struct{}
+
+func (fsyncBatchFlag) String() string { return "1" }
+
+func (fsyncBatchFlag) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if n < 1 {
+		return errors.New("must be at least 1")
+	}
+	fsyncBatchSize = n
+
+	return nil
+}
+
+// journalBatched reports whether journal records may be lost in a power
+// cut, so recovery can't trust the journal to name every comic begun.
+func journalBatched() bool {
+	return fsyncPolicy == fsyncNever || fsyncPolicy == fsyncBatch && fsyncBatchSize > 1
+}
+
+// syncComicFile waits for a file of a comic to reach the disk, if the
+// policy says to.
+func syncComicFile(f *os.File) error {
+	if err := injectedDiskFull(f.Name()); err != nil {
+		return err
+	}
+	if fsyncPolicy != fsyncFile {
+		return nil
+	}
+
+	return f.Sync()
+}
+
+// writeComicFile is os.WriteFile for the files of a comic, following the
+// fsync policy.
+func writeComicFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = syncComicFile(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
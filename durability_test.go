@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func withFsync(t *testing.T, policy string, batch int) {
+	t.Helper()
+
+	oldPolicy, oldBatch := fsyncPolicy, fsyncBatchSize
+	fsyncPolicy, fsyncBatchSize = policy, batch
+	t.Cleanup(func() { fsyncPolicy, fsyncBatchSize = oldPolicy, oldBatch })
+}
+
+func TestFsyncFlags(t *testing.T) {
+	withFsync(t, fsyncBatch, 1)
+
+	if (fsyncFlag{}).Set("sometimes") == nil {
+		t.Error("an unknown policy was accepted")
+	}
+	if (fsyncBatchFlag{}).Set("0") == nil {
+		t.Error("a batch of 0 was accepted")
+	}
+	if err := (fsyncFlag{}).Set(fsyncNever); err != nil || fsyncPolicy != fsyncNever {
+		t.Errorf("-fsync never: policy %q, error %v", fsyncPolicy, err)
+	}
+}
+
+func TestSyncEachPolicy(t *testing.T) {
+	for _, policy := range []string{fsyncFile, fsyncBatch, fsyncNever} {
+		t.Run(policy, func(t *testing.T) {
+			startFake(t, fakexkcd.Corpus(4))
+			withFsync(t, policy, 3)
+			db := tempDB(t)
+
+			res, err := syncDB(db, syncOptions{rateLimit: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.added) != 4 {
+				t.Errorf("added %v", res.added)
+			}
+			if _, err := os.Stat(db + journalFile); !os.IsNotExist(err) {
+				t.Errorf("journal left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestBatchedJournalRecovery(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	withFsync(t, fsyncBatch, 10)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A run dies while writing comic 9, and its unsynced records are lost
+	// with the power.
+	m, unlock, err := recoverManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.begin(9); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(db+"9", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db+"9/9-alt", []byte("half"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.journal.Close()
+	unlock()
+
+	journal := readFile(t, db+journalFile)
+	first := journal[:bytes.IndexByte(journal, '\n')+1]
+	if !bytes.Contains(first, []byte(`"batched"`)) {
+		t.Fatalf("journal starts with %s", first)
+	}
+	if err := os.WriteFile(db+journalFile, first, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, unlock, err = recoverManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if _, err := os.Stat(db + "9"); !os.IsNotExist(err) {
+		t.Errorf("half written comic 9 kept: %v", err)
+	}
+	stored, err := storedComics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(stored, []int{1, 2, 3}) || len(m.Comics) != 3 {
+		t.Errorf("stored %v with %d in the manifest, want 1 to 3", stored, len(m.Comics))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Pre-processing for e-ink exports. It only ever works on decoded copies;
+// the stored originals are left alone.
+type einkOptions struct {
+	rotate string
+	fit    string
+	gray   bool
+	dither bool
+	levels int
+}
+
+func einkFlags(fs *flag.FlagSet) *einkOptions {
+	opts := &einkOptions{}
+	fs.StringVar(&opts.rotate, "rotate", "auto", "Rotation: 0, 90, 180, 270 or auto to turn wide comics sideways")
+	fs.StringVar(&opts.fit, "fit", "contain", "Sizing: contain fits the page, width fills the page width, none keeps the original size")
+	fs.BoolVar(&opts.gray, "gray", true, "Convert to grayscale")
+	fs.BoolVar(&opts.dither, "dither", false, "Dither to the panel's gray levels")
+	fs.IntVar(&opts.levels, "levels", 16, "Number of gray levels the panel can show")
+
+	return opts
+}
+
+func (o *einkOptions) validate() error {
+	switch o.rotate {
+	case "0", "90", "180", "270", "auto":
+	default:
+		return errors.New("invalid rotation: " + o.rotate)
+	}
+
+	switch o.fit {
+	case "contain", "width", "none":
+	default:
+		return errors.New("invalid fit: " + o.fit)
+	}
+
+	if o.levels < 2 || o.levels > 256 {
+		return errors.New("gray levels must be between 2 and 256")
+	}
+
+	return nil
+}
+
+// prepare turns a comic into a page for dev.
+func (o *einkOptions) prepare(img image.Image, dev device) image.Image {
+	b := img.Bounds()
+
+	var out image.Image = flatten(img)
+	switch o.rotate {
+	case "90":
+		out = rotate90(out)
+	case "180":
+		out = rotate90(rotate90(out))
+	case "270":
+		out = rotate90(rotate90(rotate90(out)))
+	case "auto":
+		// Wide comics use more of a portrait panel when turned sideways.
+		if b.Dx() > b.Dy() {
+			out = rotate90(out)
+		}
+	}
+
+	switch o.fit {
+	case "contain":
+		out = fitImage(out, dev.width, dev.height)
+	case "width":
+		w, h := out.Bounds().Dx(), out.Bounds().Dy()
+		out = fitImage(out, dev.width, h*dev.width/w)
+	}
+
+	if o.dither {
+		return ditherGray(out, o.levels)
+	}
+	if o.gray {
+		return grayscale(out)
+	}
+
+	return out
+}
+
+// rotate90 turns an image clockwise by a quarter turn.
+func rotate90(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dy(), b.Dx()))
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dst.Set(b.Max.Y-1-y, x-b.Min.X, img.At(x, y))
+		}
+	}
+
+	return dst
+}
+
+// ditherGray reduces img to evenly spaced gray levels with Floyd-Steinberg
+// error diffusion, which hides banding on panels with few shades.
+func ditherGray(img image.Image, levels int) *image.Gray {
+	palette := make(color.Palette, levels)
+	for i := range palette {
+		palette[i] = color.Gray{uint8(i * 255 / (levels - 1))}
+	}
+
+	b := img.Bounds()
+	pal := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette)
+	draw.FloydSteinberg.Draw(pal, pal.Bounds(), grayscale(img), image.Point{})
+
+	return grayscale(pal)
+}
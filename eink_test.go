@@ -0,0 +1,92 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGrayscale(t *testing.T) {
+	img := image.NewRGBA(image.Rect(5, 5, 9, 6))
+	img.Set(5, 5, color.RGBA{0xff, 0, 0, 0xff})
+	img.Set(6, 5, color.RGBA{0, 0xff, 0, 0xff})
+	img.Set(7, 5, color.RGBA{0, 0, 0xff, 0xff})
+	img.Set(8, 5, color.White)
+
+	g := grayscale(img)
+	if g.Bounds() != image.Rect(0, 0, 4, 1) {
+		t.Fatalf("bounds %v", g.Bounds())
+	}
+	// Luma weights green most and blue least.
+	for x, want := range []uint8{76, 150, 29, 0xff} {
+		if got := g.GrayAt(x, 0).Y; got != want {
+			t.Errorf("pixel %d is %d, want %d", x, got, want)
+		}
+	}
+}
+
+func TestRotate90(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.Black)
+	img.Set(2, 1, color.White)
+
+	out := rotate90(img)
+	if out.Bounds() != image.Rect(0, 0, 2, 3) {
+		t.Fatalf("bounds %v", out.Bounds())
+	}
+	// Clockwise: the top left corner goes top right, the bottom right
+	// bottom left.
+	if out.RGBAAt(1, 0) != (color.RGBA{0, 0, 0, 0xff}) || out.RGBAAt(0, 2) != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("corners %v and %v", out.RGBAAt(1, 0), out.RGBAAt(0, 2))
+	}
+
+	full := rotate90(rotate90(rotate90(rotate90(img))))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			if full.RGBAAt(x, y) != img.RGBAAt(x, y) {
+				t.Fatalf("four turns moved (%d, %d)", x, y)
+			}
+		}
+	}
+}
+
+func TestDitherGray(t *testing.T) {
+	mid := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range mid.Pix {
+		mid.Pix[i] = 128
+	}
+
+	for _, levels := range []int{2, 4} {
+		out := ditherGray(mid, levels)
+		step := 255 / (levels - 1)
+
+		sum := 0
+		for _, v := range out.Pix {
+			if int(v)%step != 0 {
+				t.Fatalf("%d levels: pixel value %d", levels, v)
+			}
+			sum += int(v)
+		}
+		// Error diffusion keeps the overall tone.
+		if mean := sum / len(out.Pix); mean < 118 || mean > 138 {
+			t.Errorf("%d levels: mean %d, want about 128", levels, mean)
+		}
+	}
+}
+
+func TestPrepareRotatesWideComics(t *testing.T) {
+	dev := device{30, 40}
+	o := &einkOptions{rotate: "auto", fit: "none", gray: true, levels: 16}
+
+	if b := o.prepare(image.NewRGBA(image.Rect(0, 0, 20, 10)), dev).Bounds(); b.Dx() != 10 || b.Dy() != 20 {
+		t.Errorf("wide comic came out %v", b)
+	}
+	if b := o.prepare(image.NewRGBA(image.Rect(0, 0, 10, 20)), dev).Bounds(); b.Dx() != 10 || b.Dy() != 20 {
+		t.Errorf("tall comic came out %v", b)
+	}
+
+	o.fit = "contain"
+	if b := o.prepare(image.NewRGBA(image.Rect(0, 0, 20, 10)), dev).Bounds(); b.Dx() != 30 || b.Dy() != 40 {
+		t.Errorf("contained comic came out %v", b)
+	}
+}
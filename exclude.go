@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// excludeFile lists comics the database must not hold, e.g. for a
+// curated deployment.
+const excludeFile = "excluded.json"
+
+// exclusion is why and when a comic was excluded.
+type exclusion struct {
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+	// The trash run holding what was removed, if the comic was stored.
+	Trash string `json:"trash,omitempty"`
+}
+
+// exclude keeps comics out of the database.
+func exclude(args []string) {
+	fs := flag.NewFlagSet("exclude", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	reason := fs.String("reason", "", "Why the comics are excluded, shown by exclude list")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db exclude [flags] comic|first-last ...|list|undo comic|first-last ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	// Flags may follow the comics too.
+	var rest []string
+	for fs.NArg() > 0 {
+		rest = append(rest, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+	if len(rest) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	*dbPath = withSlash(*dbPath)
+
+	// A sync must not download the comics while they are excluded, nor
+	// another run change the exclusions under this one.
+	if rest[0] != "list" {
+		err := os.MkdirAll(*dbPath, 0755)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		unlock, err := lockDB(*dbPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer unlock()
+	}
+
+	ex, err := loadExclusions(*dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch rest[0] {
+	case "list":
+		if len(rest) != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		t := newTable("num", "excluded", "reason")
+		for _, num := range ex.nums() {
+			e := ex[num]
+			t.add(strconv.Itoa(num), e.Time.Local().Format("2006-01-02 15:04"), e.Reason)
+		}
+		err = (&tableOptions{}).print(os.Stdout, t)
+	case "undo":
+		var nums []int
+		nums, err = parseComics(rest[1:])
+		if err != nil || len(nums) == 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		a := startAudit(*dbPath, "exclude", args)
+		n := 0
+		for _, num := range nums {
+			if _, ok := ex[num]; ok {
+				delete(ex, num)
+				n++
+			}
+		}
+		err = ex.save(*dbPath)
+		if err == nil {
+			outcome := fmt.Sprintf("%d comics no longer excluded; the next sync downloads them", n)
+			fmt.Println(outcome)
+			a.end(outcome)
+		}
+	default:
+		var nums []int
+		nums, err = parseComics(rest)
+		if err != nil {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		if stored := len(storedPaths(*dbPath, nums)); stored > 0 && !confirm(fmt.Sprintf("Exclude %d comics, moving %d stored ones to the trash?", len(nums), stored)) {
+			os.Exit(1)
+		}
+
+		a := startAudit(*dbPath, "exclude", args)
+		var removed int
+		removed, err = excludeComics(*dbPath, ex, nums, *reason)
+		if err == nil {
+			outcome := fmt.Sprintf("Excluded %d comics, moving %d stored ones to the trash", len(nums), removed)
+			fmt.Println(outcome)
+			a.end(outcome)
+		}
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// exclusions are the excluded comics of a database by number.
+type exclusions map[int]exclusion
+
+func loadExclusions(dbPath string) (exclusions, error) {
+	ex := make(exclusions)
+
+	data, err := os.ReadFile(dbPath + excludeFile)
+	if os.IsNotExist(err) {
+		return ex, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &ex)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dbPath+excludeFile, err)
+	}
+
+	return ex, nil
+}
+
+func (ex exclusions) save(dbPath string) error {
+	data, err := json.MarshalIndent(ex, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dbPath+excludeFile, data, 0644)
+}
+
+func (ex exclusions) nums() []int {
+	nums := make([]int, 0, len(ex))
+	for num := range ex {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	return nums
+}
+
+// excludeComics records nums as excluded and moves those stored to the
+// trash, returning how many were stored. Callers asking first should hold
+// the database's lock from before they ask, and load ex under it.
+func excludeComics(dbPath string, ex exclusions, nums []int, reason string) (int, error) {
+	err := os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := lockDB(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	paths := storedPaths(dbPath, nums)
+	id := ""
+	if len(paths) > 0 {
+		id, err = moveToTrash(dbPath, paths)
+		if err != nil {
+			return 0, err
+		}
+
+		// The manifest forgets them.
+		_, err = fsckDB(dbPath, true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, num := range nums {
+		ex[num] = exclusion{Reason: reason, Time: now, Trash: id}
+	}
+
+	return len(paths), ex.save(dbPath)
+}
+
+// storedPaths returns the directories of the comics of nums that are
+// stored.
+func storedPaths(dbPath string, nums []int) []string {
+	var paths []string
+	for _, num := range nums {
+		p := dbPath + strconv.Itoa(num)
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+	}
+
+	return paths
+}
+
+// withoutExcluded drops excluded comics from a download list.
+func withoutExcluded(items []string, ex exclusions) []string {
+	if len(ex) == 0 {
+		return items
+	}
+
+	kept := items[:0]
+	for _, item := range items {
+		num, _ := strconv.Atoi(item)
+		if _, ok := ex[num]; !ok {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept
+}
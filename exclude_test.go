@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestExcludeComics(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex, err := loadExclusions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := excludeComics(db, ex, []int{2, 4}, "not for class")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d comics", removed)
+	}
+	if _, err := os.Stat(db + "2"); !os.IsNotExist(err) {
+		t.Error("comic 2 is still stored")
+	}
+
+	// Later syncs leave excluded comics alone, even new ones.
+	srv.Add(fakexkcd.Corpus(4)[3])
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted != 0 {
+		t.Errorf("sync downloaded %v", res.added)
+	}
+	if _, err := ensureComic(db, 2); err == nil || !strings.Contains(err.Error(), "not for class") {
+		t.Errorf("fetching an excluded comic: %v", err)
+	}
+
+	ex, err = loadExclusions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(ex.nums(), []int{2, 4}) || ex[2].Trash == "" {
+		t.Errorf("exclusions %+v", ex)
+	}
+
+	delete(ex, 2)
+	err = ex.save(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(res.added, []int{2}) {
+		t.Errorf("after undo, sync added %v", res.added)
+	}
+}
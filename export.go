@@ -0,0 +1,480 @@
+package main
+
+import (
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// exportsFile records when each destination was last exported to.
+const exportsFile = "exports.json"
+
+// An exporter writes comics into a destination directory in some format.
+type exporter interface {
+	add(c exportComic) error
+	close() error
+}
+
+// exportFormats build an exporter for a destination directory, which
+// exists and ends with a slash.
+var exportFormats = map[string]func(dest string, opts exportOptions) (exporter, error){
+	"anki":     newAnkiExporter,
+	"json":     newJSONExporter,
+	"mp4":      newMP4Exporter,
+	"obsidian": presetExporter("obsidian.md.tmpl"),
+	"template": newTemplateExporter,
+}
+
+// Built in templates, e.g. one Markdown note per comic for an Obsidian or
+// Logseq vault.
+//
+//go:embed presets
+var presetFiles embed.FS
+
+// exportFuncs are available in every export template.
+var exportFuncs = template.FuncMap{
+	// quote makes a string safe inside YAML frontmatter or JSON.
+	"quote": func(s string) string {
+		b, _ := json.Marshal(s)
+		return string(b)
+	},
+}
+
+type exportOptions struct {
+	format string
+	// Path of the Go template for the template format.
+	template string
+	// Skip comics unchanged since the last export to the destination.
+	sinceLast bool
+	// How long the mp4 format shows each comic.
+	secondsPerComic int
+	// Add a placeholder for xkcd's missing comic 404.
+	with404 bool
+	// Split the export into volumes named like DVD-{n} of at most
+	// maxSize bytes, as databases rather than in a format.
+	mediaSet string
+	maxSize  byteSize
+	// Export original images rather than normalized copies.
+	originals bool
+}
+
+// exportComic is what exporters, and so export templates, see of a comic.
+type exportComic struct {
+	Comic
+	// Publication date as YYYY-MM-DD, empty if unknown.
+	Date string
+	// Where the image is in the database, and its file name in the
+	// export. Both are empty for comics without an image.
+	ImgPath string
+	Image   string
+	// From the manifest; zero if unknown.
+	Width  int
+	Height int
+	Panels int
+}
+
+// export writes stored comics out in a format other tools can use.
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	dest := fs.String("o", "", "Directory to export into")
+	var opts exportOptions
+	fs.StringVar(&opts.format, "format", "json", "Export format: "+strings.Join(exportFormatNames(), ", "))
+	fs.StringVar(&opts.template, "template", "", "Go template to render each comic with; implies -format template")
+	fs.BoolVar(&opts.sinceLast, "since-last", false, "Only export comics added or changed since the last export to the same directory")
+	fs.IntVar(&opts.secondsPerComic, "seconds-per-comic", 8, "How long the mp4 format shows each comic")
+	fs.BoolVar(&opts.with404, "with-404", false, "Add a placeholder for xkcd's comic 404, which only ever was a 404 Not Found page")
+	fs.StringVar(&opts.mediaSet, "media-set", "", "Split the archive into volumes for removable media, named like 'DVD-{n}', each with a catalog of all; browse them with media")
+	fs.Var(&opts.maxSize, "max-size", "How much a volume of -media-set holds, e.g. 4.3GB")
+	fs.BoolVar(&opts.originals, "originals", false, "Export the original images even where analyze -normalize made display copies")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db export [flags] -o dir [comics]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *dest == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	nums, err := parseComics(fs.Args())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if opts.mediaSet != "" {
+		vols, err := exportMedia(withSlash(*dbPath), *dest, nums, opts.mediaSet, int64(opts.maxSize))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, v := range vols {
+			fmt.Printf("%s: comics %d-%d, %s\n", v.Name, v.First, v.Last, formatBytes(v.Size))
+		}
+		fmt.Printf("Exported %d volumes to %s\n", len(vols), *dest)
+		return
+	}
+
+	if opts.template != "" {
+		opts.format = "template"
+	}
+
+	n, err := exportComics(withSlash(*dbPath), *dest, nums, opts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("Exported %d comics to %s\n", n, *dest)
+}
+
+func exportFormatNames() []string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// exportComics exports nums, or every stored comic if nums is empty, and
+// returns how many were written. Images are copied next to whatever the
+// format writes. With sinceLast, comics that haven't changed since the
+// last export in the same format to dest are skipped.
+func exportComics(dbPath, dest string, nums []int, opts exportOptions) (int, error) {
+	newExporter, ok := exportFormats[opts.format]
+	if !ok {
+		return 0, errors.New("unknown export format: " + opts.format)
+	}
+
+	// A sync may be writing to the database meanwhile.
+	snap, done, err := snapshotDB(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	if len(nums) == 0 {
+		nums, err = storedComics(snap)
+		if err != nil {
+			return 0, err
+		}
+		if opts.with404 {
+			nums = with404(snap, nums)
+		}
+	}
+
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return 0, err
+	}
+	key := opts.format + " " + abs
+
+	marks, err := loadExportMarks(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	m, err := loadManifest(snap)
+	if err != nil {
+		return 0, err
+	}
+
+	// Taken before reading anything, so comics changed during the export
+	// go out again next time.
+	start := time.Now()
+
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	dest = withSlash(dest)
+	e, err := newExporter(dest, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, num := range nums {
+		if num == 404 && opts.with404 && is404Joke(snap) {
+			// It never changes, so one export is enough.
+			if _, ok := marks[key]; ok && opts.sinceLast {
+				continue
+			}
+			err = e.add(exportComic{Comic: comic404, Date: comic404.date()})
+			if err != nil {
+				e.close()
+				return n, err
+			}
+			n++
+			continue
+		}
+
+		if last, ok := marks[key]; ok && opts.sinceLast {
+			changed, err := comicModTime(snap, num)
+			if err != nil {
+				e.close()
+				return n, err
+			}
+			if !changed.After(last) {
+				continue
+			}
+		}
+
+		c, err := readComic(snap, num)
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("comic %d is not mirrored", num)
+		}
+		if err == nil {
+			if !opts.originals {
+				c.ImgPath = displayImage(snap, num, c.ImgPath)
+			}
+			err = exportOne(e, c, m, dest)
+		}
+		if err != nil {
+			e.close()
+			return n, err
+		}
+		n++
+	}
+
+	err = e.close()
+	if err != nil {
+		return n, err
+	}
+
+	marks[key] = start
+	return n, saveExportMarks(dbPath, marks)
+}
+
+// exportOne hands c to e, copying its image into dest first unless e
+// renders images into its own output.
+func exportOne(e exporter, c localComic, m *manifest, dest string) error {
+	err := c.fetchImage()
+	if err != nil {
+		return err
+	}
+	ec := exportComic{Comic: c.Comic, Date: c.date(), ImgPath: c.ImgPath}
+
+	if entry, ok := m.Comics[c.Num]; ok {
+		ec.Width, ec.Height, ec.Panels = entry.Width, entry.Height, len(entry.Panels)
+	}
+
+	if _, ok := e.(interface{ rendersImages() }); ok {
+		return e.add(ec)
+	}
+
+	if c.ImgPath != "" {
+		ec.Image = strconv.Itoa(c.Num) + filepath.Ext(c.ImgPath)
+		err := copyFile(c.ImgPath, dest+ec.Image)
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.add(ec)
+}
+
+// comicModTime is when any file of a stored comic last changed.
+func comicModTime(dbPath string, num int) (time.Time, error) {
+	var latest time.Time
+
+	entries, err := os.ReadDir(dbPath + strconv.Itoa(num))
+	if err != nil {
+		return latest, err
+	}
+
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+func loadExportMarks(dbPath string) (map[string]time.Time, error) {
+	marks := make(map[string]time.Time)
+
+	data, err := os.ReadFile(dbPath + exportsFile)
+	if os.IsNotExist(err) {
+		return marks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return marks, json.Unmarshal(data, &marks)
+}
+
+func saveExportMarks(dbPath string, marks map[string]time.Time) error {
+	data, err := json.MarshalIndent(marks, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dbPath+exportsFile, data, 0644)
+}
+
+// jsonExporter writes each comic's metadata as <num>.json.
+type jsonExporter struct {
+	dest string
+}
+
+func newJSONExporter(dest string, opts exportOptions) (exporter, error) {
+	return &jsonExporter{dest: dest}, nil
+}
+
+func (e *jsonExporter) add(c exportComic) error {
+	data, err := json.MarshalIndent(c.Comic, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(e.dest+strconv.Itoa(c.Num)+".json", data, 0644)
+}
+
+func (e *jsonExporter) close() error { return nil }
+
+// templateExporter renders each comic with a user's Go template into
+// <num><ext>. The extension comes from the template's name with .tmpl
+// dropped, so hugo.md.tmpl writes Markdown; it defaults to .txt.
+type templateExporter struct {
+	dest string
+	ext  string
+	tmpl *template.Template
+}
+
+func newTemplateExporter(dest string, opts exportOptions) (exporter, error) {
+	if opts.template == "" {
+		return nil, errors.New("the template format needs -template")
+	}
+
+	name := filepath.Base(opts.template)
+	tmpl, err := template.New(name).Funcs(exportFuncs).ParseFiles(opts.template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &templateExporter{dest: dest, ext: templateExt(name), tmpl: tmpl}, nil
+}
+
+// presetExporter renders comics with one of the built in templates.
+func presetExporter(name string) func(string, exportOptions) (exporter, error) {
+	return func(dest string, opts exportOptions) (exporter, error) {
+		tmpl, err := template.New(name).Funcs(exportFuncs).ParseFS(presetFiles, "presets/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		return &templateExporter{dest: dest, ext: templateExt(name), tmpl: tmpl}, nil
+	}
+}
+
+func templateExt(name string) string {
+	ext := filepath.Ext(strings.TrimSuffix(name, ".tmpl"))
+	if ext == "" {
+		return ".txt"
+	}
+
+	return ext
+}
+
+func (e *templateExporter) add(c exportComic) error {
+	f, err := os.Create(e.dest + strconv.Itoa(c.Num) + e.ext)
+	if err != nil {
+		return err
+	}
+
+	err = e.tmpl.Execute(f, c)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (e *templateExporter) close() error { return nil }
+
+// ankiExporter writes a deck of image-to-alt-text cards as anki.csv, in
+// Anki's text import format. The images it refers to go into Anki's
+// collection.media folder.
+type ankiExporter struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func newAnkiExporter(dest string, opts exportOptions) (exporter, error) {
+	f, err := os.Create(dest + "anki.csv")
+	if err != nil {
+		return nil, err
+	}
+
+	// Import settings Anki reads from the file itself.
+	_, err = io.WriteString(f, "#separator:Comma\n#html:true\n#tags column:3\n")
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &ankiExporter{f: f, w: csv.NewWriter(f)}, nil
+}
+
+func (e *ankiExporter) add(c exportComic) error {
+	front := fmt.Sprintf("#%d", c.Num)
+	if c.Image != "" {
+		front = fmt.Sprintf(`<img src="%s">`, html.EscapeString(c.Image))
+	}
+	back := fmt.Sprintf("<b>%d: %s</b><br>%s", c.Num, html.EscapeString(c.Title), html.EscapeString(c.Alt))
+
+	return e.w.Write([]string{front, back, "xkcd"})
+}
+
+func (e *ankiExporter) close() error {
+	e.w.Flush()
+	err := e.w.Error()
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestExportJSON(t *testing.T) {
+	comics := fakexkcd.Corpus(3)
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := withSlash(t.TempDir())
+	n, err := exportComics(db, out, nil, exportOptions{format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("exported %d comics, want 3", n)
+	}
+
+	var c Comic
+	err = json.Unmarshal(readFile(t, out+"2.json"), &c)
+	if err != nil || c.Title != "Comic 2" || c.Alt != comics[1].Alt {
+		t.Errorf("2.json: %v, %+v", err, c)
+	}
+	if !bytes.Equal(readFile(t, out+"2.png"), comics[1].Image) {
+		t.Error("image not copied")
+	}
+}
+
+func TestExportSinceLast(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	if n, err := exportComics(db, out, nil, exportOptions{format: "json", sinceLast: true}); err != nil || n != 3 {
+		t.Fatalf("first export: %d comics, %v", n, err)
+	}
+	if n, err := exportComics(db, out, nil, exportOptions{format: "json", sinceLast: true}); err != nil || n != 0 {
+		t.Fatalf("repeated export: %d comics, %v", n, err)
+	}
+
+	// A new comic and an edited one.
+	srv.Add(fakexkcd.Corpus(4)[3])
+	_, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(db+"1/1-alt", later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := exportComics(db, out, nil, exportOptions{format: "json", sinceLast: true}); err != nil || n != 2 {
+		t.Errorf("incremental export: %d comics, %v; want 2", n, err)
+	}
+
+	// Watermarks are kept per destination.
+	if n, err := exportComics(db, t.TempDir(), nil, exportOptions{format: "json", sinceLast: true}); err != nil || n != 4 {
+		t.Errorf("export to a new directory: %d comics, %v; want 4", n, err)
+	}
+}
+
+func TestExportTemplate(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(2))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := t.TempDir() + "/hugo.md.tmpl"
+	err = os.WriteFile(tmpl, []byte("# {{.Title}}\ndate: {{.Date}}\n![]({{.Image}} \"{{.Alt}}\") {{.Width}}x{{.Height}}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := withSlash(t.TempDir())
+	_, err = exportComics(db, out, nil, exportOptions{format: "template", template: tmpl})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# Comic 2\ndate: 2008-03-03\n![](2.png \"Alt text 2\") 8x4\n"
+	if got := string(readFile(t, out+"2.md")); got != want {
+		t.Errorf("2.md = %q, want %q", got, want)
+	}
+}
+
+func TestExportObsidian(t *testing.T) {
+	comics := fakexkcd.Corpus(2)
+	comics[1].Title = `Say "hi"`
+	comics[1].Transcript = ""
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := withSlash(t.TempDir())
+	_, err = exportComics(db, out, nil, exportOptions{format: "obsidian"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `---
+title: "Say \"hi\""
+num: 2
+date: 2008-03-03
+url: https://xkcd.com/2/
+tags: [xkcd]
+---
+
+# 2: Say "hi"
+
+![[2.png]]
+
+> Alt text 2
+`
+	if got := string(readFile(t, out+"2.md")); got != want {
+		t.Errorf("2.md = %q, want %q", got, want)
+	}
+	if got := string(readFile(t, out+"1.md")); !strings.Contains(got, "## Transcript\n\nTranscript 1\n") {
+		t.Errorf("1.md has no transcript:\n%s", got)
+	}
+}
+
+func TestExportAnki(t *testing.T) {
+	comics := fakexkcd.Corpus(2)
+	comics[0].Alt = `a, "quoted" <alt>`
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := withSlash(t.TempDir())
+	n, err := exportComics(db, out, nil, exportOptions{format: "anki"})
+	if err != nil || n != 2 {
+		t.Fatalf("exported %d comics, %v", n, err)
+	}
+
+	want := "#separator:Comma\n#html:true\n#tags column:3\n" +
+		`"<img src=""1.png"">","<b>1: Comic 1</b><br>a, &#34;quoted&#34; &lt;alt&gt;",xkcd` + "\n" +
+		`"<img src=""2.png"">",<b>2: Comic 2</b><br>Alt text 2,xkcd` + "\n"
+	if got := string(readFile(t, out+"anki.csv")); got != want {
+		t.Errorf("anki.csv = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// expr is a compiled filter over a comic's fields, such as
+//
+//	year > 2015 && len(transcript) == 0
+//	contains(lower(title), "physics") || contains(tags, "science")
+//
+// Values are numbers, strings, booleans and lists of strings. There are
+// the usual comparisons, && || and !, + - * / % on numbers, + on strings,
+// and the functions in exprFuncs. The variables are those of comicVars.
+type expr struct {
+	src  string
+	root exprNode
+}
+
+type exprNode interface {
+	eval(env map[string]interface{}) (interface{}, error)
+}
+
+// comicVars are what expressions can say about a comic.
+var comicVars = map[string]func(c localComic, lc listComic) interface{}{
+	"num":        func(c localComic, lc listComic) interface{} { return float64(c.Num) },
+	"title":      func(c localComic, lc listComic) interface{} { return c.Title },
+	"alt":        func(c localComic, lc listComic) interface{} { return c.Alt },
+	"transcript": func(c localComic, lc listComic) interface{} { return c.Transcript },
+	"year":       func(c localComic, lc listComic) interface{} { return atof(c.Year) },
+	"month":      func(c localComic, lc listComic) interface{} { return atof(c.Month) },
+	"day":        func(c localComic, lc listComic) interface{} { return atof(c.Day) },
+	"date":       func(c localComic, lc listComic) interface{} { return lc.Date },
+	"image":      func(c localComic, lc listComic) interface{} { return lc.Image },
+	"size":       func(c localComic, lc listComic) interface{} { return float64(lc.Size) },
+	"width":      func(c localComic, lc listComic) interface{} { return float64(lc.Width) },
+	"height":     func(c localComic, lc listComic) interface{} { return float64(lc.Height) },
+	"special":    func(c localComic, lc listComic) interface{} { return lc.Special },
+	// False until analyzed.
+	"color": func(c localComic, lc listComic) interface{} { return lc.Color != nil && *lc.Color },
+	"tags": func(c localComic, lc listComic) interface{} {
+		return append([]string{}, c.tags...)
+	},
+}
+
+func comicVarNames() []string {
+	names := make([]string, 0, len(comicVars))
+	for name := range comicVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// atof reads a number field, taking missing ones as 0.
+func atof(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// comicEnv is the variables of a comic.
+func comicEnv(c localComic, lc listComic) map[string]interface{} {
+	env := make(map[string]interface{}, len(comicVars))
+	for name, v := range comicVars {
+		env[name] = v(c, lc)
+	}
+
+	return env
+}
+
+// exprFuncs are the functions expressions can call. Arguments have been
+// checked against the count given.
+var exprFuncs = map[string]struct {
+	args int
+	call func(args []interface{}) (interface{}, error)
+}{
+	"len": {1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return float64(len(v)), nil
+		case []string:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("len of %s", typeName(args[0]))
+	}},
+	// contains finds a substring in a string, or a string in a list.
+	"contains": {2, func(args []interface{}) (interface{}, error) {
+		sub, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("contains wants a string to look for, not %s", typeName(args[1]))
+		}
+		switch v := args[0].(type) {
+		case string:
+			return strings.Contains(v, sub), nil
+		case []string:
+			for _, s := range v {
+				if s == sub {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return nil, fmt.Errorf("contains in %s", typeName(args[0]))
+	}},
+	"lower": {1, func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("lower of %s", typeName(args[0]))
+		}
+		return strings.ToLower(s), nil
+	}},
+	// matches is replaced by a matchNode when its pattern is compiled.
+	"matches": {2, nil},
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case []string:
+		return "a list"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+// parseExpr compiles an expression, rejecting unknown variables and
+// functions before any comic is looked at.
+func parseExpr(src string) (*expr, error) {
+	p := &exprParser{src: src}
+	err := p.lex()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := p.or()
+	if err == nil && p.pos < len(p.toks) {
+		err = p.errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &expr{src, root}, nil
+}
+
+func (e *expr) String() string { return e.src }
+
+// test evaluates an expression that must come out true or false.
+func (e *expr) test(env map[string]interface{}) (bool, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", e.src, err)
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s: is %s, not true or false", e.src, typeName(v))
+	}
+
+	return b, nil
+}
+
+// exprFlag is a flag holding an expression, compiled as it is set.
+type exprFlag struct{ e *expr }
+
+func (f *exprFlag) String() string {
+	if f.e == nil {
+		return ""
+	}
+	return f.e.src
+}
+
+func (f *exprFlag) Set(s string) error {
+	e, err := parseExpr(s)
+	if err != nil {
+		return err
+	}
+	f.e = e
+
+	return nil
+}
+
+type exprToken struct {
+	kind byte // 'n'umber, 's'tring, 'i'dentifier or 'o'perator
+	text string
+	num  float64
+	pos  int
+}
+
+type exprParser struct {
+	src  string
+	toks []exprToken
+	pos  int
+}
+
+var exprOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","}
+
+func (p *exprParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("bad number %q at %d", s[i:j], i+1)
+			}
+			p.toks = append(p.toks, exprToken{'n', s[i:j], n, i})
+			i = j
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j == len(s) {
+				return fmt.Errorf("unterminated string at %d", i+1)
+			}
+			p.toks = append(p.toks, exprToken{'s', b.String(), 0, i})
+			i = j + 1
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			p.toks = append(p.toks, exprToken{'i', s[i:j], 0, i})
+			i = j
+		default:
+			op := ""
+			for _, o := range exprOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("unexpected %q at %d", c, i+1)
+			}
+			p.toks = append(p.toks, exprToken{'o', op, 0, i})
+			i += len(op)
+		}
+	}
+
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	at := len(p.src)
+	if p.pos < len(p.toks) {
+		at = p.toks[p.pos].pos
+	}
+
+	return fmt.Errorf("%s at %d", fmt.Sprintf(format, args...), at+1)
+}
+
+// accept consumes the next token if it is one of the operators.
+func (p *exprParser) accept(ops ...string) string {
+	if p.pos == len(p.toks) || p.toks[p.pos].kind != 'o' {
+		return ""
+	}
+	for _, op := range ops {
+		if p.toks[p.pos].text == op {
+			p.pos++
+			return op
+		}
+	}
+
+	return ""
+}
+
+func (p *exprParser) or() (exprNode, error) {
+	return p.binary(p.and, "||")
+}
+
+func (p *exprParser) and() (exprNode, error) {
+	return p.binary(p.comparison, "&&")
+}
+
+func (p *exprParser) comparison() (exprNode, error) {
+	return p.binary(p.sum, "==", "!=", "<=", ">=", "<", ">")
+}
+
+func (p *exprParser) sum() (exprNode, error) {
+	return p.binary(p.product, "+", "-")
+}
+
+func (p *exprParser) product() (exprNode, error) {
+	return p.binary(p.unary, "*", "/", "%")
+}
+
+// binary parses operands joined by left-associative operators.
+func (p *exprParser) binary(operand func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.accept(ops...)
+		if op == "" {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op, left, right}
+	}
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if op := p.accept("!", "-"); op != "" {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op, x}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	if p.pos == len(p.toks) {
+		return nil, p.errorf("expression ends early")
+	}
+	if p.accept("(") != "" {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.accept(")") == "" {
+			return nil, p.errorf("missing )")
+		}
+		return x, nil
+	}
+
+	t := p.toks[p.pos]
+	switch t.kind {
+	case 'n':
+		p.pos++
+		return literalNode{t.num}, nil
+	case 's':
+		p.pos++
+		return literalNode{t.text}, nil
+	case 'i':
+		switch t.text {
+		case "true", "false":
+			p.pos++
+			return literalNode{t.text == "true"}, nil
+		}
+		if p.pos+1 < len(p.toks) && p.toks[p.pos+1].text == "(" {
+			return p.call()
+		}
+		if _, ok := comicVars[t.text]; !ok {
+			return nil, p.errorf("unknown variable %s", t.text)
+		}
+		p.pos++
+		return varNode(t.text), nil
+	}
+
+	return nil, p.errorf("unexpected %q", t.text)
+}
+
+func (p *exprParser) call() (exprNode, error) {
+	name := p.toks[p.pos].text
+	f, ok := exprFuncs[name]
+	if !ok {
+		return nil, p.errorf("unknown function %s", name)
+	}
+	p.pos += 2
+
+	var args []exprNode
+	for p.accept(")") == "" {
+		if len(args) > 0 && p.accept(",") == "" {
+			return nil, p.errorf("missing , or ) in call of %s", name)
+		}
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, x)
+	}
+	if len(args) != f.args {
+		return nil, fmt.Errorf("%s takes %d arguments, not %d", name, f.args, len(args))
+	}
+
+	if name == "matches" {
+		pattern, ok := args[1].(literalNode)
+		if s, isString := pattern.v.(string); ok && isString {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("matches: %v", err)
+			}
+			return &matchNode{args[0], re}, nil
+		}
+		return nil, errors.New("matches wants a quoted pattern")
+	}
+
+	return &callNode{name, args}, nil
+}
+
+type literalNode struct{ v interface{} }
+
+func (n literalNode) eval(env map[string]interface{}) (interface{}, error) { return n.v, nil }
+
+type varNode string
+
+func (n varNode) eval(env map[string]interface{}) (interface{}, error) { return env[string(n)], nil }
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (n *unaryNode) eval(env map[string]interface{}) (interface{}, error) {
+	v, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := v.(type) {
+	case bool:
+		if n.op == "!" {
+			return !v, nil
+		}
+	case float64:
+		if n.op == "-" {
+			return -v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s of %s", n.op, typeName(v))
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(env map[string]interface{}) (interface{}, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || only look as far as they need to.
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s of %s", n.op, typeName(l))
+		}
+		if lb == (n.op == "||") {
+			return lb, nil
+		}
+		r, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := r.(bool); !ok {
+			return nil, fmt.Errorf("%s of %s", n.op, typeName(r))
+		}
+		return r, nil
+	}
+
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			return arith(n.op, l, r)
+		}
+	case string:
+		if r, ok := r.(string); ok {
+			if n.op == "+" {
+				return l + r, nil
+			}
+			return compare(n.op, strings.Compare(l, r))
+		}
+	case bool:
+		if r, ok := r.(bool); ok && (n.op == "==" || n.op == "!=") {
+			return (l == r) == (n.op == "=="), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s %s %s", typeName(l), n.op, typeName(r))
+}
+
+func arith(op string, l, r float64) (interface{}, error) {
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/", "%":
+		if r == 0 {
+			return nil, errors.New("division by zero")
+		}
+		if op == "%" {
+			return float64(int64(l) % int64(r)), nil
+		}
+		return l / r, nil
+	}
+
+	cmp := 0
+	if l < r {
+		cmp = -1
+	} else if l > r {
+		cmp = 1
+	}
+
+	return compare(op, cmp)
+}
+
+// compare turns the result of comparing two values into the comparison's.
+func compare(op string, cmp int) (interface{}, error) {
+	switch op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+
+	return nil, fmt.Errorf("%s of strings", op)
+}
+
+type callNode struct {
+	name string
+	args []exprNode
+}
+
+func (n *callNode) eval(env map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	return exprFuncs[n.name].call(args)
+}
+
+type matchNode struct {
+	x  exprNode
+	re *regexp.Regexp
+}
+
+func (n *matchNode) eval(env map[string]interface{}) (interface{}, error) {
+	v, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("matches of %s", typeName(v))
+	}
+
+	return n.re.MatchString(s), nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	c := localComic{Comic: Comic{Num: 1234, Title: "Physics", Year: "2016", Transcript: ""}}
+	c.tags = []string{"science"}
+	env := comicEnv(c, listComic{Size: 2048})
+
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"year > 2015 && len(transcript) == 0", true},
+		{"year > 2015 && !(len(transcript) == 0)", false},
+		{`contains(lower(title), "phys") || num < 0`, true},
+		{`contains(tags, "science") && !contains(tags, "sci")`, true},
+		{`matches(title, "^P.*s$")`, true},
+		{"num % 2 == 0 && size / 1024 == 2", true},
+		{"-num + 1 < 0 == true", true},
+		{`title + "!" == 'Physics!'`, true},
+		{"special || color", false},
+		// Later operands aren't evaluated once the answer is known.
+		{"false && 1 / 0 == 1", false},
+	}
+	for _, tt := range tests {
+		e, err := parseExpr(tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		got, err := e.test(env)
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %v, %v; want %v", tt.src, got, err, tt.want)
+		}
+	}
+
+	for _, src := range []string{"", "year >", "yaer > 2015", "nope(1)", "len(1, 2)", `"open`, "(1", "1 1", "matches(title, title)"} {
+		if _, err := parseExpr(src); err == nil {
+			t.Errorf("%q compiled", src)
+		}
+	}
+	for _, src := range []string{"year", "title > 1", "1 / 0 == 1", "len(year) == 1"} {
+		e, err := parseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.test(env); err == nil {
+			t.Errorf("%q evaluated", src)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// extraParts is what xkcd attaches to interactive and oversized comics,
+// whose image alone doesn't show the whole thing. The fields hold HTML
+// snippets from xkcd.com's page.
+type extraParts struct {
+	Pre         string `json:"pre,omitempty"`
+	Post        string `json:"post,omitempty"`
+	HeaderExtra string `json:"headerextra,omitempty"`
+	ImgAttr     string `json:"imgAttr,omitempty"`
+	Links       string `json:"links,omitempty"`
+}
+
+// special reports whether the stored image is only part of the comic.
+func (c Comic) special() bool {
+	return c.ExtraParts != nil
+}
+
+// fullLink is where the whole comic can be seen: the page extra_parts
+// links to, like the large version of "Click and Drag", or the comic's
+// page on xkcd.com.
+func (c Comic) fullLink() string {
+	if c.ExtraParts != nil {
+		link := c.ExtraParts.Links
+		if strings.HasPrefix(link, "/") {
+			return "https://xkcd.com" + link
+		}
+		if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
+			return link
+		}
+	}
+
+	return "https://xkcd.com/" + strconv.Itoa(c.Num) + "/"
+}
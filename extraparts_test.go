@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestExtraParts(t *testing.T) {
+	comics := fakexkcd.Corpus(3)
+	comics[1].Extra = map[string]interface{}{
+		"extra_parts": map[string]string{"links": "/2/large/", "post": "<map></map>"},
+	}
+	ts, db := testServer(t, comics)
+
+	c, err := readComic(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.special() || c.ExtraParts.Post != "<map></map>" {
+		t.Fatalf("extra_parts not parsed: %+v", c.ExtraParts)
+	}
+	if got, want := c.fullLink(), "https://xkcd.com/2/large/"; got != want {
+		t.Errorf("fullLink = %q, want %q", got, want)
+	}
+
+	var out strings.Builder
+	printComicTo(&out, c)
+	if !strings.Contains(out.String(), "Interactive:") {
+		t.Errorf("show doesn't flag the comic:\n%s", out.String())
+	}
+
+	_, body := get(t, ts.URL+"/api/comic/2")
+	var p pageComic
+	json.Unmarshal(body, &p)
+	if p.ExtraParts == nil || p.FullLink == "" {
+		t.Errorf("api lacks extra_parts: %s", body)
+	}
+
+	_, body = get(t, ts.URL+"/comic/2")
+	if !bytes.Contains(body, []byte(`href="https://xkcd.com/2/large/"`)) {
+		t.Error("comic page doesn't link to the full comic")
+	}
+	if _, body = get(t, ts.URL+"/comic/1"); bytes.Contains(body, []byte(`id="special"`)) {
+		t.Error("ordinary comic flagged as special")
+	}
+}
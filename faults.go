@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Fault injection for resilience testing. XKCDDB_FAULT holds comma
+// separated kind:probability pairs, e.g. "timeout:0.05,corrupt:0.01".
+// Faults are drawn from the shared rng, so -seed or XKCDDB_FAULT_SEED make
+// them repeatable. Besides faultKinds of the network, diskfull fails
+// writes of comic files as a full disk would.
+var faultKinds = []string{"timeout", "5xx", "truncate", "corrupt"}
+
+// diskFullRate is the probability of the diskfull fault.
+var diskFullRate float64
+
+// injectedDiskFull fails a write to path, if the diskfull fault says to.
+func injectedDiskFull(path string) error {
+	if diskFullRate > 0 && rng.Float64() < diskFullRate {
+		return &os.PathError{Op: "write", Path: path, Err: errDiskFull}
+	}
+
+	return nil
+}
+
+type faultTransport struct {
+	next  http.RoundTripper
+	rates map[string]float64
+}
+
+// faultTimeout mimics a network timeout.
+type faultTimeout struct{}
+
+func (faultTimeout) Error() string   { return "injected fault: timeout" }
+func (faultTimeout) Timeout() bool   { return true }
+func (faultTimeout) Temporary() bool { return true }
+
+func parseFaults(spec string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+
+	for _, pair := range strings.Split(spec, ",") {
+		kind, rate, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, errors.New("fault spec needs kind:probability, got " + pair)
+		}
+
+		known := kind == "diskfull"
+		for _, k := range faultKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, errors.New("unknown fault kind: " + kind)
+		}
+
+		p, err := strconv.ParseFloat(rate, 64)
+		if err != nil || p < 0 || p > 1 {
+			return nil, fmt.Errorf("fault probability for %s must be between 0 and 1", kind)
+		}
+		rates[kind] = p
+	}
+
+	return rates, nil
+}
+
+// roll picks at most one fault for a request.
+func (t *faultTransport) roll() string {
+	for _, kind := range faultKinds {
+		if rng.Float64() < t.rates[kind] {
+			return kind
+		}
+	}
+
+	return ""
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fault := t.roll()
+
+	switch fault {
+	case "timeout":
+		return nil, faultTimeout{}
+	case "5xx":
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       io.NopCloser(strings.NewReader("injected fault: 5xx")),
+			Request:    req,
+		}, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || fault == "" {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) > 0 {
+		switch fault {
+		case "truncate":
+			resp.Body = io.NopCloser(io.MultiReader(
+				bytes.NewReader(body[:rng.Intn(len(body))]),
+				errReader{io.ErrUnexpectedEOF},
+			))
+			return resp, nil
+		case "corrupt":
+			body[rng.Intn(len(body))] ^= 0xff
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// injectFaults wraps the shared client according to spec.
+func injectFaults(spec, seed string) error {
+	rates, err := parseFaults(spec)
+	if err != nil {
+		return err
+	}
+
+	if seed != "" {
+		s, err := strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return errors.New("invalid fault seed: " + seed)
+		}
+		rng.Seed(s)
+	}
+
+	diskFullRate = rates["diskfull"]
+	tracked.next = &faultTransport{next: http.DefaultTransport, rates: rates}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func faultClient(t *testing.T, kind string) (*http.Client, *fakexkcd.Server) {
+	t.Helper()
+
+	srv := fakexkcd.New(fakexkcd.Corpus(1)...)
+	t.Cleanup(srv.Close)
+
+	rates := map[string]float64{kind: 1}
+	return &http.Client{Transport: &faultTransport{next: http.DefaultTransport, rates: rates}}, srv
+}
+
+func TestFaultTimeout(t *testing.T) {
+	c, srv := faultClient(t, "timeout")
+
+	_, err := c.Get(srv.URL + "/1/info.0.json")
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if srv.Hits("/1/info.0.json") != 0 {
+		t.Error("timed out request reached the server")
+	}
+}
+
+func TestFault5xx(t *testing.T) {
+	c, srv := faultClient(t, "5xx")
+
+	resp, err := c.Get(srv.URL + "/1/info.0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestFaultTruncate(t *testing.T) {
+	c, srv := faultClient(t, "truncate")
+
+	resp, err := c.Get(srv.URL + "/comics/comic_1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	_, err = io.ReadAll(resp.Body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want unexpected EOF", err)
+	}
+}
+
+func TestFaultCorrupt(t *testing.T) {
+	c, srv := faultClient(t, "corrupt")
+
+	resp, err := c.Get(srv.URL + "/comics/comic_1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := fakexkcd.Image(1)
+	if len(body) != len(want) || bytes.Equal(body, want) {
+		t.Error("body was not corrupted in place")
+	}
+}
+
+func TestParseFaults(t *testing.T) {
+	rates, err := parseFaults("timeout:0.05, corrupt:0.01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["timeout"] != 0.05 || rates["corrupt"] != 0.01 {
+		t.Errorf("rates = %v", rates)
+	}
+
+	for _, spec := range []string{"timeout", "slow:0.1", "5xx:2", "truncate:x"} {
+		if _, err := parseFaults(spec); err == nil {
+			t.Errorf("parseFaults(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestSeedRepeatsFaults(t *testing.T) {
+	ft := &faultTransport{rates: map[string]float64{"timeout": 0.3, "5xx": 0.3}}
+
+	rolls := func() []string {
+		rng.Seed(42)
+		out := make([]string, 50)
+		for i := range out {
+			out[i] = ft.roll()
+		}
+		return out
+	}
+
+	a, b := rolls(), rolls()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("roll %d differs: %q vs %q", i, a[i], b[i])
+		}
+	}
+}
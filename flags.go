@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+)
+
+// offlineFlag switches offline mode on as soon as it is parsed.
+type offlineFlag struct{}
+
+func (offlineFlag) IsBoolFlag() bool { return true }
+func (offlineFlag) String() string   { return "false" }
+
+func (offlineFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if on {
+		setOffline()
+	}
+
+	return nil
+}
+
+// seedFlag reseeds the shared rng as soon as it is parsed.
+type seedFlag struct{}
+
+func (seedFlag) String() string { return "0" }
+
+func (seedFlag) Set(s string) error {
+	seed, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	rng.Seed(seed)
+
+	return nil
+}
+
+// addGlobalFlags registers the flags every command accepts.
+func addGlobalFlags(fs *flag.FlagSet) {
+	fs.Var(offlineFlag{}, "offline", "Never touch the network; commands that need it fail")
+	fs.Var(seedFlag{}, "seed", "Seed all randomized behaviour so runs can be reproduced")
+	fs.BoolVar(&assumeYes, "yes", false, "Don't ask before destructive operations")
+	// Where a command's own -force means something else, only -yes will do.
+	if fs.Lookup("force") == nil {
+		fs.BoolVar(&assumeYes, "force", false, "Same as -yes")
+	}
+	fs.Var(langFlag{}, "lang", "Language for messages, e.g. de or fr; defaults to the locale")
+	fs.Var(colorFlag{}, "color", "Colour output: never, auto or always. Auto respects NO_COLOR")
+	fs.BoolVar(&useEmoji, "emoji", false, "Mark statuses with emoji")
+	fs.Var(verbosityFlag(quiet), "q", "Only print errors and results")
+	fs.Var(verbosityFlag(verbose), "v", "Print what happens to each comic")
+	fs.Var(verbosityFlag(veryVerbose), "vv", "Print every request as well")
+	fs.Var(fsyncFlag{}, "fsync", "When to wait for writes to reach the disk: file, batch or never. Faster is less safe in a power cut")
+	fs.Var(fsyncBatchFlag{}, "fsync-batch", "With -fsync batch, how many journal records share one fsync")
+	fs.Var(themeFlag{}, "theme", "Colour theme from the config file for the web UI and statuses")
+	fs.Var(variantFlag{}, "theme-variant", "Theme variant: light, dark or auto")
+}
+
+// optBool is a boolean flag that can also be left unset, for filters
+// where false and "don't care" differ.
+type optBool struct {
+	set, val bool
+}
+
+func (b *optBool) IsBoolFlag() bool { return true }
+
+func (b *optBool) String() string {
+	if b == nil || !b.set {
+		return ""
+	}
+
+	return strconv.FormatBool(b.val)
+}
+
+func (b *optBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	b.set, b.val = err == nil, v
+
+	return err
+}
+
+// is reports whether v passes the filter.
+func (b *optBool) is(v bool) bool {
+	return !b.set || b.val == v
+}
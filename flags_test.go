@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"testing"
+)
+
+// TestCommandFlags asks every command, and sync, for its usage, which
+// builds its flags: a flag defined twice panics.
+func TestCommandFlags(t *testing.T) {
+	if name := os.Getenv("XKCDDB_TEST_COMMAND"); name != "" {
+		if name == "sync" {
+			os.Args = []string{"xkcd-db", "-h"}
+			main()
+		} else {
+			commands[name]([]string{"-h"})
+		}
+		return
+	}
+
+	names := []string{"sync"}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestCommandFlags$")
+		cmd.Env = append(os.Environ(), "XKCDDB_TEST_COMMAND="+name, "HOME="+t.TempDir())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Errorf("%s -h: %v\n%s", name, err, out)
+		}
+	}
+}
+
+func TestForceMeansYes(t *testing.T) {
+	defer func() { assumeYes = false }()
+
+	fs := flag.NewFlagSet("trash", flag.ContinueOnError)
+	addGlobalFlags(fs)
+	if err := fs.Parse([]string{"-force"}); err != nil || !assumeYes {
+		t.Errorf("-force didn't mean -yes: %v", err)
+	}
+
+	// analyze's -force is its own.
+	assumeYes = false
+	fs = flag.NewFlagSet("analyze", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	force := fs.Bool("force", false, "")
+	addGlobalFlags(fs)
+	if err := fs.Parse([]string{"-force"}); err != nil || !*force || assumeYes {
+		t.Errorf("analyze -force: err %v, force %v, yes %v", err, *force, assumeYes)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// fsckProblem is something the manifest and the files disagree on.
+type fsckProblem struct {
+	// Zero for problems with the whole database.
+	Num     int
+	Problem string
+	Fixed   bool
+}
+
+func (p fsckProblem) String() string {
+	s := p.Problem
+	if p.Num != 0 {
+		s = fmt.Sprintf("#%d: %s", p.Num, s)
+	}
+	if p.Fixed {
+		s += " (fixed)"
+	}
+
+	return s
+}
+
+// fsck checks the manifest against the comics on disk.
+func fsck(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	reconcile := fs.Bool("reconcile", false, "Bring the manifest in line with the files")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+	var a *audit
+	if *reconcile {
+		a = startAudit(*dbPath, "fsck", args)
+	}
+
+	problems, err := fsckDB(*dbPath, *reconcile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if a != nil {
+		a.end(fmt.Sprintf("Found %d problems", len(problems)))
+	}
+
+	left := 0
+	for _, p := range problems {
+		if p.Fixed {
+			fmt.Println(paint(os.Stdout, good, p.String()))
+			continue
+		}
+		fmt.Println(paint(os.Stdout, bad, p.String()))
+		left++
+	}
+
+	switch {
+	case len(problems) == 0:
+		fmt.Println(paint(os.Stdout, good, tr("No problems found")))
+	case left > 0:
+		fmt.Println(paint(os.Stdout, bad, fmt.Sprintf(tr("%d problems left"), left)))
+		os.Exit(1)
+	}
+}
+
+// fsckDB lists where the manifest and the files disagree: comics stored
+// but not indexed, indexed but gone, or whose image changed or vanished
+// since it was measured; and comic directories holding nothing. With
+// reconcile the manifest is fixed to match the files; the files are never
+// touched.
+func fsckDB(dbPath string, reconcile bool) ([]fsckProblem, error) {
+	var m *manifest
+	var err error
+	if reconcile {
+		var unlock func()
+		m, unlock, err = recoverManifest(dbPath)
+		if err == nil {
+			defer unlock()
+		}
+	} else {
+		m, err = loadManifest(dbPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	h, err := loadHybrid(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []fsckProblem
+	found := func(num int, problem string, fixable bool) {
+		problems = append(problems, fsckProblem{num, problem, fixable && reconcile})
+	}
+
+	if !reconcile {
+		if _, err := os.Stat(dbPath + journalFile); err == nil {
+			found(0, "an interrupted run left a journal to replay", false)
+		}
+	}
+
+	// What reconciling adds to and drops from the manifest, for the
+	// change log.
+	var appeared, gone []int
+
+	stored := make(map[int]bool)
+	for _, num := range nums {
+		stored[num] = true
+
+		if empty, err := emptyDir(dbPath + strconv.Itoa(num)); err != nil {
+			return nil, err
+		} else if empty {
+			found(num, "orphaned directory with no files", false)
+			continue
+		}
+
+		e, ok := m.Comics[num]
+		if !ok {
+			found(num, "stored but not in the manifest", true)
+			appeared = append(appeared, num)
+			continue
+		}
+
+		path, err := comicImagePath(dbPath, num)
+		if err != nil {
+			// Offloaded images are kept remotely.
+			if e.Format != "" && (h == nil || !h.offloaded(dbPath, num)) {
+				found(num, "image is gone", true)
+				if reconcile {
+					m.Comics[num] = &manifestEntry{}
+				}
+			}
+			continue
+		}
+		if e.Format == "" {
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg, format, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil || cfg.Width != e.Width || cfg.Height != e.Height || format != e.Format {
+			found(num, "image changed since it was measured", true)
+			if reconcile {
+				// Measured again by index.
+				m.Comics[num] = &manifestEntry{ETag: e.ETag}
+			}
+		}
+	}
+
+	for num := range m.Comics {
+		if !stored[num] {
+			found(num, "in the manifest but not stored", true)
+			if reconcile {
+				delete(m.Comics, num)
+				gone = append(gone, num)
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Num < problems[j].Num })
+
+	if !reconcile {
+		return problems, nil
+	}
+
+	err = updateManifest(dbPath, m)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Ints(gone)
+	for _, num := range appeared {
+		err = recordChange(dbPath, "added", num)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, num := range gone {
+		err = recordChange(dbPath, "removed", num)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return problems, nil
+}
+
+func emptyDir(path string) (bool, error) {
+	entries, err := os.ReadDir(path)
+	return len(entries) == 0, err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestFsckReconcile(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(5))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(m.Comics, 1)
+	m.Comics[77] = &manifestEntry{Width: 1, Height: 1, Format: "png"}
+	m.Comics[3].Width = 999
+	if err := m.save(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(db + "2/comic_2.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(db+"50", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"#1: stored but not in the manifest",
+		"#2: image is gone",
+		"#3: image changed since it was measured",
+		"#50: orphaned directory with no files",
+		"#77: in the manifest but not stored",
+	}
+
+	problems, err := fsckDB(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("got %v, want %v", problems, want)
+	}
+	for i, p := range problems {
+		if p.String() != want[i] {
+			t.Errorf("problem %d: %q, want %q", i, p, want[i])
+		}
+	}
+
+	problems, err = fsckDB(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range problems {
+		if !p.Fixed && p.Num != 50 {
+			t.Errorf("not fixed: %v", p)
+		}
+	}
+
+	problems, err = fsckDB(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Num != 50 {
+		t.Errorf("after reconciling: %v", problems)
+	}
+}
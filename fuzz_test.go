@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Serve mode exposes these parsers to the network, and sync to whatever
+// the server sends, so none of them may panic or run away on bad input.
+
+func FuzzParseComic(f *testing.F) {
+	f.Add([]byte(`{"num":1,"title":"Barrel - Part 1","img":"https://imgs.xkcd.com/comics/barrel_cropped_(1).jpg"}`))
+	f.Add([]byte(`{"num":1110,"extra_parts":{"links":"/1110/large/","post":"<map></map>"}}`))
+	f.Add([]byte(`{"num":"1"}`))
+	f.Add([]byte(`null`))
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		c, err := parseComic(raw)
+		if err != nil {
+			return
+		}
+
+		// Whatever parses must be storable.
+		if _, err := json.Marshal(c); err != nil {
+			t.Error(err)
+		}
+		c.fullLink()
+	})
+}
+
+func FuzzParseComics(f *testing.F) {
+	f.Add("327")
+	f.Add("1000-1005")
+	f.Add("-5")
+	f.Add("1-9999999999")
+
+	f.Fuzz(func(t *testing.T, arg string) {
+		nums, err := parseComics([]string{arg})
+		if err == nil && len(nums) > maxComicRange {
+			t.Errorf("%q gave %d comics", arg, len(nums))
+		}
+	})
+}
+
+func FuzzRequestPaths(f *testing.F) {
+	f.Add("/comic/327")
+	f.Add("/327/info.0.json")
+	f.Add("/info.0.json")
+	f.Add("//info.0.json")
+
+	f.Fuzz(func(t *testing.T, path string) {
+		comicNum(path, "/comic/")
+		if num, ok := infoPath(path); ok && num < 0 {
+			t.Errorf("infoPath(%q) = %d", path, num)
+		}
+	})
+}
+
+func FuzzParseMonthDay(f *testing.F) {
+	f.Add("06-06")
+	f.Add("02-30")
+	f.Add("")
+
+	now := time.Date(2024, time.March, 14, 0, 0, 0, 0, time.UTC)
+	f.Fuzz(func(t *testing.T, s string) {
+		month, day, err := parseMonthDay(s, now)
+		if err == nil && (month < time.January || month > time.December || day < 1 || day > 31) {
+			t.Errorf("parseMonthDay(%q) = %v %d", s, month, day)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// galleryComic is a comic as the gallery page shows it. Image and Thumb
+// are relative to the page and empty for comics without an image.
+type galleryComic struct {
+	Num   int
+	Title string
+	Alt   string
+	Image string
+	Thumb string
+}
+
+// writeGallery writes an HTML page of comics into dest, with a thumbnail
+// of each image linking to a copy of it, so the directory can be shared
+// as it is.
+func writeGallery(dest, title string, comics []localComic) error {
+	err := os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+	dest = withSlash(dest)
+
+	page := struct {
+		Title  string
+		Comics []galleryComic
+	}{Title: title}
+
+	for _, c := range comics {
+		gc := galleryComic{Num: c.Num, Title: c.Title, Alt: c.Alt}
+
+		if c.ImgPath != "" {
+			err = c.fetchImage()
+			if err != nil {
+				return err
+			}
+			gc.Image = strconv.Itoa(c.Num) + filepath.Ext(c.ImgPath)
+			gc.Thumb = strconv.Itoa(c.Num) + "-thumb.png"
+
+			err = copyFile(c.ImgPath, dest+gc.Image)
+			if err == nil {
+				err = writeThumbnail(c.ImgPath, dest+gc.Thumb)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		page.Comics = append(page.Comics, gc)
+	}
+
+	f, err := os.Create(dest + "index.html")
+	if err != nil {
+		return err
+	}
+
+	err = templates.ExecuteTemplate(f, "gallery.html", page)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func writeThumbnail(src, dst string) error {
+	img, err := loadImage(src)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	err = png.Encode(f, thumbnail(img, 320, 320))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestWriteGallery(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := searchComics(db, "alt text 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir() + "/gallery"
+	err = writeGallery(out, "Twos & more", matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := string(readFile(t, out+"/index.html"))
+	for _, want := range []string{
+		"<title>Twos &amp; more</title>",
+		`<a href="2.png"><img src="2-thumb.png" alt="Comic 2" title="Alt text 2"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("gallery lacks %s:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "Comic 1") {
+		t.Error("gallery has a comic that didn't match")
+	}
+
+	for _, name := range []string{"2.png", "2-thumb.png"} {
+		if _, err := os.Stat(out + "/" + name); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tests point these at a fake server.
+var (
+	driveAPI    = "https://www.googleapis.com/drive/v3/"
+	driveUpload = "https://www.googleapis.com/upload/drive/v3/"
+	driveDevice = "https://oauth2.googleapis.com/device/code"
+	driveToken  = "https://oauth2.googleapis.com/token"
+)
+
+const driveFolder = "application/vnd.google-apps.folder"
+
+// gdriveStore keeps a mirror in a Google Drive folder. Drive knows files
+// by ID rather than path, so the IDs found are remembered.
+type gdriveStore struct {
+	dir  string
+	auth *oauthProvider
+
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func newGDrive(dir string) *gdriveStore {
+	return &gdriveStore{
+		dir: strings.Trim(dir, "/"),
+		auth: &oauthProvider{
+			name:      "gdrive",
+			clientID:  envOr("XKCDDB_GDRIVE_CLIENT_ID", gdriveClientID),
+			secret:    envOr("XKCDDB_GDRIVE_CLIENT_SECRET", gdriveClientSecret),
+			scope:     "https://www.googleapis.com/auth/drive.file",
+			deviceURL: driveDevice,
+			tokenURL:  driveToken,
+		},
+		ids: map[string]string{"": "root"},
+	}
+}
+
+func (s *gdriveStore) String() string {
+	return "gdrive://" + s.dir
+}
+
+// request sends an API request and fails unless the status is one of ok.
+func (s *gdriveStore) request(method, rawURL, contentType string, body []byte, header map[string]string, ok ...int) (*http.Response, error) {
+	resp, err := s.auth.bearer(func() (*http.Request, error) {
+		req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	return resp, fmt.Errorf("google drive %s: %s: %s", method, resp.Status, bytes.TrimSpace(msg))
+}
+
+// lookup finds the ID of a file or folder by its path in the drive, or
+// returns "" if there is none. With create, missing folders are made.
+func (s *gdriveStore) lookup(p string, create bool) (string, error) {
+	s.mu.Lock()
+	id, ok := s.ids[p]
+	s.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	parent, err := s.lookup(parentPath(p), create)
+	if err != nil || parent == "" {
+		return "", err
+	}
+	name := path.Base(p)
+
+	q := fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name), parent)
+	resp, err := s.request("GET", driveAPI+"files?fields=files(id)&q="+url.QueryEscape(q), "", nil, nil, http.StatusOK)
+	if err != nil {
+		return "", err
+	}
+	var list struct {
+		Files []struct {
+			ID string `json:"id"`
+		} `json:"files"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(list.Files) > 0:
+		id = list.Files[0].ID
+	case create:
+		meta, _ := json.Marshal(map[string]interface{}{"name": name, "mimeType": driveFolder, "parents": []string{parent}})
+		resp, err := s.request("POST", driveAPI+"files?fields=id", "application/json", meta, nil, http.StatusOK)
+		if err != nil {
+			return "", err
+		}
+		var f struct {
+			ID string `json:"id"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&f)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		id = f.ID
+	default:
+		return "", nil
+	}
+
+	s.mu.Lock()
+	s.ids[p] = id
+	s.mu.Unlock()
+
+	return id, nil
+}
+
+func parentPath(p string) string {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[:i]
+	}
+
+	return ""
+}
+
+func (s *gdriveStore) full(rel string) string {
+	return strings.Trim(path.Join(s.dir, strings.TrimSuffix(rel, "/")), "/")
+}
+
+// put uploads each file in a resumable upload. Replacing a file makes a
+// new revision of it, which readers only see once it is complete.
+func (s *gdriveStore) put(dbPath string, paths []string) (int, error) {
+	for i, rel := range paths {
+		err := s.putFile(dbPath, rel)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(paths), nil
+}
+
+func (s *gdriveStore) putFile(dbPath, rel string) error {
+	data, err := os.ReadFile(dbPath + rel)
+	if err != nil {
+		return err
+	}
+
+	p := s.full(rel)
+	parent, err := s.lookup(parentPath(p), true)
+	if err != nil {
+		return err
+	}
+	id, err := s.lookup(p, false)
+	if err != nil {
+		return err
+	}
+
+	// Start an upload session.
+	method, target, meta := "POST", driveUpload+"files?uploadType=resumable&fields=id", map[string]interface{}{"name": path.Base(p), "parents": []string{parent}}
+	if id != "" {
+		method, target, meta = "PATCH", driveUpload+"files/"+id+"?uploadType=resumable&fields=id", map[string]interface{}{}
+	}
+	metaJSON, _ := json.Marshal(meta)
+	resp, err := s.request(method, target, "application/json; charset=UTF-8", metaJSON,
+		map[string]string{"X-Upload-Content-Length": strconv.Itoa(len(data))}, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return fmt.Errorf("google drive: no upload session for %s", p)
+	}
+
+	// Send it in chunks; 308 asks for the next.
+	size := int64(len(data))
+	for offset := int64(0); ; {
+		end := offset + cloudChunk
+		if end > size {
+			end = size
+		}
+		rng := fmt.Sprintf("bytes %d-%d/%d", offset, end-1, size)
+		if size == 0 {
+			rng = "bytes */0"
+		}
+
+		resp, err := s.request("PUT", session, "", data[offset:end], map[string]string{"Content-Range": rng},
+			http.StatusOK, http.StatusCreated, http.StatusPermanentRedirect)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusPermanentRedirect {
+			break
+		}
+		// The server says how much it has.
+		offset = end
+		if r := resp.Header.Get("Range"); r != "" {
+			if i := strings.LastIndex(r, "-"); i >= 0 {
+				if last, err := strconv.ParseInt(r[i+1:], 10, 64); err == nil {
+					offset = last + 1
+				}
+			}
+		}
+		if offset >= size {
+			return fmt.Errorf("google drive: upload of %s never finished", p)
+		}
+	}
+
+	return nil
+}
+
+func (s *gdriveStore) get(rel string) (io.ReadCloser, error) {
+	id, err := s.lookup(s.full(rel), false)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("%s/%s: %w", s, rel, errRemoteNotFound)
+	}
+
+	resp, err := s.request("GET", driveAPI+"files/"+id+"?alt=media", "", nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (s *gdriveStore) remove(paths []string) error {
+	for _, rel := range paths {
+		p := s.full(rel)
+		id, err := s.lookup(p, false)
+		if err != nil {
+			return err
+		}
+		if id == "" {
+			continue
+		}
+
+		resp, err := s.request("DELETE", driveAPI+"files/"+id, "", nil, nil, http.StatusNoContent, http.StatusNotFound)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		s.mu.Lock()
+		delete(s.ids, p)
+		s.mu.Unlock()
+	}
+
+	return nil
+}
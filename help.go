@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// commandHelp says in a line what each command does, for help to search.
+var commandHelp = []struct{ name, summary string }{
+	{"sync", "Download every comic missing from the database (the default with no command)"},
+	{"analyze", "Run image analysis over stored comics: size, colours, panels"},
+	{"apply", "Carry out a plan saved by plan"},
+	{"batch", "Run list, get and search commands a line at a time from a file or stdin"},
+	{"cache", "Report on or empty the image cache of a hybrid database"},
+	{"changes", "List what changed in the database"},
+	{"check-archive", "Compare the database with xkcd's archive page"},
+	{"cleanup", "List, or move to the trash, files that don't belong in the database"},
+	{"ctl", "Pause, resume, inspect or reorder a running sync"},
+	{"digest", "Write the week's comics as one HTML page"},
+	{"exclude", "Keep comics out of the database, or let them back in"},
+	{"export", "Write stored comics out as files, CBZ, EPUB or media-sized volumes"},
+	{"fsck", "Check the manifest against the comics on disk"},
+	{"help", "Search these commands"},
+	{"hybrid", "Move a database's images to a remote store, or back"},
+	{"import-archive", "Copy the comics of a dump into the database without downloading them"},
+	{"index", "Tune, rebuild or report on the search index"},
+	{"list", "List stored comics by year, transcript, image, colour, size or tag"},
+	{"loadtest", "Send a mirror the traffic of many visitors and report how fast it answered"},
+	{"log", "Print the latest runs from the audit log"},
+	{"media", "Browse a media set written by export -media-set"},
+	{"onthisday", "List comics published on a day of the year"},
+	{"open", "Open a comic's image in a viewer"},
+	{"plan", "Work out what a sync would do and save it"},
+	{"push-device", "Send comics to a Kindle or reMarkable"},
+	{"quiz", "Guess comics from their alt text or transcript"},
+	{"random", "Show a random stored comic"},
+	{"replicate", "Copy another xkcd-db's comics and keep up with its changes"},
+	{"report", "Write a year-in-review summary"},
+	{"review", "Show comics due for another look, plus a few new ones"},
+	{"search", "Search alt text and transcripts; tag, export, open, refetch or exclude the matches"},
+	{"serve", "Run a web UI and JSON API over the database"},
+	{"share", "Create and open encrypted bundles of comics"},
+	{"show", "Print a comic, fetching it first if it isn't mirrored"},
+	{"state", "Move a database's state to another machine"},
+	{"trash", "List, restore or empty the trash"},
+	{"upload", "Copy the mirror to a WebDAV or sftp store"},
+	{"usage", "Switch the usage log on and off and report from it"},
+	{"version", "Print what the binary was built from"},
+}
+
+// helpCmd lists the commands, or those matching a search, best first.
+func helpCmd(args []string) {
+	fs := flag.NewFlagSet("help", flag.ExitOnError)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db help [flags] [words]")
+		fmt.Fprintln(fs.Output(), "Words match command names loosely, e.g. tsh for trash, and summaries as written.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	found := searchHelp(strings.Join(fs.Args(), " "))
+	if len(found) == 0 {
+		fmt.Println(tr("No command matches; xkcd-db help lists them all"))
+		os.Exit(1)
+	}
+	for _, i := range found {
+		fmt.Printf("%-15s %s\n", commandHelp[i].name, commandHelp[i].summary)
+	}
+	fmt.Println(tr("\nxkcd-db <command> -h shows a command's flags"))
+}
+
+// searchHelp returns the indexes in commandHelp of the commands matching
+// every word of query, best first. An empty query matches all.
+func searchHelp(query string) []int {
+	words := strings.Fields(strings.ToLower(query))
+
+	var found []int
+	score := make(map[int]int)
+	for i, c := range commandHelp {
+		total := 0
+		for _, w := range words {
+			s := helpScore(c.name, strings.ToLower(c.summary), w)
+			if s == 0 {
+				total = 0
+				break
+			}
+			total += s
+		}
+		if total > 0 || len(words) == 0 {
+			found = append(found, i)
+			score[i] = total
+		}
+	}
+	sort.SliceStable(found, func(a, b int) bool { return score[found[a]] > score[found[b]] })
+
+	return found
+}
+
+// helpScore rates how well a word matches a command: its name best, then
+// loosely its name, then its summary; 0 is no match.
+func helpScore(name, summary, word string) int {
+	switch {
+	case name == word:
+		return 8
+	case strings.HasPrefix(name, word):
+		return 4
+	case subsequence(name, word):
+		return 2
+	case strings.Contains(summary, word):
+		return 1
+	}
+
+	return 0
+}
+
+// subsequence reports whether the letters of word appear in s in order.
+func subsequence(s, word string) bool {
+	for _, r := range word {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+
+	return true
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestHelpCoversCommands(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, c := range commandHelp {
+		if c.name != "sync" && commands[c.name] == nil {
+			t.Errorf("help has %s, which isn't a command", c.name)
+		}
+		seen[c.name] = true
+	}
+	for name := range commands {
+		if !seen[name] {
+			t.Errorf("%s has no help", name)
+		}
+	}
+}
+
+func TestSearchHelp(t *testing.T) {
+	cases := []struct{ query, first string }{
+		{"export", "export"},
+		{"exprt", "export"},
+		{"tsh", "trash"},
+		{"refetch", "search"},
+		{"TAG", "list"},
+	}
+	for _, c := range cases {
+		found := searchHelp(c.query)
+		if len(found) == 0 || commandHelp[found[0]].name != c.first {
+			t.Errorf("help %s: no %s first in %v", c.query, c.first, found)
+		}
+	}
+
+	if found := searchHelp(""); len(found) != len(commandHelp) {
+		t.Errorf("no words matched %d of %d commands", len(found), len(commandHelp))
+	}
+	if found := searchHelp("export zzz"); len(found) != 0 {
+		t.Errorf("export zzz matched %v", found)
+	}
+}
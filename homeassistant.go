@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// haSensor is the latest comic in a shape Home Assistant's REST sensor
+// reads directly, e.g.:
+//
+//	sensor:
+//	  - platform: rest
+//	    name: xkcd
+//	    resource: http://mirror:8080/api/homeassistant
+//	    value_template: "{{ value_json.num }}"
+//	    json_attributes: [title, alt, date, image_url, page_url, new]
+//
+// A generic camera pointed at {{ state_attr('sensor.xkcd', 'image_url') }}
+// puts the comic on a smart display. To hear of new comics without
+// polling, sync with -mqtt-broker and subscribe to -mqtt-topic instead.
+type haSensor struct {
+	Num      int    `json:"num"`
+	Title    string `json:"title"`
+	Alt      string `json:"alt"`
+	Date     string `json:"date"`
+	ImageURL string `json:"image_url,omitempty"`
+	PageURL  string `json:"page_url"`
+	// Whether the mirror got the comic within the last new_hours, 24 by
+	// default, for automations that announce new comics.
+	New bool `json:"new"`
+}
+
+func (s *server) handleHomeAssistant(w http.ResponseWriter, r *http.Request) {
+	hours := 24
+	if h := r.URL.Query().Get("new_hours"); h != "" {
+		var err error
+		hours, err = strconv.Atoi(h)
+		if err != nil {
+			http.Error(w, "new_hours must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	nums, err := storedComics(s.dbPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(nums) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	num := nums[len(nums)-1]
+
+	c, err := readComic(s.dbPath, num)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stored, err := comicModTime(s.dbPath, num)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sensor := haSensor{
+		Num:     num,
+		Title:   c.Title,
+		Alt:     c.Alt,
+		Date:    c.date(),
+		PageURL: mirrorURL(r, s.prefix+"/comic/"+strconv.Itoa(num)),
+		New:     time.Since(stored) < time.Duration(hours)*time.Hour,
+	}
+	if c.ImgPath != "" {
+		sensor.ImageURL = mirrorURL(r, s.prefix+"/img/"+strconv.Itoa(num)+"/"+filepath.Base(c.ImgPath))
+	}
+
+	writeJSON(w, sensor)
+}
+
+// mirrorURL turns a path on the mirror into an absolute URL, as the
+// client reached the mirror.
+func mirrorURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + path
+}
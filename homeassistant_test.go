@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestHomeAssistantSensor(t *testing.T) {
+	ts, _ := testServer(t, fakexkcd.Corpus(3))
+
+	status, body := get(t, ts.URL+"/api/homeassistant")
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+
+	var sensor haSensor
+	err := json.Unmarshal(body, &sensor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.Num != 3 || sensor.Title != "Comic 3" || !sensor.New {
+		t.Errorf("got %+v", sensor)
+	}
+	if sensor.PageURL != ts.URL+"/comic/3" || !strings.HasPrefix(sensor.ImageURL, ts.URL+"/img/3/") {
+		t.Errorf("got URLs %s and %s", sensor.PageURL, sensor.ImageURL)
+	}
+	if status, _ := get(t, sensor.ImageURL); status != http.StatusOK {
+		t.Errorf("image URL answers %d", status)
+	}
+
+	_, body = get(t, ts.URL+"/api/homeassistant?new_hours=0")
+	err = json.Unmarshal(body, &sensor)
+	if err != nil || sensor.New {
+		t.Errorf("comic still new after 0 hours: %v, %+v", err, sensor)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// hostsFile keeps what past syncs saw of each host.
+const hostsFile = "hosts.json"
+
+// A host that answers slower than this many times its usual latency is
+// given up on.
+const hostTimeoutFactor = 20
+
+// Timeouts learned from fast hosts never drop below this.
+const minHostTimeout = 10 * time.Second
+
+// hostStats is how a host behaved, averaged over past syncs with recent
+// ones weighing most.
+type hostStats struct {
+	// Time until the response headers arrive.
+	Latency time.Duration `json:"latency"`
+	// Bytes per second while reading bodies.
+	Throughput float64 `json:"throughput"`
+	// Fraction of requests that failed, were throttled or errored.
+	ErrorRate float64 `json:"error_rate"`
+	// Where -adaptive settled, to start from next time.
+	Concurrency int       `json:"concurrency,omitempty"`
+	Updated     time.Time `json:"updated"`
+}
+
+// hostRun adds up one sync's requests to a host.
+type hostRun struct {
+	requests int
+	errors   int
+	latency  time.Duration
+	bytes    int64
+	reading  time.Duration
+}
+
+// hostRecorder measures requests through the shared client and bases
+// their timeouts on past syncs.
+type hostRecorder struct {
+	past map[string]hostStats
+
+	mu   sync.Mutex
+	runs map[string]*hostRun
+}
+
+func loadHostStats(dbPath string) (*hostRecorder, error) {
+	r := &hostRecorder{
+		past: make(map[string]hostStats),
+		runs: make(map[string]*hostRun),
+	}
+
+	data, err := os.ReadFile(dbPath + hostsFile)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return r, json.Unmarshal(data, &r.past)
+}
+
+// concurrency is where -adaptive settled for the host of rawURL last time,
+// or 0 if unknown.
+func (r *hostRecorder) concurrency(rawURL string) int {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0
+	}
+
+	return r.past[u.Host].Concurrency
+}
+
+// timeout is how long to wait for a host's response headers; 0 waits
+// forever, as for hosts not seen before.
+func (r *hostRecorder) timeout(host string) time.Duration {
+	st, ok := r.past[host]
+	if !ok || st.Latency == 0 {
+		return 0
+	}
+
+	t := hostTimeoutFactor * st.Latency
+	if t < minHostTimeout {
+		t = minHostTimeout
+	}
+
+	return t
+}
+
+func (r *hostRecorder) run(host string) *hostRun {
+	hr, ok := r.runs[host]
+	if !ok {
+		hr = &hostRun{}
+		r.runs[host] = hr
+	}
+
+	return hr
+}
+
+// track measures everything requested through the shared client until the
+// returned function is called.
+func (r *hostRecorder) track() func() {
+	return tracked.track(func(next http.RoundTripper) http.RoundTripper {
+		return &statsTransport{next: next, r: r}
+	})
+}
+
+type statsTransport struct {
+	next http.RoundTripper
+	r    *hostRecorder
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	ctx, cancel := context.WithCancel(req.Context())
+	var timer *time.Timer
+	if d := t.r.timeout(host); d > 0 {
+		timer = time.AfterFunc(d, cancel)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	took := time.Since(start)
+	if timer != nil {
+		timer.Stop()
+	}
+
+	t.r.mu.Lock()
+	hr := t.r.run(host)
+	hr.requests++
+	hr.latency += took
+	if err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		hr.errors++
+	}
+	t.r.mu.Unlock()
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &statsBody{ReadCloser: resp.Body, r: t.r, host: host, cancel: cancel}
+	return resp, nil
+}
+
+type statsBody struct {
+	io.ReadCloser
+	r      *hostRecorder
+	host   string
+	cancel func()
+}
+
+func (b *statsBody) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := b.ReadCloser.Read(p)
+
+	b.r.mu.Lock()
+	hr := b.r.run(b.host)
+	hr.bytes += int64(n)
+	hr.reading += time.Since(start)
+	b.r.mu.Unlock()
+
+	return n, err
+}
+
+func (b *statsBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
+
+// save folds this sync into the averages. settled is where -adaptive
+// ended up for the host of rawURL, or 0 if it wasn't used.
+func (r *hostRecorder) save(dbPath, rawURL string, settled int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// How much this sync counts against all before it.
+	const weight = 0.5
+	blend := func(old, cur float64, known bool) float64 {
+		if !known {
+			return cur
+		}
+		return old + weight*(cur-old)
+	}
+
+	for host, hr := range r.runs {
+		if hr.requests == 0 {
+			continue
+		}
+
+		st, known := r.past[host]
+		latency := hr.latency / time.Duration(hr.requests)
+		st.Latency = time.Duration(blend(float64(st.Latency), float64(latency), known))
+		st.ErrorRate = blend(st.ErrorRate, float64(hr.errors)/float64(hr.requests), known)
+		if hr.reading > 0 {
+			st.Throughput = blend(st.Throughput, float64(hr.bytes)/hr.reading.Seconds(), known && st.Throughput > 0)
+		}
+		st.Updated = time.Now()
+		r.past[host] = st
+	}
+
+	if u, err := url.Parse(rawURL); err == nil && settled > 0 {
+		st := r.past[u.Host]
+		st.Concurrency = settled
+		r.past[u.Host] = st
+	}
+
+	data, err := json.MarshalIndent(r.past, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dbPath+hostsFile, data, 0644)
+}
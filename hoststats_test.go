@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestHostStatsRemembered(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(5))
+	dbPath := tempDB(t)
+
+	_, err := syncDB(dbPath, syncOptions{rateLimit: 3, adaptive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats map[string]hostStats
+	err = json.Unmarshal(readFile(t, dbPath+hostsFile), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	st, ok := stats[u.Host]
+	if !ok {
+		t.Fatalf("no stats for %s in %v", u.Host, stats)
+	}
+	if st.Latency <= 0 || st.Throughput <= 0 || st.ErrorRate != 0 {
+		t.Errorf("implausible stats %+v", st)
+	}
+	if st.Concurrency != 3 {
+		t.Errorf("settled concurrency %d, want 3", st.Concurrency)
+	}
+
+	hosts, err := loadHostStats(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hosts.concurrency(xkcdURL); got != 3 {
+		t.Errorf("next sync would start at %d parallel downloads, want 3", got)
+	}
+	if got := hosts.timeout(u.Host); got != minHostTimeout {
+		t.Errorf("timeout for a fast host is %v, want %v", got, minHostTimeout)
+	}
+}
+
+func TestHostTimeout(t *testing.T) {
+	r := &hostRecorder{past: map[string]hostStats{
+		"slow.example": {Latency: 2 * time.Second},
+	}}
+
+	if got, want := r.timeout("slow.example"), 40*time.Second; got != want {
+		t.Errorf("timeout %v, want %v", got, want)
+	}
+	if got := r.timeout("new.example"); got != 0 {
+		t.Errorf("unknown host timeout %v, want none", got)
+	}
+}
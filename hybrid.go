@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// hybridFile makes a database hybrid: metadata and search stay on local
+// disk while images live in a remote store, fetched when viewed and kept
+// in a small local cache.
+const hybridFile = "hybrid.json"
+
+// Viewed images kept locally by default.
+const defaultImageCache = 100
+
+type hybridConfig struct {
+	Remote string `json:"remote"`
+	// How many viewed images, and how many bytes of them, to keep
+	// locally; zero is unlimited.
+	Cache      int   `json:"cache"`
+	CacheBytes int64 `json:"cache_bytes,omitempty"`
+	// Images fetched since the database became hybrid.
+	Fetches int `json:"fetches,omitempty"`
+	// The file names of images the store holds, by comic.
+	Images map[int]string `json:"images"`
+	// When cached images were last viewed.
+	Used map[int]time.Time `json:"used,omitempty"`
+
+	store remoteStore
+}
+
+// Fetches and evictions of a database's cache happen one at a time.
+var hybridMu sync.Mutex
+
+// loadHybrid returns the hybrid setup of a database, or nil if its
+// images are all local.
+func loadHybrid(dbPath string) (*hybridConfig, error) {
+	data, err := os.ReadFile(dbPath + hybridFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h := &hybridConfig{}
+	err = json.Unmarshal(data, h)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dbPath+hybridFile, err)
+	}
+	if h.Images == nil {
+		h.Images = make(map[int]string)
+	}
+	if h.Used == nil {
+		h.Used = make(map[int]time.Time)
+	}
+
+	h.store, err = openRemote(h.Remote)
+	return h, err
+}
+
+func (h *hybridConfig) save(dbPath string) error {
+	data, err := json.MarshalIndent(h, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(dbPath+hybridFile, data)
+}
+
+// writeFileAtomic replaces a file so readers never see half of it.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// offloaded reports whether a comic's image lives only remotely.
+func (h *hybridConfig) offloaded(dbPath string, num int) bool {
+	name, ok := h.Images[num]
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(dbPath + strconv.Itoa(num) + "/" + name)
+
+	return os.IsNotExist(err)
+}
+
+// fetchImage returns the local path of a comic's image, first fetching it
+// into the cache if it only lives remotely.
+func fetchImage(dbPath string, num int) (string, error) {
+	hybridMu.Lock()
+	defer hybridMu.Unlock()
+
+	h, err := loadHybrid(dbPath)
+	if err != nil {
+		return "", err
+	}
+	if h == nil {
+		return comicImagePath(dbPath, num)
+	}
+
+	name, ok := h.Images[num]
+	if !ok {
+		return comicImagePath(dbPath, num)
+	}
+	rel := strconv.Itoa(num) + "/" + name
+	path := dbPath + rel
+
+	// Views within a minute of each other needn't be recorded each, and
+	// views storage can't record, e.g. as it is read-only, are still
+	// shown.
+	if _, err := os.Stat(path); err == nil {
+		if time.Since(h.Used[num]) > time.Minute {
+			h.Used[num] = time.Now().UTC()
+			err = h.save(dbPath)
+		}
+		if isStorageError(err) {
+			err = nil
+		}
+		return path, err
+	}
+
+	if offline {
+		return "", fmt.Errorf("comic %d: the image is in %s: %v", num, h.store, errOffline)
+	}
+	detail("Fetching the image of comic %d from %s\n", num, h.store)
+
+	r, err := h.store.get(rel)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	// Stamped as uploaded, so upload doesn't send it back.
+	st, err := loadRemoteState(dbPath)
+	if err != nil {
+		return "", err
+	}
+	if stamp, ok := st[h.store.String()][rel]; ok {
+		os.Chtimes(path, stamp.ModTime, stamp.ModTime)
+	}
+
+	h.Used[num] = time.Now().UTC()
+	h.Fetches++
+	_, err = h.evict(dbPath)
+	if isStorageError(err) {
+		err = nil
+	}
+
+	return path, err
+}
+
+// cachedImage is an image on local disk that the store holds too.
+type cachedImage struct {
+	num  int
+	size int64
+}
+
+// cached lists the local images the store holds as they are, and records
+// them as kept there.
+func (h *hybridConfig) cached(dbPath string) ([]cachedImage, error) {
+	st, err := loadRemoteState(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	uploaded := st[h.store.String()]
+
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var local []cachedImage
+	for _, num := range nums {
+		path, err := comicImagePath(dbPath, num)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		rel := strconv.Itoa(num) + "/" + filepath.Base(path)
+		if stamp, ok := uploaded[rel]; !ok || stamp.Size != info.Size() || !stamp.ModTime.Equal(info.ModTime().UTC()) {
+			continue
+		}
+		h.Images[num] = filepath.Base(path)
+		local = append(local, cachedImage{num, info.Size()})
+	}
+
+	return local, nil
+}
+
+// evict removes the local copies of images the store holds: all those
+// never viewed, and the least recently viewed of the rest until the cache
+// is within its limits. It returns how many were removed.
+func (h *hybridConfig) evict(dbPath string) (int, error) {
+	local, err := h.cached(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Most recently viewed first.
+	sort.SliceStable(local, func(i, j int) bool { return h.Used[local[i].num].After(h.Used[local[j].num]) })
+
+	removed, kept, bytes := 0, 0, int64(0)
+	for _, c := range local {
+		if !h.Used[c.num].IsZero() && (h.Cache == 0 || kept < h.Cache) && (h.CacheBytes == 0 || bytes+c.size <= h.CacheBytes) {
+			kept++
+			bytes += c.size
+			continue
+		}
+
+		err = os.Remove(dbPath + strconv.Itoa(c.num) + "/" + h.Images[c.num])
+		if err != nil {
+			return removed, err
+		}
+		delete(h.Used, c.num)
+		removed++
+	}
+
+	return removed, h.save(dbPath)
+}
+
+// offloadImages uploads the mirror and evicts images down to the cache
+// size, returning how many were uploaded and removed.
+func offloadImages(dbPath string, h *hybridConfig) (int, int, error) {
+	hybridMu.Lock()
+	defer hybridMu.Unlock()
+
+	uploaded, _, err := pushMirror(dbPath, h.store)
+	if err != nil {
+		return uploaded, 0, err
+	}
+	removed, err := h.evict(dbPath)
+
+	return uploaded, removed, err
+}
+
+// offloadNew moves images a sync added to the remote store of a hybrid
+// database.
+func offloadNew(dbPath string) error {
+	h, err := loadHybrid(dbPath)
+	if err != nil || h == nil {
+		return err
+	}
+
+	uploaded, removed, err := offloadImages(dbPath, h)
+	if err != nil {
+		return fmt.Errorf("offloading images to %s: %v", h.store, err)
+	}
+	say("Uploaded %d files to %s and removed %d local images\n", uploaded, h.store, removed)
+
+	return nil
+}
+
+// hybrid moves a database's images to a remote store, or back.
+func hybrid(args []string) {
+	fs := flag.NewFlagSet("hybrid", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	cache := fs.Int("cache", defaultImageCache, "How many recently viewed images to keep locally; 0 is unlimited")
+	var cacheBytes byteSize
+	fs.Var(&cacheBytes, "cache-size", "Keep at most this much of recently viewed images locally, e.g. 500MB; 0 is unlimited")
+	undo := fs.Bool("undo", false, "Fetch every image back and keep them all locally again")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db hybrid [flags] [URL]")
+		fmt.Fprintln(fs.Output(), "Keeps images in the remote store at URL, like xkcd-db upload, and only the most")
+		fmt.Fprintln(fs.Output(), "recently viewed locally. Later syncs offload new images; run again to change -cache.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var target string
+	if fs.NArg() > 0 {
+		target = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if offline {
+		log.Fatalln("hybrid needs the network:", errOffline)
+	}
+
+	*dbPath = withSlash(*dbPath)
+	h, err := loadHybrid(*dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *undo {
+		if h == nil {
+			fmt.Println(*dbPath + " keeps its images locally already")
+			return
+		}
+		a := startAudit(*dbPath, "hybrid", args)
+		n, err := unhybrid(*dbPath, h)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		outcome := fmt.Sprintf("Fetched %d images back from %s", n, h.store)
+		fmt.Println(paint(os.Stdout, good, outcome))
+		a.end(outcome)
+		return
+	}
+
+	switch {
+	case h == nil && target == "":
+		fs.Usage()
+		os.Exit(2)
+	case h == nil:
+		h = &hybridConfig{Cache: *cache, Images: make(map[int]string), Used: make(map[int]time.Time)}
+		fallthrough
+	case target != "":
+		if h.Remote != "" && target != h.Remote {
+			log.Fatalf("%s keeps its images in %s; run hybrid -undo first\n", *dbPath, h.Remote)
+		}
+		h.Remote = target
+		h.store, err = openRemote(target)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	// The cache limits stay as they were unless changed.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "cache":
+			h.Cache = *cache
+		case "cache-size":
+			h.CacheBytes = int64(cacheBytes)
+		}
+	})
+
+	a := startAudit(*dbPath, "hybrid", args)
+	uploaded, removed, err := offloadImages(*dbPath, h)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	outcome := fmt.Sprintf("Uploaded %d files to %s and removed %d local images", uploaded, h.store, removed)
+	fmt.Println(paint(os.Stdout, good, outcome))
+	a.end(outcome)
+}
+
+// unhybrid fetches every offloaded image back, and makes the database
+// keep its images locally.
+func unhybrid(dbPath string, h *hybridConfig) (int, error) {
+	// Nothing fetched is evicted again.
+	h.Cache, h.CacheBytes = 0, 0
+	err := h.save(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	fetched := 0
+	for num := range h.Images {
+		if !h.offloaded(dbPath, num) {
+			continue
+		}
+		_, err := fetchImage(dbPath, num)
+		if err != nil {
+			return fetched, err
+		}
+		fetched++
+	}
+
+	return fetched, os.Remove(dbPath + hybridFile)
+}
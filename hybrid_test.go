@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// localImages counts the comics whose image is on local disk.
+func localImages(t *testing.T, db string) int {
+	t.Helper()
+
+	nums, err := storedComics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, num := range nums {
+		if _, err := comicImagePath(db, num); err == nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestHybridImages(t *testing.T) {
+	ts, db := testServer(t, fakexkcd.Corpus(5))
+	_, target := startDAV(t)
+
+	h := &hybridConfig{Remote: target, Cache: 1, Images: make(map[int]string), Used: make(map[int]time.Time)}
+	var err error
+	h.store, err = openRemote(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, removed, err := offloadImages(db, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 5 || localImages(t, db) != 0 {
+		t.Errorf("removed %d images, leaving %d", removed, localImages(t, db))
+	}
+
+	// Offloaded comics are still there to search and check.
+	if got := searchNums(t, db, "Alt text 2"); !equalInts(got, []int{2}) {
+		t.Errorf("search found %v", got)
+	}
+	problems, err := fsckDB(db, false)
+	if err != nil || len(problems) > 0 {
+		t.Errorf("fsck found %v, %v", problems, err)
+	}
+	c, err := readComic(db, 2)
+	if err != nil || !c.offloaded {
+		t.Fatalf("comic 2 not offloaded: %v", err)
+	}
+
+	// Viewing fetches the image into the cache.
+	status, body := get(t, ts.URL+"/img/2")
+	if status != 200 || !bytes.Equal(body, fakexkcd.Image(2)) {
+		t.Errorf("GET /img/2: %d, %d bytes", status, len(body))
+	}
+	if _, err := comicImagePath(db, 2); err != nil || localImages(t, db) != 1 {
+		t.Errorf("after viewing comic 2, %d images are local: %v", localImages(t, db), err)
+	}
+
+	// Uploading again neither sends the fetched image back nor removes the
+	// offloaded ones.
+	uploaded, removed, err := pushMirror(db, h.store)
+	if err != nil || uploaded != 0 || removed != 0 {
+		t.Errorf("push uploaded %d and removed %d: %v", uploaded, removed, err)
+	}
+
+	h, err = loadHybrid(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := unhybrid(db, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetched != 4 || localImages(t, db) != 5 {
+		t.Errorf("fetched %d images back, %d local", fetched, localImages(t, db))
+	}
+	if _, err := os.Stat(db + hybridFile); !os.IsNotExist(err) {
+		t.Errorf("%s kept: %v", hybridFile, err)
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	ts, db := testServer(t, fakexkcd.Corpus(5))
+	_, target := startDAV(t)
+
+	size := int64(len(fakexkcd.Image(1)))
+	h := &hybridConfig{Remote: target, CacheBytes: 2 * size, Images: make(map[int]string), Used: make(map[int]time.Time)}
+	var err error
+	h.store, err = openRemote(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = offloadImages(db, h); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only two images fit; the least recently viewed goes.
+	for _, n := range []string{"1", "2", "3"} {
+		if status, _ := get(t, ts.URL+"/img/"+n); status != 200 {
+			t.Fatalf("GET /img/%s: %d", n, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := comicImagePath(db, 1); err == nil || localImages(t, db) != 2 {
+		t.Errorf("%d images cached, comic 1 kept", localImages(t, db))
+	}
+
+	h, err = loadHybrid(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := imageCacheStats(db, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Cached != 2 || s.Bytes != 2*size || s.Offloaded != 3 || s.Fetches != 3 || !s.Oldest.Before(s.Newest) {
+		t.Errorf("stats: %+v", s)
+	}
+
+	n, err := clearImageCache(db, h)
+	if err != nil || n != 2 || localImages(t, db) != 0 {
+		t.Errorf("clear removed %d, %d left: %v", n, localImages(t, db), err)
+	}
+}
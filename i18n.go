@@ -0,0 +1,109 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Translations, one file per language, mapping English text to the
+// language's. Format strings are looked up before formatting, so their
+// verbs must match. Anything missing is shown in English.
+//
+//go:embed locales
+var localeFiles embed.FS
+
+var catalogs = loadCatalogs()
+
+// lang is the language the CLI speaks, from -lang or the environment.
+var lang = envLang()
+
+func loadCatalogs() map[string]map[string]string {
+	catalogs := make(map[string]map[string]string)
+
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		data, err := localeFiles.ReadFile("locales/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+
+		var c map[string]string
+		err = json.Unmarshal(data, &c)
+		if err != nil {
+			panic(e.Name() + ": " + err.Error())
+		}
+		catalogs[strings.TrimSuffix(e.Name(), path.Ext(e.Name()))] = c
+	}
+
+	return catalogs
+}
+
+// envLang reads the language from the locale variables, e.g. de from
+// LANG=de_DE.UTF-8.
+func envLang() string {
+	for _, v := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if s := os.Getenv(v); s != "" {
+			return baseLang(s)
+		}
+	}
+
+	return "en"
+}
+
+// baseLang reduces a locale or language tag to its language.
+func baseLang(s string) string {
+	s = strings.ToLower(s)
+	if i := strings.IndexAny(s, "_-.@"); i >= 0 {
+		s = s[:i]
+	}
+
+	return s
+}
+
+// tr translates msg into the CLI's language.
+func tr(msg string) string {
+	return trIn(lang, msg)
+}
+
+func trIn(l, msg string) string {
+	if t, ok := catalogs[l][msg]; ok {
+		return t
+	}
+
+	return msg
+}
+
+// requestLang picks the first language in the request's Accept-Language
+// that has a translation, falling back to the server's.
+func requestLang(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag := strings.TrimSpace(part)
+		if i := strings.IndexByte(tag, ';'); i >= 0 {
+			tag = tag[:i]
+		}
+
+		l := baseLang(tag)
+		if _, ok := catalogs[l]; ok || l == "en" {
+			return l
+		}
+	}
+
+	return lang
+}
+
+// langFlag sets the CLI's language.
+type langFlag struct{}
+
+func (langFlag) String() string { return "" }
+
+func (langFlag) Set(s string) error {
+	lang = baseLang(s)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogsKeepVerbs(t *testing.T) {
+	if len(catalogs) < 2 {
+		t.Fatalf("got %d catalogs, want at least 2", len(catalogs))
+	}
+
+	for l, c := range catalogs {
+		for msg, t9n := range c {
+			want := strings.Join(formatVerb.FindAllString(msg, -1), " ")
+			got := strings.Join(formatVerb.FindAllString(t9n, -1), " ")
+			if got != want {
+				t.Errorf("%s: %q has verbs %q, want %q", l, t9n, got, want)
+			}
+			if strings.HasSuffix(msg, "\n") != strings.HasSuffix(t9n, "\n") {
+				t.Errorf("%s: %q and its translation end differently", l, msg)
+			}
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	if got := trIn("de", "Nothing to clean up"); got != "Nichts aufzuräumen" {
+		t.Errorf("got %q", got)
+	}
+	if got := trIn("de", "not in the catalog"); got != "not in the catalog" {
+		t.Errorf("untranslated: got %q", got)
+	}
+	if got := trIn("xx", "Nothing to clean up"); got != "Nothing to clean up" {
+		t.Errorf("unknown language: got %q", got)
+	}
+
+	for in, want := range map[string]string{"de_DE.UTF-8": "de", "fr-CA": "fr", "C": "c", "en": "en"} {
+		if got := baseLang(in); got != want {
+			t.Errorf("baseLang(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRequestLang(t *testing.T) {
+	defer func(l string) { lang = l }(lang)
+	lang = "fr"
+
+	for header, want := range map[string]string{
+		"":                      "fr",
+		"de-DE,de;q=0.9":        "de",
+		"ja, en-GB;q=0.8":       "en",
+		"ja;q=0.9, fr-CH;q=0.5": "fr",
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", header)
+		if got := requestLang(r); got != want {
+			t.Errorf("%q: got %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestServeTranslated(t *testing.T) {
+	ts, _ := testServer(t, fakexkcd.Corpus(3))
+
+	req, _ := http.NewRequest("GET", ts.URL+"/comic/2", nil)
+	req.Header.Set("Accept-Language", "de")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	page := string(body)
+	if !strings.Contains(page, `<html lang="de">`) || !strings.Contains(page, "Übersicht") {
+		t.Errorf("page is not in German:\n%s", page)
+	}
+	if resp.Header.Get("Content-Language") != "de" {
+		t.Errorf("Content-Language is %q", resp.Header.Get("Content-Language"))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// comicImagePath finds the stored image of a comic. Every file in the comic
+// directory that isn't text or metadata is the image.
+func comicImagePath(dbPath string, num int) (string, error) {
+	item := strconv.Itoa(num)
+	dir := dbPath + item + "/"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == item+"-alt" || name == item+"-transcript" || name == item+"-info.json" {
+			continue
+		}
+
+		return dir + name, nil
+	}
+
+	return "", errors.New("comic " + item + " has no image")
+}
+
+func loadImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// flatten draws img onto an opaque white RGBA canvas so transparent
+// regions come out as paper instead of black.
+func flatten(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+
+	return dst
+}
+
+// fitImage scales img to fit inside a w x h page, preserving the aspect
+// ratio, and centres it on a white background.
+func fitImage(img image.Image, w, h int) *image.RGBA {
+	src := flatten(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Scale so the limiting side fills the page.
+	dw, dh := w, sh*w/sw
+	if dh > h {
+		dw, dh = sw*h/sh, h
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+
+	ox, oy := (w-dw)/2, (h-dh)/2
+	draw.Draw(dst, image.Rect(ox, oy, ox+dw, oy+dh), resize(src, dw, dh), image.Point{}, draw.Src)
+
+	return dst
+}
+
+// thumbnail shrinks img to fit within w x h. Small images keep their size.
+func thumbnail(img image.Image, w, h int) *image.RGBA {
+	src := flatten(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	if sw > w {
+		sw, sh = w, sh*w/sw
+	}
+	if sh > h {
+		sw, sh = sw*h/sh, h
+	}
+	if sw < 1 {
+		sw = 1
+	}
+	if sh < 1 {
+		sh = 1
+	}
+
+	return resize(src, sw, sh)
+}
+
+// resize scales src to exactly dw x dh.
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0 := y * sh / dh
+		y1 := (y + 1) * sh / dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < dw; x++ {
+			x0 := x * sw / dw
+			x1 := (x + 1) * sw / dw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			dst.SetRGBA(x, y, boxAverage(src, x0, y0, x1, y1))
+		}
+	}
+
+	return dst
+}
+
+// boxAverage averages the source pixels covered by a destination pixel.
+// Line art keeps its weight much better this way than with point sampling.
+func boxAverage(src *image.RGBA, x0, y0, x1, y1 int) color.RGBA {
+	var r, g, b, n int
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			i := src.PixOffset(x, y)
+			r += int(src.Pix[i])
+			g += int(src.Pix[i+1])
+			b += int(src.Pix[i+2])
+			n++
+		}
+	}
+
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xff}
+}
+
+func grayscale(img image.Image) *image.Gray {
+	b := img.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+
+	return dst
+}
+
+// maxComicRange bounds how many comics the arguments may ask for in all,
+// so a typo can't ask for billions of comics.
+const maxComicRange = 100000
+
+// parseComics turns arguments like "327 1000-1005" into comic numbers,
+// which start at 1.
+func parseComics(args []string) ([]int, error) {
+	var nums []int
+
+	for _, arg := range args {
+		lo, hi := arg, arg
+		if i := strings.Index(arg, "-"); i > 0 {
+			lo, hi = arg[:i], arg[i+1:]
+		}
+
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 1 {
+			return nil, errors.New("invalid comic number: " + arg)
+		}
+		last, err := strconv.Atoi(hi)
+		if err != nil || last < first {
+			return nil, errors.New("invalid comic range: " + arg)
+		}
+		if last-first >= maxComicRange-len(nums) {
+			return nil, fmt.Errorf("too many comics: at most %d at once", maxComicRange)
+		}
+
+		for n := first; n <= last; n++ {
+			nums = append(nums, n)
+		}
+	}
+
+	return nums, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestParseComics(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []int
+		ok   bool
+	}{
+		{[]string{"327"}, []int{327}, true},
+		{[]string{"1000-1003", "5"}, []int{1000, 1001, 1002, 1003, 5}, true},
+		{[]string{"7-7"}, []int{7}, true},
+		{nil, nil, true},
+		{[]string{"0"}, nil, false},
+		{[]string{"-5"}, nil, false},
+		{[]string{"0-3"}, nil, false},
+		{[]string{"5-3"}, nil, false},
+		{[]string{"3--5"}, nil, false},
+		{[]string{"x"}, nil, false},
+		{[]string{"1-100000000"}, nil, false},
+		{[]string{"1-100000"}, nil, true},
+		// Within bounds one by one, but not together.
+		{[]string{"1-60000", "100001-160000"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseComics(tt.args)
+		if (err == nil) != tt.ok {
+			t.Errorf("%v: error %v", tt.args, err)
+			continue
+		}
+		if tt.want != nil && !equalInts(got, tt.want) {
+			t.Errorf("%v gave %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestFitImage(t *testing.T) {
+	// A wide black comic fits the page's width and is centred on paper.
+	img := image.NewGray(image.Rect(0, 0, 100, 50))
+	out := fitImage(img, 40, 40)
+	if out.Bounds() != image.Rect(0, 0, 40, 40) {
+		t.Fatalf("page is %v", out.Bounds())
+	}
+	for _, p := range []struct {
+		x, y int
+		want uint8
+	}{
+		{20, 5, 0xff}, {20, 9, 0xff}, {20, 10, 0}, {0, 20, 0}, {39, 29, 0}, {20, 30, 0xff}, {20, 39, 0xff},
+	} {
+		if got := out.RGBAAt(p.x, p.y).R; got != p.want {
+			t.Errorf("(%d, %d) is %#x, want %#x", p.x, p.y, got, p.want)
+		}
+	}
+
+	// Transparency comes out as paper.
+	clear := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	draw.Draw(clear, clear.Bounds(), image.Transparent, image.Point{}, draw.Src)
+	if got := fitImage(clear, 8, 8).RGBAAt(4, 4); got != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("transparent pixel became %v", got)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// archivedComic is a comic found in someone else's dump.
+type archivedComic struct {
+	num  int
+	info []byte
+	// Empty if the dump has no image for it.
+	img string
+}
+
+// archiveLayouts read the common ways xkcd dumps are laid out:
+//
+//	native: another xkcd-db database
+//	api:    <num>/info.0.json, as left by mirroring xkcd's API with wget;
+//	        images next to it or anywhere in the dump under their own name
+//	flat:   <num>.json next to <num>.png, as written by export
+var archiveLayouts = map[string]func(root string) ([]archivedComic, error){
+	"native": readNativeArchive,
+	"api":    readAPIArchive,
+	"flat":   readFlatArchive,
+}
+
+// importArchive copies the comics of a dump into the database without
+// downloading them again.
+func importArchive(args []string) {
+	fs := flag.NewFlagSet("import-archive", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	layout := fs.String("layout", "guess", "Layout of the dump: guess, native, api or flat")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db import-archive [flags] dir")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	*dbPath = withSlash(*dbPath)
+	a := startAudit(*dbPath, "import-archive", args)
+
+	n, skipped, err := importDump(*dbPath, fs.Arg(0), *layout)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = updateIndex(*dbPath, false)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	outcome := fmt.Sprintf("Imported %d comics, %d already stored or excluded", n, skipped)
+	fmt.Println(outcome)
+	a.end(outcome)
+}
+
+// importDump returns how many comics were imported and how many were
+// skipped because the database already has them or excludes them.
+func importDump(dbPath, root, layout string) (int, int, error) {
+	root = withSlash(root)
+
+	var comics []archivedComic
+	var err error
+	if layout == "guess" {
+		layout, comics, err = guessLayout(root)
+	} else if read, ok := archiveLayouts[layout]; ok {
+		comics, err = read(root)
+	} else {
+		err = errors.New("unknown archive layout: " + layout)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(comics) == 0 {
+		return 0, 0, errors.New("found no comics in " + root)
+	}
+
+	say("Importing %d comics from a %s dump\n", len(comics), layout)
+
+	err = os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	m, unlock, err := recoverManifest(dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	ex, err := loadExclusions(dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	n, skipped := 0, 0
+	for _, ac := range comics {
+		item := strconv.Itoa(ac.num)
+		if _, err := os.Stat(dbPath + item); err == nil {
+			skipped++
+			continue
+		}
+		if _, ok := ex[ac.num]; ok {
+			skipped++
+			continue
+		}
+
+		c, err := parseComic(ac.info)
+		if err != nil {
+			return n, skipped, fmt.Errorf("comic %d: %v", ac.num, err)
+		}
+		if c.Num != ac.num {
+			return n, skipped, fmt.Errorf("comic %d: metadata is for comic %d", ac.num, c.Num)
+		}
+
+		err = m.begin(ac.num)
+		if err == nil {
+			err = os.Mkdir(dbPath+item, 0755)
+		}
+		if err == nil {
+			err = writeText(dbPath, item, c)
+		}
+		if err == nil && ac.img != "" {
+			// Named like a download would be.
+			name := filepath.Base(ac.img)
+			if i := strings.LastIndex(c.Img, "/"); i >= 0 && c.Img[i+1:] != "" {
+				name = c.Img[i+1:]
+			}
+			err = copyFile(ac.img, dbPath+item+"/"+name)
+		}
+		if err == nil {
+			err = m.setImage(ac.num, "")
+		}
+		if err != nil {
+			m.save(dbPath)
+			return n, skipped, err
+		}
+		n++
+	}
+
+	return n, skipped, updateManifest(dbPath, m)
+}
+
+// guessLayout picks the layout that finds the most comics.
+func guessLayout(root string) (string, []archivedComic, error) {
+	names := make([]string, 0, len(archiveLayouts))
+	for name := range archiveLayouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	best, bestComics := "", []archivedComic(nil)
+	for _, name := range names {
+		comics, err := archiveLayouts[name](root)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(comics) > len(bestComics) {
+			best, bestComics = name, comics
+		}
+	}
+
+	if best == "" {
+		return "", nil, errors.New("could not recognise the layout of " + root)
+	}
+
+	return best, bestComics, nil
+}
+
+func readNativeArchive(root string) ([]archivedComic, error) {
+	nums, err := storedComics(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var comics []archivedComic
+	for _, num := range nums {
+		item := strconv.Itoa(num)
+		// Plain numbered directories are the api layout.
+		if _, err := os.Stat(root + item + "/" + item + "-info.json"); err != nil {
+			if _, err := os.Stat(root + item + "/" + item + "-alt"); err != nil {
+				continue
+			}
+		}
+
+		c, err := readComic(root, num)
+		if err != nil {
+			return nil, err
+		}
+
+		// Older databases only have alt and transcript files.
+		info := c.raw
+		if info == nil {
+			info, err = json.Marshal(c.Comic)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		comics = append(comics, archivedComic{num: num, info: info, img: c.ImgPath})
+	}
+
+	return comics, nil
+}
+
+func readAPIArchive(root string) ([]archivedComic, error) {
+	// Images may be kept apart from the JSON, e.g. under
+	// imgs.xkcd.com/comics/, so index every file by name.
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files[d.Name()] = path
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var comics []archivedComic
+	for _, e := range entries {
+		num, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+
+		info, err := os.ReadFile(root + e.Name() + "/" + jsonFile)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var c Comic
+		json.Unmarshal(info, &c)
+
+		ac := archivedComic{num: num, info: info}
+		if i := strings.LastIndex(c.Img, "/"); i >= 0 {
+			ac.img = files[c.Img[i+1:]]
+		}
+		comics = append(comics, ac)
+	}
+
+	sort.Slice(comics, func(i, j int) bool { return comics[i].num < comics[j].num })
+	return comics, nil
+}
+
+func readFlatArchive(root string) ([]archivedComic, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]string)
+	var comics []archivedComic
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		base := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		num, err := strconv.Atoi(base)
+		if err != nil {
+			continue
+		}
+
+		if filepath.Ext(e.Name()) != ".json" {
+			images[base] = root + e.Name()
+			continue
+		}
+
+		info, err := os.ReadFile(root + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		comics = append(comics, archivedComic{num: num, info: info})
+	}
+
+	for i := range comics {
+		comics[i].img = images[strconv.Itoa(comics[i].num)]
+	}
+
+	sort.Slice(comics, func(i, j int) bool { return comics[i].num < comics[j].num })
+	return comics, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// checkImported compares a database built by importing with the corpus.
+func checkImported(t *testing.T, db string, comics []fakexkcd.Comic) {
+	t.Helper()
+
+	for _, want := range comics {
+		c, err := readComic(db, want.Num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Title != want.Title || c.Alt != want.Alt || c.Transcript != want.Transcript {
+			t.Errorf("comic %d imported as %+v", want.Num, c.Comic)
+		}
+		if c.ImgPath != db+strconv.Itoa(want.Num)+"/"+want.ImgName || !bytes.Equal(readFile(t, c.ImgPath), want.Image) {
+			t.Errorf("comic %d image %q differs", want.Num, c.ImgPath)
+		}
+	}
+}
+
+func TestImportFlatAndNative(t *testing.T) {
+	comics := fakexkcd.Corpus(3)
+	startFake(t, comics)
+	src := tempDB(t)
+
+	_, err := syncDB(src, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flat := t.TempDir()
+	_, err = exportComics(src, flat, nil, exportOptions{format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dump := range []string{flat, src} {
+		db := tempDB(t)
+		n, skipped, err := importDump(db, dump, "guess")
+		if err != nil || n != 3 || skipped != 0 {
+			t.Fatalf("import of %s: %d, %d, %v", dump, n, skipped, err)
+		}
+		checkImported(t, db, comics)
+
+		// Importing again changes nothing.
+		if n, skipped, err := importDump(db, dump, "guess"); err != nil || n != 0 || skipped != 3 {
+			t.Errorf("second import: %d, %d, %v", n, skipped, err)
+		}
+	}
+}
+
+func TestImportAPIMirror(t *testing.T) {
+	comics := fakexkcd.Corpus(2)
+	srv := startFake(t, comics)
+
+	// The shape wget -m leaves behind.
+	dump := withSlash(t.TempDir())
+	err := os.MkdirAll(dump+"imgs/comics", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range comics {
+		_, info := get(t, srv.URL+"/"+strconv.Itoa(c.Num)+"/info.0.json")
+		err = os.Mkdir(dump+strconv.Itoa(c.Num), 0755)
+		if err == nil {
+			err = os.WriteFile(dump+strconv.Itoa(c.Num)+"/info.0.json", info, 0644)
+		}
+		if err == nil {
+			err = os.WriteFile(dump+"imgs/comics/"+c.ImgName, c.Image, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := tempDB(t)
+	n, _, err := importDump(db, dump, "api")
+	if err != nil || n != 2 {
+		t.Fatalf("imported %d comics, %v", n, err)
+	}
+	checkImported(t, db, comics)
+
+	if _, _, err := importDump(tempDB(t), dump, "tarball"); err == nil {
+		t.Error("unknown layout accepted")
+	}
+}
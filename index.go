@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// indexCmd tunes and rebuilds the search index, or reports on it.
+func indexCmd(args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	tokens := fs.String("tokens", "", "Index trigram, to narrow any search, or word, for a smaller index that only finds whole query words")
+	storage := fs.String("storage", "", "Keep the index in memory once read, or read it from disk for every search, to save memory")
+	var weights fieldWeightsFlag
+	fs.Var(&weights, "weights", "Relevance weights of search fields, e.g. title=5,alt=2; defaults are "+fieldWeights(nil).String())
+	queries := fs.Int("queries", 200, "With stats, how many searches to time")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db index [flags] [stats]")
+		fmt.Fprintln(fs.Output(), "Rebuilds the search index, with the settings given and otherwise the ones it has; stats reports on it instead.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 || (fs.NArg() == 1 && fs.Arg(0) != "stats") || *queries < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	*dbPath = withSlash(*dbPath)
+
+	if fs.Arg(0) == "stats" {
+		s, err := indexStatsOf(*dbPath, *queries)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		printIndexStats(s)
+		return
+	}
+
+	ix, err := loadIndex(*dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	st := ix.settings
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "tokens":
+			st.Tokens = *tokens
+		case "storage":
+			st.Storage = *storage
+		case "weights":
+			// Weights given add to the ones the index has.
+			w := make(fieldWeights)
+			for field, n := range st.Weights {
+				w[field] = n
+			}
+			for field, n := range weights {
+				w[field] = n
+			}
+			st.Weights = w
+		}
+	})
+
+	a := startAudit(*dbPath, "index", args)
+	err = tuneIndex(*dbPath, st)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ix, err = loadIndex(*dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	outcome := fmt.Sprintf("Indexed %d comics by %s, kept in %s, weighted %s",
+		len(ix.covered), orDefault(st.Tokens, "trigram"), orDefault(st.Storage, "memory"), st.Weights)
+	fmt.Println(paint(os.Stdout, good, outcome))
+	a.end(outcome)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+
+	return s
+}
+
+// indexStats describes the search index and how fast it searches.
+type indexStats struct {
+	settings indexSettings
+	built    time.Time
+	covered  int
+	// Bytes the index takes on disk.
+	size int64
+	// Distinct tokens, and comics listed under them all told.
+	terms    int
+	postings int
+	// Shards kept in memory after the searches.
+	loaded  int
+	latency latencyStats
+}
+
+// indexStatsOf reads the whole index and times queries searches for
+// phrases picked from stored alt texts, without the remembered results.
+func indexStatsOf(dbPath string, queries int) (indexStats, error) {
+	ix, err := loadIndex(dbPath)
+	if err != nil {
+		return indexStats{}, err
+	}
+	s := indexStats{settings: ix.settings, built: ix.built, covered: len(ix.covered)}
+
+	entries, err := os.ReadDir(ix.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return s, err
+		}
+		s.size += info.Size()
+	}
+
+	ix.mu.Lock()
+	for n := 0; n < indexShards; n++ {
+		shard, err := ix.shard(n)
+		if err != nil {
+			ix.mu.Unlock()
+			return s, err
+		}
+		s.terms += len(shard)
+		for _, posting := range shard {
+			s.postings += len(posting)
+		}
+	}
+	ix.mu.Unlock()
+
+	nums, err := storedComics(dbPath)
+	if err != nil || len(nums) == 0 {
+		return s, err
+	}
+	for i := 0; i < queries; i++ {
+		c, err := readComic(dbPath, nums[rng.Intn(len(nums))])
+		if err != nil {
+			return s, err
+		}
+		query := samplePhrase(c.Alt)
+		if query == "" {
+			query = c.Title
+		}
+
+		ix.forget()
+		start := time.Now()
+		_, err = searchComics(dbPath, query)
+		if err != nil {
+			return s, err
+		}
+		s.latency.latencies = append(s.latency.latencies, time.Since(start))
+	}
+
+	ix.mu.Lock()
+	s.loaded = len(ix.shards)
+	ix.mu.Unlock()
+
+	return s, nil
+}
+
+// samplePhrase picks one or two neighbouring words of text.
+func samplePhrase(text string) string {
+	ws := strings.Fields(text)
+	if len(ws) == 0 {
+		return ""
+	}
+
+	i := rng.Intn(len(ws))
+	if i+1 < len(ws) && rng.Intn(2) == 0 {
+		return ws[i] + " " + ws[i+1]
+	}
+
+	return ws[i]
+}
+
+func printIndexStats(s indexStats) {
+	built := "never"
+	if !s.built.IsZero() {
+		built = s.built.Local().Format("2006-01-02 15:04")
+	}
+	fmt.Printf("Comics covered:  %d\n", s.covered)
+	fmt.Printf("Built:           %s\n", built)
+	fmt.Printf("Tokens:          %s\n", orDefault(s.settings.Tokens, "trigram"))
+	fmt.Printf("Storage:         %s, %d of %d shards loaded\n", orDefault(s.settings.Storage, "memory"), s.loaded, indexShards)
+	fmt.Printf("Weights:         %s\n", s.settings.Weights)
+	fmt.Printf("Size on disk:    %s\n", formatBytes(s.size))
+	fmt.Printf("Terms:           %d\n", s.terms)
+	fmt.Printf("Postings:        %d\n", s.postings)
+	fmt.Printf("Search latency:  p50 %s, p90 %s, p99 %s over %d searches\n",
+		fmtLatency(s.latency.percentile(50)), fmtLatency(s.latency.percentile(90)),
+		fmtLatency(s.latency.percentile(99)), len(s.latency.latencies))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestTuneIndex(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(12))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tuneIndex(db, indexSettings{Tokens: "word", Storage: "disk", Weights: fieldWeights{"transcript": 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := loadIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.settings.Tokens != "word" || ix.settings.Weights.of("transcript") != 7 || ix.settings.Weights.of("alt") != 2 {
+		t.Errorf("settings %+v", ix.settings)
+	}
+
+	// Only whole words narrow.
+	got, err := ix.candidates([]int{1, 2, 10, 11}, "text 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(got, []int{1}) {
+		t.Errorf("candidates %v", got)
+	}
+	if got := searchNums(t, db, "transcript 7"); !equalInts(got, []int{7}) {
+		t.Errorf("found %v", got)
+	}
+	if ix.warm() != nil || len(ix.shards) != 0 {
+		t.Errorf("%d shards kept in memory on disk storage", len(ix.shards))
+	}
+
+	// Later updates keep the settings.
+	err = updateIndex(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix, _ = loadIndex(db); ix.settings.Tokens != "word" {
+		t.Errorf("rebuild dropped the settings: %+v", ix.settings)
+	}
+
+	if tuneIndex(db, indexSettings{Tokens: "letters"}) == nil {
+		t.Error("unknown tokens accepted")
+	}
+	if tuneIndex(db, indexSettings{Weights: fieldWeights{"nope": 1}}) == nil {
+		t.Error("unknown field weighted")
+	}
+}
+
+func TestIndexStats(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(5))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := indexStatsOf(db, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.covered != 5 || s.terms == 0 || s.postings < s.terms || s.size == 0 {
+		t.Errorf("stats %+v", s)
+	}
+	if len(s.latency.latencies) != 20 || s.loaded != indexShards {
+		t.Errorf("%d searches timed, %d shards loaded", len(s.latency.latencies), s.loaded)
+	}
+
+	// Words make a smaller index.
+	err = tuneIndex(db, indexSettings{Tokens: "word"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := indexStatsOf(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words.terms >= s.terms {
+		t.Errorf("%d word terms, %d trigrams", words.terms, s.terms)
+	}
+}
+
+func TestFieldWeightsFlag(t *testing.T) {
+	var f fieldWeightsFlag
+	if err := f.Set("title=5,alt=0"); err != nil || f["title"] != 5 || f["alt"] != 0 {
+		t.Errorf("%v, %v", f, err)
+	}
+	for _, s := range []string{"title", "title=x", "nope=1", "alt=-1"} {
+		var f fieldWeightsFlag
+		if f.Set(s) == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+	if got := fieldWeights(nil).String(); got != "alt=2,tag=3,title=3,transcript=1" {
+		t.Errorf("default weights %s", got)
+	}
+}
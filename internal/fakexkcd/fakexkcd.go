@@ -0,0 +1,259 @@
+// Package fakexkcd serves an in-memory xkcd over httptest so the download
+// engine can be exercised without touching the real site.
+package fakexkcd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Comic is one entry of the fake corpus. ImgName is served under /comics/;
+// leave it empty for comics without an image.
+type Comic struct {
+	Num        int
+	Title      string
+	Alt        string
+	Transcript string
+	Year       string
+	Month      string
+	Day        string
+	ImgName    string
+	Image      []byte
+	// Extra fields for the JSON, like extra_parts.
+	Extra map[string]interface{}
+}
+
+// Server is a running fake. Its URL ends without a slash, like httptest's.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	comics map[int]Comic
+	images map[string]int
+	latest int
+	faults map[string]int
+	hits   map[string]int
+	log    []string
+	// Images are served without ETags, like some mirrors do.
+	noETags bool
+}
+
+// New starts a server serving comics.
+func New(comics ...Comic) *Server {
+	s := &Server{
+		comics: make(map[int]Comic),
+		images: make(map[string]int),
+		faults: make(map[string]int),
+		hits:   make(map[string]int),
+	}
+	for _, c := range comics {
+		s.Add(c)
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Add publishes a comic. The newest comic is the highest number added.
+func (s *Server) Add(c Comic) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.comics[c.Num] = c
+	if c.ImgName != "" {
+		s.images[c.ImgName] = c.Num
+	}
+	if c.Num > s.latest {
+		s.latest = c.Num
+	}
+}
+
+// Fail makes requests for path answer with status until Heal is called.
+func (s *Server) Fail(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults[path] = status
+}
+
+// Heal removes the fault on path.
+func (s *Server) Heal(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.faults, path)
+}
+
+// DisableETags stops images from carrying ETags, so clients can only
+// compare lengths.
+func (s *Server) DisableETags() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.noETags = true
+}
+
+// Hits reports how many times path was requested.
+func (s *Server) Hits(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.hits[path]
+}
+
+// Requests returns every path requested so far, in arrival order.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.log...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	s.hits[path]++
+	s.log = append(s.log, path)
+
+	if status, ok := s.faults[path]; ok {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	if strings.HasPrefix(path, "/comics/") {
+		num, ok := s.images[strings.TrimPrefix(path, "/comics/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Like a CDN: MD5 ETags, conditional requests and byte ranges.
+		img := s.comics[num].Image
+		if !s.noETags {
+			w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(img)))
+		}
+		w.Header().Set("Content-Type", "image/png")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img))
+		return
+	}
+
+	if path == "/archive/" {
+		s.archive(w)
+		return
+	}
+
+	num := s.latest
+	if path != "/info.0.json" {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/info.0.json"))
+		if err != nil || !strings.HasSuffix(path, "/info.0.json") {
+			http.NotFound(w, r)
+			return
+		}
+		num = n
+	}
+
+	c, ok := s.comics[num]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.info(c))
+}
+
+// archive lists every comic newest first, the way xkcd.com/archive/ does.
+func (s *Server) archive(w http.ResponseWriter) {
+	nums := make([]int, 0, len(s.comics))
+	for num := range s.comics {
+		nums = append(nums, num)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(nums)))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintln(w, `<div id="middleContainer" class="box">`)
+	for _, num := range nums {
+		c := s.comics[num]
+		fmt.Fprintf(w, "<a href=\"/%d/\" title=\"%s-%s-%s\">%s</a><br/>\n", num, c.Year, c.Month, c.Day, html.EscapeString(c.Title))
+	}
+	fmt.Fprintln(w, `</div>`)
+}
+
+// info renders a comic the way xkcd's JSON API does.
+func (s *Server) info(c Comic) map[string]interface{} {
+	info := map[string]interface{}{
+		"num":        c.Num,
+		"title":      c.Title,
+		"safe_title": c.Title,
+		"alt":        c.Alt,
+		"transcript": c.Transcript,
+		"year":       c.Year,
+		"month":      c.Month,
+		"day":        c.Day,
+		"link":       "",
+		"news":       "",
+		"img":        s.URL + "/comics/" + c.ImgName,
+	}
+	for k, v := range c.Extra {
+		info[k] = v
+	}
+
+	return info
+}
+
+// Corpus builds comics 1 to n with small distinct images. Like the real
+// xkcd, there is no comic 404.
+func Corpus(n int) []Comic {
+	comics := make([]Comic, 0, n)
+
+	for i := 1; i <= n; i++ {
+		if i == 404 {
+			continue
+		}
+
+		comics = append(comics, Comic{
+			Num:        i,
+			Title:      fmt.Sprintf("Comic %d", i),
+			Alt:        fmt.Sprintf("Alt text %d", i),
+			Transcript: fmt.Sprintf("Transcript %d", i),
+			Year:       strconv.Itoa(2006 + i%15),
+			Month:      strconv.Itoa(1 + i%12),
+			Day:        strconv.Itoa(1 + i%28),
+			ImgName:    fmt.Sprintf("comic_%d.png", i),
+			Image:      Image(i),
+		})
+	}
+
+	return comics
+}
+
+// Image returns a tiny PNG that differs for every seed.
+func Image(seed int) []byte {
+	img := image.NewGray(image.Rect(0, 0, 8, 4))
+	for bit := 0; bit < 32; bit++ {
+		c := color.Gray{Y: 0xff}
+		if seed&(1<<bit) != 0 {
+			c = color.Gray{}
+		}
+		img.SetGray(bit%8, bit/8, c)
+	}
+
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strconv"
+)
+
+// journalFile holds manifest changes made since it was last saved, so a
+// sync that dies halfway loses nothing and leaves no half written comic
+// behind.
+const journalFile = "manifest.journal"
+
+// journalRecord is one line of the journal.
+type journalRecord struct {
+	// "begin" before a comic's files are written, "image" once they all
+	// are, and "sums" when some were written again. A journal starting
+	// with "batched" may have lost its last records.
+	Op   string            `json:"op"`
+	Num  int               `json:"num"`
+	ETag string            `json:"etag,omitempty"`
+	Sums map[string]string `json:"sums,omitempty"`
+}
+
+// log appends r to the journal and, as the fsync policy says, waits for
+// it to reach the disk. m.mu must be held.
+func (m *manifest) log(r journalRecord) error {
+	if m.journal == nil {
+		f, err := os.OpenFile(m.dir+journalFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		m.journal = f
+
+		if journalBatched() {
+			err = m.write(journalRecord{Op: "batched"})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := m.write(r)
+	if err != nil {
+		return err
+	}
+
+	m.unsynced++
+	if fsyncPolicy == fsyncNever || fsyncPolicy == fsyncBatch && m.unsynced < fsyncBatchSize {
+		return nil
+	}
+	m.unsynced = 0
+
+	return m.journal.Sync()
+}
+
+func (m *manifest) write(r journalRecord) error {
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.journal.Write(append(data, '\n'))
+
+	return err
+}
+
+// begin records that a comic's files are about to be written. Until
+// setImage is called for it, they count as incomplete.
+func (m *manifest) begin(num int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pending == nil {
+		m.pending = make(map[int]bool)
+	}
+	m.pending[num] = true
+
+	return m.log(journalRecord{Op: "begin", Num: num})
+}
+
+// rollback removes comics that were begun but never finished, so the next
+// sync downloads them again. m.mu must be held.
+func (m *manifest) rollback() error {
+	for num := range m.pending {
+		err := os.RemoveAll(m.dir + strconv.Itoa(num))
+		if err != nil {
+			return err
+		}
+		delete(m.Comics, num)
+		delete(m.pending, num)
+	}
+
+	return nil
+}
+
+// recoverManifest locks the database for a command that changes it and
+// loads the manifest, first replaying what the journal holds of a run
+// that didn't finish. It fails with errLocked, recovering nothing, while
+// another run holds the lock; otherwise unlock releases it.
+func recoverManifest(dbPath string) (m *manifest, unlock func(), err error) {
+	unlock, err = lockDB(dbPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			unlock()
+		}
+	}()
+
+	m, err = loadManifest(dbPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = m.replay(dbPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.pending == nil {
+		return m, unlock, nil
+	}
+
+	if n := len(m.pending); n > 0 {
+		say("Removing %d comics left half written by an interrupted run\n", n)
+	}
+
+	err = m.save(dbPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return m, unlock, nil
+}
+
+// replay applies the journal to m, leaving the comics it began but never
+// finished in m.pending. Without a journal, m.pending stays nil. Nothing
+// on disk is changed, so it is safe while another run writes the journal.
+func (m *manifest) replay(dbPath string) error {
+	f, err := os.Open(dbPath + journalFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	m.pending = make(map[int]bool)
+	batched := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r journalRecord
+		// The last line may have been cut short by the crash.
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			break
+		}
+
+		switch r.Op {
+		case "batched":
+			batched = true
+		case "begin":
+			m.pending[r.Num] = true
+		case "image":
+			delete(m.pending, r.Num)
+			m.Comics[r.Num] = &manifestEntry{ETag: r.ETag, Sums: r.Sums}
+		case "sums":
+			if e, ok := m.Comics[r.Num]; ok {
+				e.Sums = r.Sums
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	// Every comic finished before the journal began is in the manifest,
+	// so any other was begun by a run whose records didn't all survive.
+	if batched {
+		nums, err := storedComics(dbPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, num := range nums {
+			if _, ok := m.Comics[num]; !ok {
+				m.pending[num] = true
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestJournalRecovery(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A run that dies after finishing comic 2 again and while writing
+	// comic 9.
+	m, unlock, err := recoverManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.setImage(2, `"new"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.begin(9); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(db+"9", 0755); err != nil {
+		t.Fatal(err)
+	}
+	m.journal.Close()
+	unlock()
+
+	// The crash may also cut the last record short.
+	f, err := os.OpenFile(db+journalFile, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"ima`)
+	f.Close()
+
+	m, unlock, err = recoverManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	if got := m.etag(2); got != `"new"` {
+		t.Errorf("comic 2 ETag %q, want the journaled one", got)
+	}
+	if _, err := os.Stat(db + "9"); !os.IsNotExist(err) {
+		t.Error("half written comic 9 was kept")
+	}
+	if _, err := os.Stat(db + journalFile); !os.IsNotExist(err) {
+		t.Error("journal kept after recovery")
+	}
+
+	saved, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.etag(2); got != `"new"` {
+		t.Errorf("recovered ETag %q not saved", got)
+	}
+}
+
+func TestFailedDownloadRolledBack(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	srv.Fail("/comics/comic_2.png", 500)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(db + "2"); !os.IsNotExist(err) {
+		t.Error("comic 2 kept without its image")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listFilter selects stored comics. Zero fields don't filter.
+type listFilter struct {
+	year          string
+	month         string
+	hasTranscript optBool
+	hasImage      optBool
+	special       optBool
+	color         optBool
+	minSize       byteSize
+	maxSize       byteSize
+	tags          tagFlags
+	where         exprFlag
+}
+
+// tagFlags collects -tag flags.
+type tagFlags []string
+
+func (t *tagFlags) String() string {
+	if t == nil {
+		return ""
+	}
+
+	return strings.Join(*t, ",")
+}
+
+func (t *tagFlags) Set(s string) error {
+	err := validTag(s)
+	if err != nil {
+		return err
+	}
+	*t = append(*t, s)
+
+	return nil
+}
+
+// listComic is a stored comic with what the filters look at.
+type listComic struct {
+	Num        int    `json:"num"`
+	Title      string `json:"title"`
+	Date       string `json:"date,omitempty"`
+	Image      string `json:"image,omitempty"`
+	Size       int64  `json:"size"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	Transcript bool   `json:"transcript"`
+	Special    bool   `json:"special"`
+	// Unknown until analyzed.
+	Color *bool `json:"color,omitempty"`
+}
+
+// list prints the stored comics that pass every filter given.
+func list(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	f := listFlags(fs)
+	asJSON := fs.Bool("json", false, "Print a JSON array instead of a table")
+	tableOpts := tableFlags(fs)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db list [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	comics, err := listComics(withSlash(*dbPath), *f)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	t := newTable("num", "title", "date", "size", "width", "height", "transcript", "special")
+	for _, c := range comics {
+		t.add(strconv.Itoa(c.Num), c.Title, c.Date, strconv.FormatInt(c.Size, 10),
+			strconv.Itoa(c.Width), strconv.Itoa(c.Height),
+			strconv.FormatBool(c.Transcript), strconv.FormatBool(c.Special))
+	}
+
+	if *asJSON {
+		err = printListJSON(os.Stdout, comics, t, tableOpts)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	err = tableOpts.print(os.Stdout, t)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// printListJSON writes the comics as a JSON array, picked and ordered by
+// the table options as t's rows would be. With -columns each comic has
+// only those fields.
+func printListJSON(w io.Writer, comics []listComic, t *table, o *tableOptions) error {
+	rows, err := o.pick(t)
+	if err != nil {
+		return err
+	}
+	idx, err := t.index(o.columns)
+	if err != nil {
+		return err
+	}
+
+	out := make([]interface{}, len(rows))
+	for i, r := range rows {
+		out[i] = comics[r]
+		if o.columns == "" {
+			continue
+		}
+
+		b, err := json.Marshal(comics[r])
+		if err != nil {
+			return err
+		}
+		var all map[string]json.RawMessage
+		err = json.Unmarshal(b, &all)
+		if err != nil {
+			return err
+		}
+		some := make(map[string]json.RawMessage)
+		for _, j := range idx {
+			if v, ok := all[t.columns[j]]; ok {
+				some[t.columns[j]] = v
+			}
+		}
+		out[i] = some
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(out)
+}
+
+func listFlags(fs *flag.FlagSet) *listFilter {
+	f := &listFilter{}
+	fs.StringVar(&f.year, "year", "", "Only comics published in this year")
+	fs.StringVar(&f.month, "month", "", "Only comics published in this month, 1-12")
+	fs.Var(&f.hasTranscript, "has-transcript", "Only comics with, or with =false without, a transcript")
+	fs.Var(&f.hasImage, "has-image", "Only comics with, or with =false without, an image")
+	fs.Var(&f.special, "special", "Only interactive comics, or with =false only plain ones")
+	fs.Var(&f.color, "in-color", "Only colour comics, or with =false only black and white ones (needs analyze)")
+	fs.Var(&f.minSize, "min-size", "Only comics whose image is at least this large, e.g. 1MB")
+	fs.Var(&f.maxSize, "max-size", "Only comics whose image is at most this large")
+	fs.Var(&f.tags, "tag", "Only comics with this tag; repeat for comics with every tag given")
+	fs.Var(&f.where, "where", "Only comics the expression is true of, e.g. 'year > 2015 && len(transcript) == 0'; variables are "+strings.Join(comicVarNames(), ", "))
+
+	return f
+}
+
+// listComics returns the stored comics passing f, lowest number first.
+func listComics(dbPath string, f listFilter) ([]listComic, error) {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := loadManifest(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags comicTags
+	if f.where.e != nil || len(f.tags) > 0 {
+		tags, err = loadTags(dbPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	comics := []listComic{}
+	for _, num := range nums {
+		c, lc, err := describeComic(dbPath, num, m)
+		if err != nil {
+			return nil, err
+		}
+
+		c.tags = tags[num]
+		if !f.match(c, lc) {
+			continue
+		}
+		if f.where.e != nil {
+			ok, err := f.where.e.test(comicEnv(c, lc))
+			if err != nil {
+				return nil, fmt.Errorf("comic %d: %v", num, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		comics = append(comics, lc)
+	}
+
+	return comics, nil
+}
+
+// describeComic reads a stored comic and what the filters look at.
+func describeComic(dbPath string, num int, m *manifest) (localComic, listComic, error) {
+	c, err := readComic(dbPath, num)
+	if err != nil {
+		return c, listComic{}, err
+	}
+
+	lc := listComic{
+		Num:        num,
+		Title:      c.Title,
+		Date:       c.date(),
+		Image:      c.ImgPath,
+		Transcript: c.Transcript != "",
+		Special:    c.special(),
+	}
+	// Offloaded images aren't fetched just to be measured.
+	if c.ImgPath != "" && !c.offloaded {
+		info, err := os.Stat(c.ImgPath)
+		if err != nil {
+			return c, lc, err
+		}
+		lc.Size = info.Size()
+	}
+	if e, ok := m.Comics[num]; ok {
+		lc.Width, lc.Height = e.Width, e.Height
+		if e.Colors != nil {
+			color := e.Colors.isColor()
+			lc.Color = &color
+		}
+	}
+
+	return c, lc, nil
+}
+
+func (f *listFilter) match(c localComic, lc listComic) bool {
+	switch {
+	case f.year != "" && c.Year != f.year:
+		return false
+	case f.month != "" && trimZeros(c.Month) != trimZeros(f.month):
+		return false
+	case !f.hasTranscript.is(lc.Transcript):
+		return false
+	case !f.hasImage.is(lc.Image != ""):
+		return false
+	case !f.special.is(lc.Special):
+		return false
+	case f.color.set && (lc.Color == nil || *lc.Color != f.color.val):
+		return false
+	case f.minSize > 0 && lc.Size < int64(f.minSize):
+		return false
+	case f.maxSize > 0 && lc.Size > int64(f.maxSize):
+		return false
+	}
+	for _, want := range f.tags {
+		if !hasTag(c.tags, want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// trimZeros makes "04" and "4" compare equal.
+func trimZeros(s string) string {
+	for len(s) > 1 && s[0] == '0' {
+		s = s[1:]
+	}
+
+	return s
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strconv"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestListComics(t *testing.T) {
+	comics := fakexkcd.Corpus(6)
+	comics[1].Transcript = ""
+	comics[3].Transcript = ""
+	comics[3].Year = comics[1].Year
+	comics[4].Image = make([]byte, 4096)
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = comicTags{1: {"fav"}, 4: {"fav", "old"}}.save(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want []int
+	}{
+		{nil, []int{1, 2, 3, 4, 5, 6}},
+		{[]string{"-has-transcript=false"}, []int{2, 4}},
+		{[]string{"-has-transcript"}, []int{1, 3, 5, 6}},
+		{[]string{"-year", comics[1].Year}, []int{2, 4}},
+		{[]string{"-year", comics[1].Year, "-has-transcript=false", "-month", "05"}, []int{4}},
+		{[]string{"-min-size", "4KiB"}, []int{5}},
+		{[]string{"-max-size", "1KB", "-year", comics[1].Year}, []int{2, 4}},
+		{[]string{"-in-color"}, nil},
+		{[]string{"-tag", "fav"}, []int{1, 4}},
+		{[]string{"-tag", "fav", "-tag", "old"}, []int{4}},
+		{[]string{"-tag", "old", "-year", comics[0].Year}, nil},
+		{[]string{"-where", "num > 3 && len(transcript) == 0"}, []int{4}},
+		{[]string{"-where", `matches(title, "Comic [56]") || size >= 4096`}, []int{5, 6}},
+	}
+
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("list", flag.ContinueOnError)
+		f := listFlags(fs)
+		err := fs.Parse(tt.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := listComics(db, *f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var nums []int
+		for _, c := range got {
+			nums = append(nums, c.Num)
+		}
+		if !equalInts(nums, tt.want) {
+			t.Errorf("%v listed %v, want %v", tt.args, nums, tt.want)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestListJSONSortsBeforeWindow(t *testing.T) {
+	comics := []listComic{{Num: 1, Title: "B", Size: 30}, {Num: 2, Title: "A", Size: 10}, {Num: 3, Title: "C", Size: 20}}
+	tbl := newTable("num", "title", "size")
+	for _, c := range comics {
+		tbl.add(strconv.Itoa(c.Num), c.Title, strconv.FormatInt(c.Size, 10))
+	}
+
+	var buf bytes.Buffer
+	err := printListJSON(&buf, comics, tbl, &tableOptions{sort: "-size", limit: 2, columns: "num,size"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[\n\t{\n\t\t\"num\": 1,\n\t\t\"size\": 30\n\t},\n\t{\n\t\t\"num\": 3,\n\t\t\"size\": 20\n\t}\n]\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	if err := printListJSON(&buf, comics, tbl, &tableOptions{columns: "nope"}); err == nil {
+		t.Error("an unknown column passed")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// splitAddr reads a -listen style address: unix:/path/to.sock for a Unix
+// socket, otherwise host:port over TCP.
+func splitAddr(addr string) (network, address string) {
+	if strings.HasPrefix(addr, "unix:") {
+		return "unix", strings.TrimPrefix(addr, "unix:")
+	}
+
+	return "tcp", addr
+}
+
+// listen opens addr. A Unix socket left by a process that crashed is
+// replaced; one that still answers is an error.
+func listen(addr string) (net.Listener, error) {
+	network, address := splitAddr(addr)
+
+	if network == "unix" {
+		if conn, err := net.Dial("unix", address); err == nil {
+			conn.Close()
+			return nil, errors.New(address + " is in use")
+		}
+		// Only ever a socket: a mistyped path may name a file worth keeping.
+		if info, err := os.Lstat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+
+	return net.Listen(network, address)
+}
+
+// addrURL names addr for people, as a URL where there is one.
+func addrURL(addr string) string {
+	if strings.HasPrefix(addr, "unix:") {
+		return addr
+	}
+
+	return "http://" + addr + "/"
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Words searched for, as visitors might.
+var loadtestQueries = []string{"the", "computer", "science", "love", "math", "password", "graph", "time", "physics", "internet"}
+
+// loadtest sends a mirror the traffic of many visitors and reports how
+// fast it answered.
+func loadtest(args []string) {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 10, "Visitors requesting at once")
+	duration := fs.Duration("duration", 30*time.Second, "How long to keep requesting")
+	tableOpts := tableFlags(fs)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db loadtest [flags] URL [flags]")
+		fmt.Fprintln(fs.Output(), "Start the mirror with -rate 0 to measure it rather than its rate limit.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// Flags may follow the URL too.
+	base := strings.TrimSuffix(fs.Arg(0), "/")
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if offline {
+		log.Fatalln("loadtest needs the network:", errOffline)
+	}
+
+	res, err := runLoadtest(base, *concurrency, *duration)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	t := newTable("kind", "requests", "errors", "throttled", "p50", "p90", "p99", "max")
+	for _, k := range res.kinds() {
+		s := res.stats[k]
+		t.add(k, strconv.Itoa(len(s.latencies)), strconv.Itoa(s.errors), strconv.Itoa(s.throttled),
+			fmtLatency(s.percentile(50)), fmtLatency(s.percentile(90)), fmtLatency(s.percentile(99)), fmtLatency(s.percentile(100)))
+	}
+
+	err = tableOpts.print(os.Stdout, t)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	say("%.1f requests a second from %d visitors over %s\n", float64(res.total())/res.elapsed.Seconds(), *concurrency, res.elapsed.Round(time.Second))
+}
+
+// loadtestResult collects the requests of a load test by kind.
+type loadtestResult struct {
+	mu      sync.Mutex
+	stats   map[string]*latencyStats
+	elapsed time.Duration
+}
+
+type latencyStats struct {
+	latencies []time.Duration
+	errors    int
+	throttled int
+}
+
+func (r *loadtestResult) record(kind string, d time.Duration, status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.stats[kind]
+	if !ok {
+		s = &latencyStats{}
+		r.stats[kind] = s
+	}
+
+	s.latencies = append(s.latencies, d)
+	switch {
+	case status == http.StatusTooManyRequests:
+		s.throttled++
+	case err != nil || status >= 500:
+		s.errors++
+	}
+}
+
+func (r *loadtestResult) kinds() []string {
+	var kinds []string
+	for k := range r.stats {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	return kinds
+}
+
+func (r *loadtestResult) total() int {
+	n := 0
+	for _, s := range r.stats {
+		n += len(s.latencies)
+	}
+
+	return n
+}
+
+// percentile is the latency p percent of requests beat or matched.
+func (s *latencyStats) percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+
+	sorted := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+
+	return sorted[i]
+}
+
+func fmtLatency(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(100 * time.Microsecond).String()
+	}
+
+	return d.Round(time.Microsecond).String()
+}
+
+// runLoadtest has concurrency visitors request pages, images and searches
+// from the mirror at base for duration. Visitors favour recent comics.
+func runLoadtest(base string, concurrency int, duration time.Duration) (*loadtestResult, error) {
+	latest, err := loadtestLatest(base)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &loadtestResult{stats: make(map[string]*latencyStats)}
+	start := time.Now()
+	deadline := start.Add(duration)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for time.Now().Before(deadline) {
+				kind, path := loadtestRequest(latest)
+
+				t := time.Now()
+				status, err := loadtestGet(base + path)
+				res.record(kind, time.Since(t), status, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	res.elapsed = time.Since(start)
+
+	return res, nil
+}
+
+// loadtestLatest asks the mirror's xkcd-compatible API for its newest
+// comic.
+func loadtestLatest(base string) (int, error) {
+	resp, err := client.Get(base + "/" + jsonFile)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s/%s: %s; is it an xkcd-db serve?", base, jsonFile, resp.Status)
+	}
+
+	var c Comic
+	err = json.NewDecoder(resp.Body).Decode(&c)
+	if err != nil {
+		return 0, err
+	}
+	if c.Num < 1 {
+		return 0, errors.New("the mirror has no comics")
+	}
+
+	return c.Num, nil
+}
+
+// loadtestRequest picks what a visitor asks for next: mostly comic
+// pages, then their images, then searches.
+func loadtestRequest(latest int) (string, string) {
+	num := 1 + rng.Intn(latest)
+	if recent := latest / 10; recent > 0 && rng.Float64() < 0.5 {
+		num = latest - rng.Intn(recent)
+	}
+
+	switch r := rng.Float64(); {
+	case r < 0.6:
+		return "page", "/comic/" + strconv.Itoa(num)
+	case r < 0.85:
+		return "image", "/img/" + strconv.Itoa(num)
+	}
+
+	q := loadtestQueries[rng.Intn(len(loadtestQueries))]
+	return "search", "/api/search?q=" + url.QueryEscape(q)
+}
+
+// loadtestGet fetches a whole response, as a browser would.
+func loadtestGet(u string) (int, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, err
+}
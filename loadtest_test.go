@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestLoadtest(t *testing.T) {
+	ts, _ := testServer(t, fakexkcd.Corpus(20))
+
+	res, err := runLoadtest(ts.URL, 4, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.total() == 0 {
+		t.Fatal("no requests made")
+	}
+	for _, k := range res.kinds() {
+		s := res.stats[k]
+		if s.errors > 0 || s.throttled > 0 {
+			t.Errorf("%s: %d errors, %d throttled", k, s.errors, s.throttled)
+		}
+	}
+	if _, ok := res.stats["page"]; !ok {
+		t.Errorf("no pages requested: %v", res.kinds())
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	s := &latencyStats{}
+	for i := 100; i >= 1; i-- {
+		s.latencies = append(s.latencies, time.Duration(i)*time.Millisecond)
+	}
+
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond, 0: time.Millisecond} {
+		if got := s.percentile(p); got != want {
+			t.Errorf("p%v = %s, want %s", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// fileSums hashes the files in a comic directory, so changes made to them
+// outside xkcd-db can be told apart later.
+func fileSums(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]string)
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+
+		sum, err := fileSum(dir + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		sums[e.Name()] = sum
+	}
+
+	return sums, nil
+}
+
+func fileSum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localEdits maps the files of a comic that changed since xkcd-db last
+// wrote them to their checksums back then. Files written before checksums
+// were kept never count.
+func (m *manifest) localEdits(num int) (map[string]string, error) {
+	m.mu.Lock()
+	var recorded map[string]string
+	if e, ok := m.Comics[num]; ok {
+		recorded = e.Sums
+	}
+	m.mu.Unlock()
+
+	dir := m.dir + strconv.Itoa(num) + "/"
+	edited := make(map[string]string)
+	for name, want := range recorded {
+		got, err := fileSum(dir + name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			edited[name] = want
+		}
+	}
+
+	return edited, nil
+}
+
+// updateSums records the checksums of a comic's files as they are now,
+// except for the files in keep, whose recorded checksums are given.
+func (m *manifest) updateSums(num int, keep map[string]string) error {
+	sums, err := fileSums(m.dir + strconv.Itoa(num) + "/")
+	if err != nil {
+		return err
+	}
+	for name, sum := range keep {
+		sums[name] = sum
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.log(journalRecord{Op: "sums", Num: num, Sums: sums})
+	if err != nil {
+		return err
+	}
+
+	e, ok := m.Comics[num]
+	if !ok || sameSums(e.Sums, sums) {
+		return nil
+	}
+	e.Sums = sums
+
+	return recordChange(m.dir, "refreshed", num)
+}
+
+// sameSums reports whether two sets of file sums are the same files.
+func sameSums(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, sum := range a {
+		if b[name] != sum {
+			return false
+		}
+	}
+
+	return true
+}
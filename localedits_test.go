@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestRefreshKeepsLocalEdits(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(2))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone fixes a transcript and swaps an image by hand.
+	err = os.WriteFile(db+"2/2-transcript", []byte("Better transcript"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(db+"2/comic_2.png", []byte("my image"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := fakexkcd.Corpus(2)[1]
+	c.Alt = "Fixed alt text"
+	c.Transcript = "Upstream transcript"
+	c.Image = fakexkcd.Image(99)
+	srv.Add(c)
+
+	opts := syncOptions{rateLimit: 2, refresh: true, images: true}
+	_, err = syncDB(db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(readFile(t, db+"2/2-alt")); got != c.Alt {
+		t.Errorf("alt = %q, want %q", got, c.Alt)
+	}
+	if got := string(readFile(t, db+"2/2-transcript")); got != "Better transcript" {
+		t.Errorf("edited transcript overwritten with %q", got)
+	}
+	if got := string(readFile(t, db+"2/comic_2.png")); got != "my image" {
+		t.Error("replaced image overwritten")
+	}
+
+	// The edits still count as edits on the next refresh.
+	_, err = syncDB(db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(readFile(t, db+"2/2-transcript")); got != "Better transcript" {
+		t.Errorf("second refresh overwrote the transcript with %q", got)
+	}
+
+	opts.force = true
+	_, err = syncDB(db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(readFile(t, db+"2/2-transcript")); got != c.Transcript {
+		t.Errorf("forced refresh left transcript %q", got)
+	}
+	if got := readFile(t, db+"2/comic_2.png"); !bytes.Equal(got, c.Image) {
+		t.Error("forced refresh left the replaced image")
+	}
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edits, err := m.localEdits(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 0 {
+		t.Errorf("after a forced refresh, edits %v", edits)
+	}
+}
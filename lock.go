@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// lockFile is held by the run writing the database, so that no other run
+// mistakes the comics it is writing for ones an interrupted run left half
+// written, and removes them.
+const lockFile = "write.lock"
+
+var errLocked = errors.New("another run is writing the database; try again when it finishes")
+
+// Runs in one process share a database's lock: they take turns by other
+// means, and one may call another.
+var dbLocks = struct {
+	sync.Mutex
+	held map[string]*dbLock
+}{held: make(map[string]*dbLock)}
+
+type dbLock struct {
+	f     *os.File
+	users int
+}
+
+// lockDB takes the database's lock without waiting for it, and returns
+// what releases it.
+func lockDB(dbPath string) (func(), error) {
+	key, err := filepath.Abs(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dbLocks.Lock()
+	defer dbLocks.Unlock()
+
+	l, ok := dbLocks.held[key]
+	if !ok {
+		f, err := openLocked(dbPath + lockFile)
+		if err != nil {
+			return nil, err
+		}
+		l = &dbLock{f: f}
+		dbLocks.held[key] = l
+	}
+	l.users++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			dbLocks.Lock()
+			defer dbLocks.Unlock()
+
+			l.users--
+			if l.users == 0 {
+				l.f.Close()
+				delete(dbLocks.held, key)
+			}
+		})
+	}, nil
+}
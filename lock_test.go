@@ -0,0 +1,117 @@
+//go:build linux || freebsd || netbsd || openbsd || dragonfly || darwin || windows
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestLockDB(t *testing.T) {
+	db := withSlash(t.TempDir())
+
+	unlock, err := lockDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Runs in this process share the lock.
+	again, err := lockDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again()
+
+	// As another process would find it.
+	if _, err := openLocked(db + lockFile); err != errLocked {
+		t.Errorf("got %v while the lock is held, want errLocked", err)
+	}
+
+	unlock()
+	f, err := openLocked(db + lockFile)
+	if err != nil {
+		t.Fatalf("lock not released: %v", err)
+	}
+	f.Close()
+}
+
+func TestRecoveryWaitsForWriter(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range fakexkcd.Corpus(5)[3:] {
+		srv.Add(c)
+	}
+
+	// Another process's sync, halfway through writing comic 4.
+	f, err := openLocked(db + lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.begin(4); err != nil {
+		t.Fatal(err)
+	}
+	defer m.journal.Close()
+	if err := os.Mkdir(db+"4", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := recoverManifest(db); err != errLocked {
+		t.Errorf("recovered with the database locked: %v", err)
+	}
+	if _, err := ensureComic(db, 5); err == nil || !strings.Contains(err.Error(), "another run") {
+		t.Errorf("show fetched comic 5 while a sync was writing: %v", err)
+	}
+	if _, err := syncDB(db, syncOptions{rateLimit: 2}); err != errLocked {
+		t.Errorf("second sync got %v, want errLocked", err)
+	}
+
+	for _, path := range []string{db + "4", db + journalFile} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("the writer's %s is gone: %v", path, err)
+		}
+	}
+}
+
+func TestExcludeWaitsForWriter(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := openLocked(db + lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ex, err := loadExclusions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := excludeComics(db, ex, []int{2}, ""); err != errLocked {
+		t.Errorf("excluded while a sync was writing: %v", err)
+	}
+	if _, err := excludeMatches(db, []int{2}, ""); err != errLocked {
+		t.Errorf("search -apply exclude while a sync was writing: %v", err)
+	}
+	if _, err := os.Stat(db + "2"); err != nil {
+		t.Errorf("comic 2 went to the trash: %v", err)
+	}
+	if _, err := os.Stat(db + excludeFile); !os.IsNotExist(err) {
+		t.Errorf("exclusions saved: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build linux || freebsd || netbsd || openbsd || dragonfly || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// openLocked opens path with an exclusive lock, which the system drops if
+// the process dies.
+func openLocked(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			err = errLocked
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// ERROR_SHARING_VIOLATION, which syscall doesn't name.
+const errSharingViolation = syscall.Errno(32)
+
+// openLocked opens path shared with no one, which is as good as an
+// exclusive lock until the file is closed or the process dies.
+func openLocked(path string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errSharingViolation {
+		return nil, errLocked
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+
+	return os.NewFile(uintptr(h), path), nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const manifestFile = "manifest.json"
+
+// The manifest records metadata derived from stored files, so it doesn't
+// have to be worked out again on every run.
+type manifest struct {
+	Comics map[int]*manifestEntry `json:"comics"`
+
+	// Guards Comics while downloads record ETags.
+	mu sync.Mutex
+
+	// The database directory, and the journal of changes since the last
+	// save while there are any.
+	dir     string
+	journal *os.File
+	// Journal records written since it was last synced.
+	unsynced int
+	// Comics begun but not finished since the last save.
+	pending map[int]bool
+}
+
+type manifestEntry struct {
+	// Image dimensions and decoder name, e.g. "png". Empty for comics
+	// without an image.
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Format string `json:"format,omitempty"`
+
+	// Filled in by analyze.
+	Panels []panel     `json:"panels,omitempty"`
+	Colors *colorStats `json:"colors,omitempty"`
+
+	// The image's ETag when it was downloaded, if the server sent one.
+	ETag string `json:"etag,omitempty"`
+
+	// SHA-256 of each file as xkcd-db wrote it, to notice local edits.
+	Sums map[string]string `json:"sums,omitempty"`
+}
+
+func loadManifest(dbPath string) (*manifest, error) {
+	m := &manifest{Comics: make(map[int]*manifestEntry), dir: dbPath}
+
+	data, err := os.ReadFile(dbPath + manifestFile)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, m)
+	if m.Comics == nil {
+		m.Comics = make(map[int]*manifestEntry)
+	}
+
+	return m, err
+}
+
+// save replaces the manifest atomically so readers never see half of it.
+// Comics left unfinished are removed first, and once the manifest is safely
+// on disk the journal is no longer needed.
+func (m *manifest) save(dbPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.rollback()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp := dbPath + manifestFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil && fsyncPolicy != fsyncNever {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dbPath+manifestFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	if m.journal != nil {
+		m.journal.Close()
+		m.journal = nil
+		m.unsynced = 0
+	}
+	err = os.Remove(dbPath + journalFile)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return err
+}
+
+// index adds entries for stored comics the manifest doesn't know yet and
+// reports how many it added.
+func (m *manifest) index(dbPath string) (int, error) {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, num := range nums {
+		entry, ok := m.Comics[num]
+		// Entries without a format are measured again, e.g. after a new
+		// image was downloaded.
+		if ok && entry.Format != "" {
+			continue
+		}
+		if !ok {
+			entry = &manifestEntry{}
+			m.Comics[num] = entry
+			added++
+		}
+
+		if path, err := comicImagePath(dbPath, num); err == nil {
+			// Only the header is decoded; unreadable images are recorded
+			// without dimensions.
+			f, err := os.Open(path)
+			if err != nil {
+				return added, err
+			}
+			cfg, format, err := image.DecodeConfig(f)
+			f.Close()
+			if err == nil {
+				entry.Width, entry.Height, entry.Format = cfg.Width, cfg.Height, format
+			}
+		}
+	}
+
+	return added, nil
+}
+
+// etag returns the stored image ETag of a comic.
+func (m *manifest) etag(num int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.Comics[num]; ok {
+		return e.ETag
+	}
+
+	return ""
+}
+
+// setImage records that a comic's files, with its image if it has one,
+// are complete. Everything derived from an old image is dropped; index and
+// analyze work it out again.
+func (m *manifest) setImage(num int, etag string) error {
+	sums, err := fileSums(m.dir + strconv.Itoa(num) + "/")
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err = m.log(journalRecord{Op: "image", Num: num, ETag: etag, Sums: sums})
+	if err != nil {
+		return err
+	}
+
+	delete(m.pending, num)
+	op := "added"
+	if e, ok := m.Comics[num]; ok {
+		op = "refreshed"
+		if sameSums(e.Sums, sums) {
+			op = ""
+		}
+	}
+	m.Comics[num] = &manifestEntry{ETag: etag, Sums: sums}
+
+	if op == "" {
+		return nil
+	}
+	return recordChange(m.dir, op, num)
+}
+
+// updateManifest indexes newly stored comics and saves m.
+func updateManifest(dbPath string, m *manifest) error {
+	_, err := m.index(dbPath)
+	if err != nil {
+		return err
+	}
+
+	return m.save(dbPath)
+}
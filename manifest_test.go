@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestSyncRecordsImageSizes(t *testing.T) {
+	comics := fakexkcd.Corpus(3)
+	comics[2].ImgName = ""
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e := m.Comics[1]; e == nil || e.Width != 8 || e.Height != 4 || e.Format != "png" {
+		t.Errorf("comic 1 entry = %+v", e)
+	}
+	if e := m.Comics[3]; e == nil || e.Format != "" {
+		t.Errorf("comic 3 entry = %+v", e)
+	}
+}
+
+func TestSyncIndexesExistingDatabase(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(2))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A database built before the manifest existed.
+	err = os.Remove(db + manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil || res.attempted != 0 {
+		t.Fatalf("sync = %d, %v", res.attempted, err)
+	}
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Comics) != 2 {
+		t.Errorf("manifest has %d comics, want 2", len(m.Comics))
+	}
+}
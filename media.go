@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// catalogFile is on every volume of a media set and lists the whole set,
+// so any one volume inserted tells which holds a comic.
+const catalogFile = "catalog.json"
+
+// Optical discs store files in blocks of this size, so every file is
+// counted as whole blocks.
+const mediaBlock = 2048
+
+// mediaCatalog describes a media set: an archive split over volumes, each
+// of them a database of its own.
+type mediaCatalog struct {
+	// When the set was exported; volumes of different exports don't mix.
+	Created time.Time `json:"created"`
+	// The volume the catalog is on.
+	Volume  string         `json:"volume"`
+	Volumes []mediaVolume  `json:"volumes"`
+	Comics  []catalogComic `json:"comics"`
+}
+
+type mediaVolume struct {
+	Name  string `json:"name"`
+	First int    `json:"first"`
+	Last  int    `json:"last"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+// catalogComic is what the catalog shows of a comic without its volume.
+type catalogComic struct {
+	Num    int    `json:"num"`
+	Title  string `json:"title"`
+	Date   string `json:"date,omitempty"`
+	Volume string `json:"volume"`
+}
+
+// volumeName is volume n, counting from 1, of the media set named like
+// DVD-{n}.
+func volumeName(set string, n int) string {
+	return strings.ReplaceAll(set, "{n}", strconv.Itoa(n))
+}
+
+func checkMediaSet(set string) error {
+	if !strings.Contains(set, "{n}") {
+		return errors.New("media set names need {n} for the volume number, e.g. DVD-{n}")
+	}
+	if name := volumeName(set, 1); strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return errors.New("media set names are directory names, without slashes")
+	}
+
+	return nil
+}
+
+// blocks rounds a file size up to whole media blocks.
+func blocks(size int64) int64 {
+	return (size + mediaBlock - 1) / mediaBlock * mediaBlock
+}
+
+// exportMedia splits nums, or every stored comic if nums is empty, into
+// volumes named after set of at most maxSize bytes each, as directories
+// in dest to burn or copy onto media. Comics stay in order, so each
+// volume holds a range of them.
+func exportMedia(dbPath, dest string, nums []int, set string, maxSize int64) ([]mediaVolume, error) {
+	err := checkMediaSet(set)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		return nil, errors.New("a media set needs -max-size, e.g. 4.3GB")
+	}
+
+	snap, done, err := snapshotDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if len(nums) == 0 {
+		nums, err = storedComics(snap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(nums) == 0 {
+		return nil, errors.New("no comics to export")
+	}
+
+	m, err := loadManifest(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	cat := mediaCatalog{Created: time.Now().UTC()}
+	sizes := make([]int64, len(nums))
+	for i, num := range nums {
+		c, err := readComic(snap, num)
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("comic %d is not mirrored", num)
+		}
+		if err == nil {
+			// Offloaded images go onto the volume too.
+			err = c.fetchImage()
+		}
+		if err == nil {
+			sizes[i], err = comicSize(snap, num)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The comic's part of the volume's manifest.
+		entry, _ := json.MarshalIndent(m.Comics[num], "\t\t", "\t")
+		sizes[i] += int64(len(entry)) + 16
+
+		cat.Comics = append(cat.Comics, catalogComic{Num: num, Title: c.Title, Date: c.date()})
+	}
+
+	// Every volume carries the catalog, which grows with the volumes it
+	// lists; pack again until the room left for it is enough.
+	var reserve int64
+	for {
+		room := maxSize - reserve
+		if room <= 0 {
+			return nil, fmt.Errorf("%s is too small for the catalog", formatBytes(maxSize))
+		}
+		err = packVolumes(&cat, set, sizes, room)
+		if err != nil {
+			return nil, err
+		}
+
+		cat.Volume = volumeName(set, len(cat.Volumes))
+		data, _ := json.MarshalIndent(cat, "", "\t")
+		need := blocks(int64(len(data))) + mediaBlock
+		if need <= reserve {
+			break
+		}
+		reserve = need
+	}
+
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return nil, err
+	}
+	dest = withSlash(dest)
+
+	for _, v := range cat.Volumes {
+		err = writeVolume(snap, dest, v.Name, cat, m)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cat.Volumes, nil
+}
+
+// packVolumes assigns the catalog's comics, of the sizes given, to
+// volumes of room bytes in order.
+func packVolumes(cat *mediaCatalog, set string, sizes []int64, room int64) error {
+	cat.Volumes = nil
+
+	var v *mediaVolume
+	for i := range cat.Comics {
+		c := &cat.Comics[i]
+		if sizes[i] > room {
+			return fmt.Errorf("comic %d needs %s, more than a volume holds", c.Num, formatBytes(sizes[i]))
+		}
+		if v == nil || v.Size+sizes[i] > room {
+			cat.Volumes = append(cat.Volumes, mediaVolume{Name: volumeName(set, len(cat.Volumes)+1), First: c.Num})
+			v = &cat.Volumes[len(cat.Volumes)-1]
+		}
+		v.Last = c.Num
+		v.Count++
+		v.Size += sizes[i]
+		c.Volume = v.Name
+	}
+
+	return nil
+}
+
+// comicSize is how much room a stored comic's files take on media.
+func comicSize(dbPath string, num int) (int64, error) {
+	entries, err := os.ReadDir(dbPath + strconv.Itoa(num))
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, e := range entries {
+		if e.IsDir() || tempName(e.Name()) != "" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return 0, err
+		}
+		size += blocks(info.Size())
+	}
+
+	return size, nil
+}
+
+// writeVolume writes the comics the catalog puts on the named volume into
+// its directory in dest, with their manifest entries and the catalog.
+func writeVolume(snap, dest, name string, cat mediaCatalog, m *manifest) error {
+	dir := dest + name + "/"
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("%s already exists; remove it or export elsewhere", dir)
+	}
+	err := os.Mkdir(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	vm := &manifest{Comics: make(map[int]*manifestEntry)}
+	for _, c := range cat.Comics {
+		if c.Volume != name {
+			continue
+		}
+
+		item := strconv.Itoa(c.Num) + "/"
+		err = os.Mkdir(dir+item, 0755)
+		if err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(snap + item)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.IsDir() || tempName(e.Name()) != "" {
+				continue
+			}
+			_, err = snapshotFile(snap+item+e.Name(), dir+item+e.Name(), false)
+			if err != nil {
+				return err
+			}
+		}
+
+		if entry, ok := m.Comics[c.Num]; ok {
+			vm.Comics[c.Num] = entry
+		}
+	}
+
+	err = vm.save(dir)
+	if err != nil {
+		return err
+	}
+
+	cat.Volume = name
+	data, err := json.MarshalIndent(cat, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dir+catalogFile, data, 0644)
+}
+
+// mediaSet is a media set as far as its volumes are inserted.
+type mediaSet struct {
+	cat mediaCatalog
+	// Where each inserted volume is.
+	inserted map[string]string
+}
+
+// findVolumes looks for the volumes of a media set in dirs, each either a
+// volume or a directory they are mounted in. Where volumes of several
+// exports are found, the newest export's are used.
+func findVolumes(dirs []string) (*mediaSet, error) {
+	var found []string
+	for _, dir := range dirs {
+		dir = withSlash(dir)
+		if _, err := os.Stat(dir + catalogFile); err == nil {
+			found = append(found, dir)
+			continue
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			sub := dir + e.Name() + "/"
+			if _, err := os.Stat(sub + catalogFile); e.IsDir() && err == nil {
+				found = append(found, sub)
+			}
+		}
+	}
+
+	var set *mediaSet
+	var others []string
+	for _, dir := range found {
+		var cat mediaCatalog
+		data, err := os.ReadFile(dir + catalogFile)
+		if err == nil {
+			err = json.Unmarshal(data, &cat)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", dir+catalogFile, err)
+		}
+
+		switch {
+		case set == nil || cat.Created.After(set.cat.Created):
+			if set != nil {
+				for _, path := range set.inserted {
+					others = append(others, path)
+				}
+			}
+			set = &mediaSet{cat: cat, inserted: make(map[string]string)}
+		case !cat.Created.Equal(set.cat.Created):
+			others = append(others, dir)
+			continue
+		}
+		set.inserted[cat.Volume] = dir
+	}
+
+	if set == nil {
+		return nil, errors.New("no volumes of a media set in " + strings.Join(dirs, ", "))
+	}
+	sort.Strings(others)
+	for _, dir := range others {
+		say("Ignoring %s, from an older export\n", dir)
+	}
+
+	return set, nil
+}
+
+// comic reads a comic from its volume, if that is inserted.
+func (s *mediaSet) comic(num int) (localComic, error) {
+	comics := s.cat.Comics
+	i := sort.Search(len(comics), func(i int) bool { return comics[i].Num >= num })
+	if i == len(comics) || comics[i].Num != num {
+		return localComic{}, fmt.Errorf("comic %d is not in the media set", num)
+	}
+
+	dir, ok := s.inserted[comics[i].Volume]
+	if !ok {
+		return localComic{}, fmt.Errorf("comic %d is on %s; insert it", num, comics[i].Volume)
+	}
+
+	return readComic(dir, num)
+}
+
+// mediaCmd browses a media set written by export -media-set, across
+// whichever of its volumes are inserted.
+func mediaCmd(args []string) {
+	fs := flag.NewFlagSet("media", flag.ExitOnError)
+	showNum := fs.Int("show", 0, "Print this comic, or say which volume to insert for it")
+	listComics := fs.Bool("comics", false, "List every comic of the set and its volume, rather than the volumes")
+	view := viewerFlags(fs)
+	tableOpts := tableFlags(fs)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db media [flags] dir...")
+		fmt.Fprintln(fs.Output(), "Each dir is a volume or where volumes are mounted, e.g. /media/$USER.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	set, err := findVolumes(fs.Args())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *showNum != 0 {
+		c, err := set.comic(*showNum)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		printComic(c)
+		if view.open {
+			err = view.openComics([]localComic{c})
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+		return
+	}
+
+	var t *table
+	if *listComics {
+		t = newTable("num", "title", "date", "volume", "inserted")
+		for _, c := range set.cat.Comics {
+			_, ok := set.inserted[c.Volume]
+			t.add(strconv.Itoa(c.Num), c.Title, c.Date, c.Volume, strconv.FormatBool(ok))
+		}
+	} else {
+		t = newTable("volume", "comics", "count", "size", "inserted")
+		for _, v := range set.cat.Volumes {
+			path, ok := set.inserted[v.Name]
+			if !ok {
+				path = "no"
+			}
+			t.add(v.Name, fmt.Sprintf("%d-%d", v.First, v.Last), strconv.Itoa(v.Count), formatBytes(v.Size), path)
+		}
+	}
+
+	err = tableOpts.print(os.Stdout, t)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
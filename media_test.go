@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestExportMediaSet(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(6))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := withSlash(t.TempDir())
+	const maxSize = 24 << 10
+	vols, err := exportMedia(db, dest, nil, "DVD-{n}", maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vols) < 2 {
+		t.Fatalf("%d volumes, want several", len(vols))
+	}
+
+	seen := 0
+	for i, v := range vols {
+		if v.Name != volumeName("DVD-{n}", i+1) {
+			t.Errorf("volume %d is named %s", i+1, v.Name)
+		}
+		dir := dest + v.Name + "/"
+		nums, err := storedComics(dir)
+		if err != nil || len(nums) != v.Count || nums[0] != v.First || nums[len(nums)-1] != v.Last {
+			t.Errorf("%s holds %v, %v; catalog says %+v", v.Name, nums, err, v)
+		}
+		seen += len(nums)
+
+		var used int64
+		for _, num := range nums {
+			size, _ := comicSize(dir, num)
+			used += size
+		}
+		for _, name := range []string{manifestFile, catalogFile} {
+			info, err := os.Stat(dir + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			used += blocks(info.Size())
+		}
+		if used > maxSize {
+			t.Errorf("%s takes %d bytes, more than %d", v.Name, used, maxSize)
+		}
+	}
+	if seen != 6 {
+		t.Errorf("volumes hold %d comics, want 6", seen)
+	}
+
+	_, err = exportMedia(db, dest, nil, "DVD-{n}", maxSize)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("exporting over a set: %v", err)
+	}
+	_, err = exportMedia(db, withSlash(t.TempDir()), nil, "DVD", maxSize)
+	if err == nil {
+		t.Error("a set without {n} was accepted")
+	}
+	_, err = exportMedia(db, withSlash(t.TempDir()), nil, "DVD-{n}", 4<<10)
+	if err == nil {
+		t.Error("volumes too small for a comic were accepted")
+	}
+}
+
+func TestMediaReader(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(6))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := withSlash(t.TempDir())
+	vols, err := exportMedia(db, dest, nil, "DVD-{n}", 24<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the last volume is inserted.
+	last := vols[len(vols)-1]
+	set, err := findVolumes([]string{dest + last.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.cat.Comics) != 6 || len(set.cat.Volumes) != len(vols) {
+		t.Fatalf("catalog lists %d comics on %d volumes", len(set.cat.Comics), len(set.cat.Volumes))
+	}
+
+	c, err := set.comic(last.Last)
+	if err != nil || c.Title != "Comic 6" || c.ImgPath == "" {
+		t.Errorf("comic on the inserted volume: %v, %+v", err, c)
+	}
+	_, err = set.comic(1)
+	if err == nil || !strings.Contains(err.Error(), "on "+vols[0].Name) {
+		t.Errorf("comic on a missing volume: %v", err)
+	}
+	if _, err = set.comic(7); err == nil {
+		t.Error("comic outside the set was found")
+	}
+
+	// All of them, found where they are mounted.
+	set, err = findVolumes([]string{dest})
+	if err != nil || len(set.inserted) != len(vols) {
+		t.Fatalf("%v, inserted %v", err, set.inserted)
+	}
+	if _, err = set.comic(1); err != nil {
+		t.Error(err)
+	}
+}
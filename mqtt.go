@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// MQTT 3.1.1 packet types, as the high nibble of the first byte.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttDisconnect = 14
+)
+
+// mqttOptions configure announcing new comics to an MQTT broker, e.g. for
+// home automation.
+type mqttOptions struct {
+	broker string
+	topic  string
+	user   string
+	retain bool
+}
+
+func mqttFlags(fs *flag.FlagSet) *mqttOptions {
+	o := &mqttOptions{}
+	fs.StringVar(&o.broker, "mqtt-broker", "", "MQTT broker to announce new comics to, as host:port, tcp://host:port or tls://host:port")
+	fs.StringVar(&o.topic, "mqtt-topic", "xkcd/new", "Topic to publish new comics on")
+	fs.StringVar(&o.user, "mqtt-user", "", "MQTT username. The password is read from XKCDDB_MQTT_PASSWORD")
+	fs.BoolVar(&o.retain, "mqtt-retain", false, "Have the broker keep the newest comic for later subscribers")
+
+	return o
+}
+
+// mqttComic is the message published for each new comic.
+type mqttComic struct {
+	Num   int    `json:"num"`
+	Title string `json:"title"`
+	Alt   string `json:"alt"`
+	Date  string `json:"date"`
+	Img   string `json:"img"`
+}
+
+// announce publishes a message for each comic, lowest number first, at
+// least once each.
+func (o *mqttOptions) announce(dbPath string, nums []int) error {
+	if o.broker == "" || len(nums) == 0 {
+		return nil
+	}
+
+	conn, err := dialMQTT(o.broker, o.user, os.Getenv("XKCDDB_MQTT_PASSWORD"))
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	for _, num := range nums {
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return err
+		}
+
+		msg, err := json.Marshal(mqttComic{Num: num, Title: c.Title, Alt: c.Alt, Date: c.date(), Img: c.Img})
+		if err != nil {
+			return err
+		}
+
+		err = conn.publish(o.topic, msg, o.retain)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mqttConn is a connection to a broker that publishes with QoS 1 and
+// waits for each acknowledgement.
+type mqttConn struct {
+	c  net.Conn
+	r  *bufio.Reader
+	id uint16
+}
+
+func dialMQTT(broker, user, password string) (*mqttConn, error) {
+	addr := broker
+	useTLS := false
+	switch {
+	case strings.HasPrefix(addr, "tls://"), strings.HasPrefix(addr, "ssl://"):
+		addr, useTLS = addr[len("tls://"):], true
+	case strings.HasPrefix(addr, "tcp://"), strings.HasPrefix(addr, "mqtt://"):
+		addr = addr[strings.Index(addr, "://")+3:]
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		port := "1883"
+		if useTLS {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(addr, port)
+	}
+
+	if offline {
+		return nil, errOffline
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var c net.Conn
+	var err error
+	if useTLS {
+		c, err = tls.DialWithDialer(dialer, "tcp", addr, nil)
+	} else {
+		c, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &mqttConn{c: c, r: bufio.NewReader(c)}
+	err = conn.connect(user, password)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (m *mqttConn) connect(user, password string) error {
+	var flags byte = 0x02 // clean session
+	payload := mqttString(fmt.Sprintf("xkcd-db-%d", os.Getpid()))
+	if user != "" {
+		flags |= 0x80 | 0x40
+		payload = append(payload, mqttString(user)...)
+		payload = append(payload, mqttString(password)...)
+	}
+
+	body := append(mqttString("MQTT"), 4, flags, 0, 60)
+	err := m.write(mqttConnect<<4, append(body, payload...))
+	if err != nil {
+		return err
+	}
+
+	typ, resp, err := readMQTTPacket(m.r)
+	if err != nil {
+		return err
+	}
+	if typ>>4 != mqttConnack || len(resp) != 2 {
+		return errors.New("mqtt: broker didn't acknowledge the connection")
+	}
+	if resp[1] != 0 {
+		return fmt.Errorf("mqtt: broker refused the connection with code %d", resp[1])
+	}
+
+	return nil
+}
+
+func (m *mqttConn) publish(topic string, msg []byte, retain bool) error {
+	m.id++
+	if m.id == 0 {
+		m.id = 1
+	}
+
+	var header byte = mqttPublish<<4 | 0x02 // QoS 1
+	if retain {
+		header |= 0x01
+	}
+
+	body := mqttString(topic)
+	body = append(body, byte(m.id>>8), byte(m.id))
+	err := m.write(header, append(body, msg...))
+	if err != nil {
+		return err
+	}
+
+	typ, resp, err := readMQTTPacket(m.r)
+	if err != nil {
+		return err
+	}
+	if typ>>4 != mqttPuback || len(resp) != 2 || binary.BigEndian.Uint16(resp) != m.id {
+		return errors.New("mqtt: broker didn't acknowledge a message")
+	}
+
+	return nil
+}
+
+func (m *mqttConn) close() error {
+	m.write(mqttDisconnect<<4, nil)
+	return m.c.Close()
+}
+
+func (m *mqttConn) write(header byte, body []byte) error {
+	m.c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	m.c.SetReadDeadline(time.Now().Add(30 * time.Second))
+
+	packet := append([]byte{header}, mqttLength(len(body))...)
+	_, err := m.c.Write(append(packet, body...))
+	return err
+}
+
+// mqttString prefixes s with its length.
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// mqttLength encodes a packet's remaining length, seven bits a byte.
+func mqttLength(n int) []byte {
+	var b []byte
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// readMQTTPacket returns a packet's first byte and the rest of it.
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	n, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("mqtt: malformed packet length")
+		}
+	}
+
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
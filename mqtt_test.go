@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// fakeBroker accepts one MQTT connection and sends what is published to
+// it down the returned channel.
+func fakeBroker(t *testing.T) (string, <-chan []byte) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	msgs := make(chan []byte, 10)
+	go func() {
+		defer close(msgs)
+
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+
+		for {
+			typ, body, err := readMQTTPacket(r)
+			if err != nil {
+				return
+			}
+
+			switch typ >> 4 {
+			case mqttConnect:
+				c.Write([]byte{mqttConnack << 4, 2, 0, 0})
+			case mqttPublish:
+				n := int(body[0])<<8 | int(body[1])
+				id := body[2+n : 4+n]
+				msgs <- body[4+n:]
+				c.Write([]byte{mqttPuback << 4, 2, id[0], id[1]})
+			case mqttDisconnect:
+				return
+			}
+		}
+	}()
+
+	return l.Addr().String(), msgs
+}
+
+func TestMQTTAnnounce(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(res.added, []int{1, 2, 3}) {
+		t.Fatalf("sync added %v", res.added)
+	}
+
+	addr, msgs := fakeBroker(t)
+	o := &mqttOptions{broker: "tcp://" + addr, topic: "xkcd/new"}
+	err = o.announce(db, res.added[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int
+	for msg := range msgs {
+		var c mqttComic
+		err := json.Unmarshal(msg, &c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, c.Num)
+		if c.Title == "" || c.Date == "" {
+			t.Errorf("message lacks details: %s", msg)
+		}
+	}
+	if !equalInts(got, []int{2, 3}) {
+		t.Errorf("announced %v, want [2 3]", got)
+	}
+}
+
+func TestMQTTLength(t *testing.T) {
+	for n, want := range map[int][]byte{0: {0}, 127: {0x7f}, 128: {0x80, 1}, 16383: {0xff, 0x7f}, 321: {0xc1, 2}} {
+		got := mqttLength(n)
+		if string(got) != string(want) {
+			t.Errorf("mqttLength(%d) = %x, want %x", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveSpec is one of several archives served together, as given to
+// serve -archive name=path[,sync=interval].
+type archiveSpec struct {
+	name   string
+	dbPath string
+	// How often to sync the archive while serving; zero never does.
+	every time.Duration
+}
+
+var archiveName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// archiveFlags collects -archive flags.
+type archiveFlags []archiveSpec
+
+func (a *archiveFlags) String() string { return "" }
+
+func (a *archiveFlags) Set(s string) error {
+	name, rest := s, ""
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		name, rest = s[:i], s[i+1:]
+	}
+	if !archiveName.MatchString(name) || name == "api" {
+		return errors.New("archive names are lower case letters, digits and dashes, and not api")
+	}
+
+	opts := strings.Split(rest, ",")
+	spec := archiveSpec{name: name, dbPath: withSlash(opts[0])}
+	if opts[0] == "" {
+		return errors.New("want name=path[,sync=interval]")
+	}
+	for _, o := range opts[1:] {
+		every := strings.TrimPrefix(o, "sync=")
+		d, err := time.ParseDuration(every)
+		if every == o || err != nil || d <= 0 {
+			return errors.New("unknown archive option " + o + "; want sync=interval, e.g. sync=6h")
+		}
+		spec.every = d
+	}
+
+	for _, other := range *a {
+		if other.name == name {
+			return errors.New("archive " + name + " is given twice")
+		}
+	}
+	*a = append(*a, spec)
+
+	return nil
+}
+
+// multiServer serves each archive under /<name>/, and at the root a list
+// of them and a search across all of them.
+type multiServer struct {
+	specs   []archiveSpec
+	servers map[string]*server
+}
+
+func newMultiServer(specs []archiveSpec, localImages bool) *multiServer {
+	ms := &multiServer{specs: specs, servers: make(map[string]*server)}
+	for _, spec := range specs {
+		ms.servers[spec.name] = &server{dbPath: spec.dbPath, prefix: "/" + spec.name, localImages: localImages}
+	}
+
+	return ms
+}
+
+// routes mounts the archives; wrap is applied to each archive's handler
+// as if it were served alone.
+func (ms *multiServer) routes(wrap func(http.Handler) http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", ms.handleRoot)
+	mux.Handle("/api/search", wrap(http.HandlerFunc(ms.handleSearch)))
+
+	for _, spec := range ms.specs {
+		s := ms.servers[spec.name]
+		mux.Handle(s.prefix+"/", http.StripPrefix(s.prefix, wrap(s.routes())))
+	}
+
+	return mux
+}
+
+// searchHit is a comic found by a search, in any archive.
+type searchHit struct {
+	Archive string `json:"archive,omitempty"`
+	Num     int    `json:"num"`
+	Title   string `json:"title"`
+	Alt     string `json:"alt"`
+	URL     string `json:"url"`
+}
+
+// search looks through every archive, in the order they were given
+// unless another order is asked for.
+func (ms *multiServer) search(query, order string) ([]searchHit, error) {
+	var matches []localComic
+	var archives []string
+	for _, spec := range ms.specs {
+		found, err := ms.servers[spec.name].matches(query)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+		for range found {
+			archives = append(archives, spec.name)
+		}
+	}
+
+	perm, err := orderMatches(matches, query, order, func(i int) fieldWeights {
+		return ms.servers[archives[i]].weights()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []searchHit{}
+	for _, i := range perm {
+		h := ms.servers[archives[i]].hit(matches[i])
+		h.Archive = archives[i]
+		hits = append(hits, h)
+	}
+
+	return hits, nil
+}
+
+func (ms *multiServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	hits, err := ms.search(q.Get("q"), q.Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), searchStatus(err))
+		return
+	}
+
+	lo, hi, ok := paginate(w, r, len(hits))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, hits[lo:hi])
+}
+
+func (ms *multiServer) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	type archive struct {
+		Name   string
+		Comics int
+	}
+	page := struct {
+		Archives []archive
+		Query    string
+		Hits     []searchHit
+	}{Query: r.URL.Query().Get("q")}
+
+	for _, spec := range ms.specs {
+		nums, err := storedComics(spec.dbPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page.Archives = append(page.Archives, archive{spec.name, len(nums)})
+	}
+
+	if page.Query != "" {
+		var err error
+		page.Hits, err = ms.search(page.Query, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	render(w, r, "archives.html", page)
+}
+
+// scheduleSyncs keeps archives with a sync interval up to date. Syncs take
+// turns, as they share the download settings.
+func scheduleSyncs(specs []archiveSpec) {
+	var turn sync.Mutex
+
+	for _, spec := range specs {
+		if spec.every == 0 {
+			continue
+		}
+
+		s := newSyncer(spec.dbPath, syncOptions{rateLimit: 20}, spec.every)
+		s.turn = &turn
+		events, _ := s.subscribe()
+
+		go func(name string) {
+			for e := range events {
+				if e.Kind != eventSyncEnd {
+					continue
+				}
+				if e.Error != "" {
+					log.Printf("Syncing %s: %s\n", name, e.Error)
+				} else if len(e.Added) > 0 {
+					log.Printf("Synced %d new comics into %s\n", len(e.Added), name)
+				}
+			}
+		}(spec.name)
+
+		s.start()
+	}
+}
+
+// matches finds comics in one archive like the search command does.
+func (s *server) matches(query string) ([]localComic, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	return searchComics(s.dbPath, query)
+}
+
+// weights are the relevance weights the archive's index is tuned to.
+func (s *server) weights() fieldWeights {
+	ix, err := loadIndex(s.dbPath)
+	if err != nil {
+		return nil
+	}
+
+	return ix.settings.Weights
+}
+
+func (s *server) hit(c localComic) searchHit {
+	return searchHit{Num: c.Num, Title: c.Title, Alt: c.Alt, URL: s.prefix + "/comic/" + strconv.Itoa(c.Num)}
+}
+
+// search matches comics in one archive, in the order asked for.
+func (s *server) search(query, order string) ([]searchHit, error) {
+	matches, err := s.matches(query)
+	if err != nil {
+		return nil, err
+	}
+	w := s.weights()
+	perm, err := orderMatches(matches, query, order, func(int) fieldWeights { return w })
+	if err != nil {
+		return nil, err
+	}
+
+	hits := []searchHit{}
+	for _, i := range perm {
+		hits = append(hits, s.hit(matches[i]))
+	}
+
+	return hits, nil
+}
+
+// searchStatus tells the client's mistakes from the server's.
+func searchStatus(err error) int {
+	if errors.Is(err, errSearchOrder) {
+		return http.StatusBadRequest
+	}
+
+	return http.StatusInternalServerError
+}
+
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	hits, err := s.search(q.Get("q"), q.Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), searchStatus(err))
+		return
+	}
+
+	lo, hi, ok := paginate(w, r, len(hits))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, hits[lo:hi])
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestArchiveFlags(t *testing.T) {
+	var a archiveFlags
+	for _, ok := range []string{"xkcd=/srv/xkcd", "what-if=/srv/whatif,sync=6h"} {
+		if err := a.Set(ok); err != nil {
+			t.Errorf("%s: %v", ok, err)
+		}
+	}
+	if len(a) != 2 || a[0].dbPath != "/srv/xkcd/" || a[1].every.Hours() != 6 {
+		t.Errorf("got %+v", a)
+	}
+
+	for _, bad := range []string{"xkcd=/again", "api=/srv/api", "Big=/srv", "x=", "x=/srv,every=1h", "x=/srv,sync=never"} {
+		if err := a.Set(bad); err == nil {
+			t.Errorf("%s accepted", bad)
+		}
+	}
+}
+
+func TestMultiServer(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	one, two := tempDB(t), tempDB(t)
+	for _, db := range []string{one, two} {
+		_, err := syncDB(db, syncOptions{rateLimit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ms := newMultiServer([]archiveSpec{{name: "one", dbPath: one}, {name: "two", dbPath: two}}, false)
+	ts := httptest.NewServer(ms.routes(parseCORS("").wrap))
+	defer ts.Close()
+
+	status, body := get(t, ts.URL+"/two/comic/2")
+	if status != http.StatusOK || !strings.Contains(string(body), `src="/two/img/2"`) || !strings.Contains(string(body), `href="3"`) {
+		t.Errorf("comic page: %d\n%s", status, body)
+	}
+	if status, _ := get(t, ts.URL+"/two/img/2"); status != http.StatusOK {
+		t.Errorf("image: %d", status)
+	}
+	if status, _ := get(t, ts.URL+"/three/comic/2"); status != http.StatusNotFound {
+		t.Errorf("unknown archive: %d", status)
+	}
+
+	_, body = get(t, ts.URL+"/api/search?q=alt+text+2")
+	var hits []searchHit
+	err := json.Unmarshal(body, &hits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].Archive != "one" || hits[1].URL != "/two/comic/2" {
+		t.Errorf("got %+v", hits)
+	}
+
+	_, body = get(t, ts.URL+"/?q=alt+text+3")
+	if !strings.Contains(string(body), `<a href="/one/comic/3">one #3 Comic 3</a>`) {
+		t.Errorf("root search:\n%s", body)
+	}
+}
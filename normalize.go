@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// normalizedDir holds display copies of comic images, with borders of
+// paper trimmed and colours converted to plain sRGB. Originals are never
+// changed; the web UI and exports show a copy only while it is newer than
+// its original.
+const normalizedDir = "normalized"
+
+// Paper kept around a trimmed image, in pixels.
+const trimMargin = 8
+
+func normalizedPath(dbPath string, num int) string {
+	return dbPath + normalizedDir + "/" + strconv.Itoa(num) + ".png"
+}
+
+// displayImage is the image to show of a comic stored at original: its
+// normalized copy if it has a current one.
+func displayImage(dbPath string, num int, original string) string {
+	orig, err := os.Stat(original)
+	if err != nil {
+		return original
+	}
+	info, err := os.Stat(normalizedPath(dbPath, num))
+	if err != nil || info.ModTime().Before(orig.ModTime()) {
+		return original
+	}
+
+	return normalizedPath(dbPath, num)
+}
+
+// normalizeDB writes normalized copies of the images of nums, or of every
+// stored comic if nums is empty, and returns how many needed one.
+func normalizeDB(dbPath string, nums []int) (int, error) {
+	if len(nums) == 0 {
+		var err error
+		nums, err = storedComics(dbPath)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err := os.MkdirAll(dbPath+normalizedDir, 0755)
+	if err != nil {
+		return 0, err
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for num := range work {
+				ok, err := normalizeComic(dbPath, num)
+				if err != nil {
+					log.Printf("Comic %d: %v\n", num, err)
+					continue
+				}
+				if ok {
+					mu.Lock()
+					done++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, num := range nums {
+		work <- num
+	}
+	close(work)
+	wg.Wait()
+
+	return done, nil
+}
+
+// normalizeComic writes a comic's normalized copy if its image needs one,
+// and otherwise removes any copy it had.
+func normalizeComic(dbPath string, num int) (bool, error) {
+	// Comics without an image, or whose image is offloaded, have nothing
+	// to normalize.
+	path, err := comicImagePath(dbPath, num)
+	if err != nil {
+		return false, nil
+	}
+
+	profile, err := hasColorProfile(path)
+	if err != nil {
+		return false, err
+	}
+	img, err := loadImage(path)
+	if err != nil {
+		return false, err
+	}
+
+	out, changed := normalizeImage(img)
+	dst := normalizedPath(dbPath, num)
+	if !changed && !profile {
+		err = os.Remove(dst)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, out)
+	if err != nil {
+		return false, err
+	}
+
+	return true, writeFileAtomic(dst, buf.Bytes())
+}
+
+// normalizeImage trims the paper around img, leaving a margin, and
+// converts colour models browsers and encoders handle unevenly. It
+// reports whether anything changed.
+func normalizeImage(img image.Image) (image.Image, bool) {
+	flat := flatten(img)
+	b := flat.Bounds()
+
+	r := trimPaper(grayscale(flat), b)
+	if r.Empty() {
+		r = b
+	}
+	r = r.Inset(-trimMargin).Intersect(b)
+
+	changed := r != b
+	switch img.ColorModel() {
+	case color.CMYKModel, color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		changed = true
+	}
+
+	return flat.SubImage(r), changed
+}
+
+// hasColorProfile reports whether an image file embeds a colour profile
+// or gamma, which decoders here ignore but browsers apply, so the same
+// comic looks different in the web UI and in exports.
+func hasColorProfile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 64<<10)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	head = head[:n]
+
+	const pngMagic = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(head, []byte(pngMagic)) {
+		// JPEG keeps ICC profiles in APP2 segments.
+		return bytes.HasPrefix(head, []byte{0xff, 0xd8}) && bytes.Contains(head, []byte("ICC_PROFILE\x00")), nil
+	}
+
+	// PNG chunks before the image data.
+	for i := len(pngMagic); i+8 <= len(head); {
+		size := int(binary.BigEndian.Uint32(head[i:]))
+		switch string(head[i+4 : i+8]) {
+		case "iCCP", "gAMA", "cHRM":
+			return true, nil
+		case "IDAT":
+			return false, nil
+		}
+		i += 12 + size
+	}
+
+	return false, nil
+}
+
+// normalizeSynced writes normalized copies of what a sync stored, if the
+// config file asks for them. Failing doesn't fail the sync.
+func normalizeSynced(dbPath string, added []int, refreshed bool) {
+	if !userConf.Normalize || (len(added) == 0 && !refreshed) {
+		return
+	}
+
+	n, err := normalizeDB(dbPath, added)
+	if err != nil {
+		log.Println("Normalizing failed:", err)
+		return
+	}
+	if n > 0 {
+		say("Normalized %d images\n", n)
+	}
+}
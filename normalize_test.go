@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// paddedImage is a black square on a lot of paper.
+func paddedImage(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(30, 30, 38, 38), image.Black, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestNormalizeImage(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(paddedImage(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, changed := normalizeImage(img)
+	want := image.Rect(30-trimMargin, 30-trimMargin, 38+trimMargin, 38+trimMargin)
+	if !changed || out.Bounds() != want {
+		t.Errorf("trimmed to %v, changed %v; want %v", out.Bounds(), changed, want)
+	}
+
+	// Already tight.
+	tight := image.NewGray(image.Rect(0, 0, 8, 8))
+	if _, changed := normalizeImage(tight); changed {
+		t.Error("a tight image was changed")
+	}
+
+	// Not sRGB.
+	cmyk := image.NewCMYK(image.Rect(0, 0, 8, 8))
+	cmyk.Set(0, 0, color.CMYK{C: 0xff})
+	if _, changed := normalizeImage(cmyk); !changed {
+		t.Error("a CMYK image was left alone")
+	}
+}
+
+func TestHasColorProfile(t *testing.T) {
+	dir := withSlash(t.TempDir())
+	plain := paddedImage(t)
+
+	// A gAMA chunk right after the header.
+	gamma := append([]byte{}, plain[:33]...)
+	gamma = append(gamma, 0, 0, 0, 4, 'g', 'A', 'M', 'A', 0, 0, 0xb1, 0x8f, 0, 0, 0, 0)
+	gamma = append(gamma, plain[33:]...)
+
+	for name, want := range map[string]bool{"plain.png": false, "gamma.png": true} {
+		data := plain
+		if want {
+			data = gamma
+		}
+		err := os.WriteFile(dir+name, data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := hasColorProfile(dir + name)
+		if err != nil || got != want {
+			t.Errorf("%s: %v, %v; want %v", name, got, err, want)
+		}
+	}
+}
+
+func TestNormalizedCopies(t *testing.T) {
+	comics := fakexkcd.Corpus(2)
+	comics[0].Image = paddedImage(t)
+	ts, db := testServer(t, comics)
+
+	n, err := normalizeDB(db, nil)
+	if err != nil || n != 1 {
+		t.Fatalf("normalized %d images, %v; want 1", n, err)
+	}
+	if _, err := os.Stat(normalizedPath(db, 2)); !os.IsNotExist(err) {
+		t.Error("comic 2 needed no copy but got one")
+	}
+
+	_, body := get(t, ts.URL+"/img/1")
+	img, err := png.Decode(bytes.NewReader(body))
+	if err != nil || img.Bounds().Dx() != 8+2*trimMargin {
+		t.Errorf("/img/1 isn't the trimmed copy: %v", err)
+	}
+	for _, path := range []string{"/img/1?original=1", "/img/1/" + comics[0].ImgName} {
+		status, body := get(t, ts.URL+path)
+		if status != http.StatusOK || !bytes.Equal(body, comics[0].Image) {
+			t.Errorf("%s isn't the original", path)
+		}
+	}
+
+	out := withSlash(t.TempDir())
+	_, err = exportComics(db, out, []int{1}, exportOptions{format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(readFile(t, out+"1.png"), comics[0].Image) {
+		t.Error("export has the original")
+	}
+	out = withSlash(t.TempDir())
+	_, err = exportComics(db, out, []int{1}, exportOptions{format: "json", originals: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readFile(t, out+"1.png"), comics[0].Image) {
+		t.Error("export -originals doesn't have the original")
+	}
+
+	// An image newer than its copy is shown as it is.
+	orig, _ := comicImagePath(db, 1)
+	later := time.Now().Add(time.Hour)
+	err = os.Chtimes(orig, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := displayImage(db, 1, orig); got != orig {
+		t.Errorf("stale copy %s shown", got)
+	}
+}
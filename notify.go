@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// notifier tells the owner of an unattended mirror when syncs start
+// failing, through any of a webhook, a command and an email.
+type notifier struct {
+	url       string
+	command   string
+	email     string
+	from      string
+	smtpAddr  string
+	smtpUser  string
+	threshold float64
+}
+
+func notifyFlags(fs *flag.FlagSet) *notifier {
+	n := &notifier{}
+	fs.StringVar(&n.url, "notify-url", "", "Webhook to POST a JSON report to when a sync fails")
+	fs.Var((*commandFlag)(&n.command), "notify-exec", "Command to run when a sync fails; the JSON report is on its stdin")
+	fs.StringVar(&n.email, "notify-email", "", "Address to mail when a sync fails; needs -smtp and -from")
+	fs.StringVar(&n.from, "from", "", "Sender address for -notify-email")
+	fs.StringVar(&n.smtpAddr, "smtp", "", "SMTP server as host:port")
+	fs.StringVar(&n.smtpUser, "smtp-user", "", "SMTP username. The password is read from XKCDDB_SMTP_PASSWORD")
+	fs.Float64Var(&n.threshold, "notify-threshold", 0.05, "Fraction of failed downloads that counts as a failed sync")
+
+	return n
+}
+
+// check reports flags that can't work together, so a sync doesn't find
+// out only once it has something to say.
+func (n *notifier) check() error {
+	if n.email != "" && (n.smtpAddr == "" || n.from == "") {
+		return errors.New("-notify-email needs -smtp and -from")
+	}
+
+	return nil
+}
+
+// commandFlag is a command line, which can't be blank.
+type commandFlag string
+
+func (c *commandFlag) String() string {
+	if c == nil {
+		return ""
+	}
+
+	return string(*c)
+}
+
+func (c *commandFlag) Set(s string) error {
+	if len(strings.Fields(s)) == 0 {
+		return errors.New("needs a command")
+	}
+	*c = commandFlag(s)
+
+	return nil
+}
+
+// syncReport is what notifications carry.
+type syncReport struct {
+	DB        string `json:"db"`
+	Attempted int    `json:"attempted"`
+	Failed    int    `json:"failed"`
+	Error     string `json:"error,omitempty"`
+	// Why the sync stopped early, keeping what it stored.
+	Partial string `json:"partial,omitempty"`
+}
+
+func (r syncReport) String() string {
+	if r.Error != "" {
+		return fmt.Sprintf("xkcd-db sync of %s failed: %s", r.DB, r.Error)
+	}
+	if r.Partial != "" {
+		return fmt.Sprintf("xkcd-db sync of %s stopped early as %s: %d of %d downloads failed", r.DB, r.Partial, r.Failed, r.Attempted)
+	}
+
+	return fmt.Sprintf("xkcd-db sync of %s: %d of %d downloads failed", r.DB, r.Failed, r.Attempted)
+}
+
+// due reports whether a sync went badly enough to tell someone: it
+// couldn't run at all, e.g. without a network, stopped early as the disk
+// filled, or more than the threshold of its downloads failed.
+func (n *notifier) due(res syncResult, err error) bool {
+	if n.url == "" && n.command == "" && n.email == "" {
+		return false
+	}
+	if err != nil || res.partial != nil {
+		return true
+	}
+
+	return res.attempted > 0 && float64(res.failed)/float64(res.attempted) > n.threshold
+}
+
+// send delivers the report through every configured channel and returns
+// the first error.
+func (n *notifier) send(dbPath string, res syncResult, syncErr error) error {
+	r := syncReport{DB: dbPath, Attempted: res.attempted, Failed: res.failed}
+	if syncErr != nil {
+		r.Error = syncErr.Error()
+	}
+	if res.partial != nil {
+		r.Partial = describeStorageError(res.partial)
+	}
+
+	report, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	var first error
+	keep := func(err error) {
+		if first == nil {
+			first = err
+		}
+	}
+
+	if n.url != "" {
+		keep(n.post(report))
+	}
+	if n.command != "" {
+		keep(n.run(r, report))
+	}
+	if n.email != "" {
+		keep(n.mail(r))
+	}
+
+	return first
+}
+
+func (n *notifier) post(report []byte) error {
+	resp, err := client.Post(n.url, "application/json", bytes.NewReader(report))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("webhook answered " + resp.Status)
+	}
+
+	return nil
+}
+
+// run starts the command with the report on stdin and its counts in
+// XKCDDB_SYNC_* variables. The command line is split on spaces; there is
+// no shell.
+func (n *notifier) run(r syncReport, report []byte) error {
+	args := strings.Fields(n.command)
+	if len(args) == 0 {
+		return errors.New("-notify-exec needs a command")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(report)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"XKCDDB_SYNC_DB="+r.DB,
+		"XKCDDB_SYNC_ATTEMPTED="+strconv.Itoa(r.Attempted),
+		"XKCDDB_SYNC_FAILED="+strconv.Itoa(r.Failed),
+		"XKCDDB_SYNC_ERROR="+r.Error,
+		"XKCDDB_SYNC_PARTIAL="+r.Partial,
+	)
+
+	return cmd.Run()
+}
+
+func (n *notifier) mail(r syncReport) error {
+	err := n.check()
+	if err != nil {
+		return err
+	}
+
+	auth, err := smtpAuth(n.smtpAddr, n.smtpUser)
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: xkcd-db sync failing\r\n\r\n%s\r\n", n.from, n.email, r)
+	return sendMail(n.smtpAddr, auth, n.from, []string{n.email}, []byte(msg))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifyDue(t *testing.T) {
+	n := &notifier{url: "http://example.com/hook", threshold: 0.05}
+
+	cases := []struct {
+		res  syncResult
+		err  error
+		want bool
+	}{
+		{syncResult{}, nil, false},
+		{syncResult{attempted: 100, failed: 5}, nil, false},
+		{syncResult{attempted: 100, failed: 6}, nil, true},
+		{syncResult{}, errors.New("no network"), true},
+	}
+	for _, c := range cases {
+		if got := n.due(c.res, c.err); got != c.want {
+			t.Errorf("due(%+v, %v) = %v, want %v", c.res, c.err, got, c.want)
+		}
+	}
+
+	if (&notifier{threshold: 0.05}).due(syncResult{}, errors.New("no network")) {
+		t.Error("due without anywhere to send to")
+	}
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	reports := make(chan syncReport, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rep syncReport
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &rep)
+		reports <- rep
+	}))
+	defer hook.Close()
+
+	n := &notifier{url: hook.URL}
+	err := n.send("db/", syncResult{attempted: 10, failed: 4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rep := <-reports
+	if rep.DB != "db/" || rep.Attempted != 10 || rep.Failed != 4 || rep.Error != "" {
+		t.Errorf("report = %+v", rep)
+	}
+}
+
+func TestNotifyMailOffline(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	goOffline(t)
+
+	n := &notifier{email: "owner@example.com", from: "xkcd-db@example.com", smtpAddr: l.Addr().String()}
+	err = n.send("db/", syncResult{}, errOffline)
+	if !errors.Is(err, errOffline) {
+		t.Errorf("got %v, want errOffline", err)
+	}
+
+	l.(*net.TCPListener).SetDeadline(time.Now().Add(100 * time.Millisecond))
+	if conn, err := l.Accept(); err == nil {
+		conn.Close()
+		t.Error("mailed offline")
+	}
+}
+
+func TestNotifyExecFlag(t *testing.T) {
+	for _, arg := range []string{"", "  "} {
+		fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		notifyFlags(fs)
+		if fs.Parse([]string{"-notify-exec", arg}) == nil {
+			t.Errorf("-notify-exec %q accepted", arg)
+		}
+	}
+}
+
+func TestNotifyEmailFlags(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-notify-email", "me@example.com"}, false},
+		{[]string{"-notify-email", "me@example.com", "-smtp", "mail:25"}, false},
+		{[]string{"-notify-email", "me@example.com", "-smtp", "mail:25", "-from", "xkcd@example.com"}, true},
+		{[]string{"-notify-url", "http://example.com/hook"}, true},
+	} {
+		fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+		n := notifyFlags(fs)
+		if err := fs.Parse(c.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := n.check(); (err == nil) != c.ok {
+			t.Errorf("%v: %v", c.args, err)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauthProvider is how xkcd-db gets access to a cloud drive on behalf of
+// its user. Logging in happens once, in the terminal; the tokens are kept
+// in the user's config directory, not in the database, so a mirror can
+// be shared without them.
+type oauthProvider struct {
+	name     string
+	clientID string
+	secret   string
+	scope    string
+	tokenURL string
+	// With a device URL the user confirms a code on another device;
+	// without, they open authURL and paste the code it shows.
+	deviceURL string
+	authURL   string
+
+	mu  sync.Mutex
+	tok *oauthToken
+}
+
+type oauthToken struct {
+	Access  string    `json:"access"`
+	Refresh string    `json:"refresh"`
+	Expiry  time.Time `json:"expiry"`
+}
+
+// Tests make polling for a device login quick.
+var pollUnit = time.Second
+
+func tokensPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "xkcd-db", "tokens.json"), nil
+}
+
+func loadTokens() (map[string]*oauthToken, error) {
+	tokens := make(map[string]*oauthToken)
+
+	path, err := tokensPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return tokens, nil
+}
+
+// saveToken keeps a provider's tokens, readable only by the user.
+func saveToken(name string, tok *oauthToken) error {
+	tokens, err := loadTokens()
+	if err != nil {
+		return err
+	}
+	tokens[name] = tok
+
+	path, err := tokensPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tokens, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// token returns an access token, logging in or refreshing as needed.
+func (p *oauthProvider) token() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.clientID == "" {
+		return "", fmt.Errorf("this build of xkcd-db has no %s client ID; set XKCDDB_%s_CLIENT_ID", p.name, strings.ToUpper(p.name))
+	}
+
+	if p.tok == nil {
+		tokens, err := loadTokens()
+		if err != nil {
+			return "", err
+		}
+		p.tok = tokens[p.name]
+	}
+
+	var err error
+	switch {
+	case p.tok == nil:
+		p.tok, err = p.login()
+	case time.Until(p.tok.Expiry) < time.Minute:
+		p.tok, err = p.refresh(p.tok)
+	default:
+		return p.tok.Access, nil
+	}
+	if err != nil {
+		p.tok = nil
+		return "", err
+	}
+
+	return p.tok.Access, saveToken(p.name, p.tok)
+}
+
+// forget drops an access token the provider turned down, so the next
+// token is refreshed.
+func (p *oauthProvider) forget() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tok != nil {
+		p.tok.Expiry = time.Time{}
+	}
+}
+
+func (p *oauthProvider) login() (*oauthToken, error) {
+	if p.deviceURL != "" {
+		return p.deviceLogin()
+	}
+
+	return p.pasteLogin()
+}
+
+// deviceLogin asks the user to enter a code at the provider's site and
+// waits for them to.
+func (p *oauthProvider) deviceLogin() (*oauthToken, error) {
+	var dev struct {
+		DeviceCode string `json:"device_code"`
+		UserCode   string `json:"user_code"`
+		// Google says verification_url.
+		VerificationURI string `json:"verification_uri"`
+		VerificationURL string `json:"verification_url"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+	}
+	err := postForm(p.deviceURL, url.Values{"client_id": {p.clientID}, "scope": {p.scope}}, &dev)
+	if err != nil {
+		return nil, err
+	}
+	if dev.VerificationURI == "" {
+		dev.VerificationURI = dev.VerificationURL
+	}
+
+	fmt.Fprintf(os.Stderr, "To let xkcd-db use %s, visit %s and enter the code %s\n", p.name, dev.VerificationURI, dev.UserCode)
+
+	interval := time.Duration(dev.Interval) * pollUnit
+	if interval <= 0 {
+		interval = 5 * pollUnit
+	}
+	deadline := time.Now().Add(time.Duration(dev.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tok, err := p.exchange(url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {dev.DeviceCode},
+		})
+		var oerr *oauthError
+		if errors.As(err, &oerr) {
+			switch oerr.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * pollUnit
+				continue
+			}
+		}
+
+		return tok, err
+	}
+
+	return nil, fmt.Errorf("logging in to %s: the code expired", p.name)
+}
+
+// pasteLogin has the user open the provider's consent page and paste the
+// code it shows, for providers without device logins. PKCE keeps the code
+// useless to anyone who sees it.
+func (p *oauthProvider) pasteLogin() (*oauthToken, error) {
+	verifier := randomToken() + randomToken()
+	sum := sha256.Sum256([]byte(verifier))
+
+	u, err := url.Parse(p.authURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("client_id", p.clientID)
+	q.Set("response_type", "code")
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	fmt.Fprintf(os.Stderr, "To let xkcd-db use %s, visit\n\n\t%s\n\nand paste the code it shows here: ", p.name, u)
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("logging in to %s: %v", p.name, err)
+	}
+
+	return p.exchange(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {strings.TrimSpace(code)},
+		"code_verifier": {verifier},
+	})
+}
+
+func (p *oauthProvider) refresh(old *oauthToken) (*oauthToken, error) {
+	tok, err := p.exchange(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {old.Refresh}})
+	if err != nil {
+		return nil, err
+	}
+	// Providers may keep the refresh token the same and not send it.
+	if tok.Refresh == "" {
+		tok.Refresh = old.Refresh
+	}
+
+	return tok, nil
+}
+
+func (p *oauthProvider) exchange(form url.Values) (*oauthToken, error) {
+	form.Set("client_id", p.clientID)
+	if p.secret != "" {
+		form.Set("client_secret", p.secret)
+	}
+
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	err := postForm(p.tokenURL, form, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauthToken{resp.AccessToken, resp.RefreshToken, time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)}, nil
+}
+
+// oauthError is an error an OAuth server reported.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+
+	return e.Code
+}
+
+// postForm posts an OAuth request and decodes the answer into v.
+func postForm(rawURL string, form url.Values, v interface{}) error {
+	resp, err := client.PostForm(rawURL, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		oerr := &oauthError{}
+		if json.NewDecoder(resp.Body).Decode(oerr) == nil && oerr.Code != "" {
+			return oerr
+		}
+		return fmt.Errorf("%s: %s", rawURL, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// bearer sends an API request with the provider's access token, once
+// more with a fresh one if the provider turns the first down.
+func (p *oauthProvider) bearer(newReq func() (*http.Request, error)) (*http.Response, error) {
+	for try := 0; ; try++ {
+		tok, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+
+		resp, err := client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || try > 0 {
+			return resp, err
+		}
+		resp.Body.Close()
+		p.forget()
+	}
+}
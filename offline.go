@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Offline mode guarantees no network access: every request through the
+// shared client fails, and commands that can't work without the network
+// refuse to start. It is set with -offline on any command, before the
+// command name, or with XKCDDB_OFFLINE=1.
+var offline bool
+
+var errOffline = errors.New("offline mode: network access is disabled")
+
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, errOffline
+}
+
+func setOffline() {
+	offline = true
+	tracked.next = offlineTransport{}
+}
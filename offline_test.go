@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func goOffline(t *testing.T) {
+	t.Helper()
+
+	old := tracked.next
+	setOffline()
+
+	t.Cleanup(func() {
+		offline = false
+		tracked.next = old
+	})
+}
+
+func TestOfflineMakesNoRequests(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := ensureComic(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goOffline(t)
+	before := len(srv.Requests())
+
+	_, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err == nil {
+		t.Error("sync succeeded offline")
+	}
+
+	_, err = ensureComic(db, 2)
+	if err == nil {
+		t.Error("fetched a missing comic offline")
+	}
+
+	_, err = client.Get(srv.URL + "/info.0.json")
+	if !errors.Is(err, errOffline) {
+		t.Errorf("got %v, want %v", err, errOffline)
+	}
+
+	if after := len(srv.Requests()); after != before {
+		t.Errorf("%d requests made offline", after-before)
+	}
+
+	// Mirrored comics still work.
+	c, err := ensureComic(db, 1)
+	if err != nil || c.Num != 1 {
+		t.Errorf("got %+v, %v", c, err)
+	}
+}
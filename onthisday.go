@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// onthisday lists comics published on a day of the year, today by default.
+func onthisday(args []string) {
+	fs := flag.NewFlagSet("onthisday", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	date := fs.String("date", "", "Day to look up as MM-DD instead of today")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	month, day, err := parseMonthDay(*date, time.Now())
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	comics, err := comicsOn(withSlash(*dbPath), month, day)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if len(comics) == 0 {
+		fmt.Printf("No comics were published on %s %d\n", month, day)
+		return
+	}
+
+	for _, c := range comics {
+		fmt.Printf("%s\t#%d\t%s\n", c.Year, c.Num, c.Title)
+	}
+}
+
+// parseMonthDay reads MM-DD, falling back to now's date when s is empty.
+func parseMonthDay(s string, now time.Time) (time.Month, int, error) {
+	if s == "" {
+		return now.Month(), now.Day(), nil
+	}
+
+	t, err := time.Parse("01-02", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid date %q, want MM-DD", s)
+	}
+
+	return t.Month(), t.Day(), nil
+}
+
+// comicsOn finds stored comics published on month and day in any year.
+func comicsOn(dbPath string, month time.Month, day int) ([]localComic, error) {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var comics []localComic
+	for _, num := range nums {
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return nil, err
+		}
+
+		m, _ := strconv.Atoi(c.Month)
+		d, _ := strconv.Atoi(c.Day)
+		if time.Month(m) == month && d == day {
+			comics = append(comics, c)
+		}
+	}
+
+	return comics, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestComicsOn(t *testing.T) {
+	// Comics 5 and 89 fall on June 6th.
+	ts, db := testServer(t, fakexkcd.Corpus(100))
+
+	comics, err := comicsOn(db, time.June, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comics) != 2 || comics[0].Num != 5 || comics[1].Num != 89 {
+		t.Fatalf("got %+v", comics)
+	}
+
+	status, body := get(t, ts.URL+"/api/onthisday?date=06-06")
+	var list []Comic
+	err = json.Unmarshal(body, &list)
+	if status != http.StatusOK || err != nil || len(list) != 2 || list[1].Title != "Comic 89" {
+		t.Errorf("api: status %d, %v, %+v", status, err, list)
+	}
+
+	if status, _ := get(t, ts.URL+"/api/onthisday?date=june"); status != http.StatusBadRequest {
+		t.Errorf("bad date: status %d", status)
+	}
+}
+
+func TestParseMonthDay(t *testing.T) {
+	now := time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)
+
+	m, d, err := parseMonthDay("", now)
+	if err != nil || m != time.February || d != 29 {
+		t.Errorf("today: %v %d %v", m, d, err)
+	}
+
+	m, d, err = parseMonthDay("12-25", now)
+	if err != nil || m != time.December || d != 25 {
+		t.Errorf("12-25: %v %d %v", m, d, err)
+	}
+}
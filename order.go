@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Download orders. Missing comics are found in ascending order.
+var orders = []string{"asc", "newest", "random", "smallest"}
+
+// orderComics rearranges dlList for the chosen order.
+func orderComics(src comicSource, dlList []string, order string, tokens chan struct{}) ([]string, error) {
+	switch order {
+	case "asc":
+	case "newest":
+		for i, j := 0, len(dlList)-1; i < j; i, j = i+1, j-1 {
+			dlList[i], dlList[j] = dlList[j], dlList[i]
+		}
+	case "random":
+		rng.Shuffle(len(dlList), func(i, j int) {
+			dlList[i], dlList[j] = dlList[j], dlList[i]
+		})
+	case "smallest":
+		sizes := imageSizes(src, dlList, tokens)
+		sort.SliceStable(dlList, func(i, j int) bool {
+			return sizes[dlList[i]] < sizes[dlList[j]]
+		})
+	default:
+		return nil, errors.New("unknown download order: " + order)
+	}
+
+	return dlList, nil
+}
+
+// imageSizes asks the server how big each comic's image is. It costs a
+// metadata request and a HEAD per comic; unknown sizes sort last.
+func imageSizes(src comicSource, dlList []string, tokens chan struct{}) map[string]int64 {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sizes := make(map[string]int64, len(dlList))
+
+	for _, item := range dlList {
+		wg.Add(1)
+		go func(item string) {
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+			defer wg.Done()
+
+			size := int64(1 << 62)
+			defer func() {
+				mu.Lock()
+				sizes[item] = size
+				mu.Unlock()
+			}()
+
+			comicData, err := src.info(item)
+			if err != nil || comicData.Img == "" {
+				return
+			}
+
+			resp, err := client.Head(comicData.Img)
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+
+			if resp.ContentLength >= 0 {
+				size = resp.ContentLength
+			}
+		}(item)
+	}
+
+	wg.Wait()
+	return sizes
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"image"
+)
+
+// A panel's bounds within its comic image.
+type panel struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Pixels at least this light count as page background.
+const paperLevel = 240
+
+// findPanels estimates panel boundaries by repeatedly cutting the image
+// along blank rows and columns (an XY-cut). Panels come back in reading
+// order. Borderless comics with a lot of white space may be over-split; the
+// result is a layout hint, not ground truth.
+func findPanels(img image.Image) []panel {
+	g := grayscale(flatten(img))
+	b := g.Bounds()
+
+	// Gutters narrower than this are white space inside a panel.
+	minGap := b.Dx()
+	if b.Dy() < minGap {
+		minGap = b.Dy()
+	}
+	minGap = minGap/60 + 2
+
+	var panels []panel
+	for _, r := range xyCut(g, b, minGap, 4) {
+		// Slivers are captions or stray marks rather than panels.
+		if r.Dx() < b.Dx()/10 || r.Dy() < b.Dy()/10 {
+			continue
+		}
+		panels = append(panels, panel{r.Min.X, r.Min.Y, r.Dx(), r.Dy()})
+	}
+
+	if len(panels) == 0 {
+		panels = []panel{{0, 0, b.Dx(), b.Dy()}}
+	}
+
+	return panels
+}
+
+func xyCut(g *image.Gray, r image.Rectangle, minGap, depth int) []image.Rectangle {
+	r = trimPaper(g, r)
+	if r.Empty() {
+		return nil
+	}
+
+	parts := splitBlank(g, r, minGap, true)
+	if len(parts) < 2 {
+		parts = splitBlank(g, r, minGap, false)
+	}
+	if len(parts) < 2 || depth == 0 {
+		return []image.Rectangle{r}
+	}
+
+	var out []image.Rectangle
+	for _, p := range parts {
+		out = append(out, xyCut(g, p, minGap, depth-1)...)
+	}
+
+	return out
+}
+
+// blankLine reports whether row (or column) i of r is all paper.
+func blankLine(g *image.Gray, r image.Rectangle, i int, rows bool) bool {
+	if rows {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if g.GrayAt(x, i).Y < paperLevel {
+				return false
+			}
+		}
+	} else {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			if g.GrayAt(i, y).Y < paperLevel {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// splitBlank cuts r wherever at least minGap blank rows (or columns) run
+// together.
+func splitBlank(g *image.Gray, r image.Rectangle, minGap int, rows bool) []image.Rectangle {
+	lo, hi := r.Min.X, r.Max.X
+	if rows {
+		lo, hi = r.Min.Y, r.Max.Y
+	}
+
+	sub := func(a, b int) image.Rectangle {
+		if rows {
+			return image.Rect(r.Min.X, a, r.Max.X, b)
+		}
+		return image.Rect(a, r.Min.Y, b, r.Max.Y)
+	}
+
+	var parts []image.Rectangle
+	start, gap := lo, 0
+	for i := lo; i < hi; i++ {
+		if !blankLine(g, r, i, rows) {
+			gap = 0
+			continue
+		}
+
+		gap++
+		if gap == minGap && i+1-gap > start {
+			parts = append(parts, sub(start, i+1-gap))
+		}
+		if gap >= minGap {
+			start = i + 1
+		}
+	}
+	if start < hi {
+		parts = append(parts, sub(start, hi))
+	}
+
+	return parts
+}
+
+// trimPaper shrinks r to the bounding box of its non-paper pixels.
+func trimPaper(g *image.Gray, r image.Rectangle) image.Rectangle {
+	for r.Min.Y < r.Max.Y && blankLine(g, r, r.Min.Y, true) {
+		r.Min.Y++
+	}
+	for r.Max.Y > r.Min.Y && blankLine(g, r, r.Max.Y-1, true) {
+		r.Max.Y--
+	}
+	for r.Min.X < r.Max.X && blankLine(g, r, r.Min.X, false) {
+		r.Min.X++
+	}
+	for r.Max.X > r.Min.X && blankLine(g, r, r.Max.X-1, false) {
+		r.Max.X--
+	}
+
+	return r
+}
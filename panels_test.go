@@ -0,0 +1,101 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// drawPanels outlines rects in black on a white page.
+func drawPanels(w, h int, rects ...image.Rectangle) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for _, r := range rects {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetGray(x, r.Min.Y, color.Gray{})
+			img.SetGray(x, r.Max.Y-1, color.Gray{})
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			img.SetGray(r.Min.X, y, color.Gray{})
+			img.SetGray(r.Max.X-1, y, color.Gray{})
+		}
+	}
+
+	return img
+}
+
+func TestFindPanelsStrip(t *testing.T) {
+	img := drawPanels(300, 100,
+		image.Rect(10, 10, 90, 90),
+		image.Rect(110, 10, 190, 90),
+		image.Rect(210, 10, 290, 90),
+	)
+
+	got := findPanels(img)
+	want := []panel{{10, 10, 80, 80}, {110, 10, 80, 80}, {210, 10, 80, 80}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("panel %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFindPanelsGridReadingOrder(t *testing.T) {
+	img := drawPanels(200, 200,
+		image.Rect(5, 5, 95, 95),
+		image.Rect(105, 5, 195, 95),
+		image.Rect(5, 105, 95, 195),
+		image.Rect(105, 105, 195, 195),
+	)
+
+	got := findPanels(img)
+	if len(got) != 4 {
+		t.Fatalf("found %d panels, want 4: %v", len(got), got)
+	}
+	if got[1].X != 105 || got[1].Y != 5 || got[2].X != 5 || got[2].Y != 105 {
+		t.Errorf("panels out of reading order: %v", got)
+	}
+}
+
+func TestFindPanelsBlankPage(t *testing.T) {
+	got := findPanels(drawPanels(50, 40))
+	if len(got) != 1 || got[0] != (panel{0, 0, 50, 40}) {
+		t.Errorf("got %v, want the whole page", got)
+	}
+}
+
+func TestAnalyzeDB(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := analyzeDB(db, false)
+	if err != nil || n != 3 {
+		t.Fatalf("analyzeDB = %d, %v", n, err)
+	}
+
+	// Results are kept, so a second pass has nothing to do.
+	n, err = analyzeDB(db, false)
+	if err != nil || n != 0 {
+		t.Fatalf("second analyzeDB = %d, %v", n, err)
+	}
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Comics[1].Panels) != 1 {
+		t.Errorf("comic 1 panels = %v", m.Comics[1].Panels)
+	}
+}
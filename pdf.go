@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"strings"
+)
+
+// writePDF writes a minimal PDF with one JPEG-encoded image per page. Each
+// page is exactly the size of its image, one point per pixel, so readers
+// scale it to the screen themselves.
+func writePDF(w io.Writer, title string, pages []image.Image) error {
+	var buf bytes.Buffer
+	// Byte offsets of objects 1..n, needed for the xref table.
+	var offsets []int
+
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// Objects 1 and 2 are the catalog and info, 3 the page tree. Each page
+	// then takes three objects: page, content stream and image.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+3*i)
+	}
+
+	obj("<< /Type /Catalog /Pages 3 0 R >>")
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (xkcd-db) >>", pdfEscape(title)))
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+
+	for i, img := range pages {
+		var data bytes.Buffer
+		err := jpeg.Encode(&data, img, &jpeg.Options{Quality: 90})
+		if err != nil {
+			return err
+		}
+
+		colorSpace := "/DeviceRGB"
+		if _, ok := img.(*image.Gray); ok {
+			colorSpace = "/DeviceGray"
+		}
+
+		pw, ph := img.Bounds().Dx(), img.Bounds().Dy()
+		content := fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im0 Do Q", pw, ph)
+		page := 4 + 3*i
+
+		obj(fmt.Sprintf("<< /Type /Page /Parent 3 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pw, ph, page+2, page+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+		obj(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d "+
+			"/ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n%s\nendstream",
+			pw, ph, colorSpace, data.Len(), data.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 2 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, xref)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func pdfEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+	return r.Replace(s)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestWritePDF(t *testing.T) {
+	pages := []image.Image{
+		image.NewRGBA(image.Rect(0, 0, 30, 20)),
+		image.NewGray(image.Rect(0, 0, 20, 30)),
+	}
+
+	var buf bytes.Buffer
+	err := writePDF(&buf, `Barrel (Part 1) \ 2`, pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Error("not framed as a PDF")
+	}
+	for _, want := range []string{
+		`/Title (Barrel \(Part 1\) \\ 2)`,
+		"/Count 2",
+		"/MediaBox [0 0 30 20]",
+		"/MediaBox [0 0 20 30]",
+		"/ColorSpace /DeviceRGB",
+		"/ColorSpace /DeviceGray",
+	} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("lacks %s", want)
+		}
+	}
+
+	// Readers find objects through the xref table, so its offsets must be
+	// exact: catalog, info, page tree and three objects a page.
+	m := regexp.MustCompile(`(?s)startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n0 10\n")) {
+		t.Fatalf("startxref points at %q", pdf[xref:xref+10])
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("%d xref entries, want 9", len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[off:], []byte(want)) {
+			t.Errorf("object %d's offset points at %q", i+1, pdf[off:off+8])
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// syncPlan is what a sync would do, saved by plan for apply to carry out
+// after review.
+type syncPlan struct {
+	DB      string       `json:"db"`
+	Created time.Time    `json:"created"`
+	Source  string       `json:"source"`
+	Latest  int          `json:"latest"`
+	Actions []planAction `json:"actions"`
+}
+
+// planAction is one step of a plan. Op is download, refresh or delete;
+// deletions name a path in the database, the others a comic.
+type planAction struct {
+	Op     string `json:"op"`
+	Num    int    `json:"num,omitempty"`
+	Images bool   `json:"images,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (a planAction) String() string {
+	switch a.Op {
+	case "delete":
+		return "delete " + a.Path + ": " + a.Reason
+	case "refresh":
+		if a.Images {
+			return "refresh #" + strconv.Itoa(a.Num) + " with its image"
+		}
+	}
+
+	return a.Op + " #" + strconv.Itoa(a.Num)
+}
+
+// count returns how many actions of each kind the plan has.
+func (p *syncPlan) count() map[string]int {
+	n := make(map[string]int)
+	for _, a := range p.Actions {
+		n[a.Op]++
+	}
+
+	return n
+}
+
+func (p *syncPlan) summary() string {
+	n := p.count()
+	return fmt.Sprintf("%d downloads, %d refreshes and %d deletions in %s", n["download"], n["refresh"], n["delete"], p.DB)
+}
+
+// plan works out what a sync would do and saves it.
+func plan(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	refresh := fs.Bool("refresh", false, "Plan to fetch the metadata of stored comics again")
+	images := fs.Bool("images", false, "With -refresh, plan to fetch images that changed upstream too")
+	out := fs.String("o", "plan.json", "Where to save the plan")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	if *images && !*refresh {
+		log.Fatalln("-images needs -refresh")
+	}
+
+	p, err := makePlan(withSlash(*dbPath), *refresh, *images)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	for _, a := range p.Actions {
+		detail("%s\n", a)
+	}
+
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = os.WriteFile(*out, data, 0644)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("Planned %s; review %s and run xkcd-db apply %s\n", p.summary(), *out, *out)
+}
+
+// makePlan lists the downloads of missing comics, refreshes of stored
+// ones if asked for, and deletions of excluded comics and cleanup litter.
+func makePlan(dbPath string, refresh, images bool) (*syncPlan, error) {
+	if offline {
+		return nil, errors.New("plan needs the network: " + errOffline.Error())
+	}
+
+	src, err := loadSource(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := src.latest()
+	if err != nil {
+		return nil, err
+	}
+	ex, err := loadExclusions(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &syncPlan{DB: dbPath, Created: time.Now().UTC(), Source: sourceName(dbPath), Latest: latest, Actions: []planAction{}}
+
+	stored, err := storedComics(dbPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		for _, num := range stored {
+			if e, ok := ex[num]; ok {
+				p.Actions = append(p.Actions, planAction{Op: "delete", Path: dbPath + strconv.Itoa(num), Reason: "excluded: " + e.Reason})
+			}
+		}
+
+		found, err := findLitter(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range found {
+			p.Actions = append(p.Actions, planAction{Op: "delete", Path: l.Path, Reason: l.Reason})
+		}
+	}
+
+	for _, item := range withoutExcluded(missingComics(src, latest, dbPath), ex) {
+		num, _ := strconv.Atoi(item)
+		p.Actions = append(p.Actions, planAction{Op: "download", Num: num})
+	}
+
+	if refresh {
+		for _, num := range stored {
+			if _, ok := ex[num]; !ok {
+				p.Actions = append(p.Actions, planAction{Op: "refresh", Num: num, Images: images})
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// apply carries out a saved plan.
+func apply(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	rate := fs.Int("r", 20, "Set the maximum number of parallel downloads")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db apply [flags] plan.json")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var p syncPlan
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		log.Fatalln(fs.Arg(0)+":", err)
+	}
+
+	if len(p.Actions) == 0 {
+		fmt.Println("The plan has nothing to do")
+		return
+	}
+	if !confirm(fmt.Sprintf("Apply %s, planned %s?", p.summary(), p.Created.Local().Format("2006-01-02 15:04"))) {
+		os.Exit(1)
+	}
+
+	a := startAudit(p.DB, "apply", args)
+	failed, err := applyPlan(&p, *rate)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	outcome := fmt.Sprintf("Applied %s, %d failed", p.summary(), failed)
+	t := good
+	if failed > 0 {
+		t = warn
+	}
+	fmt.Println(paint(os.Stdout, t, outcome))
+	a.end(outcome)
+}
+
+// applyPlan does exactly what the plan says, and nothing if the database
+// changed since in a way that conflicts with it. It returns how many
+// downloads and refreshes failed.
+func applyPlan(p *syncPlan, rate int) (int, error) {
+	if offline {
+		return 0, errors.New("apply needs the network: " + errOffline.Error())
+	}
+	dbPath := withSlash(p.DB)
+
+	if name := sourceName(dbPath); name != p.Source {
+		return 0, fmt.Errorf("the plan is for %s, but %s mirrors %s", p.Source, dbPath, name)
+	}
+
+	var deletions []string
+	for _, a := range p.Actions {
+		var err error
+		switch a.Op {
+		case "download":
+			_, err = os.Stat(dbPath + strconv.Itoa(a.Num))
+			if err == nil {
+				err = errors.New("is stored already")
+			} else if os.IsNotExist(err) {
+				err = nil
+			}
+		case "refresh":
+			_, err = os.Stat(dbPath + strconv.Itoa(a.Num))
+		case "delete":
+			_, err = os.Stat(a.Path)
+			deletions = append(deletions, a.Path)
+		default:
+			err = errors.New("is unknown")
+		}
+		if err != nil {
+			return 0, fmt.Errorf("the database changed since the plan was made; plan again: %s %v", a, err)
+		}
+	}
+
+	if len(deletions) > 0 {
+		id, err := moveToTrash(dbPath, deletions)
+		if err != nil {
+			return 0, err
+		}
+		_, err = fsckDB(dbPath, true)
+		if err != nil {
+			return 0, err
+		}
+		say("Moved %d items to trash run %s\n", len(deletions), id)
+	}
+
+	src, err := loadSource(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	err = os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		return 0, err
+	}
+	m, unlock, err := recoverManifest(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if rate < 1 {
+		rate = 1
+	}
+	tokens := make(chan struct{}, rate)
+	var wg sync.WaitGroup
+	var failed int64
+	refreshed := false
+
+	for _, a := range p.Actions {
+		if a.Op == "delete" {
+			continue
+		}
+		refreshed = refreshed || a.Op == "refresh"
+
+		wg.Add(1)
+		go func(a planAction) {
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+			defer wg.Done()
+
+			detail("%s\n", a)
+
+			var err error
+			if a.Op == "download" {
+				err = fetchComic(src, strconv.Itoa(a.Num), dbPath, m)
+			} else {
+				_, err = refreshComic(src, a.Num, dbPath, m, a.Images, false)
+			}
+			if err != nil {
+				log.Println(err)
+				atomic.AddInt64(&failed, 1)
+			}
+		}(a)
+	}
+	wg.Wait()
+
+	err = updateManifest(dbPath, m)
+	if err != nil {
+		return int(failed), err
+	}
+
+	return int(failed), updateIndex(dbPath, refreshed)
+}
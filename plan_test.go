@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestPlanApply(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Add(fakexkcd.Corpus(4)[3])
+	err = exclusions{1: {Reason: "too long"}}.save(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(db+"notes.txt", []byte("mine"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := makePlan(db, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, a := range p.Actions {
+		got = append(got, a.String())
+	}
+	want := []string{
+		"delete " + db + "1: excluded: too long",
+		"delete " + db + "notes.txt: not part of the database",
+		"download #4",
+		"refresh #2",
+		"refresh #3",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("plan:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Nothing happens until the plan is applied.
+	if srv.Hits("/4/info.0.json") != 0 {
+		t.Error("planning downloaded comic 4")
+	}
+	if _, err := os.Stat(db + "1"); err != nil {
+		t.Error("planning removed comic 1")
+	}
+
+	failed, err := applyPlan(p, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 0 {
+		t.Errorf("%d actions failed", failed)
+	}
+	nums, err := storedComics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(nums, []int{2, 3, 4}) {
+		t.Errorf("stored %v after apply", nums)
+	}
+	if _, err := os.Stat(db + "notes.txt"); !os.IsNotExist(err) {
+		t.Error("notes.txt is still there")
+	}
+
+	// The same plan doesn't fit the database any more.
+	if _, err := applyPlan(p, 2); err == nil || !strings.Contains(err.Error(), "plan again") {
+		t.Errorf("applying twice: %v", err)
+	}
+}
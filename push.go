@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// E-ink readers. Dimensions are the panel resolution in portrait.
+type device struct {
+	width, height int
+}
+
+var devices = map[string]device{
+	"kindle":     {1072, 1448},
+	"remarkable": {1404, 1872},
+}
+
+func pushDevice(args []string) {
+	fs := flag.NewFlagSet("push-device", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	devName := fs.String("device", "kindle", "Target device: kindle or remarkable")
+	kindleEmail := fs.String("kindle-email", "", "Send-to-Kindle address to deliver to")
+	from := fs.String("from", "", "Sender address approved for your Kindle")
+	smtpAddr := fs.String("smtp", "", "SMTP server as host:port")
+	smtpUser := fs.String("smtp-user", "", "SMTP username. The password is read from XKCDDB_SMTP_PASSWORD")
+	rmURL := fs.String("remarkable-url", "http://10.11.99.1", "reMarkable USB web interface address")
+	eink := einkFlags(fs)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db push-device [flags] comic|first-last ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+
+	if offline {
+		log.Fatalln("push-device needs the network:", errOffline)
+	}
+
+	dev, ok := devices[*devName]
+	if !ok {
+		log.Fatalf("Unknown device %q\n", *devName)
+	}
+
+	err := eink.validate()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	nums, err := parseComics(fs.Args())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(nums) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	pages := make([]image.Image, 0, len(nums))
+	for _, num := range nums {
+		path, err := fetchImage(*dbPath, num)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		img, err := loadImage(path)
+		if err != nil {
+			log.Fatalf("Comic %d: %v\n", num, err)
+		}
+
+		pages = append(pages, eink.prepare(img, dev))
+	}
+
+	title := "xkcd " + fs.Arg(0)
+	if fs.NArg() > 1 {
+		title += " to " + fs.Arg(fs.NArg()-1)
+	}
+	fileName := "xkcd-" + strings.Join(fs.Args(), "_") + ".pdf"
+
+	var doc bytes.Buffer
+	err = writePDF(&doc, title, pages)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch *devName {
+	case "kindle":
+		if *kindleEmail == "" || *from == "" || *smtpAddr == "" {
+			log.Fatalln("kindle delivery needs -kindle-email, -from and -smtp")
+		}
+		err = sendKindle(*smtpAddr, *smtpUser, *from, *kindleEmail, title, fileName, doc.Bytes())
+	case "remarkable":
+		err = uploadRemarkable(*rmURL, fileName, doc.Bytes())
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("Pushed %d comics to %s\n", len(pages), *devName)
+}
+
+// sendKindle mails the document as an attachment to a Send-to-Kindle
+// address.
+func sendKindle(addr, user, from, to, subject, fileName string, doc []byte) error {
+	auth, err := smtpAuth(addr, user)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	fmt.Fprintf(&body, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", from, to, subject)
+	fmt.Fprintf(&body, "MIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"application/pdf"},
+		"Content-Disposition":       {`attachment; filename="` + fileName + `"`},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Mail lines must stay under 78 characters.
+	enc := base64.StdEncoding.EncodeToString(doc)
+	for len(enc) > 76 {
+		fmt.Fprintf(part, "%s\r\n", enc[:76])
+		enc = enc[76:]
+	}
+	fmt.Fprintf(part, "%s\r\n", enc)
+
+	err = mw.Close()
+	if err != nil {
+		return err
+	}
+
+	return sendMail(addr, auth, from, []string{to}, body.Bytes())
+}
+
+// sendMail is smtp.SendMail, which offline mode forbids like any other
+// network access.
+func sendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	if offline {
+		return errOffline
+	}
+
+	return smtp.SendMail(addr, a, from, to, msg)
+}
+
+// smtpAuth logs in as user, if given, with the password from
+// XKCDDB_SMTP_PASSWORD.
+func smtpAuth(addr, user string) (smtp.Auth, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || user == "" {
+		return nil, err
+	}
+
+	return smtp.PlainAuth("", user, os.Getenv("XKCDDB_SMTP_PASSWORD"), host), nil
+}
+
+// uploadRemarkable posts the document to the tablet's USB web interface,
+// which must be enabled in its storage settings.
+func uploadRemarkable(url, fileName string, doc []byte) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	part, err := mw.CreateFormFile("file", fileName)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(doc)
+	if err != nil {
+		return err
+	}
+
+	err = mw.Close()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(strings.TrimSuffix(url, "/")+"/upload", mw.FormDataContentType(), &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("reMarkable upload failed: " + resp.Status)
+	}
+
+	return nil
+}
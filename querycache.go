@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// How many searches and API responses are kept in memory per database.
+const (
+	maxCachedQueries   = 256
+	maxCachedResponses = 512
+)
+
+// cachedSearch is the comics a query matched while the database held
+// stored comics.
+type cachedSearch struct {
+	nums   []int
+	stored int
+}
+
+// cachedResult returns what the query matched last time, if the index
+// is unchanged since and no comics came or went.
+func (ix *searchIndex) cachedResult(query string, stored int) ([]int, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	c, ok := ix.results[query]
+	if !ok || c.stored != stored {
+		return nil, false
+	}
+
+	return c.nums, true
+}
+
+func (ix *searchIndex) remember(query string, stored int, nums []int) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.results == nil {
+		ix.results = make(map[string]cachedSearch)
+	}
+	// Any query makes room; popular ones are soon back.
+	if len(ix.results) >= maxCachedQueries {
+		for q := range ix.results {
+			delete(ix.results, q)
+			break
+		}
+	}
+	ix.results[query] = cachedSearch{nums, stored}
+}
+
+// forget drops the remembered searches, e.g. to time the index itself.
+func (ix *searchIndex) forget() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.results = nil
+}
+
+// responseCache keeps recent API responses of one database until the
+// search index or manifest changes, e.g. after a sync or analyze.
+type responseCache struct {
+	dbPath string
+
+	mu      sync.Mutex
+	gen     string
+	entries map[string]*cachedResponse
+	// Counts lookups, to find the least recently used entry.
+	clock uint64
+}
+
+type cachedResponse struct {
+	header http.Header
+	body   []byte
+	used   uint64
+}
+
+func newResponseCache(dbPath string) *responseCache {
+	return &responseCache{dbPath: dbPath, entries: make(map[string]*cachedResponse)}
+}
+
+// generation changes whenever cached responses may be out of date.
+func (rc *responseCache) generation() (string, error) {
+	ix, err := loadIndex(rc.dbPath)
+	if err != nil {
+		return "", err
+	}
+
+	gen := ix.built.String()
+	for _, name := range []string{manifestFile, tagsFile} {
+		info, err := os.Stat(rc.dbPath + name)
+		if err == nil {
+			gen += fmt.Sprintf(" %s %d", info.ModTime(), info.Size())
+		}
+	}
+
+	return gen, nil
+}
+
+func (rc *responseCache) get(key, gen string) (*cachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if gen != rc.gen {
+		rc.gen = gen
+		rc.entries = make(map[string]*cachedResponse)
+		return nil, false
+	}
+
+	c, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	rc.clock++
+	c.used = rc.clock
+
+	return c, true
+}
+
+func (rc *responseCache) put(gen, key string, c *cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if gen != rc.gen {
+		return
+	}
+
+	if len(rc.entries) >= maxCachedResponses {
+		oldest := ""
+		for k, e := range rc.entries {
+			if oldest == "" || e.used < rc.entries[oldest].used {
+				oldest = k
+			}
+		}
+		delete(rc.entries, oldest)
+	}
+
+	rc.clock++
+	c.used = rc.clock
+	rc.entries[key] = c
+}
+
+// wrap answers GET requests from the cache, and caches successful
+// responses of h with the headers h set.
+func (rc *responseCache) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		gen, err := rc.generation()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		key := r.URL.RequestURI()
+		if c, ok := rc.get(key, gen); ok {
+			for k, v := range c.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("X-Cache", "hit")
+			w.Write(c.body)
+			return
+		}
+
+		// Headers set before h runs, like CORS's, are the requester's
+		// own and must not be replayed to the next.
+		outer := w.Header().Clone()
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		if rec.status == http.StatusOK {
+			own := make(http.Header)
+			for k, v := range w.Header() {
+				if _, ok := outer[k]; !ok {
+					own[k] = v
+				}
+			}
+			rc.put(gen, key, &cachedResponse{header: own, body: rec.body.Bytes()})
+		}
+	})
+}
+
+// recorder passes a response on while keeping a copy.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestResponseCache(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer((&server{dbPath: db}).routes())
+	defer ts.Close()
+
+	fetch := func() (string, string) {
+		resp, err := http.Get(ts.URL + "/api/search?q=alt+text")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type %q", ct)
+		}
+		return resp.Header.Get("X-Cache"), string(body)
+	}
+
+	hit, first := fetch()
+	if hit != "" {
+		t.Error("first search came from the cache")
+	}
+	hit, again := fetch()
+	if hit != "hit" || again != first {
+		t.Errorf("second search: cache %q\n%s", hit, again)
+	}
+
+	// A sync updates the index, which empties the cache.
+	srv.Add(fakexkcd.Corpus(4)[3])
+	_, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hit, after := fetch()
+	if hit != "" || !strings.Contains(after, `"num":4`) {
+		t.Errorf("after sync: cache %q\n%s", hit, after)
+	}
+}
+
+func TestResponseCacheKeepsCORSPerRequest(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(2))
+	db := tempDB(t)
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := parseCORS("localhost, https://app.example.com").wrap((&server{dbPath: db}).routes())
+	from := func(origin string) http.Header {
+		r := httptest.NewRequest("GET", "/api/comic/1", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Header()
+	}
+
+	from("https://app.example.com")
+	if got := from("http://localhost:5173"); got.Get("X-Cache") != "hit" || got.Get("Access-Control-Allow-Origin") != "http://localhost:5173" {
+		t.Errorf("second origin: cache %q, allowed %q", got.Get("X-Cache"), got.Get("Access-Control-Allow-Origin"))
+	}
+	if got := from(""); got.Get("Access-Control-Allow-Origin") != "" || len(got.Values("Vary")) != 1 {
+		t.Errorf("no origin: allowed %q, Vary %q", got.Get("Access-Control-Allow-Origin"), got.Values("Vary"))
+	}
+	if got := from("https://evil.example.com"); got.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("evil origin allowed %q from the cache", got.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestSearchCache(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := searchNums(t, db, "alt text"); !equalInts(got, []int{1, 2, 3}) {
+		t.Fatalf("found %v", got)
+	}
+	ix, err := loadIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ix.cachedResult("alt text", 3); !ok {
+		t.Error("search wasn't cached")
+	}
+
+	// Comics going away count as a change.
+	err = os.RemoveAll(db + "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchNums(t, db, "alt text"); !equalInts(got, []int{1, 3}) {
+		t.Errorf("found %v after removing 2", got)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import "sync"
+
+// fetchQueue hands out comics to download. Comics pushed while a sync is
+// running, such as ones a user asked for with ctl fetch, jump ahead of the
+// bulk backfill.
+type fetchQueue struct {
+	mu       sync.Mutex
+	priority []string
+	bulk     []string
+}
+
+// newFetchQueue queues a copy of bulk, which the caller keeps as it was.
+func newFetchQueue(bulk []string) *fetchQueue {
+	return &fetchQueue{bulk: append([]string(nil), bulk...)}
+}
+
+// push moves item to the back of the priority lane. Comics already waiting
+// in the bulk lane are taken out of it so they aren't fetched twice.
+func (q *fetchQueue) push(item string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, p := range q.priority {
+		if p == item {
+			return
+		}
+	}
+
+	for i, b := range q.bulk {
+		if b == item {
+			q.bulk = append(q.bulk[:i], q.bulk[i+1:]...)
+			break
+		}
+	}
+
+	q.priority = append(q.priority, item)
+}
+
+// promote moves item to the back of the priority lane if it is still
+// waiting to be fetched, and reports whether it is.
+func (q *fetchQueue) promote(item string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, p := range q.priority {
+		if p == item {
+			return true
+		}
+	}
+
+	for i, b := range q.bulk {
+		if b == item {
+			q.bulk = append(q.bulk[:i], q.bulk[i+1:]...)
+			q.priority = append(q.priority, item)
+			return true
+		}
+	}
+
+	return false
+}
+
+// pop returns the next comic to fetch, or false once both lanes are empty.
+func (q *fetchQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var item string
+	switch {
+	case len(q.priority) > 0:
+		item, q.priority = q.priority[0], q.priority[1:]
+	case len(q.bulk) > 0:
+		item, q.bulk = q.bulk[0], q.bulk[1:]
+	default:
+		return "", false
+	}
+
+	return item, true
+}
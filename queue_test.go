@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func drain(q *fetchQueue) string {
+	var items []string
+	for item, ok := q.pop(); ok; item, ok = q.pop() {
+		items = append(items, item)
+	}
+
+	return strings.Join(items, " ")
+}
+
+func TestFetchQueuePriority(t *testing.T) {
+	q := newFetchQueue([]string{"1", "2", "3", "4"})
+	q.push("3")
+	q.push("9")
+	q.push("3")
+
+	if got, want := drain(q), "3 9 1 2 4"; got != want {
+		t.Errorf("queue order %q, want %q", got, want)
+	}
+}
+
+func TestFetchQueuePushWhileDraining(t *testing.T) {
+	q := newFetchQueue([]string{"1", "2", "3"})
+
+	first, _ := q.pop()
+	q.push("3")
+
+	if got, want := first+" "+drain(q), "1 3 2"; got != want {
+		t.Errorf("queue order %q, want %q", got, want)
+	}
+}
+
+func TestFetchQueueKeepsList(t *testing.T) {
+	missing := []string{"1", "2", "3", "4"}
+	q := newFetchQueue(missing)
+	q.push("2")
+	drain(q)
+
+	if got := strings.Join(missing, " "); got != "1 2 3 4" {
+		t.Errorf("queueing changed the list to %q", got)
+	}
+}
+
+func TestFetchQueuePromote(t *testing.T) {
+	q := newFetchQueue([]string{"1", "2", "3"})
+	first, _ := q.pop()
+
+	if !q.promote("3") || !q.promote("3") {
+		t.Error("a waiting comic wasn't promoted")
+	}
+	if q.promote(first) || q.promote("9") {
+		t.Error("promoted a comic that isn't waiting")
+	}
+	if got, want := drain(q), "3 2"; got != want {
+		t.Errorf("queue order %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const quizFile = "quiz.json"
+
+// Running quiz totals, kept in the database.
+type quizScore struct {
+	Played  int `json:"played"`
+	Correct int `json:"correct"`
+	Best    int `json:"bestStreak"`
+	Streak  int `json:"streak"`
+}
+
+// quiz shows alt text or a transcript snippet and asks which comic it is.
+func quiz(args []string) {
+	fs := flag.NewFlagSet("quiz", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	rounds := fs.Int("rounds", 5, "Number of questions")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	_, err := runQuiz(withSlash(*dbPath), *rounds, os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// runQuiz plays a game and records it, returning how many answers were
+// right.
+func runQuiz(dbPath string, rounds int, in io.Reader, out io.Writer) (int, error) {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only comics with a clue and a title to guess are any fun.
+	var pool []localComic
+	for _, num := range nums {
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return 0, err
+		}
+		if c.Title != "" && (c.Alt != "" || c.Transcript != "") {
+			pool = append(pool, c)
+		}
+	}
+	if len(pool) == 0 {
+		return 0, fmt.Errorf("no comics with titles in %s; sync first", dbPath)
+	}
+
+	score, err := loadQuizScore(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	answers := bufio.NewScanner(in)
+	correct := 0
+
+	for round := 1; round <= rounds; round++ {
+		c := pool[rng.Intn(len(pool))]
+
+		fmt.Fprintf(out, "\nQuestion %d of %d:\n%s\n", round, rounds, quizClue(c))
+		fmt.Fprint(out, "Which comic is this? (number or title) ")
+
+		if !answers.Scan() {
+			break
+		}
+
+		score.Played++
+		if quizMatch(c, answers.Text()) {
+			correct++
+			score.Correct++
+			score.Streak++
+			if score.Streak > score.Best {
+				score.Best = score.Streak
+			}
+			fmt.Fprintf(out, "Correct! #%d %s\n", c.Num, c.Title)
+		} else {
+			score.Streak = 0
+			fmt.Fprintf(out, "No, it was #%d %s\n", c.Num, c.Title)
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d right this game. All time: %d of %d, best streak %d\n",
+		correct, score.Correct, score.Played, score.Best)
+
+	return correct, score.save(dbPath)
+}
+
+// quizClue picks the alt text if there is one, otherwise the start of the
+// transcript, with the title blanked out.
+func quizClue(c localComic) string {
+	clue := c.Alt
+	if clue == "" {
+		clue = c.Transcript
+		if len(clue) > 300 {
+			clue = clue[:300] + "..."
+		}
+	}
+
+	title := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(c.Title))
+	return title.ReplaceAllString(clue, "_____")
+}
+
+// quizMatch accepts the comic number or its title, ignoring case and
+// punctuation.
+func quizMatch(c localComic, answer string) bool {
+	answer = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(answer), "#"))
+	if num, err := strconv.Atoi(answer); err == nil {
+		return num == c.Num
+	}
+
+	return normalize(answer) != "" && normalize(answer) == normalize(c.Title)
+}
+
+func normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+func loadQuizScore(dbPath string) (*quizScore, error) {
+	score := &quizScore{}
+
+	data, err := os.ReadFile(dbPath + quizFile)
+	if os.IsNotExist(err) {
+		return score, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return score, json.Unmarshal(data, score)
+}
+
+func (s *quizScore) save(dbPath string) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dbPath+quizFile, data, 0644)
+}
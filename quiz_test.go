@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestQuizMatch(t *testing.T) {
+	c := localComic{Comic: Comic{Num: 927, Title: "Standards"}}
+
+	for _, answer := range []string{"927", "#927", " standards ", "STANDARDS!"} {
+		if !quizMatch(c, answer) {
+			t.Errorf("%q rejected", answer)
+		}
+	}
+	for _, answer := range []string{"928", "standard", "", "!!"} {
+		if quizMatch(c, answer) {
+			t.Errorf("%q accepted", answer)
+		}
+	}
+}
+
+func TestQuizClueHidesTitle(t *testing.T) {
+	c := localComic{Comic: Comic{Title: "Standards", Alt: "Fortunately, the charging one has been solved now that we've all standardized on mini-USB. Or is it micro-USB? STANDARDS."}}
+
+	if clue := quizClue(c); strings.Contains(strings.ToLower(clue), "standards") {
+		t.Errorf("clue gives the title away: %q", clue)
+	}
+}
+
+func TestRunQuizKeepsScore(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(1))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	correct, err := runQuiz(db, 3, strings.NewReader("1\ncomic 1\n2\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if correct != 2 {
+		t.Errorf("%d correct, want 2\n%s", correct, out.String())
+	}
+
+	// Running out of answers ends the game early.
+	_, err = runQuiz(db, 3, strings.NewReader("1\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score, err := loadQuizScore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *score != (quizScore{Played: 4, Correct: 3, Best: 2, Streak: 1}) {
+		t.Errorf("score %+v", *score)
+	}
+}
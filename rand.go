@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Shared randomness. Runs given the same -seed make the same choices.
+var rng = newLockedRand(time.Now().UnixNano())
+
+// lockedRand is a rand.Rand safe for use by concurrent workers.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func (l *lockedRand) Seed(seed int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.r.Seed(seed)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.Float64()
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.Intn(n)
+}
+
+func (l *lockedRand) Shuffle(n int, swap func(i, j int)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.r.Shuffle(n, swap)
+}
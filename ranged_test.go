@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestRangedDownload(t *testing.T) {
+	comics := fakexkcd.Corpus(2)
+	comics[0].Image = make([]byte, 5000)
+	for i := range comics[0].Image {
+		comics[0].Image[i] = byte(i * 7)
+	}
+	srv := startFake(t, comics)
+
+	old := ranged
+	ranged = rangeConfig{chunks: 3, minSize: 1000}
+	defer func() { ranged = old }()
+
+	db := tempDB(t)
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range comics {
+		if got := readFile(t, db+strconv.Itoa(c.Num)+"/"+c.ImgName); !bytes.Equal(got, c.Image) {
+			t.Errorf("comic %d image differs", c.Num)
+		}
+	}
+
+	// A HEAD and three ranges for the large image, a HEAD and a plain GET
+	// for the small one.
+	if hits := srv.Hits("/comics/comic_1.png"); hits != 4 {
+		t.Errorf("large image requested %d times, want 4", hits)
+	}
+	if hits := srv.Hits("/comics/comic_2.png"); hits != 2 {
+		t.Errorf("small image requested %d times, want 2", hits)
+	}
+}
+
+func TestRangedDownloadDiskFull(t *testing.T) {
+	comics := fakexkcd.Corpus(1)
+	comics[0].Image = make([]byte, 5000)
+	srv := startFake(t, comics)
+
+	old := ranged
+	ranged = rangeConfig{chunks: 3, minSize: 1000}
+	defer func() { ranged = old }()
+	diskFullRate = 1
+	defer func() { diskFullRate = 0 }()
+
+	path := t.TempDir() + "/comic_1.png"
+	_, _, err := downloadRanged(srv.URL+"/comics/comic_1.png", path)
+	if describeStorageError(err) != storageFull {
+		t.Fatalf("got %v, want a full disk", err)
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Errorf("left the part behind: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("kept the image: %v", err)
+	}
+}
+
+func TestCheckDownload(t *testing.T) {
+	path := t.TempDir() + "/img"
+	err := os.WriteFile(path, []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkDownload(path, 5, `"5d41402abc4b2a76b9719d911017c592"`); err != nil {
+		t.Errorf("matching download rejected: %v", err)
+	}
+	if err := checkDownload(path, 5, `"00000000000000000000000000000000"`); err == nil {
+		t.Error("checksum mismatch accepted")
+	}
+	if err := checkDownload(path, 6, ""); err == nil {
+		t.Error("short download accepted")
+	}
+	// Other ETags can't be checked.
+	if err := checkDownload(path, 5, `W/"abc"`); err != nil {
+		t.Error(err)
+	}
+}
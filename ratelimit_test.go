@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPLimiter(t *testing.T) {
+	l := newIPLimiter(2, 3, false)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	ok, wait := l.allow("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Errorf("over the burst: got %v, wait %v", ok, wait)
+	}
+	if ok, _ := l.allow("b", now); !ok {
+		t.Error("another client was limited")
+	}
+	if ok, _ := l.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("no token after waiting")
+	}
+
+	// Idle clients are forgotten.
+	l.allow("c", now.Add(time.Hour))
+	if _, ok := l.buckets["a"]; ok || len(l.buckets) != 1 {
+		t.Errorf("kept %d buckets", len(l.buckets))
+	}
+}
+
+func TestLimitRequests(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	})
+	h := limitRequests(echo, newIPLimiter(1, 2, true), 10)
+
+	do := func(body string, from string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set("X-Forwarded-For", "10.0.0.1, "+from)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("small", "1.2.3.4"); w.Code != http.StatusOK {
+		t.Errorf("small body: %d", w.Code)
+	}
+	if w := do("far too large a body", "1.2.3.4"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: %d", w.Code)
+	}
+	w := do("", "1.2.3.4")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("over the limit: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := do("", "5.6.7.8"); w.Code != http.StatusOK {
+		t.Errorf("forwarded client limited with another: %d", w.Code)
+	}
+}
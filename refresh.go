@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// refreshComics fetches the metadata of every stored comic again. With
+// images set, images are downloaded again too unless the server reports
+// the stored copy is current. Files changed locally are kept unless force
+// is set. Comics not reached within the budget are left as they are.
+// Once the database can't be written to, the rest are left too, and the
+// error is returned.
+func refreshComics(src comicSource, dbPath string, m *manifest, tokens chan struct{}, images, force bool, b *budget) error {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	refreshed, unchanged := 0, 0
+	var halted error
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return halted != nil
+	}
+
+	for _, num := range nums {
+		wg.Add(1)
+		go func(num int) {
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+			defer wg.Done()
+
+			if b.exhausted() || stopped() {
+				return
+			}
+
+			skipped, err := refreshComic(src, num, dbPath, m, images, force)
+			if isStorageError(err) {
+				mu.Lock()
+				if halted == nil {
+					halted = err
+				}
+				mu.Unlock()
+				return
+			}
+			if err != nil {
+				log.Println(err)
+				return
+			}
+
+			mu.Lock()
+			refreshed++
+			if skipped {
+				unchanged++
+			}
+			mu.Unlock()
+		}(num)
+	}
+
+	wg.Wait()
+
+	if images {
+		say("Refreshed %d comics, %d images unchanged\n", refreshed, unchanged)
+	} else {
+		say("Refreshed %d comics\n", refreshed)
+	}
+
+	return halted
+}
+
+// refreshComic rewrites the text of a stored comic and, with images set,
+// its image. Files edited locally are reported and kept, unless force is
+// set. It reports whether the image download was skipped because the
+// stored one is current.
+func refreshComic(src comicSource, num int, dbPath string, m *manifest, images, force bool) (skipped bool, err error) {
+	item := strconv.Itoa(num)
+
+	comicData, err := src.info(item)
+	if err != nil {
+		return false, err
+	}
+
+	keep, err := m.localEdits(num)
+	if err != nil {
+		return false, err
+	}
+	oldPath, _ := comicImagePath(dbPath, num)
+	_, imageEdited := keep[filepath.Base(oldPath)]
+	if len(keep) > 0 {
+		var names []string
+		for name := range keep {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if force {
+			say("Comic %d: overwriting local changes to %s\n", num, strings.Join(names, ", "))
+			keep = nil
+		} else {
+			say("Comic %d: keeping local changes to %s; -force overwrites them\n", num, strings.Join(names, ", "))
+		}
+	}
+
+	// Recorded last, keeping what was recorded for files left alone.
+	defer func() {
+		if serr := m.updateSums(num, keep); err == nil {
+			err = serr
+		}
+	}()
+
+	err = writeTextExcept(dbPath, item, comicData, keep)
+	if err != nil {
+		return false, err
+	}
+
+	splitUrl := strings.Split(comicData.Img, "/")
+	imgName := splitUrl[len(splitUrl)-1]
+	if !images || imgName == "" {
+		return false, nil
+	}
+
+	imgPath := dbPath + item + "/" + imgName
+	if imageEdited && !force {
+		return false, nil
+	}
+
+	req, err := http.NewRequest("GET", comicData.Img, nil)
+	if err != nil {
+		return false, err
+	}
+
+	// Validators only apply to the file they were recorded for, as it was
+	// downloaded.
+	if oldPath == imgPath && !imageEdited {
+		if etag := m.etag(num); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		} else if current, err := sameLength(comicData.Img, imgPath); err != nil || current {
+			return current, err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("comic %d image: %s", num, resp.Status)
+	}
+
+	// Written aside first so a failed download keeps the old image.
+	tmp := imgPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(f, resp.Body)
+	if err == nil {
+		err = syncComicFile(f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return false, err
+	}
+
+	err = os.Rename(tmp, imgPath)
+	if err != nil {
+		return false, err
+	}
+	if oldPath != "" && oldPath != imgPath {
+		err = os.Remove(oldPath)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, m.setImage(num, resp.Header.Get("ETag"))
+}
+
+// sameLength asks for the size of an image without downloading it and
+// compares it with the stored copy. It is the fallback for comics whose
+// image came without an ETag.
+func sameLength(url, path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Head(url)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 {
+		return false, nil
+	}
+
+	return resp.ContentLength == info.Size(), nil
+}
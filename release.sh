@@ -0,0 +1,31 @@
+#!/bin/sh
+# Builds static, reproducible release binaries into dist/.
+#
+# Usage: ./release.sh v1.2.3
+set -eu
+
+version=${1:?usage: $0 version}
+commit=$(git rev-parse HEAD)
+# Timestamps and paths stay out of the binaries, so the same commit always
+# builds the same bytes.
+ldflags="-s -w -buildid= -X main.version=$version -X main.commit=$commit"
+# The cloud drive client IDs registered for xkcd-db, if given.
+for id in GDRIVE_CLIENT_ID:gdriveClientID GDRIVE_CLIENT_SECRET:gdriveClientSecret DROPBOX_CLIENT_ID:dropboxClientID; do
+	value=$(printenv "${id%%:*}" || true)
+	if [ -n "$value" ]; then
+		ldflags="$ldflags -X main.${id#*:}=$value"
+	fi
+done
+
+mkdir -p dist
+for target in linux/amd64 linux/arm64 darwin/amd64 darwin/arm64 windows/amd64; do
+	os=${target%/*}
+	arch=${target#*/}
+	out=dist/xkcd-db-$version-$os-$arch
+	[ "$os" = windows ] && out=$out.exe
+
+	echo "Building $out"
+	CGO_ENABLED=0 GOOS=$os GOARCH=$arch go build -trimpath -ldflags "$ldflags" -o "$out" .
+done
+
+(cd dist && sha256sum xkcd-db-"$version"-* > SHA256SUMS)
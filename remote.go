@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// remoteFile remembers what was uploaded where, so an upload that was
+// cut short carries on where it stopped.
+const remoteFile = "remote.json"
+
+// Files uploaded between saves of what was uploaded.
+const uploadChunk = 32
+
+// remoteStore is somewhere besides the local disk to keep a mirror.
+// Paths are relative to the mirror and use slashes.
+type remoteStore interface {
+	// put uploads files of the mirror at dbPath, each replacing any
+	// earlier copy whole so readers never see half of one. It returns how
+	// many of the first paths are surely uploaded.
+	put(dbPath string, paths []string) (int, error)
+	// get downloads one file.
+	get(path string) (io.ReadCloser, error)
+	// remove deletes files, and directories named with a trailing slash.
+	// What is already gone is no error.
+	remove(paths []string) error
+	// String names the store without its secrets.
+	String() string
+}
+
+// get fails with this for files the store doesn't have.
+var errRemoteNotFound = errors.New("not in the remote store")
+
+// openRemote chooses the store for a URL: http and https are WebDAV, e.g.
+// a Nextcloud share, sftp is an SSH server, and gdrive and dropbox are
+// folders in those cloud drives.
+func openRemote(rawURL string) (remoteStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return newWebDAV(u), nil
+	case "sftp":
+		return newSFTP(u)
+	case "gdrive":
+		return newGDrive(u.Host + u.Path), nil
+	case "dropbox":
+		return newDropbox(u.Host + u.Path), nil
+	}
+
+	return nil, fmt.Errorf("%s: remote stores are http, https, sftp, gdrive or dropbox URLs", rawURL)
+}
+
+// fileStamp tells whether a local file changed since it was uploaded.
+type fileStamp struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// remoteState is what was uploaded, by store and then path.
+type remoteState map[string]map[string]fileStamp
+
+func loadRemoteState(dbPath string) (remoteState, error) {
+	st := make(remoteState)
+
+	data, err := os.ReadFile(dbPath + remoteFile)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &st)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dbPath+remoteFile, err)
+	}
+
+	return st, nil
+}
+
+func (st remoteState) save(dbPath string) error {
+	data, err := json.MarshalIndent(st, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dbPath+remoteFile, data, 0644)
+}
+
+// Database files worth keeping remotely. The rest are logs and state of
+// this machine, or like the search index are rebuilt from the comics.
+var remoteDBFiles = []string{excludeFile, feedFile, sourceFile, manifestFile}
+
+// mirrorFiles lists the files of the mirror at dbPath that belong
+// remotely, with their stamps.
+func mirrorFiles(dbPath string) (map[string]fileStamp, error) {
+	files := make(map[string]fileStamp)
+	add := func(rel string) error {
+		info, err := os.Stat(dbPath + rel)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files[rel] = fileStamp{info.Size(), info.ModTime().UTC()}
+
+		return nil
+	}
+
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, num := range nums {
+		dir := strconv.Itoa(num) + "/"
+		entries, err := os.ReadDir(dbPath + dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			// Leftovers of interrupted writes stay behind.
+			if e.IsDir() || strings.HasSuffix(e.Name(), ".tmp") {
+				continue
+			}
+			err = add(dir + e.Name())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, name := range remoteDBFiles {
+		err = add(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// pushMirror makes the store match the mirror at dbPath, uploading only
+// what changed since the last push and removing what is gone. Comics go
+// before the manifest, so the remote manifest never names comics that
+// aren't there yet. It returns how many files were uploaded and removed.
+func pushMirror(dbPath string, store remoteStore) (int, int, error) {
+	st, err := loadRemoteState(dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	key := store.String()
+	done := st[key]
+	if done == nil {
+		done = make(map[string]fileStamp)
+		st[key] = done
+	}
+
+	// Uploaded from a snapshot, so a sync running meanwhile can't leave
+	// half a comic there.
+	snap, snapDone, err := snapshotDB(dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer snapDone()
+
+	files, err := mirrorFiles(snap)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Offloaded images are missing here only because they live there.
+	h, err := loadHybrid(dbPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if h != nil {
+		for num, name := range h.Images {
+			rel := strconv.Itoa(num) + "/" + name
+			if _, ok := files[rel]; !ok {
+				if stamp, ok := done[rel]; ok {
+					files[rel] = stamp
+				}
+			}
+		}
+	}
+
+	var changed []string
+	for rel, stamp := range files {
+		if old, ok := done[rel]; !ok || old.Size != stamp.Size || !old.ModTime.Equal(stamp.ModTime) {
+			changed = append(changed, rel)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		iDB, jDB := !strings.Contains(changed[i], "/"), !strings.Contains(changed[j], "/")
+		if iDB != jDB {
+			return jDB
+		}
+		return changed[i] < changed[j]
+	})
+
+	uploaded := 0
+	for len(changed) > 0 {
+		n := uploadChunk
+		if n > len(changed) {
+			n = len(changed)
+		}
+		chunk := changed[:n]
+		changed = changed[n:]
+
+		put, err := store.put(snap, chunk)
+		for _, rel := range chunk[:put] {
+			done[rel] = files[rel]
+			detail("Uploaded %s\n", rel)
+		}
+		uploaded += put
+
+		if serr := st.save(dbPath); err == nil {
+			err = serr
+		}
+		if err != nil {
+			return uploaded, 0, err
+		}
+	}
+
+	var gone []string
+	dirs := make(map[string]bool)
+	for rel := range done {
+		if _, ok := files[rel]; ok {
+			continue
+		}
+		gone = append(gone, rel)
+		if dir := filepath.ToSlash(filepath.Dir(rel)); dir != "." {
+			if _, err := os.Stat(snap + dir); os.IsNotExist(err) {
+				dirs[dir+"/"] = true
+			}
+		}
+	}
+	if len(gone) == 0 {
+		return uploaded, 0, nil
+	}
+	sort.Strings(gone)
+	removed := len(gone)
+	for dir := range dirs {
+		gone = append(gone, dir)
+	}
+
+	err = store.remove(gone)
+	if err != nil {
+		return uploaded, 0, err
+	}
+	for _, rel := range gone {
+		delete(done, rel)
+	}
+
+	return uploaded, removed, st.save(dbPath)
+}
+
+// upload copies the mirror to a remote store.
+func upload(args []string) {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db upload [flags] URL")
+		fmt.Fprintln(fs.Output(), "URL is a WebDAV folder, e.g. https://cloud.example.com/remote.php/dav/files/me/xkcd,")
+		fmt.Fprintln(fs.Output(), "or sftp://user@host/path. The WebDAV password is read from XKCDDB_WEBDAV_PASSWORD;")
+		fmt.Fprintln(fs.Output(), "SFTP uses the sftp command and your SSH keys.")
+		fmt.Fprintln(fs.Output(), "gdrive://folder and dropbox://folder ask you to log in the first time.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// Flags may follow the URL too.
+	target := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if offline {
+		log.Fatalln("upload needs the network:", errOffline)
+	}
+
+	*dbPath = withSlash(*dbPath)
+	store, err := openRemote(target)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	a := startAudit(*dbPath, "upload", args)
+	uploaded, removed, err := pushMirror(*dbPath, store)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	outcome := fmt.Sprintf("Uploaded %d files to %s and removed %d", uploaded, store, removed)
+	fmt.Println(paint(os.Stdout, good, outcome))
+	a.end(outcome)
+}
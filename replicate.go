@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replicaFile holds where a replica copies from and how far it got in
+// the primary's change log.
+const replicaFile = "replica.json"
+
+type replicaState struct {
+	From string `json:"from"`
+	// The time of the last change copied; zero before the first run.
+	Since time.Time `json:"since"`
+}
+
+// replicaSource is another xkcd-db's serve, read through its xkcd style
+// API. Images come from the primary too, though the metadata stored keeps
+// the image URL the primary got.
+type replicaSource struct {
+	base string
+}
+
+var errNotOnPrimary = errors.New("not on the primary")
+
+func (s replicaSource) latest() (int, error) {
+	c, err := s.fetch(s.base + jsonFile)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.Num, nil
+}
+
+func (s replicaSource) info(item string) (Comic, error) {
+	c, err := s.fetch(s.base + item + "/" + jsonFile)
+	if err != nil {
+		return c, err
+	}
+	if c.Img != "" {
+		c.Img = s.base + "img/" + item + "/" + path.Base(c.Img)
+	}
+
+	return c, nil
+}
+
+func (s replicaSource) fetch(u string) (Comic, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return Comic{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Comic{}, errNotOnPrimary
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Comic{}, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxInfoSize+1))
+	if err != nil {
+		return Comic{}, err
+	}
+	if len(raw) > maxInfoSize {
+		return Comic{}, errors.New("comic metadata too large: " + u)
+	}
+
+	return parseComic(raw)
+}
+
+// The primary already left out what its comic never had.
+func (replicaSource) skip(num int) bool { return false }
+
+func (s replicaSource) host() string { return s.base }
+
+// changesSince reads the primary's change log after since, following its
+// pages to the end.
+func (s replicaSource) changesSince(since time.Time) ([]change, error) {
+	q := url.Values{"limit": {strconv.Itoa(maxPageLimit)}}
+	if !since.IsZero() {
+		q.Set("since", since.Format(time.RFC3339Nano))
+	}
+	next := s.base + "api/changes?" + q.Encode()
+
+	var changes []change
+	for next != "" {
+		resp, err := client.Get(next)
+		if err != nil {
+			return nil, err
+		}
+		var page []change
+		if resp.StatusCode == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&page)
+		} else {
+			err = fmt.Errorf("%s: %s", next, resp.Status)
+		}
+		link := resp.Header.Get("Link")
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, page...)
+
+		next = ""
+		if strings.HasSuffix(link, `rel="next"`) && strings.HasPrefix(link, "<") {
+			ref, err := url.Parse(link[1:strings.IndexByte(link, '>')])
+			if err != nil {
+				return nil, err
+			}
+			base, _ := url.Parse(s.base)
+			next = base.ResolveReference(ref).String()
+		}
+	}
+
+	return changes, nil
+}
+
+// replicate copies another xkcd-db's comics, once in full and after that
+// only what its change log says changed.
+func replicate(args []string) {
+	fs := flag.NewFlagSet("replicate", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	from := fs.String("from", "", "Address of the primary's serve, e.g. http://primary:8080; defaults to the last one")
+	rate := fs.Int("r", 4, "Set the maximum number of parallel downloads")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db replicate [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 0 || *rate < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	*dbPath = withSlash(*dbPath)
+
+	a := startAudit(*dbPath, "replicate", args)
+	outcome, err := replicateDB(*dbPath, *from, *rate)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Println(paint(os.Stdout, good, outcome))
+	a.end(outcome)
+}
+
+// replicateDB brings the database up to date with the primary at from,
+// or the one it last replicated, and describes what it did.
+func replicateDB(dbPath, from string, rate int) (string, error) {
+	if offline {
+		return "", errors.New("replicate needs the network: " + errOffline.Error())
+	}
+
+	var st replicaState
+	data, err := os.ReadFile(dbPath + replicaFile)
+	if err == nil {
+		err = json.Unmarshal(data, &st)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("%s: %v", dbPath+replicaFile, err)
+	}
+
+	if from != "" {
+		from = withSlash(from)
+		// Another primary's log means nothing here; start over.
+		if from != st.From {
+			st = replicaState{From: from}
+		}
+	}
+	if st.From == "" {
+		return "", errors.New("no primary to replicate; pass -from")
+	}
+	src := replicaSource{st.From}
+
+	err = os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	// Read first, so whatever changes while copying is copied next time.
+	changes, err := src.changesSince(st.Since)
+	if err != nil {
+		return "", err
+	}
+
+	// Last change wins.
+	ops := make(map[int]string)
+	for _, c := range changes {
+		ops[c.Num] = c.Op
+	}
+
+	// The first run copies everything there is, as the primary's log may
+	// not go back to its first comic.
+	var nums []int
+	if st.Since.IsZero() {
+		latest, err := src.latest()
+		if err != nil {
+			return "", err
+		}
+		for _, item := range missingComics(src, latest, dbPath) {
+			num, _ := strconv.Atoi(item)
+			ops[num] = "added"
+		}
+	}
+	for num := range ops {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	m, unlock, err := recoverManifest(dbPath)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	tokens := make(chan struct{}, rate)
+	copied, failed := 0, 0
+	var removed []string
+	for _, num := range nums {
+		item := strconv.Itoa(num)
+		_, err := os.Stat(dbPath + item)
+		stored := err == nil
+
+		if ops[num] == "removed" {
+			if stored {
+				removed = append(removed, dbPath+item)
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(num int) {
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+			defer wg.Done()
+
+			var err error
+			if stored {
+				_, err = refreshComic(src, num, dbPath, m, true, false)
+			} else {
+				err = fetchComic(src, item, dbPath, m)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == errNotOnPrimary:
+			case err != nil:
+				log.Printf("Comic %d: %v", num, err)
+				failed++
+			default:
+				copied++
+			}
+		}(num)
+	}
+	wg.Wait()
+
+	err = updateManifest(dbPath, m)
+	if err != nil {
+		return "", err
+	}
+	if len(removed) > 0 {
+		_, err = moveToTrash(dbPath, removed)
+		if err == nil {
+			_, err = fsckDB(dbPath, true)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	err = updateIndex(dbPath, false)
+	if err != nil {
+		return "", err
+	}
+
+	// Failed comics are tried again next time.
+	if failed == 0 && len(changes) > 0 {
+		st.Since = changes[len(changes)-1].Time
+	}
+	// An empty log still counts as caught up.
+	if failed == 0 && st.Since.IsZero() {
+		st.Since = time.Unix(0, 0).UTC()
+	}
+	data, err = json.MarshalIndent(st, "", "\t")
+	if err == nil {
+		err = writeFileAtomic(dbPath+replicaFile, data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	outcome := fmt.Sprintf("Copied %d comics from %s and removed %d", copied, st.From, len(removed))
+	if failed > 0 {
+		outcome += fmt.Sprintf("; %d failed and are tried again next time", failed)
+	}
+
+	return outcome, nil
+}
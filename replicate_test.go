@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestReplicate(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	primary := tempDB(t)
+	if _, err := syncDB(primary, syncOptions{rateLimit: 2}); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer((&server{dbPath: primary}).routes())
+	defer ts.Close()
+
+	replica := tempDB(t)
+	if _, err := replicateDB(replica, "", 2); err == nil {
+		t.Error("replicated without a primary")
+	}
+	if _, err := replicateDB(replica, ts.URL, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"1/1-info.json", "2/2-alt", "3/comic_3.png"} {
+		if !bytes.Equal(readFile(t, replica+name), readFile(t, primary+name)) {
+			t.Errorf("%s differs", name)
+		}
+	}
+
+	// Only what changed is copied after that.
+	c := fakexkcd.Corpus(3)[1]
+	c.Alt = "Fixed alt text"
+	srv.Add(c)
+	if _, err := syncDB(primary, syncOptions{rateLimit: 2, refresh: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := excludeComics(primary, exclusions{}, []int{3}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	outcome, err := replicateDB(replica, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcome != "Copied 1 comics from "+ts.URL+"/ and removed 1" {
+		t.Errorf("outcome %q", outcome)
+	}
+	if got := string(readFile(t, replica+"2/2-alt")); got != c.Alt {
+		t.Errorf("alt = %q", got)
+	}
+	if _, err := os.Stat(replica + "3"); !os.IsNotExist(err) {
+		t.Error("comic removed on the primary kept")
+	}
+
+	outcome, err = replicateDB(replica, "", 2)
+	if err != nil || outcome != "Copied 0 comics from "+ts.URL+"/ and removed 0" {
+		t.Errorf("up to date: %q, %v", outcome, err)
+	}
+}
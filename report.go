@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"html/template"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// report writes a year-in-review summary built entirely from local data.
+func report(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	format := fs.String("format", "text", "Output format: text or html")
+	out := fs.String("o", "", "Write the report to a file instead of stdout")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db report [flags] year")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if _, err := strconv.Atoi(fs.Arg(0)); fs.NArg() != 1 || err != nil {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *format != "text" && *format != "html" {
+		log.Fatalf("Unknown report format %q\n", *format)
+	}
+
+	r, err := buildReport(withSlash(*dbPath), fs.Arg(0), *format == "html")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "html" {
+		err = templates.ExecuteTemplate(w, "report.html", r)
+	} else {
+		err = r.writeText(w)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+type yearReport struct {
+	Year   string
+	Comics []reportComic
+	// Comics per month, January first.
+	Months [12]int
+	Texty  *reportComic
+	Widest *reportComic
+	// Colour counts only cover comics that have been analyzed.
+	Analyzed int
+	Colored  int
+	// Stored comics whose date isn't known yet.
+	Undated int
+}
+
+type reportComic struct {
+	Num    int
+	Title  string
+	Date   string
+	Alt    string
+	Text   int
+	Width  int
+	Height int
+	Thumb  template.URL
+}
+
+func buildReport(dbPath, year string, thumbs bool) (*yearReport, error) {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := loadManifest(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &yearReport{Year: year}
+	for _, num := range nums {
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return nil, err
+		}
+		if c.Year == "" {
+			r.Undated++
+			continue
+		}
+		if c.Year != year {
+			continue
+		}
+
+		rc := reportComic{
+			Num:   num,
+			Title: c.Title,
+			Date:  c.Year + "-" + c.Month + "-" + c.Day,
+			Alt:   c.Alt,
+			Text:  len(c.Alt) + len(c.Transcript),
+		}
+
+		if month, err := strconv.Atoi(c.Month); err == nil && month >= 1 && month <= 12 {
+			r.Months[month-1]++
+		}
+
+		if e, ok := m.Comics[num]; ok {
+			rc.Width, rc.Height = e.Width, e.Height
+			if e.Colors != nil {
+				r.Analyzed++
+				if e.Colors.isColor() {
+					r.Colored++
+				}
+			}
+		}
+
+		if thumbs && c.ImgPath != "" {
+			err = c.fetchImage()
+			if err == nil {
+				rc.Thumb, err = thumbURL(c.ImgPath)
+			}
+			if err != nil {
+				log.Printf("Comic %d: %v\n", num, err)
+			}
+		}
+
+		r.Comics = append(r.Comics, rc)
+	}
+
+	for i := range r.Comics {
+		c := &r.Comics[i]
+		if r.Texty == nil || c.Text > r.Texty.Text {
+			r.Texty = c
+		}
+		if r.Widest == nil || c.Width > r.Widest.Width {
+			r.Widest = c
+		}
+	}
+
+	return r, nil
+}
+
+// thumbURL inlines a small copy of an image so the report is one file.
+func thumbURL(path string) (template.URL, error) {
+	img, err := loadImage(path)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, thumbnail(img, 240, 240))
+	if err != nil {
+		return "", err
+	}
+
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+}
+
+// BusiestMonth names the month with the most comics.
+func (r *yearReport) BusiestMonth() string {
+	best := 0
+	for i, n := range r.Months {
+		if n > r.Months[best] {
+			best = i
+		}
+	}
+
+	return fmt.Sprintf("%s (%d)", time.Month(best+1), r.Months[best])
+}
+
+func (r *yearReport) writeText(w io.Writer) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "xkcd in %s\n", r.Year)
+	fmt.Fprintf(&buf, "Comics: %d\n", len(r.Comics))
+	if len(r.Comics) > 0 {
+		fmt.Fprintf(&buf, "Busiest month: %s\n", r.BusiestMonth())
+		fmt.Fprintf(&buf, "Most text: #%d %s (%d characters)\n", r.Texty.Num, r.Texty.Title, r.Texty.Text)
+		if r.Widest.Width > 0 {
+			fmt.Fprintf(&buf, "Widest: #%d %s (%dx%d)\n", r.Widest.Num, r.Widest.Title, r.Widest.Width, r.Widest.Height)
+		}
+	}
+	if r.Analyzed > 0 {
+		fmt.Fprintf(&buf, "Colour comics: %d of %d analyzed\n", r.Colored, r.Analyzed)
+	}
+	if r.Undated > 0 {
+		fmt.Fprintf(&buf, "%d stored comics have no date yet; sync to fetch it\n", r.Undated)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestBuildReport(t *testing.T) {
+	comics := fakexkcd.Corpus(20)
+	// Comics 2 and 17 are from 2008.
+	comics[16].Transcript = strings.Repeat("words ", 100)
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := buildReport(db, "2008", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Comics) != 2 || r.Comics[0].Num != 2 || r.Comics[1].Num != 17 {
+		t.Fatalf("report comics %+v", r.Comics)
+	}
+	if r.Texty.Num != 17 {
+		t.Errorf("most text #%d, want #17", r.Texty.Num)
+	}
+	if r.Comics[0].Thumb == "" {
+		t.Error("no thumbnail")
+	}
+
+	var text bytes.Buffer
+	err = r.writeText(&text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "Comics: 2\n") || !strings.Contains(text.String(), "Most text: #17 Comic 17") {
+		t.Errorf("text report:\n%s", text.String())
+	}
+
+	var html bytes.Buffer
+	err = templates.ExecuteTemplate(&html, "report.html", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), `src="data:image/png;base64,`) {
+		t.Error("html report has no inline thumbnails")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const reviewFile = "review.json"
+
+// The date layout used for scheduling. Reviews are planned in whole days.
+const dayLayout = "2006-01-02"
+
+// reviewCard is a comic's spaced-repetition state, scheduled with SM-2.
+type reviewCard struct {
+	Reps     int     `json:"reps"`
+	Interval int     `json:"interval"`
+	Ease     float64 `json:"ease"`
+	Due      string  `json:"due"`
+	Views    int     `json:"views"`
+}
+
+// review shows comics that are due again, plus a few new ones, so the
+// archive can be rediscovered systematically.
+func review(args []string) {
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	newLimit := fs.Int("new", 5, "Maximum number of comics seen for the first time")
+	limit := fs.Int("limit", 20, "Maximum number of comics in this session")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	err := runReview(withSlash(*dbPath), *newLimit, *limit, time.Now(), os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func runReview(dbPath string, newLimit, limit int, now time.Time, in io.Reader, out io.Writer) error {
+	deck, err := loadDeck(dbPath)
+	if err != nil {
+		return err
+	}
+
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return err
+	}
+
+	queue := dueComics(deck, nums, now, newLimit)
+	if len(queue) > limit {
+		queue = queue[:limit]
+	}
+	if len(queue) == 0 {
+		fmt.Fprintln(out, "Nothing to review today")
+		return nil
+	}
+
+	answers := bufio.NewScanner(in)
+	reviewed := 0
+
+questions:
+	for _, num := range queue {
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(out)
+		printComicTo(out, c)
+
+		for {
+			fmt.Fprint(out, "How well did you remember it? (0-5, q to stop) ")
+			if !answers.Scan() || strings.TrimSpace(answers.Text()) == "q" {
+				break questions
+			}
+
+			q, err := strconv.Atoi(strings.TrimSpace(answers.Text()))
+			if err == nil && q >= 0 && q <= 5 {
+				card := deck[num]
+				if card == nil {
+					card = &reviewCard{Ease: 2.5}
+					deck[num] = card
+				}
+				card.grade(q, now)
+				reviewed++
+				break
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "\nReviewed %d comics\n", reviewed)
+	return saveDeck(dbPath, deck)
+}
+
+// grade applies an SM-2 step for a recall quality q between 0 and 5.
+func (c *reviewCard) grade(q int, now time.Time) {
+	c.Views++
+
+	if q < 3 {
+		c.Reps = 0
+		c.Interval = 1
+	} else {
+		switch c.Reps {
+		case 0:
+			c.Interval = 1
+		case 1:
+			c.Interval = 6
+		default:
+			c.Interval = int(math.Round(float64(c.Interval) * c.Ease))
+		}
+		c.Reps++
+	}
+
+	d := float64(5 - q)
+	c.Ease += 0.1 - d*(0.08+d*0.02)
+	if c.Ease < 1.3 {
+		c.Ease = 1.3
+	}
+
+	c.Due = now.AddDate(0, 0, c.Interval).Format(dayLayout)
+}
+
+// dueComics lists comics due by now, most overdue first, followed by up
+// to newLimit comics never reviewed, oldest first.
+func dueComics(deck map[int]*reviewCard, stored []int, now time.Time, newLimit int) []int {
+	today := now.Format(dayLayout)
+
+	var due, fresh []int
+	for _, num := range stored {
+		card, ok := deck[num]
+		switch {
+		case !ok:
+			if len(fresh) < newLimit {
+				fresh = append(fresh, num)
+			}
+		case card.Due <= today:
+			due = append(due, num)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return deck[due[i]].Due < deck[due[j]].Due
+	})
+
+	return append(due, fresh...)
+}
+
+func loadDeck(dbPath string) (map[int]*reviewCard, error) {
+	deck := make(map[int]*reviewCard)
+
+	data, err := os.ReadFile(dbPath + reviewFile)
+	if os.IsNotExist(err) {
+		return deck, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return deck, json.Unmarshal(data, &deck)
+}
+
+func saveDeck(dbPath string, deck map[int]*reviewCard) error {
+	data, err := json.MarshalIndent(deck, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dbPath+reviewFile, data, 0644)
+}
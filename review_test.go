@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestReviewCardGrade(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := &reviewCard{Ease: 2.5}
+
+	for i, want := range []int{1, 6, 15} {
+		c.grade(4, now)
+		if c.Interval != want {
+			t.Fatalf("review %d: interval %d, want %d", i+1, c.Interval, want)
+		}
+	}
+	if c.Due != "2024-01-16" || c.Views != 3 {
+		t.Errorf("card %+v", c)
+	}
+
+	// Forgetting starts over, and the comic gets harder.
+	c.grade(1, now)
+	if c.Reps != 0 || c.Interval != 1 || c.Ease >= 2.5 {
+		t.Errorf("after lapse %+v", c)
+	}
+}
+
+func TestDueComics(t *testing.T) {
+	now := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	deck := map[int]*reviewCard{
+		1: {Due: "2024-03-12"},
+		2: {Due: "2024-03-10"},
+		3: {Due: "2024-02-01"},
+	}
+
+	got := dueComics(deck, []int{1, 2, 3, 4, 5, 6}, now, 2)
+	want := []int{3, 2, 4, 5}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRunReview(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+
+	// Invalid answers are asked again; q stops early.
+	err = runReview(db, 5, 10, now, strings.NewReader("5\nmaybe\n2\nq\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deck, err := loadDeck(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deck) != 2 || deck[1].Due != "2024-03-11" || deck[2].Reps != 0 {
+		t.Errorf("deck after review: 1=%+v 2=%+v", deck[1], deck[2])
+	}
+
+	// Next day both are due again, ahead of the last new comic.
+	out.Reset()
+	err = runReview(db, 5, 10, now.AddDate(0, 0, 1), strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "#1 Comic 1") {
+		t.Errorf("comic 1 not due:\n%s", out.String())
+	}
+}
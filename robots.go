@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userAgent identifies the tool to sites it crawls. Its first word is what
+// robots.txt rules are matched against.
+const userAgent = "xkcd-db/1 (+https://github.com/Sqvid/xkcd-db)"
+
+// robots holds the robots.txt rules that apply to this tool on a host.
+type robots struct {
+	rules []robotsRule
+	// Crawl-delay, if the host asked for one.
+	delay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// parseRobots picks the group for agent out of a robots.txt, falling back
+// to the one for every robot.
+func parseRobots(data []byte, agent string) *robots {
+	agent = strings.ToLower(strings.SplitN(agent, "/", 2)[0])
+
+	var mine, any *robots
+	var current []*robots
+	inAgents := false
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			// Consecutive User-agent lines share one group.
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+
+			name := strings.ToLower(value)
+			switch {
+			case name == "*":
+				if any == nil {
+					any = &robots{}
+				}
+				current = append(current, any)
+			case name != "" && strings.Contains(agent, name):
+				if mine == nil {
+					mine = &robots{}
+				}
+				current = append(current, mine)
+			}
+			continue
+		}
+		inAgents = false
+
+		for _, r := range current {
+			switch key {
+			case "allow", "disallow":
+				// An empty Disallow allows everything.
+				if value != "" {
+					r.rules = append(r.rules, robotsRule{allow: key == "allow", pattern: value})
+				}
+			case "crawl-delay":
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+					r.delay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	switch {
+	case mine != nil:
+		return mine
+	case any != nil:
+		return any
+	}
+
+	return &robots{}
+}
+
+// allowed applies the most specific matching rule to path, Allow winning
+// ties, like the major crawlers do.
+func (r *robots) allowed(path string) bool {
+	best, allow := -1, true
+
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > best || (n == best && rule.allow) {
+			best, allow = n, rule.allow
+		}
+	}
+
+	return allow
+}
+
+// robotsMatch matches path against a pattern where * is any run of
+// characters and a trailing $ anchors the end.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+
+	for i, part := range parts[1:] {
+		// The last part has to be at the end of anchored patterns.
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+
+	return !anchored || rest == ""
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// feedFile numbers the comics an rss source has discovered.
+const feedFile = "feed.json"
+
+// rssSource is a plugin for a webcomic without numbers or an API, e.g.
+//
+//	{
+//		"name": "smbc",
+//		"type": "rss",
+//		"feed": "https://www.smbc-comics.com/comic/rss",
+//		"image": "<img[^>]+src=\"([^\"]+)\"[^>]+id=\"cc-comic\"",
+//		"alt": "<img title=\"([^\"]*)\"[^>]+id=\"cc-comic\"",
+//		"delay": "2s"
+//	}
+//
+// Comics are found in the feed and numbered in the order they appear,
+// oldest first, so only those published since the first sync, plus what
+// the feed still lists then, are mirrored. The image and alt text are
+// scraped from each comic's page with the first group of a regular
+// expression; the image defaults to the page's og:image. Pages are
+// fetched like any crawl, keeping to robots.txt and waiting delay, one
+// second by default, between requests.
+type rssSource struct {
+	Name  string `json:"name"`
+	Feed  string `json:"feed"`
+	Image string `json:"image,omitempty"`
+	Alt   string `json:"alt,omitempty"`
+	Delay string `json:"delay,omitempty"`
+
+	dbPath string
+	image  *regexp.Regexp
+	alt    *regexp.Regexp
+	crawl  *crawler
+
+	mu      sync.Mutex
+	entries []feedEntry
+}
+
+// feedEntry is a comic found in the feed; comic n is entry n-1.
+type feedEntry struct {
+	Link  string `json:"link"`
+	Title string `json:"title"`
+	Date  string `json:"date,omitempty"`
+}
+
+var ogImage = regexp.MustCompile(`<meta[^>]+property="og:image"[^>]+content="([^"]+)"`)
+
+func parseRSSSource(data []byte, dbPath string) (*rssSource, error) {
+	s := &rssSource{dbPath: dbPath, image: ogImage}
+	err := json.Unmarshal(data, s)
+	if err != nil {
+		return nil, fmt.Errorf("comic source: %v", err)
+	}
+	if s.Feed == "" {
+		return nil, fmt.Errorf("comic source %s has no feed", s.Name)
+	}
+
+	pattern := func(expr string) (*regexp.Regexp, error) {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("comic source %s: %v", s.Name, err)
+		}
+		if re.NumSubexp() < 1 {
+			return nil, fmt.Errorf("comic source %s: %s has no group to take", s.Name, expr)
+		}
+		return re, nil
+	}
+	if s.Image != "" {
+		if s.image, err = pattern(s.Image); err != nil {
+			return nil, err
+		}
+	}
+	if s.Alt != "" {
+		if s.alt, err = pattern(s.Alt); err != nil {
+			return nil, err
+		}
+	}
+
+	delay := time.Second
+	if s.Delay != "" {
+		delay, err = time.ParseDuration(s.Delay)
+		if err != nil {
+			return nil, fmt.Errorf("comic source %s: %v", s.Name, err)
+		}
+	}
+	s.crawl = newCrawler(1, delay, "")
+
+	raw, err := os.ReadFile(dbPath + feedFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(raw, &s.entries)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", dbPath+feedFile, err)
+		}
+	}
+
+	return s, nil
+}
+
+// rssFeed is the part of an RSS 2.0 feed that is read.
+type rssFeed struct {
+	Items []struct {
+		Title   string `xml:"title"`
+		Link    string `xml:"link"`
+		PubDate string `xml:"pubDate"`
+	} `xml:"channel>item"`
+}
+
+// latest numbers the comics in the feed that are new.
+func (s *rssSource) latest() (int, error) {
+	body, err := s.crawl.get(s.Feed)
+	if err != nil {
+		return 0, err
+	}
+
+	var feed rssFeed
+	err = xml.Unmarshal(body, &feed)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", s.Feed, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known := make(map[string]bool, len(s.entries))
+	for _, e := range s.entries {
+		known[e.Link] = true
+	}
+
+	// Feeds list the newest first.
+	added := false
+	for i := len(feed.Items) - 1; i >= 0; i-- {
+		item := feed.Items[i]
+		if item.Link == "" || known[item.Link] {
+			continue
+		}
+		known[item.Link] = true
+
+		e := feedEntry{Link: item.Link, Title: html.UnescapeString(item.Title)}
+		for _, layout := range []string{time.RFC1123Z, time.RFC1123} {
+			if t, err := time.Parse(layout, item.PubDate); err == nil {
+				e.Date = t.Format(dayLayout)
+				break
+			}
+		}
+		s.entries = append(s.entries, e)
+		added = true
+	}
+
+	if added {
+		data, err := json.MarshalIndent(s.entries, "", "\t")
+		if err != nil {
+			return 0, err
+		}
+		err = os.MkdirAll(s.dbPath, 0755)
+		if err != nil {
+			return 0, err
+		}
+		err = os.WriteFile(s.dbPath+feedFile, data, 0644)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(s.entries), nil
+}
+
+func (s *rssSource) info(item string) (Comic, error) {
+	num, _ := strconv.Atoi(item)
+
+	s.mu.Lock()
+	if num < 1 || num > len(s.entries) {
+		s.mu.Unlock()
+		return Comic{}, fmt.Errorf("comic %s is not in the feed of %s", item, s.Name)
+	}
+	e := s.entries[num-1]
+	s.mu.Unlock()
+
+	c := Comic{Num: num, Title: e.Title}
+	if t, err := time.Parse(dayLayout, e.Date); err == nil {
+		c.Year, c.Month, c.Day = strconv.Itoa(t.Year()), strconv.Itoa(int(t.Month())), strconv.Itoa(t.Day())
+	}
+
+	page, err := s.crawl.get(e.Link)
+	if err != nil {
+		return c, err
+	}
+
+	if m := s.image.FindSubmatch(page); m != nil {
+		base, err := url.Parse(e.Link)
+		if err != nil {
+			return c, err
+		}
+		ref, err := url.Parse(html.UnescapeString(string(m[1])))
+		if err != nil {
+			return c, fmt.Errorf("%s: image URL: %v", e.Link, err)
+		}
+		c.Img = base.ResolveReference(ref).String()
+	}
+	if s.alt != nil {
+		if m := s.alt.FindSubmatch(page); m != nil {
+			c.Alt = html.UnescapeString(string(m[1]))
+		}
+	}
+
+	return c, nil
+}
+
+func (s *rssSource) skip(num int) bool { return false }
+
+func (s *rssSource) host() string { return s.Feed }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeFeedComic is a webcomic site with an RSS feed of its newest
+// comics, newest first, and a page for each.
+type fakeFeedComic struct {
+	*httptest.Server
+	slugs []string
+}
+
+func newFakeFeedComic(t *testing.T, slugs ...string) *fakeFeedComic {
+	t.Helper()
+
+	f := &fakeFeedComic{slugs: slugs}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rss", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Fake</title>`)
+		for i := len(f.slugs) - 1; i >= 0; i-- {
+			fmt.Fprintf(w, `<item><title>%s &amp; more</title><link>%s/comic/%s</link><pubDate>Mon, 0%d Mar 2021 10:00:00 -0500</pubDate></item>`,
+				f.slugs[i], f.URL, f.slugs[i], i+1)
+		}
+		fmt.Fprint(w, `</channel></rss>`)
+	})
+	mux.HandleFunc("/comic/", func(w http.ResponseWriter, r *http.Request) {
+		slug := strings.TrimPrefix(r.URL.Path, "/comic/")
+		fmt.Fprintf(w, `<html><body><img title="Why &quot;%s&quot;?" src="/comics/%s.png" id="cc-comic" /></body></html>`, slug, slug)
+	})
+	mux.HandleFunc("/comics/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image " + r.URL.Path))
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func TestRSSSource(t *testing.T) {
+	site := newFakeFeedComic(t, "first", "second")
+	plugin := t.TempDir() + "/fake.json"
+	err := os.WriteFile(plugin, []byte(`{
+		"name": "fake",
+		"type": "rss",
+		"feed": "`+site.URL+`/rss",
+		"image": "<img[^>]+src=\"([^\"]+)\"[^>]+id=\"cc-comic\"",
+		"alt": "<img title=\"([^\"]*)\"[^>]+id=\"cc-comic\"",
+		"delay": "1ms"
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := tempDB(t)
+	err = installSource(db, plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(res.added, []int{1, 2}) {
+		t.Fatalf("first sync added %v", res.added)
+	}
+
+	// A comic published later is numbered after the others.
+	site.slugs = append(site.slugs, "third")
+	res, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(res.added, []int{3}) {
+		t.Fatalf("second sync added %v", res.added)
+	}
+
+	c, err := readComic(db, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Title != "third & more" || c.Alt != `Why "third"?` || c.date() != "2021-03-03" {
+		t.Errorf("got %+v", c.Comic)
+	}
+	if got := string(readFile(t, c.ImgPath)); got != "image /comics/third.png" {
+		t.Errorf("image holds %q", got)
+	}
+
+	// Search and the web UI don't care where comics came from.
+	found, err := searchComics(db, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Num != 2 {
+		t.Errorf("search found %v", found)
+	}
+
+	ts := httptest.NewServer((&server{dbPath: db}).routes())
+	defer ts.Close()
+	status, body := get(t, ts.URL+"/comic/1")
+	if status != http.StatusOK || !strings.Contains(string(body), "<title>fake #1</title>") || !strings.Contains(string(body), "Why &#34;first&#34;?") {
+		t.Errorf("comic page: %d\n%s", status, body)
+	}
+}
+
+func TestSMBCPlugin(t *testing.T) {
+	data, err := os.ReadFile("plugins/smbc.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := parseSource(data, t.TempDir()+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := src.(*rssSource)
+	page := []byte(`<img title="The alt" src="https://www.smbc-comics.com/comics/1.png" id="cc-comic" />`)
+	if m := s.image.FindSubmatch(page); m == nil || string(m[1]) != "https://www.smbc-comics.com/comics/1.png" {
+		t.Errorf("image pattern matched %q", m)
+	}
+	if m := s.alt.FindSubmatch(page); m == nil || string(m[1]) != "The alt" {
+		t.Errorf("alt pattern matched %q", m)
+	}
+}
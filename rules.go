@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// tagRule tags the comics it matches as they are downloaded or refreshed.
+// A rule has a pattern, a where expression or both, and matches if all it
+// has do. Rules only add tags; a sync with -refresh runs them over every
+// comic again.
+type tagRule struct {
+	Tag string `json:"tag"`
+	// A regular expression, matched regardless of case against any of
+	// Fields: title, alt or transcript, all three if none are given.
+	Pattern string   `json:"pattern,omitempty"`
+	Fields  []string `json:"fields,omitempty"`
+	// An expression as for list -where.
+	Where string `json:"where,omitempty"`
+
+	pattern *regexp.Regexp
+	where   *expr
+}
+
+// compile checks a rule and readies it for matching.
+func (r *tagRule) compile() error {
+	err := validTag(r.Tag)
+	if err != nil {
+		return err
+	}
+	if r.Pattern == "" && r.Where == "" {
+		return fmt.Errorf("rule for %s needs a pattern or where", r.Tag)
+	}
+
+	if r.Pattern != "" {
+		r.pattern, err = regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule for %s: %v", r.Tag, err)
+		}
+	}
+	if len(r.Fields) == 0 {
+		r.Fields = []string{"title", "alt", "transcript"}
+	}
+	for _, f := range r.Fields {
+		if _, ok := searchFields[f]; !ok || f == "tag" {
+			return fmt.Errorf("rule for %s: unknown field %q", r.Tag, f)
+		}
+	}
+	if r.Where != "" {
+		r.where, err = parseExpr(r.Where)
+		if err != nil {
+			return fmt.Errorf("rule for %s: %v", r.Tag, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *tagRule) match(c localComic, lc listComic) (bool, error) {
+	if r.pattern != nil {
+		found := false
+		for _, f := range r.Fields {
+			if r.pattern.MatchString(searchFields[f].text(c)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if r.where != nil {
+		return r.where.test(comicEnv(c, lc))
+	}
+
+	return true, nil
+}
+
+// autoTag applies the config file's rules to comics, returning how many
+// tags it added.
+func autoTag(dbPath string, nums []int, m *manifest) (int, error) {
+	if len(userConf.Rules) == 0 || len(nums) == 0 {
+		return 0, nil
+	}
+
+	tags, err := loadTags(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	var errs []error
+	for _, num := range nums {
+		c, lc, err := describeComic(dbPath, num, m)
+		if err != nil {
+			return added, err
+		}
+		c.tags = tags[num]
+
+		for _, r := range userConf.Rules {
+			ok, err := r.match(c, lc)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("comic %d: %v", num, err))
+				continue
+			}
+			if ok && tags.add(num, r.Tag) {
+				added++
+			}
+		}
+	}
+
+	if added > 0 {
+		err = tags.save(dbPath)
+		if err != nil {
+			return added, err
+		}
+		say("Added %d tags by rule\n", added)
+	}
+	// One broken rule would say the same for every comic.
+	if len(errs) == 1 {
+		return added, errs[0]
+	}
+	if len(errs) > 1 {
+		return added, fmt.Errorf("%v (and %d more)", errs[0], len(errs)-1)
+	}
+
+	return added, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestTagRules(t *testing.T) {
+	t.Cleanup(func() { userConf = &userConfig{} })
+	path := t.TempDir() + "/config.json"
+	t.Setenv("XKCDDB_CONFIG", path)
+
+	os.WriteFile(path, []byte(`{"rules": [{"tag": "ones", "pattern": "bogus", "fields": ["tag"]}]}`), 0644)
+	if err := loadUserConfig(); err == nil {
+		t.Error("rule on tags loaded")
+	}
+
+	os.WriteFile(path, []byte(`{"rules": [
+		{"tag": "ones", "pattern": "COMIC 1\\b", "fields": ["title"]},
+		{"tag": "late", "where": "num > 10"},
+		{"tag": "late-ones", "pattern": "text 1", "where": "num > 10"}
+	]}`), 0644)
+	if err := loadUserConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	startFake(t, fakexkcd.Corpus(12))
+	db := tempDB(t)
+	if _, err := syncDB(db, syncOptions{rateLimit: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := loadTags(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := comicTags{1: {"ones"}, 11: {"late", "late-ones"}, 12: {"late", "late-ones"}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("tagged %v, want %v", tags, want)
+	}
+}
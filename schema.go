@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Schema drift: xkcd occasionally adds fields to its JSON. Unknown fields
+// are still stored, since the JSON is kept as sent, but they are reported
+// so the tool can learn about them. With strictSchema set they fail the
+// comic instead, for mirrors that would rather stop than miss anything.
+var strictSchema bool
+
+// knownFields are the fields of xkcd's JSON the tool understands.
+var knownFields = func() map[string]bool {
+	known := make(map[string]bool)
+	t := reflect.TypeOf(xkcdInfo{})
+	for i := 0; i < t.NumField(); i++ {
+		known[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+
+	return known
+}()
+
+// drift remembers unknown fields so each is only reported once a run.
+var drift = &schemaDrift{seen: make(map[string]int)}
+
+type schemaDrift struct {
+	mu sync.Mutex
+	// The first comic each unknown field was seen in.
+	seen map[string]int
+}
+
+// check looks for unknown fields in a comic's raw JSON.
+func (d *schemaDrift) check(raw []byte, num int) error {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(raw, &fields)
+	if err != nil {
+		return err
+	}
+
+	var unknown []string
+	for name := range fields {
+		if !knownFields[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+
+	if strictSchema {
+		return fmt.Errorf("comic %d has unknown fields: %s", num, strings.Join(unknown, ", "))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, name := range unknown {
+		if _, ok := d.seen[name]; !ok {
+			d.seen[name] = num
+			log.Printf("Schema drift: comic %d has the unknown field %q\n", num, name)
+		}
+	}
+
+	return nil
+}
+
+// report lists the unknown fields seen so far and where they first showed
+// up, or returns "" if there were none.
+func (d *schemaDrift) report() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.seen) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(d.seen))
+	for name := range d.seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		names[i] = fmt.Sprintf("%s (first in #%d)", name, d.seen[name])
+	}
+
+	return "Unknown fields in xkcd's JSON: " + strings.Join(names, ", ")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// driftCorpus has a comic with a field xkcd might add one day.
+func driftCorpus(t *testing.T) string {
+	t.Helper()
+
+	comics := fakexkcd.Corpus(3)
+	comics[1].Extra = map[string]interface{}{"hover_sound": "boing.ogg"}
+	startFake(t, comics)
+
+	old := drift
+	drift = &schemaDrift{seen: make(map[string]int)}
+	t.Cleanup(func() { drift = old })
+
+	return tempDB(t)
+}
+
+func TestSchemaDriftReported(t *testing.T) {
+	db := driftCorpus(t)
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil || res.failed != 0 {
+		t.Fatalf("sync: %+v, %v", res, err)
+	}
+
+	if r := drift.report(); !strings.Contains(r, "hover_sound (first in #2)") {
+		t.Errorf("report = %q", r)
+	}
+	if got := readFile(t, db+"2/2-info.json"); !strings.Contains(string(got), "boing.ogg") {
+		t.Error("unknown field not stored")
+	}
+}
+
+func TestStrictSchema(t *testing.T) {
+	db := driftCorpus(t)
+	strictSchema = true
+	defer func() { strictSchema = false }()
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.failed != 1 {
+		t.Errorf("%d comics failed, want 1", res.failed)
+	}
+	if _, err := os.Stat(db + "2"); !os.IsNotExist(err) {
+		t.Errorf("comic with unknown fields stored: %v", err)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// indexDir holds the search index: which comics it covers, and posting
+// lists from each token of the lower case alt text and transcript to the
+// comics containing it, split into shards so a search only reads the
+// shards its query needs. Tokens are three byte sequences unless the
+// index is tuned to words.
+const indexDir = ".index"
+
+const (
+	indexMeta   = "meta.json"
+	indexShards = 16
+)
+
+// indexMetaData is what the index covers, and how it was built.
+type indexMetaData struct {
+	Comics   []int         `json:"comics"`
+	Built    time.Time     `json:"built"`
+	Settings indexSettings `json:"settings"`
+}
+
+// indexSettings trade the index's accuracy and speed for its footprint,
+// for small machines. They stay with the index until the index command
+// changes them.
+type indexSettings struct {
+	// "trigram", the default, narrows any search. "word" makes a smaller
+	// index, but it only finds comics where every word of the query is a
+	// whole word, so "hobb" no longer finds "hobby".
+	Tokens string `json:"tokens,omitempty"`
+	// "memory", the default, keeps shards loaded once they were read;
+	// "disk" reads them again for every search.
+	Storage string `json:"storage,omitempty"`
+	// How much a hit in each field counts towards relevance, where it
+	// differs from searchFields.
+	Weights fieldWeights `json:"weights,omitempty"`
+}
+
+func (st indexSettings) check() error {
+	switch st.Tokens {
+	case "", "trigram", "word":
+	default:
+		return errors.New("unknown index tokens " + st.Tokens + "; want trigram or word")
+	}
+	switch st.Storage {
+	case "", "memory", "disk":
+	default:
+		return errors.New("unknown index storage " + st.Storage + "; want memory or disk")
+	}
+
+	return st.Weights.check()
+}
+
+// tokens lists the distinct tokens of lower case text s.
+func (st indexSettings) tokens(s string) []string {
+	if st.Tokens == "word" {
+		return words(s)
+	}
+
+	return trigrams(s)
+}
+
+// searchIndex is a loaded index. Shards are read when first needed.
+type searchIndex struct {
+	dir      string
+	covered  map[int]bool
+	built    time.Time
+	settings indexSettings
+
+	mu     sync.Mutex
+	shards map[int]map[string][]int
+	// Recent searches, by lower case query.
+	results map[string]cachedSearch
+}
+
+// Indexes stay loaded between searches until they are rebuilt.
+var (
+	indexesMu sync.Mutex
+	indexes   = make(map[string]*searchIndex)
+)
+
+// loadIndex returns the database's index, which is empty if there is
+// none.
+func loadIndex(dbPath string) (*searchIndex, error) {
+	dir := dbPath + indexDir + "/"
+	var meta indexMetaData
+	data, err := os.ReadFile(dir + indexMeta)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", dir+indexMeta, err)
+		}
+	}
+
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+
+	if ix, ok := indexes[dbPath]; ok && ix.built.Equal(meta.Built) {
+		return ix, nil
+	}
+
+	ix := &searchIndex{dir: dir, covered: make(map[int]bool, len(meta.Comics)), built: meta.Built, settings: meta.Settings, shards: make(map[int]map[string][]int)}
+	for _, num := range meta.Comics {
+		ix.covered[num] = true
+	}
+	indexes[dbPath] = ix
+
+	return ix, nil
+}
+
+func shardOf(gram string) int {
+	h := fnv.New32a()
+	h.Write([]byte(gram))
+	return int(h.Sum32() % indexShards)
+}
+
+// trigrams lists the distinct three byte sequences of s.
+func trigrams(s string) []string {
+	seen := make(map[string]bool)
+	var grams []string
+	for i := 0; i+3 <= len(s); i++ {
+		g := s[i : i+3]
+		if !seen[g] {
+			seen[g] = true
+			grams = append(grams, g)
+		}
+	}
+
+	return grams
+}
+
+// words lists the distinct words of s, letters and digits between
+// anything else.
+func words(s string) []string {
+	seen := make(map[string]bool)
+	var ws []string
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if !seen[w] {
+			seen[w] = true
+			ws = append(ws, w)
+		}
+	}
+
+	return ws
+}
+
+// shard loads one shard, keeping it unless the index is stored on disk;
+// the caller holds ix.mu.
+func (ix *searchIndex) shard(n int) (map[string][]int, error) {
+	if s, ok := ix.shards[n]; ok {
+		return s, nil
+	}
+
+	s := make(map[string][]int)
+	data, err := os.ReadFile(fmt.Sprintf("%sshard-%02d.json", ix.dir, n))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &s)
+		if err != nil {
+			return nil, fmt.Errorf("%sshard-%02d.json: %v", ix.dir, n, err)
+		}
+	}
+	if ix.settings.Storage != "disk" {
+		ix.shards[n] = s
+	}
+
+	return s, nil
+}
+
+// warm loads every shard, so the first searches don't wait for them.
+// Indexes stored on disk stay there.
+func (ix *searchIndex) warm() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.settings.Storage == "disk" {
+		return nil
+	}
+
+	for n := 0; n < indexShards; n++ {
+		_, err := ix.shard(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// warmIndex loads a database's whole index, e.g. while serve starts.
+func warmIndex(dbPath string) {
+	ix, err := loadIndex(dbPath)
+	if err == nil {
+		err = ix.warm()
+	}
+	if err != nil {
+		log.Println("Loading the search index:", err)
+	}
+}
+
+// candidates narrows nums to the comics that may match the lower case
+// query: those the index lists under each of its tokens, and those it
+// doesn't cover. Queries without tokens, e.g. under three bytes, match
+// anything.
+func (ix *searchIndex) candidates(nums []int, query string) ([]int, error) {
+	grams := ix.settings.tokens(query)
+	if len(grams) == 0 {
+		return nums, nil
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	hits := make(map[int]int)
+	for _, g := range grams {
+		s, err := ix.shard(shardOf(g))
+		if err != nil {
+			return nil, err
+		}
+		for _, num := range s[g] {
+			hits[num]++
+		}
+	}
+
+	var found []int
+	for _, num := range nums {
+		if !ix.covered[num] || hits[num] == len(grams) {
+			found = append(found, num)
+		}
+	}
+
+	return found, nil
+}
+
+// updateIndex adds the stored comics the index doesn't cover yet, or with
+// rebuild set indexes everything again, e.g. after texts changed.
+func updateIndex(dbPath string, rebuild bool) error {
+	return buildIndex(dbPath, rebuild, nil)
+}
+
+// tuneIndex rebuilds the index with new settings.
+func tuneIndex(dbPath string, st indexSettings) error {
+	err := st.check()
+	if err != nil {
+		return err
+	}
+
+	return buildIndex(dbPath, true, &st)
+}
+
+// buildIndex updates or rebuilds the index, keeping its settings unless
+// others are given.
+func buildIndex(dbPath string, rebuild bool, settings *indexSettings) error {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return err
+	}
+
+	old, err := loadIndex(dbPath)
+	if err != nil {
+		return err
+	}
+	st := old.settings
+	if settings != nil {
+		st = *settings
+	}
+
+	shards := make([]map[string][]int, indexShards)
+	stored := make(map[int]bool, len(nums))
+	for _, num := range nums {
+		stored[num] = true
+	}
+
+	old.mu.Lock()
+	for n := range shards {
+		shards[n] = make(map[string][]int)
+		if rebuild {
+			continue
+		}
+
+		s, err := old.shard(n)
+		if err != nil {
+			old.mu.Unlock()
+			return err
+		}
+		// Comics since removed are dropped.
+		for g, posting := range s {
+			var kept []int
+			for _, num := range posting {
+				if stored[num] {
+					kept = append(kept, num)
+				}
+			}
+			if len(kept) > 0 {
+				shards[n][g] = kept
+			}
+		}
+	}
+	old.mu.Unlock()
+
+	added := 0
+	for _, num := range nums {
+		if old.covered[num] && !rebuild {
+			continue
+		}
+
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return err
+		}
+		for _, g := range st.tokens(strings.ToLower(c.Alt) + "\n" + strings.ToLower(c.Transcript)) {
+			n := shardOf(g)
+			shards[n][g] = append(shards[n][g], num)
+		}
+		added++
+	}
+
+	if added == 0 && len(old.covered) == len(nums) && !rebuild {
+		return nil
+	}
+
+	dir := dbPath + indexDir + "/"
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	for n, s := range shards {
+		for _, posting := range s {
+			sort.Ints(posting)
+		}
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		err = writeIndexFile(fmt.Sprintf("%sshard-%02d.json", dir, n), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The meta file goes last, so an interrupted update leaves comics
+	// uncovered rather than missing from results.
+	data, err := json.Marshal(indexMetaData{Comics: nums, Built: time.Now().UTC(), Settings: st})
+	if err != nil {
+		return err
+	}
+
+	return writeIndexFile(dir+indexMeta, data)
+}
+
+func writeIndexFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
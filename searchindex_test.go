@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func searchNums(t *testing.T, db, query string) []int {
+	t.Helper()
+
+	found, err := searchComics(db, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nums []int
+	for _, c := range found {
+		nums = append(nums, c.Num)
+	}
+
+	return nums
+}
+
+func TestSearchIndex(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(12))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ix, err := loadIndex(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.covered) != 12 {
+		t.Fatalf("index covers %d comics", len(ix.covered))
+	}
+	got, err := ix.candidates([]int{1, 2, 3, 11, 12}, "text 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(got, []int{1, 11, 12}) {
+		t.Errorf("candidates %v", got)
+	}
+
+	for query, want := range map[string][]int{
+		"text 1":       {1, 10, 11, 12},
+		"TRANSCRIPT 7": {7},
+		"t":            {1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		"nowhere":      nil,
+	} {
+		if got := searchNums(t, db, query); !equalInts(got, want) {
+			t.Errorf("%q found %v, want %v", query, got, want)
+		}
+	}
+
+	// A newer comic is indexed by the next sync.
+	c := fakexkcd.Corpus(13)[12]
+	c.Alt = "Something else entirely"
+	srv.Add(c)
+	_, err = syncDB(db, syncOptions{rateLimit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchNums(t, db, "else entire"); !equalInts(got, []int{13}) {
+		t.Errorf("found %v after sync", got)
+	}
+
+	// Comics the index doesn't cover are still searched.
+	err = os.RemoveAll(db + indexDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := searchNums(t, db, "text 1"); !equalInts(got, []int{1, 10, 11, 12}) {
+		t.Errorf("found %v without an index", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Orders search results can come in. Found order is by number within
+// each archive.
+var searchOrders = []string{"num", "num-desc", "date", "date-desc", "relevance", "size", "size-desc"}
+
+var errSearchOrder = errors.New("unknown search order")
+
+// orderMatches returns the positions of matches in the order asked for.
+// Relevance is the query's score, see searchQuery.score, with the weights
+// of the database each match is from; nil weights are the defaults. Ties,
+// and comics of the same date or size, keep the order they were found
+// in. Offloaded images have no size and sort last.
+func orderMatches(matches []localComic, query, order string, weights func(i int) fieldWeights) ([]int, error) {
+	if order != "" && !isSearchOrder(order) {
+		return nil, fmt.Errorf("%w: %s; choose from %s", errSearchOrder, order, strings.Join(searchOrders, ", "))
+	}
+
+	keys := make([]int64, len(matches))
+	desc := strings.HasSuffix(order, "-desc")
+	sq := parseQuery(query)
+
+	for i, c := range matches {
+		switch strings.TrimSuffix(order, "-desc") {
+		case "", "num":
+			keys[i] = int64(c.Num)
+		case "date":
+			y, _ := strconv.Atoi(c.Year)
+			m, _ := strconv.Atoi(c.Month)
+			d, _ := strconv.Atoi(c.Day)
+			keys[i] = int64(y*10000 + m*100 + d)
+		case "relevance":
+			// Most relevant first.
+			desc = true
+			var w fieldWeights
+			if weights != nil {
+				w = weights(i)
+			}
+			keys[i] = int64(sq.score(c, w))
+		case "size":
+			keys[i] = 1 << 62
+			if desc {
+				keys[i] = -1
+			}
+			if c.ImgPath != "" && !c.offloaded {
+				if info, err := os.Stat(c.ImgPath); err == nil {
+					keys[i] = info.Size()
+				}
+			}
+		}
+	}
+
+	perm := make([]int, len(matches))
+	for i := range perm {
+		perm[i] = i
+	}
+	if order == "" {
+		return perm, nil
+	}
+	sort.SliceStable(perm, func(i, j int) bool {
+		if desc {
+			return keys[perm[i]] > keys[perm[j]]
+		}
+		return keys[perm[i]] < keys[perm[j]]
+	})
+
+	return perm, nil
+}
+
+// isSearchOrder reports whether s names a search order rather than a
+// table column.
+func isSearchOrder(s string) bool {
+	for _, o := range searchOrders {
+		if s == o {
+			return true
+		}
+	}
+
+	return false
+}
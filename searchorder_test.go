@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestOrderMatches(t *testing.T) {
+	dir := t.TempDir() + "/"
+	os.WriteFile(dir+"big.png", make([]byte, 300), 0644)
+	os.WriteFile(dir+"small.png", make([]byte, 100), 0644)
+
+	matches := []localComic{
+		{Comic: Comic{Num: 1, Year: "2010", Month: "5", Day: "1", Alt: "physics"}, ImgPath: dir + "big.png"},
+		{Comic: Comic{Num: 2, Year: "2008", Month: "12", Day: "24", Title: "Physics", Alt: "more physics"}},
+		{Comic: Comic{Num: 3, Year: "2010", Month: "10", Day: "2", Transcript: "physics"}, ImgPath: dir + "small.png"},
+	}
+
+	for order, want := range map[string][]int{
+		"":          {1, 2, 3},
+		"num-desc":  {3, 2, 1},
+		"date":      {2, 1, 3},
+		"date-desc": {3, 1, 2},
+		"relevance": {2, 1, 3},
+		"size":      {3, 1, 2},
+		"size-desc": {1, 3, 2},
+	} {
+		perm, err := orderMatches(matches, "PHYSICS", order, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, i := range perm {
+			got = append(got, matches[i].Num)
+		}
+		if !equalInts(got, want) {
+			t.Errorf("%q: got %v, want %v", order, got, want)
+		}
+	}
+
+	if _, err := orderMatches(nil, "x", "relevance-desc", nil); err == nil {
+		t.Error("accepted relevance-desc")
+	}
+}
+
+func TestSearchAPISort(t *testing.T) {
+	ts, _ := testServer(t, fakexkcd.Corpus(3))
+
+	status, body := get(t, ts.URL+"/api/search?q=alt+text&sort=num-desc")
+	var hits []searchHit
+	if err := json.Unmarshal(body, &hits); err != nil || status != http.StatusOK {
+		t.Fatalf("%d: %v", status, err)
+	}
+	if len(hits) != 3 || hits[0].Num != 3 || hits[2].Num != 1 {
+		t.Errorf("got %+v", hits)
+	}
+
+	if status, _ := get(t, ts.URL+"/api/search?q=alt&sort=bogus"); status != http.StatusBadRequest {
+		t.Errorf("unknown order: %d", status)
+	}
+}
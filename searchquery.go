@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// searchFields are the parts of a comic a query can name with a prefix,
+// e.g. title:pi or alt:"my hobby", and how much a hit in each counts
+// towards relevance.
+var searchFields = map[string]struct {
+	weight int
+	text   func(c localComic) string
+	// Whether the search index covers the field.
+	indexed bool
+}{
+	"title":      {3, func(c localComic) string { return c.Title }, false},
+	"alt":        {2, func(c localComic) string { return c.Alt }, true},
+	"transcript": {1, func(c localComic) string { return c.Transcript }, true},
+	"tag":        {3, func(c localComic) string { return strings.Join(c.tags, " ") }, false},
+}
+
+// fieldWeights override the relevance weights of searchFields.
+type fieldWeights map[string]int
+
+func (w fieldWeights) of(field string) int {
+	if n, ok := w[field]; ok {
+		return n
+	}
+
+	return searchFields[field].weight
+}
+
+func (w fieldWeights) check() error {
+	for field, n := range w {
+		if _, ok := searchFields[field]; !ok {
+			return fmt.Errorf("unknown search field %q", field)
+		}
+		if n < 0 {
+			return fmt.Errorf("weight of %s below 0", field)
+		}
+	}
+
+	return nil
+}
+
+// String lists every field's weight, e.g. alt=2,tag=3.
+func (w fieldWeights) String() string {
+	var parts []string
+	for field := range searchFields {
+		parts = append(parts, field+"="+strconv.Itoa(w.of(field)))
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+// fieldWeightsFlag reads weights like title=5,alt=2.
+type fieldWeightsFlag fieldWeights
+
+func (f *fieldWeightsFlag) String() string { return "" }
+
+func (f *fieldWeightsFlag) Set(s string) error {
+	if *f == nil {
+		*f = make(fieldWeightsFlag)
+	}
+	for _, part := range strings.Split(s, ",") {
+		i := strings.IndexByte(part, '=')
+		n, err := strconv.Atoi(part[i+1:])
+		if i < 0 || err != nil {
+			return fmt.Errorf("want field=weight, e.g. title=5, not %q", part)
+		}
+		(*f)[part[:i]] = n
+	}
+
+	return fieldWeights(*f).check()
+}
+
+// searchTerm is lower case text to find in a field.
+type searchTerm struct {
+	field string
+	text  string
+}
+
+// searchQuery is a parsed query: terms in named fields, and the rest of
+// it as one phrase that may be in the alt text or the transcript. A comic
+// matches if it has all of them.
+type searchQuery struct {
+	terms  []searchTerm
+	phrase string
+}
+
+// parseQuery splits prefixed terms out of a query. Prefixes that aren't
+// fields, like the re: of "re: sandwiches", are left as text.
+func parseQuery(q string) searchQuery {
+	var sq searchQuery
+	var rest []string
+
+	for s := strings.TrimSpace(q); s != ""; s = strings.TrimSpace(s) {
+		word := s
+		if i := strings.IndexAny(s, " \t\n"); i >= 0 {
+			word = s[:i]
+		}
+		s = s[len(word):]
+
+		i := strings.Index(word, ":")
+		field := ""
+		if i > 0 {
+			field = strings.ToLower(word[:i])
+		}
+		if _, ok := searchFields[field]; !ok {
+			rest = append(rest, word)
+			continue
+		}
+
+		text := word[i+1:]
+		// A quoted phrase runs to the closing quote.
+		if strings.HasPrefix(text, `"`) {
+			quoted := text[1:] + s
+			end := strings.Index(quoted, `"`)
+			if end < 0 {
+				end = len(quoted)
+				s = ""
+			} else {
+				s = quoted[end+1:]
+			}
+			text = quoted[:end]
+		}
+		if text != "" {
+			sq.terms = append(sq.terms, searchTerm{field, strings.ToLower(text)})
+		}
+	}
+	sq.phrase = strings.ToLower(strings.Join(rest, " "))
+	// Plain queries are matched exactly as given.
+	if len(sq.terms) == 0 {
+		sq.phrase = strings.ToLower(q)
+	}
+
+	return sq
+}
+
+// uses reports whether the query has terms in the field.
+func (sq searchQuery) uses(field string) bool {
+	for _, t := range sq.terms {
+		if t.field == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sq searchQuery) match(c localComic) bool {
+	if sq.phrase != "" && !strings.Contains(strings.ToLower(c.Alt), sq.phrase) &&
+		!strings.Contains(strings.ToLower(c.Transcript), sq.phrase) {
+		return false
+	}
+	for _, t := range sq.terms {
+		if !strings.Contains(strings.ToLower(searchFields[t.field].text(c)), t.text) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// score ranks a match: each hit counts by the weight of its field, and
+// the phrase counts wherever it appears.
+func (sq searchQuery) score(c localComic, w fieldWeights) int {
+	score := 0
+	for name, f := range searchFields {
+		text := strings.ToLower(f.text(c))
+		if sq.phrase != "" {
+			score += w.of(name) * strings.Count(text, sq.phrase)
+		}
+	}
+	for _, t := range sq.terms {
+		f := searchFields[t.field]
+		score += w.of(t.field) * strings.Count(strings.ToLower(f.text(c)), t.text)
+	}
+
+	return score
+}
+
+// indexed returns the texts the search index can narrow comics by.
+func (sq searchQuery) indexed() []string {
+	var texts []string
+	if sq.phrase != "" {
+		texts = append(texts, sq.phrase)
+	}
+	for _, t := range sq.terms {
+		if searchFields[t.field].indexed {
+			texts = append(texts, t.text)
+		}
+	}
+
+	return texts
+}
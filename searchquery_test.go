@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestParseQuery(t *testing.T) {
+	for q, want := range map[string]searchQuery{
+		"Alt  Text":                    {phrase: "alt  text"},
+		"re: sandwiches":               {phrase: "re: sandwiches"},
+		`title:Pi alt:"My Hobby" math`: {terms: []searchTerm{{"title", "pi"}, {"alt", "my hobby"}}, phrase: "math"},
+		`transcript:"unclosed quote`:   {terms: []searchTerm{{"transcript", "unclosed quote"}}},
+		"TITLE:x title:":               {terms: []searchTerm{{"title", "x"}}},
+	} {
+		if got := parseQuery(q); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %+v, want %+v", q, got, want)
+		}
+	}
+}
+
+func TestSearchFields(t *testing.T) {
+	_, db := testServer(t, fakexkcd.Corpus(12))
+
+	for q, want := range map[string][]int{
+		`title:"comic 1"`:          {1, 10, 11, 12},
+		`title:comic alt:"text 2"`: {2},
+		"transcript:11":            {11},
+		`title:"comic 1" text 11`:  {11},
+	} {
+		if got := searchNums(t, db, q); !equalInts(got, want) {
+			t.Errorf("%q: got %v, want %v", q, got, want)
+		}
+	}
+
+	// Title hits count most.
+	matches, err := searchComics(db, "title:12 12")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("got %d matches: %v", len(matches), err)
+	}
+	if s := parseQuery("title:12 12").score(matches[0], nil); s != 3+3+2+1 {
+		t.Errorf("score %d", s)
+	}
+}
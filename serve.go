@@ -0,0 +1,457 @@
+package main
+
+import (
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// templates speak the CLI's language, for pages written to files.
+var templates = parsePages(func() string { return lang })
+
+// pages holds the templates translated into each language the web UI
+// speaks, picked per request by render.
+var pages = translatedPages()
+
+func parsePages(l func() string) *template.Template {
+	funcs := template.FuncMap{
+		"T":     func(msg string) string { return trIn(l(), msg) },
+		"lang":  l,
+		"theme": themeCSS,
+	}
+
+	return template.Must(template.New("").Funcs(funcs).ParseFS(webFiles, "web/*.html"))
+}
+
+func translatedPages() map[string]*template.Template {
+	pages := map[string]*template.Template{"en": parsePages(func() string { return "en" })}
+	for l := range catalogs {
+		l := l
+		pages[l] = parsePages(func() string { return l })
+	}
+
+	return pages
+}
+
+// serve runs a web UI and JSON API over the database.
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	addr := fs.String("listen", "localhost:8080", "Address to listen on, as host:port or unix:/path/to.sock")
+	localImages := fs.Bool("local-images", false, "Point image URLs in the xkcd-compatible API at this server")
+	var archives archiveFlags
+	fs.Var(&archives, "archive", "Serve a database under /name/ as name=path[,sync=6h], syncing it every interval; repeat for several archives")
+	oidc := oidcFlags(fs)
+	rate := fs.Float64("rate", 20, "Requests a second allowed per client address on average; 0 disables the limit")
+	burst := fs.Int("burst", 60, "Requests a client may make at once before -rate applies")
+	forwarded := fs.Bool("trust-forwarded", false, "Limit clients by X-Forwarded-For, when behind a reverse proxy")
+	cors := fs.String("cors-origins", "localhost", "Comma separated origins whose pages may call the API; localhost allows any local port, * every origin")
+	maxBody := byteSize(1 << 20)
+	fs.Var(&maxBody, "max-body", "Largest request body accepted, e.g. 64KB")
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	s := &server{dbPath: withSlash(*dbPath), localImages: *localImages}
+	policy := parseCORS(*cors)
+
+	handler := policy.wrap(s.routes())
+	dbPaths := []string{s.dbPath}
+	if len(archives) > 0 {
+		handler = newMultiServer(archives, *localImages).routes(policy.wrap)
+		scheduleSyncs(archives)
+
+		dbPaths = dbPaths[:0]
+		for _, spec := range archives {
+			dbPaths = append(dbPaths, spec.dbPath)
+		}
+	}
+	for _, p := range dbPaths {
+		go warmIndex(p)
+	}
+
+	auth, err := oidc.authenticator()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if auth != nil {
+		handler = auth.wrap(handler)
+	}
+
+	var limiter *ipLimiter
+	if *rate > 0 {
+		limiter = newIPLimiter(*rate, *burst, *forwarded)
+	}
+	handler = limitRequests(handler, limiter, int64(maxBody))
+
+	l, err := listen(*addr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if len(archives) > 0 {
+		say("Serving %d archives on %s\n", len(archives), addrURL(*addr))
+	} else {
+		say("Serving %s on %s\n", s.dbPath, addrURL(*addr))
+	}
+	log.Fatalln(newHTTPServer(handler).Serve(l))
+}
+
+type server struct {
+	dbPath string
+	// Where the archive is mounted, e.g. /whatif, or empty at the root.
+	prefix string
+	// Rewrite img in info.0.json to the mirror's copy.
+	localImages bool
+
+	// The manifest is reloaded whenever a sync rewrites it.
+	mu       sync.Mutex
+	man      *manifest
+	manMtime time.Time
+	manSize  int64
+}
+
+func (s *server) routes() http.Handler {
+	// Popular API answers are kept until the database changes.
+	rc := newResponseCache(s.dbPath)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/comic/", s.handleComic)
+	mux.HandleFunc("/img/", s.handleImage)
+	mux.Handle("/api/comic/", rc.wrap(http.HandlerFunc(s.handleAPIComic)))
+	mux.HandleFunc("/api/onthisday", s.handleOnThisDay)
+	mux.Handle("/api/search", rc.wrap(http.HandlerFunc(s.handleSearch)))
+	mux.HandleFunc("/api/changes", s.handleChanges)
+	mux.HandleFunc("/api/homeassistant", s.handleHomeAssistant)
+
+	return mux
+}
+
+func (s *server) manifest() (*manifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.dbPath + manifestFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var mtime time.Time
+	var size int64
+	if info != nil {
+		mtime, size = info.ModTime(), info.Size()
+	}
+
+	if s.man == nil || !mtime.Equal(s.manMtime) || size != s.manSize {
+		m, err := loadManifest(s.dbPath)
+		if err != nil {
+			return nil, err
+		}
+		s.man, s.manMtime, s.manSize = m, mtime, size
+	}
+
+	return s.man, nil
+}
+
+// comicNum parses the number at the end of paths like /comic/327.
+func comicNum(path, prefix string) (int, bool) {
+	num, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, prefix), "/"))
+	return num, err == nil
+}
+
+// pageComic is what the comic page and API expose about a comic.
+type pageComic struct {
+	Num        int     `json:"num"`
+	Alt        string  `json:"alt"`
+	Transcript string  `json:"transcript"`
+	Img        string  `json:"img,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Panels     []panel `json:"panels,omitempty"`
+	// Special comics link to where they can be seen in full.
+	ExtraParts *extraParts `json:"extra_parts,omitempty"`
+	FullLink   string      `json:"full_link,omitempty"`
+	Prev       int         `json:"-"`
+	Next       int         `json:"-"`
+	// The webcomic's name, for the page title.
+	Source string `json:"-"`
+	// Set for xkcd's missing comic 404.
+	NotFound bool `json:"-"`
+}
+
+// lookup loads a stored comic; ok is false if it isn't mirrored.
+func (s *server) lookup(w http.ResponseWriter, r *http.Request, num int) (pageComic, bool) {
+	c, err := readComic(s.dbPath, num)
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return pageComic{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return pageComic{}, false
+	}
+
+	m, err := s.manifest()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return pageComic{}, false
+	}
+
+	p := pageComic{Num: num, Alt: c.Alt, Transcript: c.Transcript, Source: sourceName(s.dbPath)}
+	if c.ImgPath != "" {
+		p.Img = s.prefix + "/img/" + strconv.Itoa(num)
+	}
+	if c.special() {
+		p.ExtraParts, p.FullLink = c.ExtraParts, c.fullLink()
+	}
+	if e, ok := m.Comics[num]; ok {
+		p.Width, p.Height, p.Panels = e.Width, e.Height, e.Panels
+	}
+
+	return p, true
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		if num, ok := infoPath(r.URL.Path); ok {
+			s.handleInfo(w, r, num)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	nums, err := storedComics(s.dbPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Newest first.
+	for i, j := 0, len(nums)-1; i < j; i, j = i+1, j-1 {
+		nums[i], nums[j] = nums[j], nums[i]
+	}
+
+	now := time.Now()
+	today, err := comicsOn(s.dbPath, now.Month(), now.Day())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render(w, r, "index.html", struct {
+		Nums  []int
+		Today []localComic
+	}{nums, today})
+}
+
+// handleOnThisDay lists comics published on ?date=MM-DD, or today.
+func (s *server) handleOnThisDay(w http.ResponseWriter, r *http.Request) {
+	month, day, err := parseMonthDay(r.URL.Query().Get("date"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comics, err := comicsOn(s.dbPath, month, day)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]Comic, 0, len(comics))
+	for _, c := range comics {
+		list = append(list, c.Comic)
+	}
+
+	writeJSON(w, list)
+}
+
+func (s *server) handleComic(w http.ResponseWriter, r *http.Request) {
+	num, ok := comicNum(r.URL.Path, "/comic/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	stored, err := storedComics(s.dbPath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nums := with404(s.dbPath, stored)
+
+	// The missing comic 404 is shown as the error it is on xkcd.
+	status := http.StatusOK
+	var p pageComic
+	if num == 404 && len(nums) > len(stored) {
+		status = http.StatusNotFound
+		p = pageComic{Num: 404, Alt: comic404.Alt, Source: sourceName(s.dbPath), NotFound: true}
+	} else {
+		p, ok = s.lookup(w, r, num)
+		if !ok {
+			return
+		}
+	}
+	recordUsage(s.dbPath, usageRecord{Comic: num})
+
+	for i, n := range nums {
+		if n != num {
+			continue
+		}
+		if i > 0 {
+			p.Prev = nums[i-1]
+		}
+		if i+1 < len(nums) {
+			p.Next = nums[i+1]
+		}
+	}
+
+	renderStatus(w, r, status, "comic.html", p)
+}
+
+// handleImage serves /img/<num>, optionally followed by the image's file
+// name.
+func (s *server) handleImage(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/img/")
+	named := false
+	if i := strings.Index(path, "/"); i >= 0 {
+		path, named = path[:i], true
+	}
+
+	num, ok := comicNum(path, "")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	path, err := fetchImage(s.dbPath, num)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// Images named like xkcd's are the originals, as replicas and API
+	// clients expect.
+	if !named && r.URL.Query().Get("original") == "" {
+		path = displayImage(s.dbPath, num, path)
+	}
+
+	http.ServeFile(w, r, path)
+}
+
+func (s *server) handleAPIComic(w http.ResponseWriter, r *http.Request) {
+	num, ok := comicNum(r.URL.Path, "/api/comic/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	p, ok := s.lookup(w, r, num)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, p)
+}
+
+// render executes a page in the language the browser asks for.
+func render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	renderStatus(w, r, http.StatusOK, name, data)
+}
+
+// renderStatus is render with another status than 200.
+func renderStatus(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	l := requestLang(r)
+	w.Header().Set("Content-Language", l)
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(status)
+
+	err := pages[l].ExecuteTemplate(w, name, data)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// API results come in pages of this many, unless limit asks for fewer
+// or, up to maxPageLimit, more.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// paginate picks the page of n results that the limit and cursor
+// parameters ask for. The total goes in X-Total-Count, and a Link header
+// points at the next page if there is one. Cursors are opaque to clients.
+// It reports false, having answered, if the parameters are invalid.
+func paginate(w http.ResponseWriter, r *http.Request, n int) (int, int, bool) {
+	q := r.URL.Query()
+
+	limit := defaultPageLimit
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxPageLimit {
+			http.Error(w, fmt.Sprintf("limit must be 1 to %d", maxPageLimit), http.StatusBadRequest)
+			return 0, 0, false
+		}
+		limit = l
+	}
+
+	lo := 0
+	if v := q.Get("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err == nil {
+			lo, err = strconv.Atoi(strings.TrimPrefix(string(raw), "o"))
+		}
+		if err != nil || lo < 0 || !strings.HasPrefix(string(raw), "o") {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return 0, 0, false
+		}
+		if lo > n {
+			lo = n
+		}
+	}
+
+	hi := n
+	if lo+limit < n {
+		hi = lo + limit
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(n))
+	if hi < n {
+		q.Set("cursor", base64.RawURLEncoding.EncodeToString([]byte("o"+strconv.Itoa(hi))))
+		q.Set("limit", strconv.Itoa(limit))
+		// The path as the client sent it, before archive prefixes were
+		// stripped.
+		path := r.RequestURI
+		if i := strings.IndexByte(path, '?'); i >= 0 {
+			path = path[:i]
+		}
+		w.Header().Set("Link", "<"+path+"?"+q.Encode()+`>; rel="next"`)
+	}
+
+	return lo, hi, true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// testServer serves a database synced from a small fake corpus.
+func testServer(t *testing.T, comics []fakexkcd.Comic) (*httptest.Server, string) {
+	t.Helper()
+
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer((&server{dbPath: db}).routes())
+	t.Cleanup(ts.Close)
+
+	return ts, db
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, body
+}
+
+func TestServeComicPage(t *testing.T) {
+	comics := fakexkcd.Corpus(3)
+	ts, _ := testServer(t, comics)
+
+	status, body := get(t, ts.URL+"/comic/2")
+	if status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	for _, want := range []string{comics[1].Alt, `href="1"`, `href="3"`, `src="/img/2"`} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+
+	status, body = get(t, ts.URL+"/img/2")
+	if status != http.StatusOK || !bytes.Equal(body, comics[1].Image) {
+		t.Errorf("image: status %d, %d bytes", status, len(body))
+	}
+
+	for _, path := range []string{"/comic/9", "/comic/x", "/img/9", "/api/comic/9", "/nope"} {
+		if status, _ := get(t, ts.URL+path); status != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, status)
+		}
+	}
+}
+
+func TestServePanelReader(t *testing.T) {
+	ts, db := testServer(t, fakexkcd.Corpus(2))
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Comics[1].Panels = []panel{{0, 0, 4, 4}, {4, 0, 4, 4}}
+	err = m.save(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, body := get(t, ts.URL+"/comic/1")
+	if !strings.Contains(string(body), `id="reader"`) || !strings.Contains(string(body), `"x":4`) {
+		t.Error("comic with panels has no panel reader")
+	}
+
+	_, body = get(t, ts.URL+"/comic/2")
+	if strings.Contains(string(body), `id="reader"`) {
+		t.Error("single panel comic has a panel reader")
+	}
+
+	_, body = get(t, ts.URL+"/api/comic/1")
+	var p pageComic
+	err = json.Unmarshal(body, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Panels) != 2 || p.Width != 8 || p.Img != "/img/1" {
+		t.Errorf("api returned %+v", p)
+	}
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	db := withSlash(t.TempDir())
+	path := db + "serve.sock"
+
+	l, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: (&server{dbPath: db}).routes()}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	c := controlClient("unix:" + path)
+	resp, err := c.Get("http://xkcd-db/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("index over a Unix socket: %s", resp.Status)
+	}
+
+	if _, err := listen("unix:" + path); err == nil {
+		t.Error("a second server took over a socket in use")
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	ts, _ := testServer(t, fakexkcd.Corpus(5))
+
+	var nums []int
+	next := "/api/search?q=alt+text&limit=2"
+	for pages := 0; next != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		// Asked twice, so the answer comes from the cache.
+		get(t, ts.URL+next)
+		resp, err := http.Get(ts.URL + next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var hits []searchHit
+		err = json.NewDecoder(resp.Body).Decode(&hits)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Header.Get("X-Total-Count") != "5" || resp.Header.Get("X-Cache") != "hit" {
+			t.Errorf("headers: %v", resp.Header)
+		}
+		for _, h := range hits {
+			nums = append(nums, h.Num)
+		}
+
+		next = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			next = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	if !equalInts(nums, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("pages held %v", nums)
+	}
+
+	for _, q := range []string{"limit=0", "limit=x", "cursor=nope"} {
+		if status, _ := get(t, ts.URL+"/api/search?q=alt&"+q); status != http.StatusBadRequest {
+			t.Errorf("%s: %d", q, status)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// sftpStore keeps a mirror on an SSH server through the sftp command, so
+// it uses the keys, agent and known hosts of ssh as they are.
+type sftpStore struct {
+	// The port if not the default, and the mirror's folder.
+	user, host, port, dir string
+}
+
+func newSFTP(u *url.URL) (*sftpStore, error) {
+	if u.Host == "" {
+		return nil, errors.New(u.String() + ": no host")
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, errors.New("sftp:// URLs can't hold a password; use an SSH key")
+	}
+	// sftp would take them for options.
+	if strings.HasPrefix(u.Hostname(), "-") || strings.HasPrefix(u.User.Username(), "-") {
+		return nil, errors.New(u.String() + ": user and host can't start with -")
+	}
+
+	// As with curl, /~/ starts at the home folder.
+	dir := strings.TrimPrefix(strings.TrimPrefix(u.Path, "/~"), "/")
+	if !strings.HasPrefix(u.Path, "/~") {
+		dir = u.Path
+	}
+
+	s := &sftpStore{user: u.User.Username(), host: u.Hostname(), port: u.Port(), dir: strings.TrimSuffix(dir, "/")}
+	if s.dir == "" {
+		s.dir = "."
+	}
+
+	return s, nil
+}
+
+func (s *sftpStore) String() string {
+	p := s.dir
+	if !strings.HasPrefix(p, "/") {
+		p = "/~/" + strings.TrimPrefix(p, ".")
+	}
+	u := url.URL{Scheme: "sftp", Host: s.host, Path: strings.TrimSuffix(p, "/")}
+	if s.user != "" {
+		u.User = url.User(s.user)
+	}
+	if s.port != "" {
+		u.Host += ":" + s.port
+	}
+
+	return u.String()
+}
+
+// sftpQuote writes a path for an sftp batch file.
+func sftpQuote(p string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(p) + `"`
+}
+
+// args are the arguments of sftp, reading a batch from stdin.
+func (s *sftpStore) args() []string {
+	args := []string{"-b", "-"}
+	if s.port != "" {
+		args = append(args, "-P", s.port)
+	}
+
+	return append(args, "--", s.dest())
+}
+
+func (s *sftpStore) dest() string {
+	if s.user != "" {
+		return s.user + "@" + s.host
+	}
+
+	return s.host
+}
+
+// run runs a batch of sftp commands. Those starting with - may fail.
+func (s *sftpStore) run(script string) error {
+	cmd := exec.Command("sftp", s.args()...)
+	cmd.Stdin = strings.NewReader(script)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("sftp %s: %v: %s", s.dest(), err, strings.TrimSpace(out.String()))
+	}
+
+	return nil
+}
+
+// putScript uploads each file aside and renames it into place, which
+// OpenSSH servers do atomically.
+func (s *sftpStore) putScript(dbPath string, paths []string) string {
+	var b strings.Builder
+	made := make(map[string]bool)
+	mkdir := func(dir string) {
+		if !made[dir] {
+			made[dir] = true
+			fmt.Fprintf(&b, "-mkdir %s\n", sftpQuote(dir))
+		}
+	}
+
+	// The mirror's folder and those above it.
+	if s.dir != "." {
+		for i := 1; i <= len(s.dir); i++ {
+			if i == len(s.dir) || s.dir[i] == '/' {
+				mkdir(s.dir[:i])
+			}
+		}
+	}
+
+	for _, rel := range paths {
+		remote := path.Join(s.dir, rel)
+		mkdir(path.Dir(remote))
+		fmt.Fprintf(&b, "put %s %s\n", sftpQuote(dbPath+rel), sftpQuote(remote+".part"))
+		fmt.Fprintf(&b, "rename %s %s\n", sftpQuote(remote+".part"), sftpQuote(remote))
+	}
+
+	return b.String()
+}
+
+// put can't tell how far a failed batch got, so it counts as none.
+func (s *sftpStore) put(dbPath string, paths []string) (int, error) {
+	err := s.run(s.putScript(dbPath, paths))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(paths), nil
+}
+
+// get downloads to a temporary file, removed once it is closed.
+func (s *sftpStore) get(rel string) (io.ReadCloser, error) {
+	f, err := os.CreateTemp("", "xkcd-db-sftp-")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	err = s.run(fmt.Sprintf("get %s %s\n", sftpQuote(path.Join(s.dir, rel)), sftpQuote(f.Name())))
+	if err != nil {
+		os.Remove(f.Name())
+		if strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("%s/%s: %w", s, rel, errRemoteNotFound)
+		}
+		return nil, err
+	}
+
+	f, err = os.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return &tempFile{f}, nil
+}
+
+func (s *sftpStore) removeScript(paths []string) string {
+	var b strings.Builder
+	for _, rel := range paths {
+		if strings.HasSuffix(rel, "/") {
+			fmt.Fprintf(&b, "-rmdir %s\n", sftpQuote(path.Join(s.dir, rel)))
+		} else {
+			fmt.Fprintf(&b, "-rm %s\n", sftpQuote(path.Join(s.dir, rel)))
+		}
+	}
+
+	return b.String()
+}
+
+func (s *sftpStore) remove(paths []string) error {
+	return s.run(s.removeScript(paths))
+}
+
+// tempFile is removed when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+
+	return err
+}
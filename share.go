@@ -0,0 +1,363 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A share bundle is a line of JSON saying how it was encrypted, followed
+// by a gzipped tar of comics laid out like a database, sealed with
+// AES-256-GCM under a key derived from a password. The header is
+// authenticated along with the comics, so neither can be altered, and
+// nothing about the comics is readable without the password.
+const shareFormat = "xkcd-db share"
+
+type shareHeader struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+}
+
+// Tests make key derivation quick.
+var shareIterations = 600000
+
+// The largest bundle share open reads.
+const maxShareSize = 4 << 30
+
+var errSharePassword = errors.New("wrong password, or the bundle was altered")
+
+// share creates and opens encrypted bundles of comics.
+func share(args []string) {
+	fs := flag.NewFlagSet("share", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	comics := fs.String("comics", "", "With create, the comics to share, e.g. 1-50,327")
+	out := fs.String("o", "", "With create, the bundle to write")
+	password := fs.String("password", "", "Password of the bundle; XKCDDB_SHARE_PASSWORD is read if not given, keeping it out of process lists")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db share create [flags] -o bundle [comics]")
+		fmt.Fprintln(fs.Output(), "       xkcd-db share open [flags] bundle")
+		fmt.Fprintln(fs.Output(), "Passes a set of comics around encrypted, to be imported by anyone with the password.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var sub string
+	if fs.NArg() > 0 {
+		sub = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if *password == "" {
+		*password = os.Getenv("XKCDDB_SHARE_PASSWORD")
+	}
+
+	*dbPath = withSlash(*dbPath)
+
+	switch {
+	case sub == "create" && *out != "":
+		nums, err := parseComics(append(strings.FieldsFunc(*comics, func(r rune) bool { return r == ',' || r == ' ' }), fs.Args()...))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(nums) == 0 {
+			log.Fatalln("share create: no comics given; use -comics")
+		}
+		if *password == "" {
+			log.Fatalln("share create: no password given; use -password or XKCDDB_SHARE_PASSWORD")
+		}
+
+		err = createShare(*dbPath, *out, nums, *password)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("Shared %d comics in %s\n", len(nums), *out)
+	case sub == "open" && fs.NArg() == 1:
+		if *password == "" {
+			log.Fatalln("share open: no password given; use -password or XKCDDB_SHARE_PASSWORD")
+		}
+
+		a := startAudit(*dbPath, "share", redactArgs(args, "password"))
+		n, skipped, err := openShare(*dbPath, fs.Arg(0), *password)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = updateIndex(*dbPath, false)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		outcome := fmt.Sprintf("Imported %d comics, %d already stored or excluded", n, skipped)
+		fmt.Println(paint(os.Stdout, good, outcome))
+		a.end(outcome)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+// createShare writes the comics nums of a database to an encrypted bundle
+// at path.
+func createShare(dbPath, path string, nums []int, password string) error {
+	snap, done, err := snapshotDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	var plain bytes.Buffer
+	zw := gzip.NewWriter(&plain)
+	tw := tar.NewWriter(zw)
+
+	for _, num := range nums {
+		c, err := readComic(snap, num)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("comic %d is not in %s", num, dbPath)
+		}
+		if err == nil {
+			err = c.fetchImage()
+		}
+		if err != nil {
+			return err
+		}
+
+		item := strconv.Itoa(num)
+		info := c.raw
+		if info == nil {
+			info, err = json.Marshal(c.Comic)
+			if err != nil {
+				return err
+			}
+		}
+		err = addTarFile(tw, item+"/"+item+"-info.json", info)
+		if err != nil {
+			return err
+		}
+
+		if c.ImgPath == "" {
+			continue
+		}
+		img, err := os.ReadFile(c.ImgPath)
+		if err == nil {
+			err = addTarFile(tw, item+"/"+filepath.Base(c.ImgPath), img)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	h := shareHeader{
+		Format:     shareFormat,
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: shareIterations,
+		Salt:       make([]byte, 16),
+		Cipher:     "aes-256-gcm",
+		Nonce:      make([]byte, 12),
+	}
+	_, err = rand.Read(h.Salt)
+	if err == nil {
+		_, err = rand.Read(h.Nonce)
+	}
+	if err != nil {
+		return err
+	}
+	header, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	header = append(header, '\n')
+
+	aead, err := shareCipher(password, h)
+	if err != nil {
+		return err
+	}
+	sealed := aead.Seal(header, h.Nonce, plain.Bytes(), header)
+
+	return writeFileAtomic(path, sealed)
+}
+
+func addTarFile(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+
+	return err
+}
+
+// shareCipher derives the key of a bundle from its password.
+func shareCipher(password string, h shareHeader) (cipher.AEAD, error) {
+	if h.KDF != "pbkdf2-sha256" || h.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported share encryption: %s, %s", h.KDF, h.Cipher)
+	}
+	// Bounded so a crafted bundle can't keep share open busy for hours.
+	if h.Iterations < 1 || h.Iterations > 100*600000 || len(h.Salt) == 0 {
+		return nil, errors.New("invalid share header")
+	}
+
+	key := pbkdf2([]byte(password), h.Salt, h.Iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 is PBKDF2 from RFC 8018, which the standard library lacks.
+func pbkdf2(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	size := prf.Size()
+
+	var key []byte
+	var block [4]byte
+	for i := uint32(1); len(key) < keyLen; i++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(block[:], i)
+		prf.Write(block[:])
+		u := prf.Sum(nil)
+
+		t := make([]byte, size)
+		copy(t, u)
+		for n := 1; n < iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
+
+// openShare decrypts a bundle and imports its comics, returning how many
+// were imported and how many the database already had or excludes.
+func openShare(dbPath, path, password string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.LimitReader(f, maxShareSize))
+	header, err := r.ReadBytes('\n')
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s is not a share bundle", path)
+	}
+	var h shareHeader
+	if json.Unmarshal(header, &h) != nil || h.Format != shareFormat {
+		return 0, 0, fmt.Errorf("%s is not a share bundle", path)
+	}
+	if h.Version != 1 {
+		return 0, 0, fmt.Errorf("%s: share bundle version %d is newer than this xkcd-db", path, h.Version)
+	}
+
+	aead, err := shareCipher(password, h)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(h.Nonce) != aead.NonceSize() {
+		return 0, 0, errors.New("invalid share header")
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	plain, err := aead.Open(nil, h.Nonce, sealed, header)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %w", path, errSharePassword)
+	}
+
+	tmp, err := os.MkdirTemp("", "xkcd-db-share-")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.RemoveAll(tmp)
+
+	err = extractShare(plain, withSlash(tmp))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return importDump(dbPath, tmp, "native")
+}
+
+// extractShare unpacks the comics of a decrypted bundle into dir. Only
+// files directly in numbered directories are accepted.
+func extractShare(plain []byte, dir string) error {
+	zr, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		parts := strings.Split(hdr.Name, "/")
+		if hdr.Typeflag != tar.TypeReg || len(parts) != 2 || parts[1] == "" || parts[1] == "." || parts[1] == ".." || strings.ContainsRune(parts[1], '\\') {
+			return fmt.Errorf("unexpected file in bundle: %q", hdr.Name)
+		}
+		if num, err := strconv.Atoi(parts[0]); err != nil || num < 1 || strconv.Itoa(num) != parts[0] {
+			return fmt.Errorf("unexpected file in bundle: %q", hdr.Name)
+		}
+
+		err = os.MkdirAll(dir+parts[0], 0755)
+		if err != nil {
+			return err
+		}
+		out, err := os.Create(dir + hdr.Name)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
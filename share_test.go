@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// From RFC 6070.
+	key := pbkdf2([]byte("password"), []byte("salt"), 4096, 20, sha1.New)
+	if got := hex.EncodeToString(key); got != "4b007901b765489abead49d926f721d065a429c1" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestShare(t *testing.T) {
+	saved := shareIterations
+	shareIterations = 10
+	t.Cleanup(func() { shareIterations = saved })
+
+	_, db := testServer(t, fakexkcd.Corpus(5))
+	bundle := t.TempDir() + "/comics.xkcdshare"
+
+	err := createShare(db, bundle, []int{2, 3}, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := readFile(t, bundle)
+	if bytes.Contains(data, []byte("Alt text 2")) || !strings.HasPrefix(string(data), `{"format":"xkcd-db share"`) {
+		t.Error("bundle isn't encrypted, or doesn't say what it is")
+	}
+
+	other := tempDB(t)
+	if _, _, err := openShare(other, bundle, "hunter3"); !errors.Is(err, errSharePassword) {
+		t.Errorf("wrong password: %v", err)
+	}
+
+	// Tampering with the header is caught too.
+	tampered := t.TempDir() + "/tampered"
+	os.WriteFile(tampered, bytes.Replace(data, []byte(`"iterations":10`), []byte(`"iterations":11`), 1), 0644)
+	if _, _, err := openShare(other, tampered, "hunter2"); err == nil {
+		t.Error("opened a tampered bundle")
+	}
+
+	n, skipped, err := openShare(other, bundle, "hunter2")
+	if err != nil || n != 2 || skipped != 0 {
+		t.Fatalf("imported %d, skipped %d: %v", n, skipped, err)
+	}
+	c, err := readComic(other, 3)
+	if err != nil || c.Alt != "Alt text 3" {
+		t.Errorf("comic 3: %+v, %v", c.Comic, err)
+	}
+	if !bytes.Equal(readFile(t, c.ImgPath), fakexkcd.Image(3)) {
+		t.Error("image of comic 3 differs")
+	}
+
+	if n, skipped, err := openShare(other, bundle, "hunter2"); err != nil || n != 0 || skipped != 2 {
+		t.Errorf("opened again: imported %d, skipped %d: %v", n, skipped, err)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// show prints a comic, fetching it first if it isn't mirrored yet.
+func show(args []string) {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	copyWhat := fs.String("copy", "", "Copy the comic's image, alt or path to the clipboard")
+	view := viewerFlags(fs)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db show [flags] comic")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	num, err := strconv.Atoi(fs.Arg(0))
+	if fs.NArg() != 1 || err != nil {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	*dbPath = withSlash(*dbPath)
+
+	c, err := ensureComic(*dbPath, num)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	showComic(*dbPath, c, *copyWhat, view)
+}
+
+// random shows a randomly chosen stored comic.
+func random(args []string) {
+	fs := flag.NewFlagSet("random", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	copyWhat := fs.String("copy", "", "Copy the comic's image, alt or path to the clipboard")
+	view := viewerFlags(fs)
+	addGlobalFlags(fs)
+	fs.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+
+	nums, err := storedComics(*dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(nums) == 0 {
+		log.Fatalln("No comics stored; sync first")
+	}
+
+	c, err := readComic(*dbPath, nums[rng.Intn(len(nums))])
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	showComic(*dbPath, c, *copyWhat, view)
+}
+
+// showComic prints a comic with what the manifest knows about it, copies
+// part of it to the clipboard and opens its image if asked.
+func showComic(dbPath string, c localComic, copyWhat string, view *viewerOptions) {
+	printComic(c)
+	recordUsage(dbPath, usageRecord{Comic: c.Num})
+
+	tags, err := loadTags(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(tags[c.Num]) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(tags[c.Num], ", "))
+	}
+
+	m, err := loadManifest(dbPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if e, ok := m.Comics[c.Num]; ok && e.Format != "" {
+		fmt.Printf("Size: %dx%d %s\n", e.Width, e.Height, e.Format)
+		if len(e.Panels) > 0 {
+			fmt.Printf("Panels: %d\n", len(e.Panels))
+		}
+		if e.Colors != nil {
+			fmt.Printf("Colour: %.1f%%\n", 100*e.Colors.ColorFraction)
+		}
+	}
+
+	if copyWhat != "" {
+		err = copyComic(c, copyWhat)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("Copied %s to the clipboard\n", copyWhat)
+	}
+
+	if view.open {
+		err = view.openComics([]localComic{c})
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+// search lists mirrored comics whose alt text or transcript contains the
+// query. A comic number is looked up like show does. With -apply, the
+// matches are tagged, exported, refetched or excluded instead.
+func search(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	colorOnly := fs.Bool("color-only", false, "Only list colour comics (needs analyze)")
+	gallery := fs.String("export-gallery", "", "Write an HTML gallery of the matches into this directory instead of listing them")
+	openAll := fs.Bool("open-all", false, "Open the images of all matches in one viewer instead of listing them")
+	viewer := fs.String("viewer", "", "With -open-all, the command to open images with, e.g. 'feh %s'; see xkcd-db open -h")
+	var actions bulkActions
+	fs.Var(&actions, "apply", "Do something to every match instead of listing them: tag=name, untag=name, export=dir, refetch or exclude[=reason]; may be repeated")
+	tableOpts := tableFlags(fs)
+	fs.Lookup("sort").Usage = "Order of results: " + strings.Join(searchOrders, ", ") + "; or a column to sort by, prefixed with - to reverse"
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db search [flags] query")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// Flags may follow the query too.
+	var words []string
+	for fs.NArg() > 0 {
+		words = append(words, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+
+	*dbPath = withSlash(*dbPath)
+	query := strings.Join(words, " ")
+
+	if num, err := strconv.Atoi(query); err == nil {
+		c, err := ensureComic(*dbPath, num)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		printComic(c)
+		return
+	}
+
+	matches, err := searchComics(*dbPath, query)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *colorOnly {
+		m, err := loadManifest(*dbPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		colored := matches[:0]
+		for _, c := range matches {
+			if e, ok := m.Comics[c.Num]; ok && e.Colors.isColor() {
+				colored = append(colored, c)
+			}
+		}
+		matches = colored
+	}
+
+	if isSearchOrder(tableOpts.sort) {
+		ix, err := loadIndex(*dbPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		w := ix.settings.Weights
+		perm, err := orderMatches(matches, query, tableOpts.sort, func(int) fieldWeights { return w })
+		if err != nil {
+			log.Fatalln(err)
+		}
+		sorted := make([]localComic, len(perm))
+		for i, p := range perm {
+			sorted[i] = matches[p]
+		}
+		matches, tableOpts.sort = sorted, ""
+	}
+
+	t := newTable("num", "title", "date", "alt")
+	for _, c := range matches {
+		t.add(strconv.Itoa(c.Num), c.Title, c.date(), firstLine(c.Alt))
+	}
+
+	// Galleries, viewers and actions get the page of matches a table would
+	// list, in its order.
+	if *gallery != "" || *openAll || len(actions) > 0 {
+		rows, err := tableOpts.pick(t)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		page := make([]localComic, len(rows))
+		for i, r := range rows {
+			page[i] = matches[r]
+		}
+		matches = page
+	}
+
+	if *gallery != "" {
+		err = writeGallery(*gallery, fmt.Sprintf("xkcd comics about %q", query), matches)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		fmt.Printf("Wrote a gallery of %d comics to %s\n", len(matches), withSlash(*gallery)+"index.html")
+		return
+	}
+
+	if len(actions) > 0 {
+		if len(matches) == 0 {
+			fmt.Println("No matches")
+			return
+		}
+
+		a := startAudit(*dbPath, "search", args)
+		outcome, err := applyActions(*dbPath, actions, matches)
+		if outcome != "" {
+			outcome = strings.ToUpper(outcome[:1]) + outcome[1:]
+			fmt.Println(paint(os.Stdout, good, outcome))
+			a.end(outcome)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	if *openAll {
+		if len(matches) == 0 {
+			fmt.Println("No matches")
+			return
+		}
+		say("Opening %d comics\n", len(matches))
+
+		err = (&viewerOptions{viewer: *viewer}).openComics(matches)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	err = tableOpts.print(os.Stdout, t)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// searchComics matches the query case-insensitively against alt text and
+// transcripts, and prefixed terms against their fields; see parseQuery.
+// The search index rules out most comics without reading them.
+func searchComics(dbPath, query string) ([]localComic, error) {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+	var matches []localComic
+
+	ix, err := loadIndex(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	sq := parseQuery(query)
+	var tags comicTags
+	if sq.uses("tag") {
+		tags, err = loadTags(dbPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Tags change without the index noticing.
+	stored := len(nums)
+	if found, ok := ix.cachedResult(query, stored); ok && tags == nil {
+		for _, num := range found {
+			c, err := readComic(dbPath, num)
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, c)
+		}
+		return matches, nil
+	}
+
+	for _, text := range sq.indexed() {
+		nums, err = ix.candidates(nums, text)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, num := range nums {
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return nil, err
+		}
+
+		c.tags = tags[num]
+		if sq.match(c) {
+			matches = append(matches, c)
+		}
+	}
+
+	found := make([]int, len(matches))
+	for i, c := range matches {
+		found[i] = c.Num
+	}
+	ix.remember(query, stored, found)
+
+	return matches, nil
+}
+
+func printComic(c localComic) {
+	printComicTo(os.Stdout, c)
+}
+
+func printComicTo(w io.Writer, c localComic) {
+	if c.Title != "" {
+		fmt.Fprintf(w, "#%d %s\n", c.Num, c.Title)
+	} else {
+		fmt.Fprintf(w, "#%d\n", c.Num)
+	}
+	if c.Year != "" {
+		fmt.Fprintf(w, "Published: %s-%s-%s\n", c.Year, c.Month, c.Day)
+	}
+	if c.ImgPath != "" {
+		fmt.Fprintf(w, "Image: %s\n", c.ImgPath)
+	}
+	if c.special() {
+		fmt.Fprintf(w, "Interactive: the image is only part of this comic; see %s\n", c.fullLink())
+	}
+	if c.Alt != "" {
+		fmt.Fprintf(w, "Alt: %s\n", c.Alt)
+	}
+	if c.Transcript != "" {
+		fmt.Fprintf(w, "Transcript:\n%s\n", c.Transcript)
+	}
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+
+	return s
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestEnsureComicFetchesOnDemand(t *testing.T) {
+	comics := fakexkcd.Corpus(10)
+	srv := startFake(t, comics)
+	db := tempDB(t)
+
+	c, err := ensureComic(db, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Alt != comics[6].Alt || c.ImgPath != db+"7/comic_7.png" {
+		t.Errorf("got %+v", c)
+	}
+
+	_, err = ensureComic(db, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := srv.Hits("/7/info.0.json"); hits != 1 {
+		t.Errorf("comic 7 fetched %d times, want 1", hits)
+	}
+	if hits := srv.Hits("/6/info.0.json"); hits != 0 {
+		t.Errorf("comic 6 fetched %d times, want 0", hits)
+	}
+}
+
+func TestSearchComics(t *testing.T) {
+	comics := fakexkcd.Corpus(3)
+	comics[0].Alt = "Standards proliferate"
+	comics[2].Transcript = "[[A man thinks about STANDARDS.]]"
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := searchComics(db, "standards")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Num != 1 || matches[1].Num != 3 {
+		t.Errorf("got %+v", matches)
+	}
+}
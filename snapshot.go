@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// snapshotDB copies what a database holds of finished comics into a
+// directory of its own, so exports and uploads can read a database that a
+// sync is writing to. Comics the journal shows half written are left out,
+// and each comic is copied again until no file of it changed while it
+// was read. Images are only ever replaced, never rewritten, so they are
+// linked rather than copied where the file system allows.
+//
+// The snapshot is a database itself, with the manifest as it was when it
+// was taken. done removes it.
+func snapshotDB(dbPath string) (snap string, done func(), err error) {
+	// Listed before the journal is read, so comics begun in between
+	// aren't listed at all.
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	before, _ := os.Stat(dbPath + manifestFile)
+	m, err := loadManifest(dbPath)
+	if err != nil {
+		return "", nil, err
+	}
+	err = m.replay(dbPath)
+	if err != nil {
+		return "", nil, err
+	}
+	// Whether the snapshot's manifest is the database's as it is on disk,
+	// to be stamped like it so uploads see it unchanged.
+	after, _ := os.Stat(dbPath + manifestFile)
+	exact := m.pending == nil && before != nil && after != nil &&
+		before.Size() == after.Size() && before.ModTime().Equal(after.ModTime())
+
+	// Inside the database, to be on its file system, and named so that
+	// cleanup takes what a crash leaves behind.
+	snap = withSlash(fmt.Sprintf("%ssnapshot-%d-%d.tmp", dbPath, os.Getpid(), time.Now().UnixNano()))
+	err = os.Mkdir(snap, 0755)
+	if err != nil {
+		return "", nil, err
+	}
+	done = func() { os.RemoveAll(snap) }
+	defer func() {
+		if err != nil {
+			done()
+		}
+	}()
+
+	listed := make(map[int]bool)
+	for _, num := range nums {
+		if m.pending[num] {
+			continue
+		}
+
+		err = snapshotComic(dbPath, snap, num)
+		// Removed since it was listed.
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		listed[num] = true
+	}
+	// Comics stored but left out go from the manifest too; entries of
+	// comics that aren't stored at all are fsck's business.
+	for num := range m.Comics {
+		if _, err := os.Stat(dbPath + strconv.Itoa(num)); err == nil && !listed[num] {
+			delete(m.Comics, num)
+			exact = false
+		}
+	}
+
+	// Display copies, for exports to use.
+	if _, err := os.Stat(dbPath + normalizedDir); err == nil {
+		err = os.Mkdir(snap+normalizedDir, 0755)
+		if err != nil {
+			return "", nil, err
+		}
+		for num := range listed {
+			_, err = snapshotFile(normalizedPath(dbPath, num), normalizedPath(snap, num), true)
+			if err != nil && !os.IsNotExist(err) {
+				return "", nil, err
+			}
+		}
+	}
+
+	for _, name := range []string{excludeFile, feedFile, hybridFile, sourceFile} {
+		_, err = snapshotFile(dbPath+name, snap+name, false)
+		if err != nil && !os.IsNotExist(err) {
+			return "", nil, err
+		}
+	}
+	m.pending = nil
+	err = m.save(snap)
+	if err == nil && exact {
+		err = os.Chtimes(snap+manifestFile, before.ModTime(), before.ModTime())
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	return snap, done, nil
+}
+
+// snapshotComic copies a comic's directory into the snapshot, again if
+// anything in it changed meanwhile.
+func snapshotComic(dbPath, snap string, num int) error {
+	item := strconv.Itoa(num) + "/"
+	img, _ := comicImagePath(dbPath, num)
+
+	for tries := 0; tries < 5; tries++ {
+		err := os.RemoveAll(snap + item)
+		if err == nil {
+			err = os.Mkdir(snap+item, 0755)
+		}
+		if err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(dbPath + item)
+		if err != nil {
+			return err
+		}
+
+		copied := make(map[string]os.FileInfo)
+		for _, e := range entries {
+			if e.IsDir() || tempName(e.Name()) != "" {
+				continue
+			}
+			src := dbPath + item + e.Name()
+			info, err := snapshotFile(src, snap+item+e.Name(), src == img)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				copied[e.Name()] = info
+			}
+		}
+
+		if unchanged(dbPath+item, copied) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("comic %d kept changing while it was copied", num)
+}
+
+// unchanged reports whether dir holds just the files given, as they were.
+func unchanged(dir string, files map[string]os.FileInfo) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	n := 0
+	for _, e := range entries {
+		if e.IsDir() || tempName(e.Name()) != "" {
+			continue
+		}
+		was, ok := files[e.Name()]
+		info, err := e.Info()
+		if !ok || err != nil || info.Size() != was.Size() || !info.ModTime().Equal(was.ModTime()) {
+			return false
+		}
+		n++
+	}
+
+	return n == len(files)
+}
+
+// snapshotFile copies or links src to dst, keeping its modification time,
+// and returns what src was like before it was read.
+func snapshotFile(src, dst string, link bool) (os.FileInfo, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if link && os.Link(src, dst) == nil {
+		return info, nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
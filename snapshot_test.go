@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestSnapshotDuringSync(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A sync halfway through writing comic 4.
+	m, unlock, err := recoverManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	defer m.journal.Close()
+	if err := m.begin(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(db+"4", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db+"4/4-alt", []byte("Alt te"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := withSlash(t.TempDir())
+	n, err := exportComics(db, out, nil, exportOptions{format: "json"})
+	if err != nil || n != 3 {
+		t.Fatalf("exported %d comics: %v", n, err)
+	}
+	if _, err := os.Stat(out + "4.json"); !os.IsNotExist(err) {
+		t.Error("half written comic exported")
+	}
+	if _, err := exportComics(db, out, []int{4}, exportOptions{format: "json"}); err == nil {
+		t.Error("half written comic exported by number")
+	}
+
+	// The sync's files are left alone, and the snapshots are gone.
+	if _, err := os.Stat(db + journalFile); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(db + "4/4-alt"); err != nil {
+		t.Error(err)
+	}
+	if left, _ := filepath.Glob(db + "snapshot-*"); len(left) > 0 {
+		t.Errorf("snapshots left behind: %v", left)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sourceFile holds the plugin of a database that mirrors a webcomic other
+// than xkcd.
+const sourceFile = "source.json"
+
+// A comicSource is a webcomic sync can mirror.
+type comicSource interface {
+	// latest is the number of the newest comic.
+	latest() (int, error)
+	// info fetches the metadata of a comic, with Img the URL of its image
+	// or empty if it has none.
+	info(item string) (Comic, error)
+	// skip reports numbers the comic never had.
+	skip(num int) bool
+	// host is where the metadata comes from, for host statistics.
+	host() string
+}
+
+// xkcdSource is xkcd itself.
+type xkcdSource struct{}
+
+func (xkcdSource) latest() (int, error) {
+	comicData, err := fetchInfo(xkcdURL + jsonFile)
+	if err != nil {
+		return 0, err
+	}
+
+	return comicData.Num, nil
+}
+
+func (xkcdSource) info(item string) (Comic, error) {
+	return fetchInfo(xkcdURL + item + "/" + jsonFile)
+}
+
+// xkcd 404 doesn't exist.
+func (xkcdSource) skip(num int) bool { return num == 404 }
+
+func (xkcdSource) host() string { return xkcdURL }
+
+// sourcePlugin is what every plugin file has. Type is json, the default,
+// or rss.
+type sourcePlugin struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// parseSource reads and checks a plugin for the database at dbPath.
+func parseSource(data []byte, dbPath string) (comicSource, error) {
+	var p sourcePlugin
+	err := json.Unmarshal(data, &p)
+	if err != nil {
+		return nil, fmt.Errorf("comic source: %v", err)
+	}
+	if p.Name == "" {
+		return nil, errors.New("comic source has no name")
+	}
+
+	switch p.Type {
+	case "", "json":
+		return parseJSONSource(data)
+	case "rss":
+		return parseRSSSource(data, dbPath)
+	}
+
+	return nil, fmt.Errorf("comic source %s has unknown type %s; want json or rss", p.Name, p.Type)
+}
+
+// jsonSource is a plugin for a webcomic whose metadata is JSON, one
+// document per comic, e.g.
+//
+//	{
+//		"name": "example",
+//		"latest": "https://example.com/latest.json",
+//		"comic": "https://example.com/comics/{num}.json",
+//		"fields": {"title": "name", "img": "image.url", "date": "published"},
+//		"skip": [13]
+//	}
+//
+// Fields maps a Comic field (num, title, year, month, day, date, img, alt
+// or transcript) to a key, with dots reaching into nested objects; keys
+// named like the field need no entry. A date is YYYY-MM-DD and fills in
+// year, month and day. Relative image URLs are taken from the comic's URL.
+type jsonSource struct {
+	Name   string            `json:"name"`
+	Latest string            `json:"latest"`
+	Comic  string            `json:"comic"`
+	Fields map[string]string `json:"fields,omitempty"`
+	Skip   []int             `json:"skip,omitempty"`
+}
+
+// sourceFields are what a plugin can map.
+var sourceFields = []string{"num", "title", "year", "month", "day", "date", "img", "alt", "transcript"}
+
+func parseJSONSource(data []byte) (*jsonSource, error) {
+	var s jsonSource
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return nil, fmt.Errorf("comic source: %v", err)
+	}
+
+	switch {
+	case s.Latest == "":
+		return nil, fmt.Errorf("comic source %s has no latest URL", s.Name)
+	case !strings.Contains(s.Comic, "{num}"):
+		return nil, fmt.Errorf("comic source %s: the comic URL needs {num}", s.Name)
+	}
+
+	for field := range s.Fields {
+		known := false
+		for _, f := range sourceFields {
+			known = known || f == field
+		}
+		if !known {
+			return nil, fmt.Errorf("comic source %s: unknown field %s; want one of %s", s.Name, field, strings.Join(sourceFields, ", "))
+		}
+	}
+
+	return &s, nil
+}
+
+func (s *jsonSource) latest() (int, error) {
+	c, err := s.fetch(s.Latest)
+	if err != nil {
+		return 0, err
+	}
+	if c.Num <= 0 {
+		return 0, fmt.Errorf("%s has no comic number", s.Latest)
+	}
+
+	return c.Num, nil
+}
+
+func (s *jsonSource) info(item string) (Comic, error) {
+	c, err := s.fetch(strings.Replace(s.Comic, "{num}", item, -1))
+	if err != nil {
+		return c, err
+	}
+
+	// Not every API repeats the number it was asked for.
+	if c.Num == 0 {
+		c.Num, _ = strconv.Atoi(item)
+	}
+
+	return c, nil
+}
+
+func (s *jsonSource) skip(num int) bool {
+	for _, n := range s.Skip {
+		if n == num {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *jsonSource) host() string { return s.Comic }
+
+// fetch downloads a comic's JSON and maps it onto a Comic. The result
+// has no raw JSON, so the database stores it in xkcd's format.
+func (s *jsonSource) fetch(u string) (Comic, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return Comic{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return Comic{}, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxInfoSize+1))
+	if err != nil {
+		return Comic{}, err
+	}
+	if len(raw) > maxInfoSize {
+		return Comic{}, errors.New("comic metadata too large: " + u)
+	}
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(raw, &doc)
+	if err != nil {
+		return Comic{}, fmt.Errorf("%s: %v", u, err)
+	}
+
+	var c Comic
+	c.Num, _ = strconv.Atoi(s.field(doc, "num"))
+	c.Title = s.field(doc, "title")
+	c.Year, c.Month, c.Day = s.field(doc, "year"), s.field(doc, "month"), s.field(doc, "day")
+	if date := s.field(doc, "date"); len(date) >= len(dayLayout) {
+		parts := strings.SplitN(date[:len(dayLayout)], "-", 3)
+		if len(parts) == 3 {
+			c.Year, c.Month, c.Day = parts[0], strings.TrimLeft(parts[1], "0"), strings.TrimLeft(parts[2], "0")
+		}
+	}
+	c.Alt = s.field(doc, "alt")
+	c.Transcript = s.field(doc, "transcript")
+
+	if img := s.field(doc, "img"); img != "" {
+		base, err := url.Parse(u)
+		if err != nil {
+			return Comic{}, err
+		}
+		ref, err := url.Parse(img)
+		if err != nil {
+			return Comic{}, fmt.Errorf("%s: image URL: %v", u, err)
+		}
+		c.Img = base.ResolveReference(ref).String()
+	}
+
+	return c, nil
+}
+
+// field looks up a Comic field in doc as a string.
+func (s *jsonSource) field(doc map[string]interface{}, name string) string {
+	key := name
+	if k, ok := s.Fields[name]; ok {
+		key = k
+	}
+
+	var v interface{} = doc
+	for _, part := range strings.Split(key, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = obj[part]
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+// loadSource is the source a database mirrors, xkcd unless it has a
+// plugin.
+func loadSource(dbPath string) (comicSource, error) {
+	data, err := os.ReadFile(dbPath + sourceFile)
+	if os.IsNotExist(err) {
+		return xkcdSource{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSource(data, dbPath)
+}
+
+// sourceName is the name of the webcomic a database mirrors.
+func sourceName(dbPath string) string {
+	var p sourcePlugin
+	data, err := os.ReadFile(dbPath + sourceFile)
+	if err != nil || json.Unmarshal(data, &p) != nil || p.Name == "" {
+		return "xkcd"
+	}
+
+	return p.Name
+}
+
+// installSource makes the database at dbPath mirror the plugin in path
+// from now on. A database keeps the comic it started with.
+func installSource(dbPath, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, err = parseSource(data, dbPath)
+	if err != nil {
+		return err
+	}
+
+	nums, err := storedComics(dbPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(nums) > 0 {
+		var current, next sourcePlugin
+		old, _ := os.ReadFile(dbPath + sourceFile)
+		json.Unmarshal(old, &current)
+		json.Unmarshal(data, &next)
+		if current.Name != next.Name {
+			return fmt.Errorf("%s already mirrors another comic", dbPath)
+		}
+	}
+
+	err = os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dbPath+sourceFile, data, 0644)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeWebcomic serves comics 1 to 3, without 2, in a JSON shape unlike
+// xkcd's.
+func fakeWebcomic(t *testing.T) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	comic := func(w http.ResponseWriter, n int) {
+		fmt.Fprintf(w, `{"id": %d, "name": "Strip %d", "published": "2021-03-0%dT12:00:00Z", "caption": "caption %d", "image": {"url": "../img/%d.png"}}`, n, n, n, n, n)
+	}
+	mux.HandleFunc("/latest.json", func(w http.ResponseWriter, r *http.Request) { comic(w, 3) })
+	mux.HandleFunc("/comics/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/comics/1.json":
+			comic(w, 1)
+		case "/comics/3.json":
+			comic(w, 3)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/img/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image " + r.URL.Path))
+	})
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	return ts.URL
+}
+
+func TestJSONSource(t *testing.T) {
+	url := fakeWebcomic(t)
+	plugin := t.TempDir() + "/strip.json"
+	err := os.WriteFile(plugin, []byte(`{
+		"name": "strip",
+		"latest": "`+url+`/latest.json",
+		"comic": "`+url+`/comics/{num}.json",
+		"fields": {"num": "id", "title": "name", "date": "published", "alt": "caption", "img": "image.url"},
+		"skip": [2]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := tempDB(t)
+	err = installSource(db, plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(res.added, []int{1, 3}) || res.failed != 0 {
+		t.Fatalf("got %+v", res)
+	}
+
+	c, err := readComic(db, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Title != "Strip 3" || c.Alt != "caption 3" || c.date() != "2021-03-03" {
+		t.Errorf("got %+v", c.Comic)
+	}
+	if got := string(readFile(t, c.ImgPath)); got != "image /img/3.png" {
+		t.Errorf("image holds %q", got)
+	}
+
+	// Comics of one webcomic don't mix with another's.
+	err = os.WriteFile(plugin, []byte(`{"name": "other", "latest": "x", "comic": "{num}"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := installSource(db, plugin); err == nil || !strings.Contains(err.Error(), "another comic") {
+		t.Errorf("switched sources: %v", err)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	for _, bad := range []string{
+		`{"latest": "a", "comic": "{num}"}`,
+		`{"name": "x", "comic": "{num}"}`,
+		`{"name": "x", "latest": "a", "comic": "a"}`,
+		`{"name": "x", "latest": "a", "comic": "{num}", "fields": {"author": "by"}}`,
+		`{"name": "x", "type": "atom"}`,
+		`{"name": "x", "type": "rss", "image": "no group"}`,
+	} {
+		if _, err := parseSource([]byte(bad), t.TempDir()+"/"); err == nil {
+			t.Errorf("accepted %s", bad)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+// stateFiles are what a database holds beyond the comics and what can be
+// worked out from them: tags, exclusions, review progress, quiz scores,
+// export watermarks and what syncs learned about hosts.
+var stateFiles = []string{excludeFile, exportsFile, hostsFile, quizFile, reviewFile, tagsFile}
+
+// stateBundle carries the state files between machines.
+type stateBundle struct {
+	Version int                        `json:"version"`
+	Files   map[string]json.RawMessage `json:"files"`
+}
+
+// state moves a database's state to another machine.
+func state(args []string) {
+	fs := flag.NewFlagSet("state", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db state [flags] export|import file")
+		fmt.Fprintln(fs.Output(), "The file may be - for stdout or stdin.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	*dbPath = withSlash(*dbPath)
+	file := fs.Arg(1)
+
+	switch fs.Arg(0) {
+	case "export":
+		w := io.Writer(os.Stdout)
+		if file != "-" {
+			f, err := os.Create(file)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		names, err := exportState(*dbPath, w)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %v\n", names)
+	case "import":
+		r := io.Reader(os.Stdin)
+		if file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		var b stateBundle
+		err := json.NewDecoder(r).Decode(&b)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if !confirm(fmt.Sprintf("Replace %v in %s? The current files go to the trash.", b.names(), *dbPath)) {
+			os.Exit(1)
+		}
+
+		a := startAudit(*dbPath, "state", args)
+		err = importState(*dbPath, b)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		a.end(fmt.Sprintf("Imported %v", b.names()))
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func (b stateBundle) names() []string {
+	names := make([]string, 0, len(b.Files))
+	for name := range b.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// exportState writes the state files that exist as a bundle and returns
+// their names.
+func exportState(dbPath string, w io.Writer) ([]string, error) {
+	b := stateBundle{Version: 1, Files: make(map[string]json.RawMessage)}
+
+	for _, name := range stateFiles {
+		data, err := os.ReadFile(dbPath + name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(data) {
+			return nil, errors.New(dbPath + name + " is not valid JSON")
+		}
+		b.Files[name] = data
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+
+	return b.names(), enc.Encode(b)
+}
+
+// importState writes the bundle's files into the database. Files it
+// replaces are moved to the trash.
+func importState(dbPath string, b stateBundle) error {
+	if b.Version != 1 {
+		return fmt.Errorf("unknown state version %d", b.Version)
+	}
+
+	known := make(map[string]bool)
+	for _, name := range stateFiles {
+		known[name] = true
+	}
+
+	var replaced []string
+	for _, name := range b.names() {
+		if !known[name] {
+			return errors.New("unknown state file " + name)
+		}
+		if _, err := os.Stat(dbPath + name); err == nil {
+			replaced = append(replaced, dbPath+name)
+		}
+	}
+
+	err := os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		return err
+	}
+
+	if len(replaced) > 0 {
+		_, err := moveToTrash(dbPath, replaced)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, data := range b.Files {
+		err := os.WriteFile(dbPath+name, data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
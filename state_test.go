@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	from := withSlash(t.TempDir())
+	to := withSlash(t.TempDir()) + "db/"
+
+	files := map[string]string{
+		reviewFile:  `{"927":{"reps":2,"interval":3,"ease":2.5,"due":"2026-10-20","views":2}}`,
+		quizFile:    `{"played":5,"correct":4,"bestStreak":3,"streak":1}`,
+		tagsFile:    `{"927":["fav"]}`,
+		excludeFile: `{"404":{"reason":"not for class","time":"2026-10-01T00:00:00Z"}}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(from+name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Manifests can be rebuilt, so they don't travel.
+	if err := os.WriteFile(from+manifestFile, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	names, err := exportState(from, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{excludeFile, quizFile, reviewFile, tagsFile}; strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("exported %v, want %v", names, want)
+	}
+
+	if err := os.MkdirAll(to, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(to+quizFile, []byte(`{"played":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var b stateBundle
+	if err := json.NewDecoder(&buf).Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := importState(to, b); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range files {
+		var got bytes.Buffer
+		if err := json.Compact(&got, readFile(t, to+name)); err != nil || got.String() != data {
+			t.Errorf("%s imported as %s", name, got.String())
+		}
+	}
+	if _, err := os.Stat(to + manifestFile); !os.IsNotExist(err) {
+		t.Error("manifest was imported")
+	}
+
+	runs, err := listTrash(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || len(runs[0].Paths) != 1 || runs[0].Paths[0] != quizFile {
+		t.Errorf("replaced files not in the trash: %+v", runs)
+	}
+}
+
+func TestStateImportRejectsUnknownFiles(t *testing.T) {
+	b := stateBundle{Version: 1, Files: map[string]json.RawMessage{"../evil": []byte(`{}`)}}
+	if err := importState(withSlash(t.TempDir()), b); err == nil {
+		t.Error("imported a file outside the state")
+	}
+}
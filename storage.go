@@ -0,0 +1,57 @@
+package main
+
+import "os"
+
+// Why storage stopped taking writes.
+const (
+	storageFull     = "the disk is full"
+	storageReadOnly = "the storage is read-only"
+)
+
+// isStorageError reports whether err is a write refused because the
+// storage is full or read-only. A run that meets one stops starting work
+// and keeps what it stored, rather than failing; other errors fail just
+// the comic at hand.
+func isStorageError(err error) bool {
+	return storageProblem(err) != ""
+}
+
+// storageProblem says why storage refused err's write, if it is full or
+// read-only, and is empty otherwise.
+func storageProblem(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return errnoProblem(err)
+}
+
+// describeStorageError is the reason a run stopped early.
+func describeStorageError(err error) string {
+	if why := storageProblem(err); why != "" {
+		return why
+	}
+
+	return err.Error()
+}
+
+// checkWritable tries a write into the database before a run starts, so
+// storage that is read-only, or too full for even that, is found before
+// any work is done.
+func checkWritable(dbPath string) error {
+	f, err := os.CreateTemp(dbPath, ".write-check-*.tmp")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	_, err = f.Write(make([]byte, 4096))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	os.Remove(name)
+
+	return err
+}
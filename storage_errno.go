@@ -0,0 +1,31 @@
+//go:build !plan9
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// storageErrnos are the errors of storage that is full or read-only, with
+// more that only some systems report in storageErrnosOS.
+var storageErrnos = map[syscall.Errno]string{
+	syscall.ENOSPC: storageFull,
+	syscall.EDQUOT: storageFull,
+	syscall.EROFS:  storageReadOnly,
+}
+
+// errDiskFull is what the diskfull fault fails writes with.
+var errDiskFull error = syscall.ENOSPC
+
+func errnoProblem(err error) string {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return ""
+	}
+	if why, ok := storageErrnos[errno]; ok {
+		return why
+	}
+
+	return storageErrnosOS[errno]
+}
@@ -0,0 +1,7 @@
+//go:build !windows && !plan9
+
+package main
+
+import "syscall"
+
+var storageErrnosOS = map[syscall.Errno]string{}
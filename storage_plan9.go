@@ -0,0 +1,18 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Plan 9 reports errors as text. Only the diskfull fault's is known, so
+// syncs there fail on full storage rather than stop early.
+var errDiskFull = errors.New("file system full")
+
+func errnoProblem(err error) string {
+	if strings.Contains(err.Error(), errDiskFull.Error()) {
+		return storageFull
+	}
+
+	return ""
+}
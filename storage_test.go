@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestStorageProblem(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{&os.PathError{Op: "write", Path: "1/info.0.json", Err: syscall.ENOSPC}, storageFull},
+		{fmt.Errorf("saving: %w", &os.PathError{Op: "open", Path: "db", Err: syscall.EROFS}), storageReadOnly},
+		{&os.PathError{Op: "open", Path: "db", Err: syscall.ENOENT}, ""},
+		{errors.New("connection reset"), ""},
+	}
+	for _, c := range cases {
+		if got := storageProblem(c.err); got != c.want {
+			t.Errorf("storageProblem(%v) = %q, want %q", c.err, got, c.want)
+		}
+		if got := isStorageError(c.err); got != (c.want != "") {
+			t.Errorf("isStorageError(%v) = %v", c.err, got)
+		}
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	db := withSlash(t.TempDir())
+	if err := checkWritable(db); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(db)
+	if len(entries) != 0 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+
+	if err := checkWritable(db + "missing/"); err == nil {
+		t.Error("wrote to a missing directory")
+	}
+}
+
+func TestSyncStopsWhenDiskFull(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range fakexkcd.Corpus(8)[3:] {
+		srv.Add(c)
+	}
+	diskFullRate = 1
+	defer func() { diskFullRate = 0 }()
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatalf("sync failed instead of stopping early: %v", err)
+	}
+	if res.partial == nil || describeStorageError(res.partial) != storageFull {
+		t.Fatalf("partial = %v, want a full disk", res.partial)
+	}
+	// Only the downloads already running when the disk filled are tried.
+	if res.attempted > 2 || len(res.added) != 0 {
+		t.Errorf("attempted %d and added %v after the disk filled", res.attempted, res.added)
+	}
+	if !(&notifier{url: "http://example.com/hook"}).due(res, nil) {
+		t.Error("a partial run isn't reported")
+	}
+
+	// What was stored before is kept and served.
+	nums, err := storedComics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(nums, []int{1, 2, 3}) {
+		t.Errorf("stored %v, want 1-3", nums)
+	}
+	ts := httptest.NewServer((&server{dbPath: db}).routes())
+	defer ts.Close()
+	comics := fakexkcd.Corpus(3)
+	if status, body := get(t, ts.URL+"/comic/2"); status != http.StatusOK || !bytes.Contains(body, []byte(comics[1].Alt)) {
+		t.Errorf("comic 2: status %d", status)
+	}
+	if status, body := get(t, ts.URL+"/img/2"); status != http.StatusOK || !bytes.Equal(body, comics[1].Image) {
+		t.Errorf("image 2: status %d, %d bytes", status, len(body))
+	}
+
+	// The next run with room picks up the rest.
+	diskFullRate = 0
+	res, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.partial != nil || len(res.added) != 5 {
+		t.Errorf("partial %v, added %v, want the 5 left", res.partial, res.added)
+	}
+}
+
+func TestSyncGoesOnAfterOtherWriteErrors(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(4))
+	db := tempDB(t)
+	if err := os.MkdirAll(db, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Comic 2's directory can't be made, but not for want of room.
+	if err := os.Symlink(db+"nowhere", db+"2"); err != nil {
+		t.Skip(err)
+	}
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.partial != nil {
+		t.Errorf("stopped early over %v", res.partial)
+	}
+	if res.failed != 1 || !equalInts(res.added, []int{1, 3, 4}) {
+		t.Errorf("failed %d, added %v; want 1 failed and 1, 3 and 4 added", res.failed, res.added)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import "syscall"
+
+// Windows reports full and write protected disks with errors of its own.
+var storageErrnosOS = map[syscall.Errno]string{
+	19:  storageReadOnly, // ERROR_WRITE_PROTECT
+	39:  storageFull,     // ERROR_HANDLE_DISK_FULL
+	112: storageFull,     // ERROR_DISK_FULL
+}
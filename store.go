@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// localComic is a comic as stored in the database.
+type localComic struct {
+	Comic
+	ImgPath string
+
+	// Set when the image lives remotely in a hybrid database, and ImgPath
+	// is where fetchImage puts it.
+	offloaded bool
+	dbPath    string
+
+	// Only filled in where tags are shown or searched.
+	tags []string
+}
+
+// readComic loads a mirrored comic. The error satisfies os.IsNotExist when
+// the comic hasn't been downloaded.
+func readComic(dbPath string, num int) (localComic, error) {
+	item := strconv.Itoa(num)
+	dir := dbPath + item + "/"
+	c := localComic{Comic: Comic{Num: num}}
+
+	_, err := os.Stat(dir)
+	if err != nil {
+		return c, err
+	}
+
+	// Comics stored by older versions have no metadata file until the next
+	// sync backfills it.
+	info, err := os.ReadFile(dir + item + "-info.json")
+	if err == nil {
+		err = json.Unmarshal(info, &c.Comic)
+		c.raw = info
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return c, err
+	}
+
+	alt, err := os.ReadFile(dir + item + "-alt")
+	if err != nil && !os.IsNotExist(err) {
+		return c, err
+	}
+	c.Alt = string(alt)
+
+	transcript, err := os.ReadFile(dir + item + "-transcript")
+	if err != nil && !os.IsNotExist(err) {
+		return c, err
+	}
+	c.Transcript = string(transcript)
+
+	// Comics without an image are still worth showing.
+	c.ImgPath, _ = comicImagePath(dbPath, num)
+	if c.ImgPath == "" {
+		h, err := loadHybrid(dbPath)
+		if err != nil {
+			return c, err
+		}
+		if h != nil && h.offloaded(dbPath, num) {
+			c.ImgPath, c.offloaded, c.dbPath = dir+h.Images[num], true, dbPath
+		}
+	}
+
+	return c, nil
+}
+
+// fetchImage makes sure the image is at ImgPath, fetching it from the
+// remote store of a hybrid database if needed.
+func (c *localComic) fetchImage() error {
+	if !c.offloaded {
+		return nil
+	}
+
+	path, err := fetchImage(c.dbPath, c.Num)
+	if err != nil {
+		return err
+	}
+	c.ImgPath, c.offloaded = path, false
+
+	return nil
+}
+
+// ensureComic loads a comic, downloading it first if it isn't mirrored.
+func ensureComic(dbPath string, num int) (localComic, error) {
+	c, err := readComic(dbPath, num)
+	if !os.IsNotExist(err) {
+		return c, err
+	}
+	if offline {
+		return c, fmt.Errorf("comic %d is not mirrored and %v", num, errOffline)
+	}
+
+	ex, err := loadExclusions(dbPath)
+	if err != nil {
+		return c, err
+	}
+	if e, ok := ex[num]; ok {
+		return c, fmt.Errorf("comic %d is excluded from this database: %s", num, e.Reason)
+	}
+
+	err = os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		return c, err
+	}
+
+	// A run writing the database may be storing this comic right now.
+	m, unlock, err := recoverManifest(dbPath)
+	if err == errLocked {
+		return c, fmt.Errorf("comic %d is not mirrored yet, and %v", num, err)
+	}
+	if err != nil {
+		return c, err
+	}
+	defer unlock()
+
+	src, err := loadSource(dbPath)
+	if err != nil {
+		return c, err
+	}
+
+	err = fetchComic(src, strconv.Itoa(num), dbPath, m)
+	if err != nil {
+		// Saving removes whatever was written of the comic.
+		m.save(dbPath)
+		return c, err
+	}
+
+	err = updateManifest(dbPath, m)
+	if err != nil {
+		return c, err
+	}
+
+	return readComic(dbPath, num)
+}
+
+// storedComics lists the numbers of all mirrored comics in ascending order.
+func storedComics(dbPath string) ([]int, error) {
+	entries, err := os.ReadDir(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var nums []int
+	for _, e := range entries {
+		num, err := strconv.Atoi(e.Name())
+		if err == nil && e.IsDir() {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+
+	return nums, nil
+}
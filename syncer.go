@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kinds of syncEvent.
+const (
+	eventSyncStart   = "sync-start"
+	eventQueued      = "queued"
+	eventComicStart  = "comic-start"
+	eventComicDone   = "comic-done"
+	eventComicFailed = "comic-failed"
+	eventSyncEnd     = "sync-end"
+)
+
+// syncEvent is progress reported by a sync run.
+type syncEvent struct {
+	Kind string    `json:"kind"`
+	Time time.Time `json:"time"`
+	// The comic of comic events.
+	Comic int `json:"comic,omitempty"`
+	// How long a comic took.
+	Took time.Duration `json:"took,omitempty"`
+	// Comics to download, for queued.
+	Total int `json:"total,omitempty"`
+	// What a run stored, for sync-end.
+	Added []int  `json:"added,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Set on sync-end if the run stopped early as the database couldn't
+	// be written to; Error says why.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// How many events a subscriber may fall behind by before it misses some.
+const subscriberBuffer = 256
+
+// syncer keeps a database synced in the background of a long running
+// process, every interval, and tells subscribers how it goes.
+type syncer struct {
+	dbPath string
+	opts   syncOptions
+	every  time.Duration
+	// Held while syncing, when several syncers must take turns.
+	turn *sync.Mutex
+
+	mu      sync.Mutex
+	subs    map[int]chan syncEvent
+	nextSub int
+	quit    chan struct{}
+	done    chan struct{}
+	health  syncerHealth
+}
+
+// syncerHealth is a snapshot of a syncer.
+type syncerHealth struct {
+	Running   bool      `json:"running"`
+	Syncing   bool      `json:"syncing"`
+	Runs      int       `json:"runs"`
+	LastStart time.Time `json:"last_start,omitempty"`
+	LastEnd   time.Time `json:"last_end,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	// Whether the last run stopped early, e.g. as the disk was full.
+	LastPartial bool `json:"last_partial,omitempty"`
+	// Of the current run, or the last one if none is running.
+	Total  int `json:"total"`
+	Done   int `json:"done"`
+	Failed int `json:"failed"`
+	Added  int `json:"added"`
+}
+
+func newSyncer(dbPath string, opts syncOptions, every time.Duration) *syncer {
+	return &syncer{dbPath: withSlash(dbPath), opts: opts, every: every, subs: make(map[int]chan syncEvent)}
+}
+
+// start syncs now and then every interval until stop.
+func (s *syncer) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.quit != nil {
+		return errors.New("syncer for " + s.dbPath + " is already running")
+	}
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+	s.health.Running = true
+
+	go s.loop(s.quit, s.done)
+
+	return nil
+}
+
+// stop ends the current sync once its downloads in flight finish, and
+// waits for it.
+func (s *syncer) stop() {
+	s.mu.Lock()
+	quit, done := s.quit, s.done
+	s.quit = nil
+	s.mu.Unlock()
+
+	if quit == nil {
+		return
+	}
+	close(quit)
+	<-done
+
+	s.mu.Lock()
+	s.health.Running = false
+	s.mu.Unlock()
+}
+
+func (s *syncer) loop(quit, done chan struct{}) {
+	defer close(done)
+
+	var tick <-chan time.Time
+	if s.every > 0 {
+		t := time.NewTicker(s.every)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		s.run(quit)
+
+		select {
+		case <-quit:
+			return
+		case <-tick:
+		}
+	}
+}
+
+// run syncs once.
+func (s *syncer) run(quit chan struct{}) {
+	if s.turn != nil {
+		s.turn.Lock()
+		defer s.turn.Unlock()
+	}
+
+	opts := s.opts
+	opts.stop = quit
+	opts.events = s.publish
+
+	s.publish(syncEvent{Kind: eventSyncStart})
+	res, err := syncDB(s.dbPath, opts)
+
+	end := syncEvent{Kind: eventSyncEnd, Added: res.added}
+	if err != nil {
+		end.Error = err.Error()
+	}
+	if res.partial != nil && err == nil {
+		end.Error, end.Partial = "stopped early as "+describeStorageError(res.partial), true
+	}
+	s.publish(end)
+}
+
+// publish updates the health snapshot with e and passes it on to
+// subscribers. Slow subscribers miss events rather than hold up the sync.
+func (s *syncer) publish(e syncEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := &s.health
+	switch e.Kind {
+	case eventSyncStart:
+		h.Syncing, h.LastStart = true, e.Time
+		h.Total, h.Done, h.Failed, h.Added = 0, 0, 0, 0
+	case eventQueued:
+		h.Total = e.Total
+	case eventComicDone:
+		h.Done++
+	case eventComicFailed:
+		h.Done++
+		h.Failed++
+	case eventSyncEnd:
+		h.Syncing, h.LastEnd, h.LastError, h.LastPartial = false, e.Time, e.Error, e.Partial
+		h.Added = len(e.Added)
+		h.Runs++
+	}
+
+	for _, ch := range s.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel of events until cancel is called.
+func (s *syncer) subscribe() (<-chan syncEvent, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextSub
+	s.nextSub++
+	ch := make(chan syncEvent, subscriberBuffer)
+	s.subs[id] = ch
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, ok := s.subs[id]; ok {
+			delete(s.subs, id)
+			close(ch)
+		}
+	}
+}
+
+func (s *syncer) snapshot() syncerHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.health
+}
+
+// comicEvent reports a download that ended.
+func comicEvent(item string, took time.Duration, err error) syncEvent {
+	num, _ := strconv.Atoi(item)
+	e := syncEvent{Kind: eventComicDone, Comic: num, Took: took}
+	if err != nil {
+		e.Kind, e.Error = eventComicFailed, err.Error()
+	}
+
+	return e
+}
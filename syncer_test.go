@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestSyncerEvents(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(5))
+	db := tempDB(t)
+
+	s := newSyncer(db, syncOptions{rateLimit: 2}, time.Hour)
+	events, cancel := s.subscribe()
+	defer cancel()
+
+	err := s.start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.start() == nil {
+		t.Error("a running syncer started again")
+	}
+
+	var kinds []string
+	var done []int
+	timeout := time.After(10 * time.Second)
+	for end := false; !end; {
+		select {
+		case e := <-events:
+			kinds = append(kinds, e.Kind)
+			switch e.Kind {
+			case eventComicDone:
+				done = append(done, e.Comic)
+			case eventComicFailed:
+				t.Errorf("comic %d failed: %s", e.Comic, e.Error)
+			case eventSyncEnd:
+				end = true
+				if e.Error != "" || len(e.Added) != 5 {
+					t.Errorf("sync ended with %v added and error %q", e.Added, e.Error)
+				}
+			}
+		case <-timeout:
+			t.Fatalf("no sync-end after %v", kinds)
+		}
+	}
+	s.stop()
+
+	if kinds[0] != eventSyncStart || kinds[1] != eventQueued {
+		t.Errorf("events began %v", kinds)
+	}
+	if len(done) != 5 {
+		t.Errorf("done comics = %v, want 5", done)
+	}
+
+	h := s.snapshot()
+	if h.Running || h.Syncing || h.Runs != 1 || h.Total != 5 || h.Done != 5 || h.Failed != 0 || h.Added != 5 {
+		t.Errorf("health = %+v", h)
+	}
+}
+
+func TestSyncerStop(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(20))
+	db := tempDB(t)
+
+	s := newSyncer(db, syncOptions{rateLimit: 1}, 0)
+	events, cancel := s.subscribe()
+	defer cancel()
+
+	s.start()
+	for e := range events {
+		if e.Kind == eventComicDone {
+			break
+		}
+	}
+	s.stop()
+
+	h := s.snapshot()
+	if h.Runs != 1 || h.Syncing {
+		t.Errorf("health = %+v", h)
+	}
+	if h.Done >= 20 {
+		t.Errorf("stop let all %d downloads run", h.Done)
+	}
+
+	// Nothing more is stored once stopped.
+	before, _ := storedComics(db)
+	time.Sleep(50 * time.Millisecond)
+	after, _ := storedComics(db)
+	if len(after) != len(before) {
+		t.Error("the syncer kept downloading after stop")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// table is what listing commands print: named columns, one row per item.
+type table struct {
+	columns []string
+	rows    [][]string
+}
+
+func newTable(columns ...string) *table {
+	return &table{columns: columns}
+}
+
+// add appends a row with a cell for each column, in order.
+func (t *table) add(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// tableOptions are the flags every listing command shares.
+type tableOptions struct {
+	columns  string
+	sort     string
+	noHeader bool
+	limit    int
+	offset   int
+}
+
+func tableFlags(fs *flag.FlagSet) *tableOptions {
+	o := &tableOptions{}
+	fs.StringVar(&o.columns, "columns", "", "Comma separated columns to print, in order; empty prints all")
+	fs.StringVar(&o.sort, "sort", "", "Column to sort by; prefix with - to reverse")
+	fs.BoolVar(&o.noHeader, "no-header", false, "Leave out the header line")
+	fs.IntVar(&o.limit, "limit", 0, "Print at most this many rows; 0 prints all")
+	fs.IntVar(&o.offset, "offset", 0, "Skip this many rows, after sorting")
+
+	return o
+}
+
+// print writes t as aligned columns. Cells are kept to one line so each
+// row can be read by line-based tools.
+func (o *tableOptions) print(w io.Writer, t *table) error {
+	idx, err := t.index(o.columns)
+	if err != nil {
+		return err
+	}
+	rows, err := o.pick(t)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	line := func(cells []string) {
+		out := make([]string, len(idx))
+		for i, j := range idx {
+			out[i] = oneLine(cells[j])
+		}
+		fmt.Fprintln(tw, strings.Join(out, "\t"))
+	}
+
+	if !o.noHeader {
+		line(t.columns)
+	}
+	for _, r := range rows {
+		line(t.rows[r])
+	}
+
+	return tw.Flush()
+}
+
+// pick returns the positions of the rows print would list, in the order
+// it would list them: sorted by -sort, then cut to -offset and -limit.
+// Commands printing something other than the table, like JSON, take
+// their items in this order.
+func (o *tableOptions) pick(t *table) ([]int, error) {
+	rows := make([]int, len(t.rows))
+	for i := range rows {
+		rows[i] = i
+	}
+
+	if o.sort != "" {
+		less, err := t.less(o.sort)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+	}
+
+	lo, hi := o.window(len(rows))
+
+	return rows[lo:hi], nil
+}
+
+// window returns the bounds of the rows -offset and -limit pick out of n.
+func (o *tableOptions) window(n int) (int, int) {
+	lo := o.offset
+	if lo < 0 {
+		lo = 0
+	}
+	if lo > n {
+		lo = n
+	}
+	hi := n
+	if o.limit > 0 && lo+o.limit < hi {
+		hi = lo + o.limit
+	}
+
+	return lo, hi
+}
+
+// index resolves a -columns list to column positions.
+func (t *table) index(columns string) ([]int, error) {
+	if columns == "" {
+		idx := make([]int, len(t.columns))
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx, nil
+	}
+
+	var idx []int
+	for _, name := range strings.Split(columns, ",") {
+		i, err := t.column(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		idx = append(idx, i)
+	}
+
+	return idx, nil
+}
+
+func (t *table) column(name string) (int, error) {
+	for i, c := range t.columns {
+		if c == name {
+			return i, nil
+		}
+	}
+
+	return 0, errors.New("unknown column " + name + "; choose from " + strings.Join(t.columns, ", "))
+}
+
+// less orders rows by a column, numerically if both cells are numbers.
+// A leading - reverses the order.
+func (t *table) less(key string) (func(i, j int) bool, error) {
+	desc := strings.HasPrefix(key, "-")
+	col, err := t.column(strings.TrimPrefix(key, "-"))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(i, j int) bool {
+		a, b := t.rows[i][col], t.rows[j][col]
+		if desc {
+			a, b = b, a
+		}
+
+		x, errA := strconv.ParseFloat(a, 64)
+		y, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			return x < y
+		}
+
+		return a < b
+	}, nil
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testTable() *table {
+	t := newTable("num", "title", "size")
+	t.add("10", "Pi Equals", "2048")
+	t.add("9", "Pet", "512")
+	t.add("100", "Family Circus", "4096")
+
+	return t
+}
+
+func TestTablePrint(t *testing.T) {
+	tests := []struct {
+		opts tableOptions
+		want string
+	}{
+		{tableOptions{}, "num  title          size\n" +
+			"10   Pi Equals      2048\n" +
+			"9    Pet            512\n" +
+			"100  Family Circus  4096\n"},
+		{tableOptions{sort: "num", noHeader: true}, "9    Pet            512\n" +
+			"10   Pi Equals      2048\n" +
+			"100  Family Circus  4096\n"},
+		{tableOptions{columns: "size,num", sort: "-size"}, "size  num\n" +
+			"4096  100\n" +
+			"2048  10\n" +
+			"512   9\n"},
+		{tableOptions{columns: "title", sort: "title", noHeader: true}, "Family Circus\nPet\nPi Equals\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := tt.opts.print(&buf, testTable())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%+v printed\n%s\nwant\n%s", tt.opts, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestTableUnknownColumn(t *testing.T) {
+	for _, opts := range []tableOptions{{columns: "num,nope"}, {sort: "-nope"}} {
+		var buf bytes.Buffer
+		if err := opts.print(&buf, testTable()); err == nil {
+			t.Errorf("%+v: no error", opts)
+		}
+	}
+}
+
+func TestTableOneLine(t *testing.T) {
+	tbl := newTable("alt")
+	tbl.add("two\nlines\tand a tab")
+
+	var buf bytes.Buffer
+	err := (&tableOptions{noHeader: true}).print(&buf, tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "two lines and a tab\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTableWindow(t *testing.T) {
+	tests := []struct {
+		opts tableOptions
+		want string
+	}{
+		{tableOptions{noHeader: true, limit: 2}, "10  Pi Equals  2048\n9   Pet        512\n"},
+		{tableOptions{noHeader: true, sort: "num", offset: 1, limit: 1}, "10  Pi Equals  2048\n"},
+		{tableOptions{noHeader: true, offset: 5}, ""},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := tt.opts.print(&buf, testTable())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%+v printed\n%q\nwant\n%q", tt.opts, buf.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// tagsFile holds the user's tags of each comic.
+const tagsFile = "tags.json"
+
+// comicTags are the tags of a database's comics by number, each list
+// sorted.
+type comicTags map[int][]string
+
+func loadTags(dbPath string) (comicTags, error) {
+	tags := make(comicTags)
+
+	data, err := os.ReadFile(dbPath + tagsFile)
+	if os.IsNotExist(err) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &tags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", dbPath+tagsFile, err)
+	}
+
+	return tags, nil
+}
+
+func (t comicTags) save(dbPath string) error {
+	data, err := json.MarshalIndent(t, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(dbPath+tagsFile, data)
+}
+
+// validTag keeps tags to one word that queries like tag:name can find.
+func validTag(tag string) error {
+	if tag == "" || strings.ContainsAny(tag, " \t\n\",") {
+		return fmt.Errorf("invalid tag %q: tags are single words without quotes or commas", tag)
+	}
+
+	return nil
+}
+
+// hasTag reports whether tags holds tag.
+func hasTag(tags []string, tag string) bool {
+	for _, have := range tags {
+		if have == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// add tags a comic, reporting whether it wasn't already.
+func (t comicTags) add(num int, tag string) bool {
+	for _, have := range t[num] {
+		if have == tag {
+			return false
+		}
+	}
+	t[num] = append(t[num], tag)
+	sort.Strings(t[num])
+
+	return true
+}
+
+// remove untags a comic, reporting whether it was tagged.
+func (t comicTags) remove(num int, tag string) bool {
+	for i, have := range t[num] {
+		if have == tag {
+			t[num] = append(t[num][:i], t[num][i+1:]...)
+			if len(t[num]) == 0 {
+				delete(t, num)
+			}
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// colorMode is never, auto or always, as set by -color. Auto colours
+// terminals only, and not at all if NO_COLOR is set.
+var colorMode = "auto"
+
+// useEmoji puts a marker before statuses, as set by -emoji.
+var useEmoji bool
+
+// A tone says how a status line went.
+type tone int
+
+const (
+	good tone = iota
+	warn
+	bad
+)
+
+// ANSI colours and emoji markers for each tone.
+var tones = map[tone]struct{ color, emoji string }{
+	good: {"\x1b[32m", "✅"},
+	warn: {"\x1b[33m", "⚠️"},
+	bad:  {"\x1b[31m", "❌"},
+}
+
+// colorFlag checks -color against the modes it knows.
+type colorFlag struct{}
+
+func (colorFlag) String() string { return "auto" }
+
+func (colorFlag) Set(s string) error {
+	switch s {
+	case "never", "auto", "always":
+		colorMode = s
+		return nil
+	}
+
+	return errors.New("must be never, auto or always")
+}
+
+// colorful reports whether to colour output going to f.
+func colorful(f *os.File) bool {
+	switch colorMode {
+	case "never":
+		return false
+	case "always":
+		return true
+	}
+
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return !noColor && os.Getenv("TERM") != "dumb" && isTerminal(f)
+}
+
+// paint dresses a status line for f in its tone's colour and marker.
+func paint(f *os.File, t tone, s string) string {
+	if useEmoji {
+		s = tones[t].emoji + " " + s
+	}
+	if colorful(f) {
+		color := tones[t].color
+		if c, ok := themeTones[t]; ok {
+			color = c
+		}
+		s = color + s + "\x1b[0m"
+	}
+
+	return s
+}
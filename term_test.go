@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPaint(t *testing.T) {
+	defer func(m string, e bool) { colorMode, useEmoji = m, e }(colorMode, useEmoji)
+
+	// Output to a file is plain unless colour is forced.
+	f, err := os.Create(t.TempDir() + "/out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, c := range []struct {
+		mode  string
+		emoji bool
+		want  string
+	}{
+		{"auto", false, "done"},
+		{"never", true, "✅ done"},
+		{"always", false, "\x1b[32mdone\x1b[0m"},
+		{"always", true, "\x1b[32m✅ done\x1b[0m"},
+	} {
+		colorMode, useEmoji = c.mode, c.emoji
+		if got := paint(f, good, "done"); got != c.want {
+			t.Errorf("%s, emoji %v: got %q, want %q", c.mode, c.emoji, got, c.want)
+		}
+	}
+
+	if (colorFlag{}).Set("sometimes") == nil {
+		t.Error("-color accepted sometimes")
+	}
+}
+
+func TestNoColor(t *testing.T) {
+	defer func(m string) { colorMode = m }(colorMode)
+	colorMode = "auto"
+	t.Setenv("NO_COLOR", "")
+
+	if colorful(os.Stdout) {
+		t.Error("coloured despite NO_COLOR")
+	}
+}
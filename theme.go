@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A theme colours the web UI and the status lines of the CLI. It has a
+// light and a dark variant, or just one of them. Themes are defined in
+// the config file, e.g.
+//
+//	{
+//		"theme": "solarized",
+//		"themes": {
+//			"solarized": {
+//				"light": {"background": "#fdf6e3", "text": "#657b83", "link": "#268bd2"},
+//				"dark": {"background": "#002b36", "text": "#839496", "link": "#268bd2", "good": "#859900"}
+//			}
+//		}
+//	}
+type theme struct {
+	Light *palette `json:"light,omitempty"`
+	Dark  *palette `json:"dark,omitempty"`
+}
+
+// palette colours are CSS hex colours or names. Good, warn and bad colour
+// statuses on terminals, which only know the ANSI names: black, red,
+// green, yellow, blue, magenta, cyan, white and their bright- forms.
+// Colours left out keep the usual look.
+type palette struct {
+	Background string `json:"background,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Link       string `json:"link,omitempty"`
+	Good       string `json:"good,omitempty"`
+	Warn       string `json:"warn,omitempty"`
+	Bad        string `json:"bad,omitempty"`
+}
+
+// activeTheme is the theme in use; nil keeps the usual look.
+var activeTheme *theme
+
+// themeVariant picks light or dark; auto lets browsers follow their
+// preference, and terminals go by COLORFGBG.
+var themeVariant = "auto"
+
+var ansiColors = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// Anything else could break out of the CSS it is put in.
+var cssColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z][a-zA-Z-]*)$`)
+
+// themeFlag picks a theme from the config file, as set by -theme.
+type themeFlag struct{}
+
+func (themeFlag) String() string { return "" }
+
+func (themeFlag) Set(s string) error { return useTheme(s) }
+
+// variantFlag sets -theme-variant.
+type variantFlag struct{}
+
+func (variantFlag) String() string { return "auto" }
+
+func (variantFlag) Set(s string) error { return setThemeVariant(s) }
+
+func setThemeVariant(s string) error {
+	switch s {
+	case "light", "dark", "auto":
+		themeVariant = s
+		return applyTheme()
+	}
+
+	return errors.New("must be light, dark or auto")
+}
+
+// useTheme makes the named theme of the config file the active one.
+func useTheme(name string) error {
+	t, ok := userConf.Themes[name]
+	if !ok {
+		names := make([]string, 0, len(userConf.Themes))
+		for n := range userConf.Themes {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("no theme %q; the config file defines none", name)
+		}
+		return fmt.Errorf("no theme %q; the config file defines %s", name, strings.Join(names, ", "))
+	}
+	if t == nil || (t.Light == nil && t.Dark == nil) {
+		return fmt.Errorf("theme %q has neither a light nor a dark variant", name)
+	}
+
+	for _, p := range []*palette{t.Light, t.Dark} {
+		if p == nil {
+			continue
+		}
+		for _, c := range []string{p.Background, p.Text, p.Link, p.Good, p.Warn, p.Bad} {
+			if c != "" && !cssColor.MatchString(c) {
+				return fmt.Errorf("theme %q: invalid colour %q", name, c)
+			}
+		}
+		for _, c := range []string{p.Good, p.Warn, p.Bad} {
+			if _, err := ansiColor(c); err != nil {
+				return fmt.Errorf("theme %q: %v", name, err)
+			}
+		}
+	}
+
+	activeTheme = t
+	return applyTheme()
+}
+
+// variant returns the palette for dark or light backgrounds, or the
+// only one the theme has.
+func (t *theme) variant(dark bool) *palette {
+	if (dark && t.Dark != nil) || t.Light == nil {
+		return t.Dark
+	}
+
+	return t.Light
+}
+
+// darkTerminal guesses the terminal's background from COLORFGBG, which
+// some terminals set to e.g. "15;0" for white on black.
+func darkTerminal() bool {
+	switch themeVariant {
+	case "dark":
+		return true
+	case "light":
+		return false
+	}
+
+	v := os.Getenv("COLORFGBG")
+	bg, err := strconv.Atoi(v[strings.LastIndex(v, ";")+1:])
+	return err == nil && (bg < 7 || bg == 8)
+}
+
+// Status colours of the active theme, for terminals.
+var themeTones = make(map[tone]string)
+
+// applyTheme colours statuses with the active theme.
+func applyTheme() error {
+	themeTones = make(map[tone]string)
+	if activeTheme == nil {
+		return nil
+	}
+
+	p := activeTheme.variant(darkTerminal())
+	for t, c := range map[tone]string{good: p.Good, warn: p.Warn, bad: p.Bad} {
+		code, err := ansiColor(c)
+		if err != nil {
+			return err
+		}
+		if code != "" {
+			themeTones[t] = code
+		}
+	}
+
+	return nil
+}
+
+// ansiColor turns a colour name or #rrggbb into a terminal escape.
+func ansiColor(c string) (string, error) {
+	if c == "" {
+		return "", nil
+	}
+
+	if strings.HasPrefix(c, "#") && len(c) == 7 {
+		v, err := strconv.ParseUint(c[1:], 16, 32)
+		if err == nil {
+			return fmt.Sprintf("\x1b[38;2;%d;%d;%dm", v>>16, v>>8&0xff, v&0xff), nil
+		}
+	}
+
+	base, bright := strings.TrimPrefix(c, "bright-"), 30
+	if base != c {
+		bright = 90
+	}
+	for i, name := range ansiColors {
+		if strings.EqualFold(base, name) {
+			return fmt.Sprintf("\x1b[%dm", bright+i), nil
+		}
+	}
+
+	return "", fmt.Errorf("terminals can't show colour %q; use #rrggbb or an ANSI colour name", c)
+}
+
+// themeCSS styles web pages with the active theme. Browsers pick the
+// dark variant if they prefer dark pages, unless a variant was chosen.
+func themeCSS() template.CSS {
+	if activeTheme == nil {
+		return ""
+	}
+
+	rules := func(p *palette) string {
+		var b strings.Builder
+		if p.Background != "" || p.Text != "" {
+			b.WriteString("body {")
+			if p.Background != "" {
+				b.WriteString(" background: " + p.Background + ";")
+			}
+			if p.Text != "" {
+				b.WriteString(" color: " + p.Text + ";")
+			}
+			b.WriteString(" }\n")
+		}
+		if p.Link != "" {
+			b.WriteString("a { color: " + p.Link + "; }\n")
+		}
+		return b.String()
+	}
+
+	t := activeTheme
+	switch {
+	case themeVariant == "light" || themeVariant == "dark":
+		return template.CSS(rules(t.variant(themeVariant == "dark")))
+	case t.Light != nil && t.Dark != nil:
+		return template.CSS(rules(t.Light) + "@media (prefers-color-scheme: dark) {\n" + rules(t.Dark) + "}\n")
+	}
+
+	return template.CSS(rules(t.variant(false)))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestThemes(t *testing.T) {
+	t.Cleanup(func() {
+		userConf, activeTheme, themeVariant = &userConfig{}, nil, "auto"
+		applyTheme()
+	})
+	path := t.TempDir() + "/config.json"
+	t.Setenv("XKCDDB_CONFIG", path)
+	t.Setenv("COLORFGBG", "15;0")
+
+	os.WriteFile(path, []byte(`{
+		"theme": "night",
+		"themes": {
+			"night": {
+				"light": {"background": "#fdf6e3", "link": "#268bd2"},
+				"dark": {"background": "#002b36", "good": "bright-green", "bad": "#dc322f"}
+			},
+			"evil": {"dark": {"background": "red; } body { display: none"}}
+		}
+	}`), 0644)
+	if err := loadUserConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// COLORFGBG says the terminal is dark.
+	defer func(m string) { colorMode = m }(colorMode)
+	colorMode = "always"
+	f, err := os.Create(t.TempDir() + "/out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for tn, want := range map[tone]string{good: "\x1b[92m", warn: "\x1b[33m", bad: "\x1b[38;2;220;50;47m"} {
+		if got := paint(f, tn, "x"); got != want+"x\x1b[0m" {
+			t.Errorf("tone %d: got %q", tn, got)
+		}
+	}
+
+	// Browsers choose the variant.
+	ts, _ := testServer(t, fakexkcd.Corpus(1))
+	_, body := get(t, ts.URL+"/")
+	if !strings.Contains(string(body), "background: #fdf6e3") || !strings.Contains(string(body), "@media (prefers-color-scheme: dark) {\nbody { background: #002b36; }") {
+		t.Errorf("page not themed:\n%s", body)
+	}
+
+	if err := (variantFlag{}).Set("light"); err != nil {
+		t.Fatal(err)
+	}
+	if got := paint(f, good, "x"); got != "\x1b[32mx\x1b[0m" {
+		t.Errorf("light variant: got %q", got)
+	}
+	if css := string(themeCSS()); strings.Contains(css, "#002b36") {
+		t.Errorf("light variant has dark CSS: %s", css)
+	}
+
+	if err := useTheme("evil"); err == nil {
+		t.Error("accepted a colour that breaks out of CSS")
+	}
+	if err := useTheme("day"); err == nil || !strings.Contains(err.Error(), "evil, night") {
+		t.Errorf("unknown theme: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+)
+
+// tracked is the shared client's transport. What the command line sets up
+// once, like faults, offline mode and tracing, goes under it as next;
+// syncs add and remove trackers on top while other goroutines use the
+// client.
+var tracked = &trackedTransport{}
+
+// trackedTransport passes each request through the trackers registered
+// when it starts, the latest outermost, and then next.
+type trackedTransport struct {
+	// Only set at startup; nil is http.DefaultTransport.
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	trackers []*tracker
+}
+
+type tracker struct {
+	wrap func(http.RoundTripper) http.RoundTripper
+}
+
+// track wraps requests with wrap until the returned function is called.
+func (t *trackedTransport) track(wrap func(http.RoundTripper) http.RoundTripper) func() {
+	k := &tracker{wrap: wrap}
+
+	t.mu.Lock()
+	t.trackers = append(t.trackers, k)
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			kept := make([]*tracker, 0, len(t.trackers))
+			for _, other := range t.trackers {
+				if other != k {
+					kept = append(kept, other)
+				}
+			}
+			t.trackers = kept
+		})
+	}
+}
+
+func (t *trackedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := t.next
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	t.mu.Lock()
+	for _, k := range t.trackers {
+		rt = k.wrap(rt)
+	}
+	t.mu.Unlock()
+
+	return rt.RoundTrip(req)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// trashDir holds what cleanup removed, in one directory per run, laid out
+// like the database so it can be put back.
+const trashDir = ".trash"
+
+// Runs older than this are emptied from the trash as new ones arrive.
+const trashRetention = 30 * 24 * time.Hour
+
+// Trash runs are named after when they happened.
+const trashLayout = "20060102-150405.000000000"
+
+// trash lists, restores and empties the trash.
+func trash(args []string) {
+	fs := flag.NewFlagSet("trash", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	olderThan := fs.Duration("older-than", 0, "With empty, only remove runs older than this, e.g. 168h")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db trash [flags] list|restore run|empty")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+
+	var err error
+	switch {
+	case fs.Arg(0) == "list" && fs.NArg() == 1:
+		var runs []trashRun
+		runs, err = listTrash(*dbPath)
+		for _, r := range runs {
+			fmt.Printf("%s  %s\n", r.ID, r.Time.Local().Format("2006-01-02 15:04"))
+			for _, p := range r.Paths {
+				fmt.Println("  " + p)
+			}
+		}
+	case fs.Arg(0) == "restore" && fs.NArg() == 2:
+		a := startAudit(*dbPath, "trash", args)
+		err = restoreTrash(*dbPath, fs.Arg(1))
+		if err == nil {
+			a.end("Restored trash run " + fs.Arg(1))
+		}
+	case fs.Arg(0) == "empty" && fs.NArg() == 1:
+		var runs []trashRun
+		runs, err = listTrash(*dbPath)
+		if err != nil {
+			break
+		}
+
+		files := 0
+		runs = expiredRuns(runs, *olderThan)
+		for _, r := range runs {
+			fmt.Printf("%s  %d files\n", r.ID, len(r.Paths))
+			files += len(r.Paths)
+		}
+		if len(runs) == 0 {
+			fmt.Println("Nothing to remove")
+			break
+		}
+		if !confirm(fmt.Sprintf("Permanently remove %d files in %d runs?", files, len(runs))) {
+			os.Exit(1)
+		}
+
+		a := startAudit(*dbPath, "trash", args)
+
+		var n int
+		n, err = emptyTrash(*dbPath, *olderThan)
+		if err == nil {
+			outcome := fmt.Sprintf("Removed %d runs from the trash", n)
+			fmt.Println(outcome)
+			a.end(outcome)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// trashRun is what one run moved to the trash.
+type trashRun struct {
+	ID   string
+	Time time.Time
+	// Files as they were in the database.
+	Paths []string
+}
+
+// moveToTrash moves paths, which are inside dbPath, into a new run in the
+// trash, and returns its ID.
+func moveToTrash(dbPath string, paths []string) (string, error) {
+	_, err := emptyTrash(dbPath, trashRetention)
+	if err != nil {
+		return "", err
+	}
+
+	id := time.Now().UTC().Format(trashLayout)
+	run := dbPath + trashDir + "/" + id + "/"
+
+	for _, p := range paths {
+		dst := run + strings.TrimPrefix(p, dbPath)
+		err := os.MkdirAll(filepath.Dir(dst), 0755)
+		if err != nil {
+			return id, err
+		}
+
+		err = os.Rename(p, dst)
+		// Already moved with a directory above it.
+		if err != nil && !os.IsNotExist(err) {
+			return id, err
+		}
+	}
+
+	return id, nil
+}
+
+// listTrash returns the runs in the trash, oldest first.
+func listTrash(dbPath string) ([]trashRun, error) {
+	entries, err := os.ReadDir(dbPath + trashDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []trashRun
+	for _, e := range entries {
+		t, err := time.Parse(trashLayout, e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+
+		r := trashRun{ID: e.Name(), Time: t}
+		root := dbPath + trashDir + "/" + e.Name()
+		err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				rel, _ := filepath.Rel(root, path)
+				r.Paths = append(r.Paths, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Time.Before(runs[j].Time) })
+	return runs, nil
+}
+
+// restoreTrash puts a run's files back where they were. Nothing is
+// overwritten; files that have since come back stop the restore.
+func restoreTrash(dbPath, id string) error {
+	if _, err := time.Parse(trashLayout, id); err != nil {
+		return errors.New("no such trash run: " + id)
+	}
+
+	runs, err := listTrash(dbPath)
+	if err != nil {
+		return err
+	}
+
+	var run *trashRun
+	for i := range runs {
+		if runs[i].ID == id {
+			run = &runs[i]
+		}
+	}
+	if run == nil {
+		return errors.New("no such trash run: " + id)
+	}
+
+	root := dbPath + trashDir + "/" + id + "/"
+	for _, p := range run.Paths {
+		if _, err := os.Stat(dbPath + p); err == nil {
+			return errors.New(p + " exists; move it away to restore")
+		}
+	}
+
+	for _, p := range run.Paths {
+		err := os.MkdirAll(filepath.Dir(dbPath+p), 0755)
+		if err == nil {
+			err = os.Rename(root+p, dbPath+p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.RemoveAll(root)
+	if err != nil {
+		return err
+	}
+
+	// Restored comics go back into the manifest.
+	_, err = fsckDB(dbPath, true)
+	return err
+}
+
+// emptyTrash removes runs older than olderThan, or all of them if it is
+// zero, and reports how many.
+func emptyTrash(dbPath string, olderThan time.Duration) (int, error) {
+	runs, err := listTrash(dbPath)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, r := range expiredRuns(runs, olderThan) {
+		err := os.RemoveAll(dbPath + trashDir + "/" + r.ID)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// expiredRuns picks the runs older than olderThan, or all if it is zero.
+func expiredRuns(runs []trashRun, olderThan time.Duration) []trashRun {
+	var old []trashRun
+	for _, r := range runs {
+		if olderThan == 0 || time.Since(r.Time) >= olderThan {
+			old = append(old, r)
+		}
+	}
+
+	return old
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestTrashRestore(t *testing.T) {
+	comics := fakexkcd.Corpus(3)
+	comics[1].Image = []byte{}
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db+"notes.txt", []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := findLitter(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := removeLitter(db, found)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(db + "2"); !os.IsNotExist(err) {
+		t.Error("comic 2 still in the database")
+	}
+
+	runs, err := listTrash(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != id || len(runs[0].Paths) != 5 {
+		t.Fatalf("trash holds %+v", runs)
+	}
+
+	err = restoreTrash(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(readFile(t, db+"notes.txt")); got != "mine" {
+		t.Errorf("notes.txt restored as %q", got)
+	}
+	if _, err := os.Stat(db + "2/2-alt"); err != nil {
+		t.Error("comic 2 not restored")
+	}
+	if runs, _ := listTrash(db); len(runs) != 0 {
+		t.Errorf("restored run still in the trash: %+v", runs)
+	}
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Comics[2]; !ok {
+		t.Error("restored comic not back in the manifest")
+	}
+}
+
+func TestTrashExpires(t *testing.T) {
+	db := withSlash(t.TempDir())
+
+	old := db + trashDir + "/" + time.Now().Add(-2*trashRetention).UTC().Format(trashLayout)
+	if err := os.MkdirAll(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(db+"junk", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := moveToTrash(db, []string{db + "junk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expired run kept")
+	}
+	if runs, _ := listTrash(db); len(runs) != 1 {
+		t.Errorf("trash holds %+v", runs)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usageFile records, once switched on with usage on, which commands were
+// run and which comics were looked at. It is only ever read by xkcd-db on
+// this machine; nothing is sent anywhere. Arguments aren't kept, so
+// search queries stay private.
+const usageFile = "usage.log"
+
+type usageRecord struct {
+	Time    time.Time
+	Command string `json:",omitempty"`
+	// The comic looked at, e.g. with show or in the web UI.
+	Comic int `json:",omitempty"`
+}
+
+// recordUsage appends r to the usage log if there is one. Failing to is
+// never worth stopping a command for.
+func recordUsage(dbPath string, r usageRecord) {
+	f, err := os.OpenFile(dbPath+usageFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	r.Time = time.Now().UTC()
+	data, err := json.Marshal(r)
+	if err == nil {
+		f.Write(append(data, '\n'))
+	}
+}
+
+// recordCommand notes that a command is run, on the database its -d flag
+// names.
+func recordCommand(name string, args []string) {
+	dbPath := defaultDB
+	for i, a := range args {
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		if a == "d" && i+1 < len(args) {
+			dbPath = args[i+1]
+		} else if strings.HasPrefix(a, "d=") {
+			dbPath = a[2:]
+		}
+	}
+
+	recordUsage(withSlash(dbPath), usageRecord{Command: name})
+}
+
+func readUsage(dbPath string) ([]usageRecord, error) {
+	f, err := os.Open(dbPath + usageFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []usageRecord
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r usageRecord
+		if json.Unmarshal(sc.Bytes(), &r) == nil {
+			records = append(records, r)
+		}
+	}
+
+	return records, sc.Err()
+}
+
+// usage switches the usage log on and off and reports from it.
+func usage(args []string) {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	n := fs.Int("n", 10, "Number of comics to list")
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db usage [flags] [stats|unread|on|off|purge]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+
+	var err error
+	switch fs.Arg(0) {
+	case "", "stats":
+		err = usageStats(*dbPath, *n)
+	case "unread":
+		err = usageUnread(*dbPath, *n)
+	case "on":
+		var f *os.File
+		f, err = os.OpenFile(*dbPath+usageFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err == nil {
+			err = f.Close()
+			say("Recording usage in %s; it never leaves this machine\n", *dbPath+usageFile)
+		}
+	case "off":
+		if !confirm("Stop recording usage and delete what was recorded?") {
+			os.Exit(1)
+		}
+		err = os.Remove(*dbPath + usageFile)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	case "purge":
+		if !confirm("Delete the recorded usage?") {
+			os.Exit(1)
+		}
+		// Truncating keeps recording on.
+		err = os.Truncate(*dbPath+usageFile, 0)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if os.IsNotExist(err) {
+		log.Fatalln("Usage isn't recorded; xkcd-db usage on starts")
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// usageCount is how often something appears in the usage log.
+type usageCount struct {
+	key   string
+	count int
+}
+
+func countUsage(records []usageRecord, key func(usageRecord) string) []usageCount {
+	counts := make(map[string]int)
+	for _, r := range records {
+		if k := key(r); k != "" {
+			counts[k]++
+		}
+	}
+
+	sorted := make([]usageCount, 0, len(counts))
+	for k, c := range counts {
+		sorted = append(sorted, usageCount{k, c})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].key < sorted[j].key
+	})
+
+	return sorted
+}
+
+// usageStats prints the most used commands and most viewed comics.
+func usageStats(dbPath string, n int) error {
+	records, err := readUsage(dbPath)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Println("Nothing recorded yet")
+		return nil
+	}
+
+	fmt.Printf("Since %s\n", records[0].Time.Local().Format("2006-01-02"))
+
+	fmt.Println("\nCommands:")
+	for _, c := range countUsage(records, func(r usageRecord) string { return r.Command }) {
+		fmt.Printf("%6d  %s\n", c.count, c.key)
+	}
+
+	viewed := countUsage(records, func(r usageRecord) string {
+		if r.Comic == 0 {
+			return ""
+		}
+		return strconv.Itoa(r.Comic)
+	})
+	if len(viewed) > n {
+		viewed = viewed[:n]
+	}
+
+	fmt.Println("\nMost viewed comics:")
+	for _, c := range viewed {
+		title := ""
+		if num, err := strconv.Atoi(c.key); err == nil {
+			if lc, err := readComic(dbPath, num); err == nil {
+				title = lc.Title
+			}
+		}
+		fmt.Printf("%6d  #%s %s\n", c.count, c.key, title)
+	}
+
+	return nil
+}
+
+// unreadComics lists the stored comics never looked at since usage was
+// switched on.
+func unreadComics(dbPath string) ([]int, error) {
+	records, err := readUsage(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	for _, r := range records {
+		seen[r.Comic] = true
+	}
+
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var unread []int
+	for _, num := range nums {
+		if !seen[num] {
+			unread = append(unread, num)
+		}
+	}
+
+	return unread, nil
+}
+
+func usageUnread(dbPath string, n int) error {
+	unread, err := unreadComics(dbPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d comics unread\n", len(unread))
+	if len(unread) > n {
+		unread = unread[:n]
+	}
+	for _, num := range unread {
+		c, err := readComic(dbPath, num)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("#%d %s\n", num, c.Title)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestUsageOptIn(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(4))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is recorded until usage is switched on.
+	recordUsage(db, usageRecord{Comic: 1})
+	if _, err := os.Stat(db + usageFile); !os.IsNotExist(err) {
+		t.Fatalf("usage recorded without opting in: %v", err)
+	}
+
+	err = os.WriteFile(db+usageFile, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordUsage(db, usageRecord{Comic: 2})
+	recordUsage(db, usageRecord{Comic: 2})
+	recordUsage(db, usageRecord{Comic: 4})
+	recordCommand("list", []string{"-json", "-d", db})
+	recordCommand("show", []string{"--d=" + db, "2"})
+
+	records, err := readUsage(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	viewed := countUsage(records, func(r usageRecord) string {
+		if r.Comic == 0 {
+			return ""
+		}
+		return strconv.Itoa(r.Comic)
+	})
+	if len(viewed) != 2 || viewed[0] != (usageCount{"2", 2}) || viewed[1] != (usageCount{"4", 1}) {
+		t.Errorf("got views %v", viewed)
+	}
+
+	commands := countUsage(records, func(r usageRecord) string { return r.Command })
+	if len(commands) != 2 || commands[0] != (usageCount{"list", 1}) || commands[1] != (usageCount{"show", 1}) {
+		t.Errorf("got commands %v", commands)
+	}
+
+	unread, err := unreadComics(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(unread, []int{1, 3}) {
+		t.Errorf("got unread %v, want [1 3]", unread)
+	}
+}
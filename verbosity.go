@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// verbosity is how much commands say, as set by -q, -v and -vv. Errors
+// and results are always shown.
+var verbosity int
+
+const (
+	// Only errors and results.
+	quiet = -1
+	// Progress notes too.
+	normal = 0
+	// Every comic worked on.
+	verbose = 1
+	// Every request made.
+	veryVerbose = 2
+)
+
+// verbosityFlag sets verbosity to its level when switched on.
+type verbosityFlag int
+
+func (verbosityFlag) IsBoolFlag() bool { return true }
+func (verbosityFlag) String() string   { return "false" }
+
+func (f verbosityFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil || !on {
+		return err
+	}
+
+	verbosity = int(f)
+	if verbosity >= veryVerbose {
+		traceRequests()
+	}
+
+	return nil
+}
+
+// say prints a progress note, unless -q.
+func say(format string, a ...interface{}) {
+	if verbosity >= normal {
+		fmt.Printf(format, a...)
+	}
+}
+
+// detail prints what happens to a single comic, with -v.
+func detail(format string, a ...interface{}) {
+	if verbosity >= verbose {
+		fmt.Printf(format, a...)
+	}
+}
+
+// traceRequests logs every request through the shared client.
+func traceRequests() {
+	if _, ok := tracked.next.(*traceTransport); ok {
+		return
+	}
+
+	next := tracked.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	tracked.next = &traceTransport{next: next}
+}
+
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	took := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		log.Printf("%s %s: %v after %v", req.Method, req.URL, err, took)
+	} else {
+		log.Printf("%s %s: %s in %v", req.Method, req.URL, resp.Status, took)
+	}
+
+	return resp, err
+}
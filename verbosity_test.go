@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestVerbosityFlags(t *testing.T) {
+	defer func(v int) { verbosity = v }(verbosity)
+	orig := tracked.next
+	defer func() { tracked.next = orig }()
+
+	for args, want := range map[string]int{"": normal, "-q": quiet, "-v": verbose, "-vv": veryVerbose} {
+		verbosity = normal
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		addGlobalFlags(fs)
+
+		err := fs.Parse(strings.Fields(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verbosity != want {
+			t.Errorf("%q: verbosity %d, want %d", args, verbosity, want)
+		}
+	}
+
+	if _, ok := tracked.next.(*traceTransport); !ok {
+		t.Error("-vv doesn't trace requests")
+	}
+}
+
+func TestTraceRequests(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(2))
+	orig := tracked.next
+	defer func() { tracked.next = orig }()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	traceRequests()
+	traceRequests()
+
+	_, err := xkcdSource{}.latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(buf.String(), "200 OK"); n != 1 {
+		t.Errorf("traced %d times:\n%s", n, buf.String())
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildInfo(t *testing.T) {
+	old := [2]string{version, commit}
+	t.Cleanup(func() { version, commit = old[0], old[1] })
+
+	version, commit = "v1.2.3", "0123456789abcdef"
+	if got, want := buildInfo(), "xkcd-db v1.2.3 (0123456789ab, "; !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want it to start with %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Size of the slideshow's frames.
+const videoWidth, videoHeight = 1920, 1080
+
+// mp4Exporter renders comics as a slideshow, slideshow.mp4, with each
+// comic's title and alt text as captions. Frames are drawn here and
+// encoded by ffmpeg, which has to be on the PATH. The captions are a
+// subtitle track, as drawing text would need a font.
+type mp4Exporter struct {
+	dest    string
+	ffmpeg  string
+	seconds int
+	// Frames wait here until close encodes them.
+	frames   string
+	n        int
+	captions strings.Builder
+}
+
+func newMP4Exporter(dest string, opts exportOptions) (exporter, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, errors.New("the mp4 format needs ffmpeg on the PATH")
+	}
+
+	seconds := opts.secondsPerComic
+	if seconds < 1 {
+		seconds = 8
+	}
+
+	frames, err := os.MkdirTemp(dest, ".frames-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &mp4Exporter{dest: dest, ffmpeg: ffmpeg, seconds: seconds, frames: withSlash(frames)}, nil
+}
+
+// rendersImages keeps exportComics from copying images next to the video.
+func (e *mp4Exporter) rendersImages() {}
+
+func (e *mp4Exporter) add(c exportComic) error {
+	var frame image.Image
+	if c.ImgPath != "" {
+		img, err := loadImage(c.ImgPath)
+		if err != nil {
+			return err
+		}
+		frame = fitImage(img, videoWidth, videoHeight)
+	} else {
+		blank := image.NewRGBA(image.Rect(0, 0, videoWidth, videoHeight))
+		draw.Draw(blank, blank.Bounds(), image.White, image.Point{}, draw.Src)
+		frame = blank
+	}
+
+	f, err := os.Create(fmt.Sprintf("%s%05d.png", e.frames, e.n))
+	if err != nil {
+		return err
+	}
+	err = png.Encode(f, frame)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	per := time.Duration(e.seconds) * time.Second
+	start := time.Duration(e.n) * per
+	e.n++
+	fmt.Fprintf(&e.captions, "%d\n%s --> %s\n#%d %s\n%s\n\n", e.n, srtTime(start), srtTime(start+per), c.Num, c.Title, c.Alt)
+
+	return nil
+}
+
+func (e *mp4Exporter) close() error {
+	defer os.RemoveAll(e.frames)
+
+	if e.n == 0 {
+		return nil
+	}
+
+	captions := e.frames + "captions.srt"
+	err := os.WriteFile(captions, []byte(e.captions.String()), 0644)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(e.ffmpeg, "-y", "-loglevel", "error",
+		"-framerate", fmt.Sprintf("1/%d", e.seconds), "-i", e.frames+"%05d.png",
+		"-i", captions,
+		"-map", "0:v", "-map", "1:s",
+		"-c:v", "libx264", "-r", "25", "-pix_fmt", "yuv420p",
+		"-c:s", "mov_text",
+		e.dest+"slideshow.mp4")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("ffmpeg: %v", err)
+	}
+
+	return nil
+}
+
+// srtTime formats d as SubRip does, e.g. 00:01:04,000.
+func srtTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// fakeFFmpeg stands in for ffmpeg, keeping what it was given in dir.
+const fakeFFmpeg = `#!/bin/sh
+for a; do
+	case $a in
+	*.srt) cp "$a" "$FAKE_FFMPEG_OUT/captions.srt" ;;
+	*%05d.png) ls "${a%/*}" | grep png > "$FAKE_FFMPEG_OUT/frames" ;;
+	esac
+done
+echo "$@" > "$FAKE_FFMPEG_OUT/args"
+`
+
+func TestExportMP4(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffmpeg is a shell script")
+	}
+
+	bin, out := t.TempDir(), t.TempDir()
+	err := os.WriteFile(bin+"/ffmpeg", []byte(fakeFFmpeg), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_FFMPEG_OUT", out)
+
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dest := withSlash(t.TempDir())
+	n, err := exportComics(db, dest, []int{3, 1}, exportOptions{format: "mp4", secondsPerComic: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("exported %d comics, want 2", n)
+	}
+
+	if frames := strings.Fields(string(readFile(t, out+"/frames"))); len(frames) != 2 || frames[0] != "00000.png" {
+		t.Errorf("got frames %v", frames)
+	}
+
+	captions := string(readFile(t, out+"/captions.srt"))
+	want := "1\n00:00:00,000 --> 00:00:05,000\n#3 Comic 3\nAlt text 3\n\n2\n00:00:05,000 --> 00:00:10,000\n#1 Comic 1\n"
+	if !strings.HasPrefix(captions, want) {
+		t.Errorf("got captions:\n%s", captions)
+	}
+
+	args := string(readFile(t, out+"/args"))
+	if !strings.Contains(args, "-framerate 1/5") || !strings.HasSuffix(strings.TrimSpace(args), dest+"slideshow.mp4") {
+		t.Errorf("ffmpeg called with %s", args)
+	}
+
+	// Only the video is left behind.
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("export left %d files; the fake ffmpeg writes none", len(entries))
+	}
+}
+
+func TestSRTTime(t *testing.T) {
+	if got := srtTime(time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond); got != "01:02:03,004" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// viewerOptions are the flags of commands that open images.
+type viewerOptions struct {
+	open   bool
+	viewer string
+}
+
+func viewerFlags(fs *flag.FlagSet) *viewerOptions {
+	o := &viewerOptions{}
+	fs.BoolVar(&o.open, "open", false, "Open the image in a viewer")
+	fs.StringVar(&o.viewer, "viewer", "", "Command to open images with, e.g. 'feh %s', where %s is the image paths; defaults to the config file's viewer, inline on terminals that show images, then the system's opener")
+
+	return o
+}
+
+// openComic opens a comic's image, fetching the comic first if it isn't
+// mirrored yet.
+func openComic(args []string) {
+	fs := flag.NewFlagSet("open", flag.ExitOnError)
+	dbPath := fs.String("d", defaultDB, "Specify the path of the database")
+	view := viewerFlags(fs)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: xkcd-db open [flags] comic")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	num, err := strconv.Atoi(fs.Arg(0))
+	if fs.NArg() != 1 || err != nil {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	*dbPath = withSlash(*dbPath)
+
+	c, err := ensureComic(*dbPath, num)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	recordUsage(*dbPath, usageRecord{Comic: c.Num})
+
+	err = view.openComics([]localComic{c})
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// openComics opens the images of comics, all in one viewer.
+func (o *viewerOptions) openComics(comics []localComic) error {
+	var paths []string
+	for _, c := range comics {
+		err := c.fetchImage()
+		if err != nil {
+			return err
+		}
+		if c.ImgPath == "" {
+			if len(comics) == 1 {
+				return fmt.Errorf("comic %d has no image", c.Num)
+			}
+			continue
+		}
+		paths = append(paths, c.ImgPath)
+	}
+	if len(paths) == 0 {
+		return errors.New("no images to open")
+	}
+
+	return openImages(o.viewer, paths)
+}
+
+// openImages shows images with the viewer, or the config file's, or
+// inline if the terminal can, or with the system's opener.
+func openImages(viewer string, paths []string) error {
+	if viewer == "" {
+		viewer = userConf.Viewer
+	}
+	if viewer == "" && isTerminal(os.Stdout) {
+		if proto := inlineProtocol(); proto != "" {
+			for _, p := range paths {
+				err := writeInline(os.Stdout, proto, p)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	cmd, err := viewerCommand(viewer, paths)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// viewerCommand builds the command that opens paths. The viewer is split
+// on spaces, with no shell; %s stands for the paths, which are appended
+// if it is missing.
+func viewerCommand(viewer string, paths []string) (*exec.Cmd, error) {
+	args := strings.Fields(viewer)
+	if len(args) == 0 {
+		var err error
+		args, err = defaultViewer(len(paths))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var argv []string
+	substituted := false
+	for _, a := range args {
+		if a == "%s" {
+			argv = append(argv, paths...)
+			substituted = true
+			continue
+		}
+		argv = append(argv, a)
+	}
+	if !substituted {
+		argv = append(argv, paths...)
+	}
+
+	return exec.Command(argv[0], argv[1:]...), nil
+}
+
+// defaultViewer is the system's way of opening files. The openers of
+// Linux and Windows take one file at a time.
+func defaultViewer(n int) ([]string, error) {
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"open"}, nil
+	case "windows":
+		args = []string{"cmd", "/c", "start", ""}
+	default:
+		if _, err := exec.LookPath("xdg-open"); err != nil {
+			return nil, errors.New("no image viewer found; install xdg-utils or pass -viewer")
+		}
+		args = []string{"xdg-open"}
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("%s opens one image at a time; pass -viewer, e.g. -viewer 'feh %%s'", args[0])
+	}
+
+	return args, nil
+}
+
+// inlineProtocol detects terminals that show images themselves: kitty's
+// graphics protocol, or the inline images of iTerm2 that WezTerm and
+// others copied.
+func inlineProtocol() string {
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("TERM") == "xterm-kitty":
+		return "kitty"
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return "iterm"
+	}
+
+	return ""
+}
+
+// writeInline writes an image as the terminal's escape sequence.
+func writeInline(w io.Writer, proto, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if proto == "iterm" {
+		_, err = fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%d;preserveAspectRatio=1:%s\a\n", len(data), base64.StdEncoding.EncodeToString(data))
+		return err
+	}
+
+	// Kitty wants PNG, in chunks of at most 4096 base64 bytes.
+	if !bytes.HasPrefix(data, []byte("\x89PNG")) {
+		img, err := loadImage(path)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		err = png.Encode(&buf, img)
+		if err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	enc := base64.StdEncoding.EncodeToString(data)
+	for first := true; ; first = false {
+		chunk := enc
+		if len(chunk) > 4096 {
+			chunk = chunk[:4096]
+		}
+		enc = enc[len(chunk):]
+		more := 0
+		if enc != "" {
+			more = 1
+		}
+
+		if first {
+			_, err = fmt.Fprintf(w, "\x1b_Gf=100,a=T,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			_, err = fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+		if err != nil || more == 0 {
+			break
+		}
+	}
+	if err == nil {
+		_, err = fmt.Fprintln(w)
+	}
+
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestViewerCommand(t *testing.T) {
+	for _, c := range []struct {
+		viewer string
+		want   []string
+	}{
+		{"feh %s", []string{"feh", "a.png", "b.png"}},
+		{"feh -F %s --auto-zoom", []string{"feh", "-F", "a.png", "b.png", "--auto-zoom"}},
+		{"sxiv", []string{"sxiv", "a.png", "b.png"}},
+	} {
+		cmd, err := viewerCommand(c.viewer, []string{"a.png", "b.png"})
+		if err != nil || !reflect.DeepEqual(cmd.Args, c.want) {
+			t.Errorf("%q: got %v, %v", c.viewer, cmd.Args, err)
+		}
+	}
+}
+
+func TestOpenImages(t *testing.T) {
+	_, db := testServer(t, fakexkcd.Corpus(2))
+	out := t.TempDir() + "/opened"
+
+	// The viewer from the config file is used unless -viewer is given.
+	defer func(c *userConfig) { userConf = c }(userConf)
+	userConf = &userConfig{Viewer: "cp %s " + out}
+
+	c, err := readComic(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&viewerOptions{open: true}).openComics([]localComic{c}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readFile(t, out), fakexkcd.Image(2)) {
+		t.Error("viewer didn't get the image")
+	}
+
+	if err := (&viewerOptions{viewer: "false"}).openComics([]localComic{c}); err == nil {
+		t.Error("-viewer ignored")
+	}
+}
+
+func TestWriteInline(t *testing.T) {
+	path := t.TempDir() + "/1.png"
+	img := bytes.Repeat(fakexkcd.Image(1), 2000)
+	os.WriteFile(path, img, 0644)
+
+	var b bytes.Buffer
+	if err := writeInline(&b, "iterm", path); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), "\x1b]1337;File=inline=1;") || !strings.Contains(b.String(), base64.StdEncoding.EncodeToString(img)) {
+		t.Errorf("iterm: %.60q", b.String())
+	}
+
+	// Kitty takes large images in chunks.
+	b.Reset()
+	if err := writeInline(&b, "kitty", path); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	if !strings.HasPrefix(s, "\x1b_Gf=100,a=T,m=1;") || !strings.Contains(s, "\x1b_Gm=1;") || !strings.Contains(s, "\x1b_Gm=0;") {
+		t.Errorf("kitty: %.60q", s)
+	}
+
+	t.Setenv("KITTY_WINDOW_ID", "")
+	t.Setenv("TERM", "xterm-256color")
+	t.Setenv("TERM_PROGRAM", "WezTerm")
+	if p := inlineProtocol(); p != "iterm" {
+		t.Errorf("WezTerm detected as %q", p)
+	}
+}
+
+func TestOpenAll(t *testing.T) {
+	_, db := testServer(t, fakexkcd.Corpus(3))
+	out := t.TempDir()
+
+	matches, err := searchComics(db, "Alt text")
+	if err != nil || len(matches) != 3 {
+		t.Fatalf("found %d: %v", len(matches), err)
+	}
+
+	// One viewer gets every image.
+	err = (&viewerOptions{viewer: "cp %s " + out}).openComics(matches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(out)
+	if err != nil || len(entries) != 3 {
+		t.Errorf("viewer got %d images: %v", len(entries), err)
+	}
+}
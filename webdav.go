@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// webdavStore keeps a mirror in a WebDAV folder, like a Nextcloud share.
+type webdavStore struct {
+	base       *url.URL
+	user, pass string
+
+	mu sync.Mutex
+	// Folders known to exist.
+	made map[string]bool
+}
+
+// newWebDAV takes the user from the URL and the password from it or from
+// XKCDDB_WEBDAV_PASSWORD.
+func newWebDAV(u *url.URL) *webdavStore {
+	base := *u
+	base.User = nil
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	s := &webdavStore{base: &base, made: make(map[string]bool)}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.pass, _ = u.User.Password()
+	}
+	if s.pass == "" {
+		s.pass = os.Getenv("XKCDDB_WEBDAV_PASSWORD")
+	}
+
+	return s
+}
+
+func (s *webdavStore) String() string {
+	return s.base.String()
+}
+
+func (s *webdavStore) url(rel string) string {
+	u := *s.base
+	u.Path += rel
+
+	return u.String()
+}
+
+// do sends a request and fails unless the response status is one of ok.
+func (s *webdavStore) do(method, rel string, body io.Reader, size int64, header map[string]string, ok ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.url(rel), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.pass)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+
+	return resp, fmt.Errorf("WebDAV %s %s: %s", method, s.url(rel), resp.Status)
+}
+
+// mkdirs makes the folders above rel, and the mirror's own.
+func (s *webdavStore) mkdirs(rel string) error {
+	dirs := []string{""}
+	if dir := path.Dir(rel); dir != "." {
+		dirs = append(dirs, dir+"/")
+	}
+
+	for _, dir := range dirs {
+		s.mu.Lock()
+		made := s.made[dir]
+		s.mu.Unlock()
+		if made {
+			continue
+		}
+
+		// 405 means it exists already.
+		resp, err := s.do("MKCOL", dir, nil, 0, nil, http.StatusCreated, http.StatusMethodNotAllowed)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		s.mu.Lock()
+		s.made[dir] = true
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// put uploads each file aside and then moves it into place.
+func (s *webdavStore) put(dbPath string, paths []string) (int, error) {
+	for i, rel := range paths {
+		err := s.putFile(dbPath, rel)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(paths), nil
+}
+
+func (s *webdavStore) putFile(dbPath, rel string) error {
+	err := s.mkdirs(rel)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(dbPath + rel)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	resp, err := s.do("PUT", rel+".part", f, info.Size(), nil, http.StatusCreated, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	resp, err = s.do("MOVE", rel+".part", nil, 0, map[string]string{"Destination": s.url(rel), "Overwrite": "T"},
+		http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *webdavStore) get(rel string) (io.ReadCloser, error) {
+	resp, err := s.do("GET", rel, nil, 0, nil, http.StatusOK)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", s.url(rel), errRemoteNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (s *webdavStore) remove(paths []string) error {
+	for _, rel := range paths {
+		resp, err := s.do("DELETE", rel, nil, 0, nil, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	return nil
+}
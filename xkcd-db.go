@@ -2,93 +2,583 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	xkcdURL  = "https://xkcd.com/"
-	jsonFile = "info.0.json"
+	jsonFile  = "info.0.json"
+	defaultDB = "./xkcdDB/"
+
+	// The largest comic JSON accepted.
+	maxInfoSize = 1 << 20
 )
 
-// Transcript and Alt are needed for searching.
+// Tests point this at a fake server.
+var xkcdURL = "https://xkcd.com/"
+
+// All network access goes through this client.
+var client = &http.Client{Transport: tracked}
+
+// Subcommands. Running without one syncs the database.
+var commands = map[string]func(args []string){
+	"analyze":        analyze,
+	"apply":          apply,
+	"batch":          batch,
+	"cache":          cache,
+	"changes":        changesCmd,
+	"check-archive":  checkArchive,
+	"cleanup":        cleanup,
+	"ctl":            control,
+	"digest":         digest,
+	"exclude":        exclude,
+	"export":         export,
+	"fsck":           fsck,
+	"help":           helpCmd,
+	"hybrid":         hybrid,
+	"log":            auditLog,
+	"import-archive": importArchive,
+	"index":          indexCmd,
+	"list":           list,
+	"loadtest":       loadtest,
+	"media":          mediaCmd,
+	"onthisday":      onthisday,
+	"open":           openComic,
+	"plan":           plan,
+	"push-device":    pushDevice,
+	"quiz":           quiz,
+	"random":         random,
+	"replicate":      replicate,
+	"report":         report,
+	"review":         review,
+	"search":         search,
+	"serve":          serve,
+	"share":          share,
+	"show":           show,
+	"state":          state,
+	"trash":          trash,
+	"upload":         upload,
+	"usage":          usage,
+	"version":        versionCmd,
+}
+
+// Transcript and Alt are needed for searching. The tags match xkcd's JSON.
 type Comic struct {
-	Num        int
-	Img        string
-	Transcript string
-	Alt        string
+	Num        int    `json:"num"`
+	Title      string `json:"title"`
+	Year       string `json:"year"`
+	Month      string `json:"month"`
+	Day        string `json:"day"`
+	Img        string `json:"img"`
+	Transcript string `json:"transcript"`
+	Alt        string `json:"alt"`
+	// Only set for special comics.
+	ExtraParts *extraParts `json:"extra_parts,omitempty"`
+
+	// The JSON as xkcd sent it, kept byte for byte with any fields the
+	// struct doesn't know.
+	raw []byte
+}
+
+// date is the publication date as YYYY-MM-DD, or empty if unknown.
+func (c Comic) date() string {
+	y, _ := strconv.Atoi(c.Year)
+	m, _ := strconv.Atoi(c.Month)
+	d, _ := strconv.Atoi(c.Day)
+	if y <= 0 || m <= 0 || d <= 0 {
+		return ""
+	}
+
+	return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC).Format(dayLayout)
+}
+
+// Settings for a sync run.
+type syncOptions struct {
+	rateLimit int64
+	// Start downloads strictly in list order.
+	ordered bool
+	// One of orders.
+	order string
+	// Comics to fetch before the backfill.
+	priority []int
+	// Fetch the text of stored comics again, and with images their
+	// images too when the server reports a change.
+	refresh bool
+	images  bool
+	// Overwrite files changed locally when refreshing.
+	force bool
+	// Stop starting downloads past these; zero is unlimited.
+	maxBytes    int64
+	maxDuration time.Duration
+	// Adapt the number of parallel downloads, up to rateLimit.
+	adaptive bool
+	// Show live progress in the terminal instead of a line per comic.
+	dashboard bool
+	// Accept commands from ctl while downloading, on controlAddr or by
+	// default a socket in the database.
+	control     bool
+	controlAddr string
+	// For embedding: progress goes to events, and closing stop stops
+	// starting downloads.
+	events func(syncEvent)
+	stop   <-chan struct{}
 }
 
 func main() {
-	rateLimit := flag.Int64("r", 20, "Set the maximum number of parallel downloads")
-	dbPath := flag.String("d", "./xkcdDB/", "Specify the path where the database should be built")
-	flag.Parse()
+	if spec := os.Getenv("XKCDDB_FAULT"); spec != "" {
+		err := injectFaults(spec, os.Getenv("XKCDDB_FAULT_SEED"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
 
-	// Add trailing /
-	if (*dbPath)[len(*dbPath)-1] != '/' {
-		*dbPath = *dbPath + "/"
+	if on, _ := strconv.ParseBool(os.Getenv("XKCDDB_OFFLINE")); on {
+		setOffline()
 	}
 
-	// The latest comic is used to find the number of comics.
-	numComics, err := latestComicNum()
+	err := loadUserConfig()
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	_, err = os.Stat(*dbPath)
-	if os.IsNotExist(err) {
-		fmt.Printf("%s does not exist. Creating...\n", *dbPath)
-		err = os.Mkdir(*dbPath, 0755)
+	// Global flags may come before the command name.
+	args := os.Args[1:]
+	for len(args) > 0 && (args[0] == "-offline" || args[0] == "--offline") {
+		setOffline()
+		args = args[1:]
+	}
+
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			recordCommand(args[0], args[1:])
+			cmd(args[1:])
+			return
+		}
+	}
+
+	var opts syncOptions
+	flag.Int64Var(&opts.rateLimit, "r", 20, "Set the maximum number of parallel downloads")
+	dbPath := flag.String("d", defaultDB, "Specify the path where the database should be built")
+	flag.BoolVar(&opts.ordered, "ordered", false, "Start downloads in a stable order; use with -r 1 for a fully sequential run")
+	flag.StringVar(&opts.order, "order", "asc", "Download order: "+strings.Join(orders, ", "))
+	priority := flag.String("p", "", "Comma separated comics or ranges to fetch before the rest, e.g. 2950,1000-1005")
+	flag.BoolVar(&opts.refresh, "refresh", false, "Fetch the metadata of stored comics again")
+	flag.BoolVar(&opts.images, "images", false, "With -refresh, also fetch images that changed upstream")
+	flag.BoolVar(&opts.force, "force", false, "With -refresh, overwrite files that were changed locally")
+	flag.Var((*byteSize)(&opts.maxBytes), "max-bytes", "Stop starting downloads after this much data, e.g. 500MB")
+	flag.DurationVar(&opts.maxDuration, "max-duration", 0, "Stop starting downloads after this long, e.g. 30m")
+	flag.BoolVar(&opts.dashboard, "dashboard", false, "Show a live dashboard while syncing in a terminal; type p, r, + or - and Enter to pause, resume or change parallel downloads")
+	flag.BoolVar(&opts.control, "control", false, "Let xkcd-db ctl pause, resume and inspect downloads")
+	flag.StringVar(&opts.controlAddr, "control-listen", "", "Address for -control, as unix:/path or host:port; implies -control")
+	flag.BoolVar(&opts.adaptive, "adaptive", false, "Adapt the number of parallel downloads to the network, up to -r")
+	flag.IntVar(&ranged.chunks, "range-chunks", 0, "Download large images in this many parallel byte ranges")
+	flag.Var((*byteSize)(&ranged.minSize), "range-min", "Smallest image to download in ranges, e.g. 4MB")
+	uploadTo := flag.String("upload", "", "After syncing, upload the mirror to this WebDAV or sftp:// URL; see xkcd-db upload -h")
+	source := flag.String("source", "", "Mirror the webcomic described by this JSON plugin instead of xkcd; the database remembers it")
+	flag.BoolVar(&strictSchema, "strict-schema", false, "Fail comics whose JSON has fields this version doesn't know")
+	notify := notifyFlags(flag.CommandLine)
+	mq := mqttFlags(flag.CommandLine)
+	addGlobalFlags(flag.CommandLine)
+	flag.CommandLine.Parse(args)
+
+	*dbPath = withSlash(*dbPath)
+
+	if opts.images && !opts.refresh {
+		log.Fatalln("-images needs -refresh")
+	}
+	if opts.force && !opts.refresh {
+		log.Fatalln("-force needs -refresh")
+	}
+	if err := notify.check(); err != nil {
+		log.Fatalln(err)
+	}
+
+	if opts.controlAddr != "" {
+		opts.control = true
+	}
+
+	if *priority != "" {
+		var err error
+		opts.priority, err = parseComics(strings.Split(*priority, ","))
 		if err != nil {
 			log.Fatalln(err)
 		}
 	}
 
-	missing := missingComics(numComics, *dbPath)
+	if *source != "" {
+		err := installSource(*dbPath, *source)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
 
-	if len(missing) == 0 {
-		fmt.Println("Found no missing comics")
-		return
+	recordUsage(*dbPath, usageRecord{Command: "sync"})
+	a := startAudit(*dbPath, "sync", args)
+
+	res, err := syncDB(*dbPath, opts)
+	if notify.due(res, err) {
+		nerr := notify.send(*dbPath, res, err)
+		if nerr != nil {
+			log.Println("Notification failed:", nerr)
+		}
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = mq.announce(*dbPath, res.added)
+	if err != nil {
+		log.Println("Announcing new comics failed:", err)
+	}
+
+	if r := drift.report(); r != "" {
+		fmt.Println(r)
+	}
+
+	if *uploadTo != "" {
+		store, err := openRemote(*uploadTo)
+		if err == nil {
+			var n int
+			n, _, err = pushMirror(*dbPath, store)
+			say("Uploaded %d files to %s\n", n, store)
+		}
+		if err != nil {
+			log.Println("Uploading failed:", err)
+		}
+	}
+
+	var outcome string
+	t := good
+	switch {
+	case res.partial != nil:
+		outcome = fmt.Sprintf(tr("Partial run, stopped early as %s: stored %d missing comics, the rest are left for the next run"), describeStorageError(res.partial), len(res.added))
+		t = warn
+	case res.attempted == 0:
+		outcome = tr("Found no missing comics")
+	case res.failed > 0:
+		outcome = fmt.Sprintf(tr("Downloaded %d missing comics, %d failed"), res.attempted-res.failed, res.failed)
+		t = warn
+	default:
+		outcome = fmt.Sprintf(tr("Downloaded %d missing comics"), res.attempted)
+	}
+
+	fmt.Println(paint(os.Stdout, t, outcome))
+	a.end(outcome)
+}
+
+// syncResult counts the downloads of a sync run.
+type syncResult struct {
+	attempted int
+	failed    int
+	// Comics stored by this run, lowest first.
+	added []int
+	// Why the run stopped early, keeping what it stored, if the database
+	// could no longer be written to.
+	partial error
+}
+
+// storageFailed notes err as the reason the run is partial if it is a
+// failure to write the database, and reports whether it was.
+func (res *syncResult) storageFailed(err error) bool {
+	if !isStorageError(err) {
+		return false
+	}
+	if res.partial == nil {
+		res.partial = err
+		log.Printf("Stopping early, as %s; what was stored is kept\n", describeStorageError(err))
+	}
+
+	return true
+}
+
+// syncDB downloads every comic missing from the database.
+func syncDB(dbPath string, opts syncOptions) (syncResult, error) {
+	if offline {
+		return syncResult{}, errors.New("sync needs the network: " + errOffline.Error())
+	}
+
+	if opts.order == "" {
+		opts.order = "asc"
+	}
+
+	b := newBudget(opts.maxBytes, opts.maxDuration)
+	defer b.track()()
+
+	hosts, err := loadHostStats(dbPath)
+	if err != nil {
+		return syncResult{}, err
+	}
+	defer hosts.track()()
+
+	src, err := loadSource(dbPath)
+	if err != nil {
+		return syncResult{}, err
+	}
+
+	// The latest comic is used to find the number of comics.
+	numComics, err := src.latest()
+	if err != nil {
+		return syncResult{}, err
+	}
+
+	_, err = os.Stat(dbPath)
+	if os.IsNotExist(err) {
+		say(tr("%s does not exist. Creating...\n"), dbPath)
+		err = os.Mkdir(dbPath, 0755)
+		if err != nil {
+			return syncResult{}, err
+		}
+	}
+
+	// Nothing is begun on storage that can't take it.
+	var res syncResult
+	err = checkWritable(dbPath)
+	if res.storageFailed(err) {
+		return res, nil
+	}
+	if err != nil {
+		return syncResult{}, err
 	}
 
 	// Counting semaphore.
-	tokens := make(chan struct{}, *rateLimit)
+	tokens := make(chan struct{}, opts.rateLimit)
+
+	// Remember how the hosts did, whatever the outcome, if there is
+	// still room to.
+	settled := 0
+	defer func() {
+		if res.partial != nil {
+			return
+		}
+		err := hosts.save(dbPath, src.host(), settled)
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	m, unlock, err := recoverManifest(dbPath)
+	if res.storageFailed(err) {
+		return res, nil
+	}
+	if err != nil {
+		return syncResult{}, err
+	}
+	defer unlock()
+
+	backfillInfo(src, dbPath, tokens)
 
-	getComic(missing, *dbPath, tokens)
-	fmt.Printf("Downloaded %d missing comics\n", len(missing))
+	if opts.refresh {
+		err = refreshComics(src, dbPath, m, tokens, opts.images, opts.force, b)
+		if res.storageFailed(err) {
+			return res, finishPartial(dbPath, m)
+		}
+	}
+
+	ex, err := loadExclusions(dbPath)
+	if err != nil {
+		return syncResult{}, err
+	}
+	missing := withoutExcluded(missingComics(src, numComics, dbPath), ex)
+
+	if len(missing) == 0 {
+		autoTagSynced(dbPath, nil, m, opts.refresh)
+		normalizeSynced(dbPath, nil, opts.refresh)
+		err = updateManifest(dbPath, m)
+		if err == nil {
+			err = updateIndex(dbPath, opts.refresh)
+		}
+		if res.storageFailed(err) {
+			return res, nil
+		}
+		return res, err
+	}
+
+	missing, err = orderComics(src, missing, opts.order, tokens)
+	if err != nil {
+		return syncResult{}, err
+	}
+
+	queue := newFetchQueue(missing)
+	for _, num := range opts.priority {
+		item := strconv.Itoa(num)
+		for _, m := range missing {
+			if m == item {
+				queue.push(item)
+				break
+			}
+		}
+	}
+
+	// Any order other than the default only holds if downloads start in
+	// it, and a budget is checked before each start. So that ctl fetch
+	// can reorder what is left, -control keeps comics queued too.
+	ordered := opts.ordered || opts.order != "asc" || len(opts.priority) > 0 ||
+		opts.maxBytes > 0 || opts.maxDuration > 0 || opts.control
+	var gate *aimd
+	if opts.adaptive {
+		gate = newAIMD(hosts.concurrency(src.host()), int(opts.rateLimit))
+	}
+
+	ctl := newSyncControl(gate, int(opts.rateLimit))
+	ctl.events, ctl.stop = opts.events, opts.stop
+	defer ctl.watchStop()()
+	ctl.queue = queue
+	ctl.emit(syncEvent{Kind: eventQueued, Total: len(missing)})
+	if opts.control {
+		addr := opts.controlAddr
+		if addr == "" {
+			addr = "unix:" + dbPath + controlSocket
+		}
+
+		stop, err := serveControl(addr, ctl)
+		if err != nil {
+			return syncResult{}, err
+		}
+		defer stop()
+	}
+
+	stopDashboard := func() {}
+	if opts.dashboard && isTerminal(os.Stdout) {
+		ctl.quiet = true
+		stopDashboard = runDashboard(os.Stdout, os.Stdin, ctl, b, len(missing))
+	}
+
+	got := getComic(src, queue, dbPath, m, tokens, ordered, b, ctl)
+	stopDashboard()
+	got.partial = res.partial
+	res = got
+	res.storageFailed(ctl.haltedBy())
+
+	// Comics are in the manifest once complete.
+	for _, item := range missing {
+		num, _ := strconv.Atoi(item)
+		if m.Comics[num] != nil {
+			res.added = append(res.added, num)
+		}
+	}
+	sort.Ints(res.added)
+
+	if gate != nil {
+		settled = gate.current()
+		say("Settled at %d parallel downloads\n", settled)
+	}
+
+	if res.partial != nil {
+		return res, finishPartial(dbPath, m)
+	}
+	if left := len(missing) - res.attempted; left > 0 {
+		say(tr("Budget used up; %d comics left for the next run\n"), left)
+	}
+
+	autoTagSynced(dbPath, res.added, m, opts.refresh)
+	normalizeSynced(dbPath, res.added, opts.refresh)
+
+	err = updateManifest(dbPath, m)
+	if err == nil {
+		// Searches in serve can then start at once.
+		err = updateIndex(dbPath, opts.refresh)
+	}
+	if err == nil {
+		err = offloadNew(dbPath)
+	}
+	if res.storageFailed(err) {
+		return res, nil
+	}
+
+	return res, err
+}
+
+// finishPartial saves what a sync that ran out of storage stored, if the
+// storage still lets it. If not, the journal has it for the next run.
+// Indexing, tagging and the like wait for a run that has room.
+func finishPartial(dbPath string, m *manifest) error {
+	err := updateManifest(dbPath, m)
+	if err != nil && !isStorageError(err) {
+		return err
+	}
+
+	return nil
+}
+
+// autoTagSynced runs the tagging rules over what a sync stored: the new
+// comics, or after a refresh every comic. Tagging failing doesn't fail the
+// sync.
+func autoTagSynced(dbPath string, added []int, m *manifest, refreshed bool) {
+	nums := added
+	if refreshed {
+		var err error
+		nums, err = storedComics(dbPath)
+		if err != nil {
+			log.Println("Tagging failed:", err)
+			return
+		}
+	}
+
+	_, err := autoTag(dbPath, nums, m)
+	if err != nil {
+		log.Println("Tagging failed:", err)
+	}
+}
+
+// Add trailing /
+func withSlash(path string) string {
+	if path == "" || path[len(path)-1] != '/' {
+		return path + "/"
+	}
+
+	return path
 }
 
-func latestComicNum() (int, error) {
-	url := xkcdURL + jsonFile
-	resp, err := http.Get(url)
+// fetchInfo downloads and decodes comic metadata.
+func fetchInfo(url string) (Comic, error) {
+	resp, err := client.Get(url)
 	if err != nil {
-		return 0, err
+		return Comic{}, err
 	}
 	defer resp.Body.Close()
 
-	decoder := json.NewDecoder(resp.Body)
+	// Real metadata is a few kilobytes; don't buffer whatever a broken or
+	// hostile server sends.
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxInfoSize+1))
+	if err != nil {
+		return Comic{}, err
+	}
+	if len(raw) > maxInfoSize {
+		return Comic{}, errors.New("comic metadata too large: " + url)
+	}
+
+	return parseComic(raw)
+}
+
+// parseComic decodes comic JSON as xkcd serves it, keeping the raw bytes.
+func parseComic(raw []byte) (Comic, error) {
 	var comicData Comic
-	err = decoder.Decode(&comicData)
+
+	err := json.Unmarshal(raw, &comicData)
 	if err != nil {
-		return 0, err
+		return comicData, err
 	}
+	comicData.raw = raw
 
-	return comicData.Num, nil
+	return comicData, drift.check(raw, comicData.Num)
 }
 
-func missingComics(numComics int, dbPath string) []string {
+func missingComics(src comicSource, numComics int, dbPath string) []string {
 	dlList := make([]string, 0, numComics)
 
 	for i := 1; i <= numComics; i++ {
-		// xkcd 404 doesn't exist.
-		if i == 404 {
+		if src.skip(i) {
 			continue
 		}
 
@@ -103,105 +593,261 @@ func missingComics(numComics int, dbPath string) []string {
 	return dlList
 }
 
-// Tokens is a channel that acts as a counting semaphore.
-func getComic(dlList []string, dbPath string, tokens chan struct{}) {
+// Tokens is a channel that acts as a counting semaphore. When ordered is
+// set, tokens are taken before each worker starts so downloads begin in
+// queue order. ctl can pause downloads or run fewer at once. It reports
+// how many downloads were started before the queue ran dry or the budget
+// ran out, and how many of those failed.
+func getComic(src comicSource, queue *fetchQueue, dbPath string, m *manifest, tokens chan struct{}, ordered bool, b *budget, ctl *syncControl) syncResult {
 	var wg sync.WaitGroup
+	var res syncResult
+	var failed, stopped int64
+
+	for {
+		// Wait for a free slot before choosing, so comics pushed in the
+		// meantime still go first.
+		if ordered {
+			tokens <- struct{}{}
+			ctl.acquire()
+		}
 
-	for _, item := range dlList {
+		item, ok := "", false
+		if !b.exhausted() && !ctl.stopping() {
+			item, ok = queue.pop()
+		}
+		if !ok {
+			if ordered {
+				ctl.release("", 0, nil)
+				<-tokens
+			}
+			break
+		}
 
 		// Start data fetching workers for missing comics.
+		res.attempted++
 		wg.Add(1)
 		go func(item string) {
 			// Aquire a token.
-			tokens <- struct{}{}
+			if !ordered {
+				tokens <- struct{}{}
+				ctl.acquire()
+			}
 			// Release the token.
 			defer func() { <-tokens }()
 			defer wg.Done()
 
-			fmt.Printf("Fetching Comic #%s ...\n", item)
+			if !ordered && ctl.stopping() {
+				ctl.release("", 0, nil)
+				atomic.AddInt64(&stopped, 1)
+				return
+			}
 
-			// Fetch comic metadata.
-			var comicData Comic
-			url := xkcdURL + item + "/" + jsonFile
+			ctl.started(item)
+			if !ctl.quiet {
+				detail(tr("Fetching Comic #%s ...\n"), item)
+			}
 
-			resp, err := http.Get(url)
-			if err != nil {
-				log.Println(err)
+			start := time.Now()
+			err := fetchComic(src, item, dbPath, m)
+			// One full disk is enough to hear about.
+			if isStorageError(err) {
+				ctl.halt(err)
+				ctl.release(item, time.Since(start), err)
+				atomic.AddInt64(&failed, 1)
 				return
 			}
-			defer resp.Body.Close()
-
-			decoder := json.NewDecoder(resp.Body)
-			err = decoder.Decode(&comicData)
+			ctl.release(item, time.Since(start), err)
 			if err != nil {
-				fmt.Printf("JSON decoding error: Comic %s\n", item)
-				log.Println(err)
-				return
+				if !ctl.quiet {
+					log.Println(err)
+				}
+				atomic.AddInt64(&failed, 1)
 			}
+		}(item)
+	}
 
-			// Write metadata files.
-			savePath := dbPath + item + "/"
+	wg.Wait()
+	res.failed = int(failed)
+	res.attempted -= int(stopped)
 
-			err = os.Mkdir(savePath, 0755)
-			if err != nil {
-				log.Fatalln(err)
-			}
+	return res
+}
 
-			// Write alt data if it exists.
-			if comicData.Alt != "" {
-				alt, err := os.Create(savePath + item + "-alt")
-				if err != nil {
-					log.Fatalln(err)
-				}
-				defer alt.Close()
+// fetchComic downloads one comic into the database and records its image
+// ETag in m. Errors are returned, and those of full or read-only storage
+// halt the sync.
+func fetchComic(src comicSource, item, dbPath string, m *manifest) error {
+	// Fetch comic metadata.
+	comicData, err := src.info(item)
+	if err != nil {
+		detail("JSON decoding error: Comic %s\n", item)
+		return err
+	}
 
-				_, writeErr := alt.WriteString(comicData.Alt)
-				if writeErr != nil {
-					log.Fatalln(err)
-				}
-			}
+	// Write metadata files.
+	savePath := dbPath + item + "/"
+	num, _ := strconv.Atoi(item)
 
-			// Write transcript data if it exists.
-			if comicData.Transcript != "" {
-				transcript, err := os.Create(savePath + item + "-transcript")
-				if err != nil {
-					log.Fatalln(err)
-				}
-				defer transcript.Close()
+	// Until the comic is complete, the journal says so.
+	err = m.begin(num)
+	if err != nil {
+		return err
+	}
 
-				_, writeErr := transcript.WriteString(comicData.Transcript)
-				if writeErr != nil {
-					log.Fatalln(err)
-				}
-			}
+	err = os.Mkdir(savePath, 0755)
+	if err != nil {
+		return err
+	}
 
-			// Write image files.
-			imgResp, err := http.Get(comicData.Img)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			defer imgResp.Body.Close()
+	err = writeText(dbPath, item, comicData)
+	if err != nil {
+		return err
+	}
 
-			splitUrl := strings.Split(comicData.Img, "/")
-			imgName := splitUrl[len(splitUrl)-1]
+	// Write image files.
+	splitUrl := strings.Split(comicData.Img, "/")
+	imgName := splitUrl[len(splitUrl)-1]
 
-			if imgName == "" {
-				fmt.Printf("Comic %s has no image.\n", item)
-				return
+	if imgName == "" {
+		detail("Comic %s has no image.\n", item)
+		return m.setImage(num, "")
+	}
+
+	imgPath := savePath + imgName
+
+	if ranged.chunks > 1 {
+		etag, ok, err := downloadRanged(comicData.Img, imgPath)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return m.setImage(num, etag)
+		}
+	}
+
+	imgResp, err := client.Get(comicData.Img)
+	if err != nil {
+		return err
+	}
+	defer imgResp.Body.Close()
+
+	if imgResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("comic %s image: %s", item, imgResp.Status)
+	}
+
+	img, err := os.Create(imgPath)
+	if err != nil {
+		return err
+	}
+
+	// A full disk fails the copy with its own error; others are the
+	// network's.
+	_, err = io.Copy(img, imgResp.Body)
+	if err == nil {
+		err = syncComicFile(img)
+	}
+	if cerr := img.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Remembered so a refresh can skip unchanged images.
+	return m.setImage(num, imgResp.Header.Get("ETag"))
+}
+
+// writeText stores the metadata, alt text and transcript of a comic,
+// replacing earlier copies.
+func writeText(dbPath, item string, comicData Comic) error {
+	return writeTextExcept(dbPath, item, comicData, nil)
+}
+
+// writeTextExcept is writeText leaving the files named in keep alone.
+func writeTextExcept(dbPath, item string, comicData Comic, keep map[string]string) error {
+	if _, ok := keep[item+"-info.json"]; !ok {
+		err := writeInfo(dbPath, item, comicData)
+		if err != nil {
+			return err
+		}
+	}
+
+	files := map[string]string{
+		item + "-alt":        comicData.Alt,
+		item + "-transcript": comicData.Transcript,
+	}
+	for name, text := range files {
+		if _, ok := keep[name]; ok {
+			continue
+		}
+
+		path := dbPath + item + "/" + name
+
+		// Only written if there is something to say.
+		if text == "" {
+			err := os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
 			}
+			continue
+		}
+
+		err := writeComicFile(path, []byte(text))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeInfo stores the comic's metadata, which holds everything that has
+// no file of its own, like the title and publication date. The upstream
+// JSON is stored unchanged when there is one.
+func writeInfo(dbPath, item string, comicData Comic) error {
+	data := comicData.raw
+	if data == nil {
+		var err error
+		data, err = json.Marshal(comicData)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeComicFile(dbPath+item+"/"+item+"-info.json", data)
+}
 
-			imgPath := savePath + imgName
+// backfillInfo fetches metadata for comics stored before it was kept.
+func backfillInfo(src comicSource, dbPath string, tokens chan struct{}) {
+	nums, err := storedComics(dbPath)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, num := range nums {
+		item := strconv.Itoa(num)
+		_, err := os.Stat(dbPath + item + "/" + item + "-info.json")
+		if !os.IsNotExist(err) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(item string) {
+			tokens <- struct{}{}
+			defer func() { <-tokens }()
+			defer wg.Done()
 
-			img, err := os.Create(imgPath)
+			comicData, err := src.info(item)
 			if err != nil {
-				log.Fatalln(err)
+				log.Println(err)
+				return
 			}
-			defer img.Close()
 
-			_, err = io.Copy(img, imgResp.Body)
+			err = writeInfo(dbPath, item, comicData)
 			if err != nil {
-				log.Fatalln(err)
+				log.Println(err)
 			}
 		}(item)
 	}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+// startFake serves comics and points the downloader at them for the length
+// of the test.
+func startFake(t *testing.T, comics []fakexkcd.Comic) *fakexkcd.Server {
+	t.Helper()
+
+	srv := fakexkcd.New(comics...)
+	old := xkcdURL
+	xkcdURL = srv.URL + "/"
+
+	t.Cleanup(func() {
+		xkcdURL = old
+		srv.Close()
+	})
+
+	return srv
+}
+
+func tempDB(t *testing.T) string {
+	t.Helper()
+	return withSlash(t.TempDir()) + "db/"
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestSyncDownloadsEverything(t *testing.T) {
+	comics := fakexkcd.Corpus(12)
+	startFake(t, comics)
+	db := tempDB(t)
+
+	res, err := syncDB(db, syncOptions{rateLimit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted != len(comics) {
+		t.Fatalf("synced %d comics, want %d", res.attempted, len(comics))
+	}
+
+	for _, c := range comics {
+		dir := db + strconv.Itoa(c.Num) + "/"
+		item := strconv.Itoa(c.Num)
+
+		if got := string(readFile(t, dir+item+"-alt")); got != c.Alt {
+			t.Errorf("comic %d alt = %q, want %q", c.Num, got, c.Alt)
+		}
+		if got := string(readFile(t, dir+item+"-transcript")); got != c.Transcript {
+			t.Errorf("comic %d transcript = %q, want %q", c.Num, got, c.Transcript)
+		}
+		if got := readFile(t, dir+c.ImgName); !bytes.Equal(got, c.Image) {
+			t.Errorf("comic %d image differs", c.Num)
+		}
+	}
+}
+
+func TestSyncFetchesOnlyMissing(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(5))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Add(fakexkcd.Corpus(6)[5])
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted != 1 {
+		t.Errorf("second sync fetched %d comics, want 1", res.attempted)
+	}
+	if hits := srv.Hits("/1/info.0.json"); hits != 1 {
+		t.Errorf("comic 1 fetched %d times, want 1", hits)
+	}
+	if _, err := os.Stat(db + "6/comic_6.png"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncSkips404(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(405))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hits := srv.Hits("/404/info.0.json"); hits != 0 {
+		t.Errorf("comic 404 requested %d times", hits)
+	}
+	if _, err := os.Stat(db + "405/405-alt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncRetriesFailedComicsNextRun(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(4))
+	db := tempDB(t)
+
+	srv.Fail("/3/info.0.json", http.StatusInternalServerError)
+
+	res, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.failed != 1 {
+		t.Errorf("%d failed downloads reported, want 1", res.failed)
+	}
+	if _, err := os.Stat(db + "3"); !os.IsNotExist(err) {
+		t.Fatalf("comic 3 stored despite a server error: %v", err)
+	}
+
+	srv.Heal("/3/info.0.json")
+
+	res, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted != 1 {
+		t.Errorf("second sync fetched %d comics, want 1", res.attempted)
+	}
+	if _, err := os.Stat(db + "3/comic_3.png"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncLatestUnavailable(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	srv.Fail("/info.0.json", http.StatusServiceUnavailable)
+
+	_, err := syncDB(tempDB(t), syncOptions{rateLimit: 2})
+	if err == nil {
+		t.Fatal("sync succeeded without the latest comic")
+	}
+}
+
+func TestSyncComicWithoutImage(t *testing.T) {
+	comics := fakexkcd.Corpus(2)
+	comics[1].ImgName = ""
+	startFake(t, comics)
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(readFile(t, db+"2/2-alt")); got != comics[1].Alt {
+		t.Errorf("alt = %q, want %q", got, comics[1].Alt)
+	}
+
+	_, err = comicImagePath(db, 2)
+	if err == nil {
+		t.Error("found an image for a comic without one")
+	}
+}
+
+func TestSyncOrdered(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(30))
+
+	_, err := syncDB(tempDB(t), syncOptions{rateLimit: 1, ordered: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := 1
+	for _, path := range srv.Requests() {
+		if !strings.HasSuffix(path, "/"+jsonFile) || path == "/"+jsonFile {
+			continue
+		}
+
+		if want := "/" + strconv.Itoa(next) + "/" + jsonFile; path != want {
+			t.Fatalf("requested %s, want %s", path, want)
+		}
+		next++
+	}
+}
+
+// fetchOrder lists the comics whose metadata was requested, in order.
+func fetchOrder(srv *fakexkcd.Server) []string {
+	var nums []string
+	for _, path := range srv.Requests() {
+		if path == "/"+jsonFile || !strings.HasSuffix(path, "/"+jsonFile) {
+			continue
+		}
+		nums = append(nums, strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/"+jsonFile))
+	}
+
+	return nums
+}
+
+func TestSyncNewestFirst(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(5))
+
+	_, err := syncDB(tempDB(t), syncOptions{rateLimit: 1, order: "newest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(fetchOrder(srv), " ")
+	if want := "5 4 3 2 1"; got != want {
+		t.Errorf("fetch order %q, want %q", got, want)
+	}
+}
+
+func TestSyncSmallestFirst(t *testing.T) {
+	comics := fakexkcd.Corpus(4)
+	for i := range comics {
+		comics[i].Image = bytes.Repeat([]byte{'x'}, 100*(len(comics)-i))
+	}
+	srv := startFake(t, comics)
+
+	_, err := syncDB(tempDB(t), syncOptions{rateLimit: 1, order: "smallest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first four fetches probe sizes; the downloads follow.
+	got := strings.Join(fetchOrder(srv)[4:], " ")
+	if want := "4 3 2 1"; got != want {
+		t.Errorf("download order %q, want %q", got, want)
+	}
+}
+
+func TestSyncUnknownOrder(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(2))
+
+	_, err := syncDB(tempDB(t), syncOptions{rateLimit: 1, order: "alphabetical"})
+	if err == nil {
+		t.Fatal("sync accepted an unknown order")
+	}
+}
+
+func TestSyncPriorityFirst(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(6))
+
+	res, err := syncDB(tempDB(t), syncOptions{rateLimit: 1, priority: []int{5, 2, 99}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.Join(fetchOrder(srv), " ")
+	if want := "5 2 1 3 4 6"; got != want {
+		t.Errorf("fetch order %q, want %q", got, want)
+	}
+	if !equalInts(res.added, []int{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("added %v, want 1-6", res.added)
+	}
+}
+
+func TestSyncBackfillsMetadata(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(2))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A comic stored before metadata was kept.
+	err = os.Remove(db + "2/2-info.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := readComic(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Title != "Comic 2" || c.Year == "" {
+		t.Errorf("metadata not backfilled: %+v", c.Comic)
+	}
+}
+
+func TestRefreshSkipsUnchangedImages(t *testing.T) {
+	startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Comics[1].ETag == "" {
+		t.Fatal("no ETag recorded on download")
+	}
+
+	skipped, err := refreshComic(xkcdSource{}, 1, db, m, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !skipped {
+		t.Error("unchanged image downloaded again")
+	}
+}
+
+func TestRefreshDownloadsChangedImage(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(3))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := fakexkcd.Corpus(3)[1]
+	c.Alt = "Fixed alt text"
+	c.Image = fakexkcd.Image(99)
+	srv.Add(c)
+
+	_, err = syncDB(db, syncOptions{rateLimit: 2, refresh: true, images: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(readFile(t, db+"2/2-alt")); got != c.Alt {
+		t.Errorf("alt = %q, want %q", got, c.Alt)
+	}
+	if got := readFile(t, db+"2/comic_2.png"); !bytes.Equal(got, c.Image) {
+		t.Error("changed image not downloaded")
+	}
+	if hits := srv.Hits("/comics/comic_1.png"); hits != 2 {
+		t.Errorf("comic 1 image requested %d times, want 2", hits)
+	}
+}
+
+func TestRefreshComparesLengthWithoutETag(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(2))
+	srv.DisableETags()
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := loadManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skipped, err := refreshComic(xkcdSource{}, 1, db, m, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !skipped {
+		t.Error("image of the same length downloaded again")
+	}
+
+	c := fakexkcd.Corpus(2)[1]
+	c.Image = bytes.Repeat([]byte{'x'}, 500)
+	srv.Add(c)
+
+	skipped, err = refreshComic(xkcdSource{}, 2, db, m, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped {
+		t.Error("image with a new length skipped")
+	}
+	if got := readFile(t, db+"2/comic_2.png"); !bytes.Equal(got, c.Image) {
+		t.Error("changed image not stored")
+	}
+}
+
+func TestSyncKeepsUpstreamJSON(t *testing.T) {
+	srv := startFake(t, fakexkcd.Corpus(2))
+	db := tempDB(t)
+
+	_, err := syncDB(db, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(srv.URL + "/2/info.0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	upstream, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Including fields Comic doesn't know, like safe_title.
+	if got := readFile(t, db+"2/2-info.json"); !bytes.Equal(got, upstream) {
+		t.Errorf("stored %s, want %s", got, upstream)
+	}
+}
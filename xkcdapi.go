@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// xkcdInfo is a comic in the shape of xkcd's own JSON API, down to the
+// field order, so existing xkcd clients can be pointed at a mirror.
+type xkcdInfo struct {
+	Month      string `json:"month"`
+	Num        int    `json:"num"`
+	Link       string `json:"link"`
+	Year       string `json:"year"`
+	News       string `json:"news"`
+	SafeTitle  string `json:"safe_title"`
+	Transcript string `json:"transcript"`
+	Alt        string `json:"alt"`
+	Img        string `json:"img"`
+	Title      string `json:"title"`
+	Day        string `json:"day"`
+	// Only present on special comics.
+	ExtraParts *extraParts `json:"extra_parts,omitempty"`
+}
+
+// infoPath parses xkcd API paths: /info.0.json for the latest comic, which
+// is reported as 0, and /<num>/info.0.json.
+func infoPath(path string) (int, bool) {
+	if path == "/"+jsonFile {
+		return 0, true
+	}
+
+	num, ok := comicNum(strings.TrimSuffix(path, "/"+jsonFile), "/")
+	return num, ok && num > 0 && strings.HasSuffix(path, "/"+jsonFile)
+}
+
+// handleInfo answers like xkcd.com does for /info.0.json and
+// /<num>/info.0.json. The JSON xkcd sent is served byte for byte; it is
+// rebuilt for comics stored before it was kept, and with localImages so
+// images point back at the mirror.
+func (s *server) handleInfo(w http.ResponseWriter, r *http.Request, num int) {
+	if num == 0 {
+		nums, err := storedComics(s.dbPath)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(nums) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		num = nums[len(nums)-1]
+	}
+
+	c, err := readComic(s.dbPath, num)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// Older versions stored the JSON reduced to the Comic struct.
+	if !s.localImages && bytes.Contains(c.raw, []byte(`"safe_title"`)) {
+		w.Write(c.raw)
+		return
+	}
+
+	info := xkcdInfo{
+		Month:      c.Month,
+		Num:        c.Num,
+		Year:       c.Year,
+		SafeTitle:  c.Title,
+		Transcript: c.Transcript,
+		Alt:        c.Alt,
+		Title:      c.Title,
+		Day:        c.Day,
+		ExtraParts: c.ExtraParts,
+	}
+	if c.ImgPath != "" {
+		// The file name is kept, as clients name downloads after it.
+		info.Img = mirrorURL(r, s.prefix+"/img/"+strconv.Itoa(num)+"/"+filepath.Base(c.ImgPath))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(info)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sqvid/xkcd-db/internal/fakexkcd"
+)
+
+func TestXKCDInfoVerbatim(t *testing.T) {
+	ts, _ := testServer(t, fakexkcd.Corpus(3))
+
+	_, upstream := get(t, xkcdURL+"2/info.0.json")
+	if status, body := get(t, ts.URL+"/2/info.0.json"); status != http.StatusOK || !bytes.Equal(body, upstream) {
+		t.Errorf("status %d, body %s; want %s", status, body, upstream)
+	}
+	if _, body := get(t, ts.URL+"/info.0.json"); !bytes.Contains(body, []byte(`"num":3`)) {
+		t.Errorf("latest = %s", body)
+	}
+}
+
+func TestXKCDInfoShape(t *testing.T) {
+	_, db := testServer(t, fakexkcd.Corpus(3))
+	ts := httptest.NewServer((&server{dbPath: db, localImages: true}).routes())
+	defer ts.Close()
+
+	status, body := get(t, ts.URL+"/2/info.0.json")
+	if status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+
+	// Clients written against xkcd.com may depend on the exact keys.
+	keys := []string{"month", "num", "link", "year", "news", "safe_title", "transcript", "alt", "img", "title", "day"}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.Token()
+	for _, want := range keys {
+		tok, err := dec.Token()
+		if err != nil || tok != want {
+			t.Fatalf("key %v, %v; want %q", tok, err, want)
+		}
+		var v interface{}
+		dec.Decode(&v)
+	}
+	if dec.More() {
+		t.Error("unexpected extra keys")
+	}
+
+	var info map[string]interface{}
+	json.Unmarshal(body, &info)
+	if info["num"] != 2.0 || info["safe_title"] != "Comic 2" || info["year"] != "2008" {
+		t.Errorf("info = %v", info)
+	}
+	if img := info["img"].(string); !strings.HasSuffix(img, "/img/2/comic_2.png") {
+		t.Errorf("img = %q", img)
+	}
+
+	if status, _ := get(t, ts.URL+"/9/info.0.json"); status != http.StatusNotFound {
+		t.Errorf("missing comic: status %d", status)
+	}
+}
+
+// A mirror must be good enough to sync another mirror from.
+func TestSyncFromMirror(t *testing.T) {
+	comics := fakexkcd.Corpus(4)
+	_, db := testServer(t, comics)
+
+	mirror := httptest.NewServer((&server{dbPath: db, localImages: true}).routes())
+	defer mirror.Close()
+	xkcdURL = mirror.URL + "/"
+
+	copyDB := tempDB(t)
+	res, err := syncDB(copyDB, syncOptions{rateLimit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.attempted != 4 || res.failed != 0 {
+		t.Fatalf("synced %+v from the mirror", res)
+	}
+
+	for _, c := range comics {
+		got, err := readComic(copyDB, c.Num)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != c.Title || got.Alt != c.Alt || !bytes.Equal(readFile(t, got.ImgPath), c.Image) {
+			t.Errorf("comic %d differs after syncing from the mirror", c.Num)
+		}
+	}
+}